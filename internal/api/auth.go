@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+)
+
+const (
+	SessionCookieName = "libreta_session"
+	CSRFTokenHeader   = "X-CSRF-Token"
+)
+
+const (
+	UnauthorizedErrCode     = "libreta.unauthorized"
+	InvalidCSRFTokenErrCode = "libreta.invalid_csrf_token"
+	ForbiddenErrCode        = "libreta.forbidden"
+)
+
+func init() {
+	jmsgp.RegisterErrors(
+		jmsgp.ErrorSpec{
+			Code:       UnauthorizedErrCode,
+			HTTPStatus: http.StatusUnauthorized,
+			Message:    "authentication required",
+		},
+		jmsgp.ErrorSpec{
+			Code:       InvalidCSRFTokenErrCode,
+			HTTPStatus: http.StatusForbidden,
+			Message:    "missing or invalid CSRF token",
+		},
+		jmsgp.ErrorSpec{
+			Code:       ForbiddenErrCode,
+			HTTPStatus: http.StatusForbidden,
+			Message:    "{{with .scope}}scope {{printf \"%q\" .}} required{{else}}access denied{{end}}",
+		},
+	)
+}
+
+func ErrUnauthorized(msg string) error {
+	return &Error{Code: UnauthorizedErrCode, Msg: msg}
+}
+
+func ErrInvalidCSRFToken() error {
+	return &Error{Code: InvalidCSRFTokenErrCode}
+}
+
+func ErrForbidden(scope string) error {
+	return &Error{Code: ForbiddenErrCode, Data: map[string]string{"scope": scope}}
+}
+
+// authorize checks that principal from ctx has required scope. Requests without principal
+// (authentication disabled or local stdio transport) are allowed.
+func authorize(ctx context.Context, scope, target string) error {
+	principal, ok := core.PrincipalFromContext(ctx)
+	if !ok || principal.Allows(scope, target) {
+		return nil
+	}
+	return ErrForbidden(scope)
+}
+
+func NewAuth(logger *slog.Logger, auth *core.Auth, enabled bool) (*Auth, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is nil")
+	}
+	if auth == nil {
+		return nil, fmt.Errorf("auth is nil")
+	}
+	return &Auth{
+		logger:  logger,
+		auth:    auth,
+		enabled: enabled,
+	}, nil
+}
+
+// Auth authenticates API requests with session cookie (issued by Login) or with API token
+// passed in "Authorization: Bearer" header. Cookie authenticated requests must carry CSRF token
+// in X-CSRF-Token header unless request method is safe.
+type Auth struct {
+	logger  *slog.Logger
+	auth    *core.Auth
+	enabled bool
+}
+
+type LoginParams struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type SessionInfo struct {
+	User      string    `json:"user"`
+	CSRFToken string    `json:"csrf_token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+func (a *Auth) Login(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	requestID := r.Header.Get(jmsgp.DefaultMessageIdHTTPHeader)
+
+	// Only JSON body is accepted, so cross-site form can't be used for login CSRF.
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInvalidContentType(ct))
+	}
+	var params LoginParams
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&params); err != nil {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, &Error{Code: jmsgp.InvalidMessageErrCode, Msg: "invalid login request"})
+	}
+	session, err := a.auth.Login(ctx, params.User, params.Password)
+	if errors.Is(err, core.ErrInvalidCredentials) {
+		a.logger.WarnContext(ctx, "login failed", slog.String("user", params.User))
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrUnauthorized("invalid user name or password"))
+	}
+	if err != nil {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInternal(fmt.Errorf("login: %w", err)))
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, SessionInfo{
+		User:      params.User,
+		CSRFToken: session.CSRFToken,
+		ExpiresAt: session.ExpiresAt,
+	})
+}
+
+func (a *Auth) Logout(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	requestID := r.Header.Get(jmsgp.DefaultMessageIdHTTPHeader)
+
+	cookie, err := r.Cookie(SessionCookieName)
+	if err == nil {
+		_, csrfToken, err := a.auth.AuthenticateSession(ctx, cookie.Value)
+		if err == nil && !validCSRFToken(r, csrfToken) {
+			return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInvalidCSRFToken())
+		}
+		if err := a.auth.Logout(ctx, cookie.Value); err != nil {
+			return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInternal(fmt.Errorf("logout: %w", err)))
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, "ok")
+}
+
+// Session returns current session info, UI uses it to get CSRF token after page reload.
+func (a *Auth) Session(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	requestID := r.Header.Get(jmsgp.DefaultMessageIdHTTPHeader)
+	if !a.enabled {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, SessionInfo{})
+	}
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrUnauthorized(""))
+	}
+	principal, csrfToken, err := a.auth.AuthenticateSession(ctx, cookie.Value)
+	if errors.Is(err, core.ErrUnauthenticated) {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrUnauthorized("session expired"))
+	}
+	if err != nil {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInternal(fmt.Errorf("authenticate session: %w", err)))
+	}
+	return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, SessionInfo{User: principal.UserName, CSRFToken: csrfToken})
+}
+
+// Middleware rejects unauthenticated requests and puts principal into request context.
+// Does nothing if authentication is disabled.
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	if !a.enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		requestID := r.Header.Get(jmsgp.DefaultMessageIdHTTPHeader)
+		principal, err := a.authenticate(r)
+		if err != nil {
+			if !errors.As(err, new(*Error)) {
+				a.logger.ErrorContext(ctx, "authenticate request", slog.Any("error", err))
+				err = ErrInternal(nil)
+			}
+			if werr := jmsgp.WriteHTTPResponse(ctx, w, "", requestID, err); werr != nil {
+				a.logger.ErrorContext(ctx, "http handler error", slog.Any("error", werr))
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(core.WithPrincipal(ctx, principal)))
+	})
+}
+
+// RequireScope returns middleware which rejects requests of principals without scope.
+// Must be used inside Middleware.
+func (a *Auth) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if err := authorize(ctx, scope, ""); err != nil {
+				requestID := r.Header.Get(jmsgp.DefaultMessageIdHTTPHeader)
+				if werr := jmsgp.WriteHTTPResponse(ctx, w, "", requestID, err); werr != nil {
+					a.logger.ErrorContext(ctx, "http handler error", slog.Any("error", werr))
+				}
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (a *Auth) authenticate(r *http.Request) (core.Principal, error) {
+	ctx := r.Context()
+	if authz := r.Header.Get("Authorization"); authz != "" {
+		scheme, token, _ := strings.Cut(authz, " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return core.Principal{}, ErrUnauthorized("unsupported authorization scheme")
+		}
+		principal, err := a.auth.AuthenticateToken(ctx, strings.TrimSpace(token))
+		if errors.Is(err, core.ErrUnauthenticated) {
+			return core.Principal{}, ErrUnauthorized("invalid token")
+		}
+		return principal, err
+	}
+
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return core.Principal{}, ErrUnauthorized("")
+	}
+	principal, csrfToken, err := a.auth.AuthenticateSession(ctx, cookie.Value)
+	if errors.Is(err, core.ErrUnauthenticated) {
+		return core.Principal{}, ErrUnauthorized("session expired")
+	}
+	if err != nil {
+		return core.Principal{}, err
+	}
+	if !isSafeMethod(r.Method) && !validCSRFToken(r, csrfToken) {
+		return core.Principal{}, ErrInvalidCSRFToken()
+	}
+	return principal, nil
+}
+
+func validCSRFToken(r *http.Request, csrfToken string) bool {
+	got := r.Header.Get(CSRFTokenHeader)
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(csrfToken)) == 1
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
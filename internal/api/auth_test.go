@@ -0,0 +1,282 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/api"
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+	s, err := storage.NewStorage(slog.New(slog.NewTextHandler(io.Discard, nil)), t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Open(context.Background(), false))
+	t.Cleanup(func() { require.NoError(t, s.Close()) })
+	return s
+}
+
+// testRPC creates RPC with bookmarks which don't fetch pages.
+func testRPC(t *testing.T, logger *slog.Logger, s *storage.Storage) *api.RPC {
+	t.Helper()
+	rpc, err := api.NewRPC(logger, s, core.NewBookmarks(logger, s, nil), core.NewArchiver(logger, s, core.ArchiverConfig{}))
+	require.NoError(t, err)
+	return rpc
+}
+
+func TestAuthScopes(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := testStorage(t)
+	coreAuth := core.NewAuth(logger, s)
+	require.NoError(t, coreAuth.UserSetPassword(ctx, "alice", "secret"))
+	apiAuth, err := api.NewAuth(logger, coreAuth, true)
+	require.NoError(t, err)
+	rpc := testRPC(t, logger, s)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = io.WriteString(w, "ok") })
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/rpc/{method_name}", apiAuth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Returned error is already written to response.
+		_ = rpc.HandleRequest(w, r)
+	})))
+	mux.Handle("POST /api/content", apiAuth.Middleware(apiAuth.RequireScope(core.ScopeContentUpload)(ok)))
+	mux.Handle("GET /api/content/{node_id}", apiAuth.Middleware(apiAuth.RequireScope(core.ScopeRead)(ok)))
+
+	token := func(scopes ...string) string {
+		_, token, err := coreAuth.TokenCreate(ctx, "alice", "test", scopes)
+		require.NoError(t, err)
+		return token
+	}
+	readToken := token(core.ScopeRead)
+	writeToken := token(core.ScopeWrite)
+	deleteToken := token(core.ScopeRPCPrefix + "NodesDelete")
+	catalogToken := token(core.ScopeRPCPrefix + "ErrorCatalog")
+
+	type response struct {
+		status int
+		msg    jmsgp.Message
+	}
+	do := func(method, path, token, body string) response {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		resp := response{status: w.Code}
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp.msg))
+		}
+		return resp
+	}
+
+	for _, tc := range []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+		wantErr    string
+		wantScope  string
+	}{
+		{"no token", "POST", "/api/rpc/GenerateNodeID", "", `{}`, http.StatusUnauthorized, api.UnauthorizedErrCode, ""},
+		{"invalid token", "POST", "/api/rpc/GenerateNodeID", "invalid", `{}`, http.StatusUnauthorized, api.UnauthorizedErrCode, ""},
+		{"read target with read token", "POST", "/api/rpc/GenerateNodeID", readToken, `{}`, http.StatusOK, "", ""},
+		{"write target with read token", "POST", "/api/rpc/NodesDelete", readToken, `{"ids":[]}`, http.StatusForbidden, api.ForbiddenErrCode, core.ScopeWrite},
+		{"write target with write token", "POST", "/api/rpc/NodesDelete", writeToken, `{"ids":[]}`, http.StatusOK, "", ""},
+		{"target scope", "POST", "/api/rpc/NodesDelete", deleteToken, `{"ids":[]}`, http.StatusOK, "", ""},
+		{"other target with target scope", "POST", "/api/rpc/GenerateNodeID", deleteToken, `{}`, http.StatusForbidden, api.ForbiddenErrCode, core.ScopeRead},
+		{"cancel with read token", "POST", "/api/rpc/jmsgp.cancel", readToken, `{"id":"1"}`, http.StatusOK, "", ""},
+		{"cancel with target scope", "POST", "/api/rpc/jmsgp.cancel", catalogToken, `{"id":"1"}`, http.StatusForbidden, api.ForbiddenErrCode, core.ScopeRead},
+		{"download with read token", "GET", "/api/content/x", readToken, "", http.StatusOK, "", ""},
+		{"download with target scope", "GET", "/api/content/x", catalogToken, "", http.StatusForbidden, api.ForbiddenErrCode, core.ScopeRead},
+		{"upload with read token", "POST", "/api/content", readToken, "data", http.StatusForbidden, api.ForbiddenErrCode, core.ScopeContentUpload},
+		{"upload with write token", "POST", "/api/content", writeToken, "data", http.StatusOK, "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := do(tc.method, tc.path, tc.token, tc.body)
+			assert.Equal(t, tc.wantStatus, resp.status)
+			assert.Equal(t, tc.wantErr, resp.msg.ErrorCode)
+			if tc.wantScope != "" {
+				assert.Equal(t, map[string]any{"scope": tc.wantScope}, resp.msg.Data)
+			}
+		})
+	}
+
+	t.Run("session requires csrf token", func(t *testing.T) {
+		session, err := coreAuth.Login(ctx, "alice", "secret")
+		require.NoError(t, err)
+		call := func(csrfToken string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest("POST", "/api/rpc/GenerateNodeID", strings.NewReader(`{}`))
+			r.Header.Set("Content-Type", "application/json")
+			r.AddCookie(&http.Cookie{Name: api.SessionCookieName, Value: session.Token})
+			if csrfToken != "" {
+				r.Header.Set(api.CSRFTokenHeader, csrfToken)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			return w
+		}
+		w := call("")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), api.InvalidCSRFTokenErrCode)
+		assert.Equal(t, http.StatusOK, call(session.CSRFToken).Code)
+	})
+}
+
+func TestAuthLoginLogout(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := testStorage(t)
+	coreAuth := core.NewAuth(logger, s)
+	require.NoError(t, coreAuth.UserSetPassword(ctx, "alice", "secret"))
+	apiAuth, err := api.NewAuth(logger, coreAuth, true)
+	require.NoError(t, err)
+
+	type response struct {
+		status  int
+		cookies []*http.Cookie
+		msg     jmsgp.Message
+		session api.SessionInfo
+	}
+	do := func(handler func(http.ResponseWriter, *http.Request) error, r *http.Request) response {
+		t.Helper()
+		w := httptest.NewRecorder()
+		// Returned error is already written to response.
+		_ = handler(w, r)
+		resp := response{status: w.Code, cookies: w.Result().Cookies()}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp.msg))
+		if data, ok := resp.msg.Data.(map[string]any); ok {
+			encoded, err := json.Marshal(data)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(encoded, &resp.session))
+		}
+		return resp
+	}
+	login := func(body string, tls bool) response {
+		t.Helper()
+		target := "http://libreta.test/api/login"
+		if tls {
+			// Request gets TLS connection state.
+			target = "https://libreta.test/api/login"
+		}
+		r := httptest.NewRequest("POST", target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		return do(apiAuth.Login, r)
+	}
+	withSession := func(r *http.Request, token, csrfToken string) *http.Request {
+		r.AddCookie(&http.Cookie{Name: api.SessionCookieName, Value: token})
+		if csrfToken != "" {
+			r.Header.Set(api.CSRFTokenHeader, csrfToken)
+		}
+		return r
+	}
+	session := func(token string) response {
+		t.Helper()
+		return do(apiAuth.Session, withSession(httptest.NewRequest("GET", "/api/session", nil), token, ""))
+	}
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		for _, body := range []string{`{"user":"alice","password":"wrong"}`, `{"user":"bob","password":"secret"}`} {
+			resp := login(body, false)
+			assert.Equal(t, http.StatusUnauthorized, resp.status, body)
+			assert.Equal(t, api.UnauthorizedErrCode, resp.msg.ErrorCode, body)
+			assert.Empty(t, resp.cookies, body)
+		}
+	})
+
+	t.Run("form body", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/api/login", strings.NewReader("user=alice&password=secret"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := do(apiAuth.Login, r)
+		assert.NotEqual(t, http.StatusOK, resp.status)
+		assert.Empty(t, resp.cookies)
+	})
+
+	t.Run("cookie", func(t *testing.T) {
+		resp := login(`{"user":"alice","password":"secret"}`, false)
+		require.Equal(t, http.StatusOK, resp.status)
+		require.Len(t, resp.cookies, 1)
+		cookie := resp.cookies[0]
+		assert.Equal(t, api.SessionCookieName, cookie.Name)
+		assert.NotEmpty(t, cookie.Value)
+		assert.Equal(t, "/", cookie.Path)
+		assert.True(t, cookie.HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+		assert.False(t, cookie.Secure)
+		assert.Equal(t, "alice", resp.session.User)
+		assert.NotEmpty(t, resp.session.CSRFToken)
+		assert.WithinDuration(t, resp.session.ExpiresAt, cookie.Expires, time.Second)
+
+		resp = login(`{"user":"alice","password":"secret"}`, true)
+		require.Equal(t, http.StatusOK, resp.status)
+		require.Len(t, resp.cookies, 1)
+		assert.True(t, resp.cookies[0].Secure)
+	})
+
+	t.Run("session", func(t *testing.T) {
+		resp := login(`{"user":"alice","password":"secret"}`, false)
+		require.Equal(t, http.StatusOK, resp.status)
+		info := session(resp.cookies[0].Value)
+		assert.Equal(t, http.StatusOK, info.status)
+		assert.Equal(t, api.SessionInfo{User: "alice", CSRFToken: resp.session.CSRFToken}, info.session)
+
+		noCookie := do(apiAuth.Session, httptest.NewRequest("GET", "/api/session", nil))
+		assert.Equal(t, http.StatusUnauthorized, noCookie.status)
+		assert.Equal(t, http.StatusUnauthorized, session("invalid").status)
+
+		disabled, err := api.NewAuth(logger, coreAuth, false)
+		require.NoError(t, err)
+		resp = do(disabled.Session, httptest.NewRequest("GET", "/api/session", nil))
+		assert.Equal(t, http.StatusOK, resp.status)
+		assert.Equal(t, api.SessionInfo{}, resp.session)
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		resp := login(`{"user":"alice","password":"secret"}`, false)
+		require.Equal(t, http.StatusOK, resp.status)
+		token, csrfToken := resp.cookies[0].Value, resp.session.CSRFToken
+		logout := func(csrfToken string) response {
+			return do(apiAuth.Logout, withSession(httptest.NewRequest("POST", "/api/logout", nil), token, csrfToken))
+		}
+
+		// Cross-site request without CSRF token can't end the session.
+		for _, csrf := range []string{"", "invalid"} {
+			resp = logout(csrf)
+			assert.Equal(t, http.StatusForbidden, resp.status)
+			assert.Equal(t, api.InvalidCSRFTokenErrCode, resp.msg.ErrorCode)
+			assert.Empty(t, resp.cookies)
+			assert.Equal(t, http.StatusOK, session(token).status)
+		}
+
+		resp = logout(csrfToken)
+		assert.Equal(t, http.StatusOK, resp.status)
+		require.Len(t, resp.cookies, 1)
+		assert.Equal(t, api.SessionCookieName, resp.cookies[0].Name)
+		assert.Empty(t, resp.cookies[0].Value)
+		assert.Negative(t, resp.cookies[0].MaxAge)
+		assert.True(t, resp.cookies[0].HttpOnly)
+
+		expired := session(token)
+		assert.Equal(t, http.StatusUnauthorized, expired.status)
+		assert.Equal(t, api.UnauthorizedErrCode, expired.msg.ErrorCode)
+		_, _, err := coreAuth.AuthenticateSession(ctx, token)
+		assert.ErrorIs(t, err, core.ErrUnauthenticated)
+	})
+}
@@ -2,13 +2,42 @@ package api
 
 import (
 	"fmt"
+	"net/http"
+	"strconv"
 
 	"github.com/brainmorsel/libreta/pkg/jmsgp"
 )
 
+const (
+	NotFoundErrCode           = "libreta.not_found"
+	InvalidContentTypeErrCode = "libreta.invalid_content_type"
+	ContentTooLargeErrCode    = "libreta.content_too_large"
+)
+
+func init() {
+	jmsgp.RegisterErrors(
+		jmsgp.ErrorSpec{
+			Code:       NotFoundErrCode,
+			HTTPStatus: http.StatusNotFound,
+			Message:    "{{with .kind}}{{.}} {{end}}{{with .id}}{{printf \"%q\" .}} {{end}}not found",
+		},
+		jmsgp.ErrorSpec{
+			Code:       InvalidContentTypeErrCode,
+			HTTPStatus: http.StatusUnsupportedMediaType,
+			Message:    "unsupported content type",
+		},
+		jmsgp.ErrorSpec{
+			Code:       ContentTooLargeErrCode,
+			HTTPStatus: http.StatusRequestEntityTooLarge,
+			Message:    "content is too large{{with .limit}}, limit is {{.}} bytes{{end}}",
+		},
+	)
+}
+
 type Error struct {
 	Code string
 	Msg  string
+	Data map[string]string
 }
 
 func (err *Error) Error() string {
@@ -23,7 +52,15 @@ func (err *Error) JMSGPError() (string, string) {
 	return err.Code, err.Msg
 }
 
+func (err *Error) JMSGPErrorData() any {
+	if len(err.Data) == 0 {
+		return nil
+	}
+	return err.Data
+}
+
 var _ jmsgp.JMSGPError = (*Error)(nil)
+var _ jmsgp.JMSGPErrorData = (*Error)(nil)
 
 func ErrInternal(err error) error {
 	e := &Error{Code: jmsgp.InternalErrCode}
@@ -34,9 +71,14 @@ func ErrInternal(err error) error {
 }
 
 func ErrInvalidContentType(msg string) error {
-	return &Error{Code: "libreta.invalid_content_type", Msg: msg}
+	return &Error{Code: InvalidContentTypeErrCode, Msg: msg}
+}
+
+func ErrContentTooLarge(limit int64) error {
+	return &Error{Code: ContentTooLargeErrCode, Data: map[string]string{"limit": strconv.FormatInt(limit, 10)}}
 }
 
-func ErrNotFound() error {
-	return &Error{Code: "libreta.not_found"}
+// ErrNotFound reports missing entity, kind and id are returned to client as error details.
+func ErrNotFound(kind, id string) error {
+	return &Error{Code: NotFoundErrCode, Data: map[string]string{"kind": kind, "id": id}}
 }
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+)
+
+const (
+	eventsKeepAliveInterval = 30 * time.Second
+	eventsBacklogBatchSize  = 500
+)
+
+func NewEvents(logger *slog.Logger, events *core.Events) (*Events, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is nil")
+	}
+	if events == nil {
+		return nil, fmt.Errorf("events is nil")
+	}
+	return &Events{
+		logger: logger,
+		events: events,
+	}, nil
+}
+
+// Events streams change notifications as Server-Sent Events.
+type Events struct {
+	logger *slog.Logger
+	events *core.Events
+}
+
+func (e *Events) Stream(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	requestID := r.Header.Get(jmsgp.DefaultMessageIdHTTPHeader)
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastSeq int64 = -1
+	if lastEventID != "" {
+		seq, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || seq < 0 {
+			return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, &Error{Code: jmsgp.InvalidMessageErrCode, Msg: "invalid Last-Event-ID"})
+		}
+		lastSeq = seq
+	}
+
+	// Subscribe before reading backlog to not miss events in between, duplicates are skipped by seq.
+	sub := e.events.Subscribe()
+	defer sub.Unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	if lastSeq >= 0 {
+		for {
+			events, err := e.events.Since(ctx, lastSeq, eventsBacklogBatchSize)
+			if err != nil {
+				return fmt.Errorf("load events since %d: %w", lastSeq, err)
+			}
+			for _, event := range events {
+				if err := writeEvent(w, event); err != nil {
+					return err
+				}
+				lastSeq = event.Seq
+			}
+			if len(events) < eventsBacklogBatchSize {
+				break
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return fmt.Errorf("flush: %w", err)
+		}
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return ignoreCanceled(ctx, fmt.Errorf("write keep-alive: %w", err))
+			}
+		case event, ok := <-sub.C:
+			if !ok {
+				// Subscription dropped, client will reconnect with Last-Event-ID.
+				return nil
+			}
+			if event.Seq <= lastSeq {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return ignoreCanceled(ctx, err)
+			}
+			lastSeq = event.Seq
+		}
+		if err := rc.Flush(); err != nil {
+			return ignoreCanceled(ctx, fmt.Errorf("flush: %w", err))
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event core.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event %d: %w", event.Seq, err)
+	}
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+		return fmt.Errorf("write event %d: %w", event.Seq, err)
+	}
+	return nil
+}
+
+func ignoreCanceled(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
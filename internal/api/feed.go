@@ -0,0 +1,106 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+)
+
+func NewFeed(logger *slog.Logger, feeds *core.Feeds) (*Feed, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is nil")
+	}
+	if feeds == nil {
+		return nil, fmt.Errorf("feeds is nil")
+	}
+	return &Feed{
+		logger: logger,
+		feeds:  feeds,
+	}, nil
+}
+
+// Feed serves Atom and RSS feeds of nodes selected by query, saved search or list: "/feed/{name}.atom" and
+// "/feed/{name}.rss".
+type Feed struct {
+	logger *slog.Logger
+	feeds  *core.Feeds
+}
+
+func (f *Feed) Handle(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	requestID := r.Header.Get(jmsgp.DefaultMessageIdHTTPHeader)
+	name := r.PathValue("name")
+
+	var write func(*core.Feed, *bytes.Buffer) error
+	var contentType string
+	switch {
+	case strings.HasSuffix(name, ".atom"):
+		name, contentType = strings.TrimSuffix(name, ".atom"), core.AtomMimetype
+		write = func(feed *core.Feed, buf *bytes.Buffer) error { return feed.WriteAtom(buf) }
+	case strings.HasSuffix(name, ".rss"):
+		name, contentType = strings.TrimSuffix(name, ".rss"), core.RSSMimetype
+		write = func(feed *core.Feed, buf *bytes.Buffer) error { return feed.WriteRSS(buf) }
+	default:
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrNotFound("feed", name))
+	}
+
+	feed, err := f.feeds.Feed(ctx, name, requestBaseURL(r))
+	if errors.Is(err, storage.ErrNoRecord) {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrNotFound("feed", name))
+	}
+	if err != nil {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInternal(fmt.Errorf("build feed %q: %w", name, err)))
+	}
+	var buf bytes.Buffer
+	if err := write(feed, &buf); err != nil {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInternal(fmt.Errorf("write feed %q: %w", name, err)))
+	}
+
+	hash := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", buf.Len()))
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("write response: %w", err)
+	}
+	return nil
+}
+
+// etagMatch reports whether If-None-Match header value matches etag, weak comparison is used.
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// requestBaseURL returns URL of the server as seen by client.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/brainmorsel/libreta/internal/metrics"
+)
+
+func NewMetrics(logger *slog.Logger, registry *metrics.Registry) (*Metrics, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is nil")
+	}
+	if registry == nil {
+		return nil, fmt.Errorf("registry is nil")
+	}
+	return &Metrics{
+		logger:   logger,
+		registry: registry,
+	}, nil
+}
+
+// Metrics exposes metrics in Prometheus text format.
+type Metrics struct {
+	logger   *slog.Logger
+	registry *metrics.Registry
+}
+
+func (m *Metrics) Handle(w http.ResponseWriter, r *http.Request) error {
+	var buf bytes.Buffer
+	if err := m.registry.WriteText(r.Context(), &buf); err != nil {
+		// Partial metrics are still useful, failed collectors are just missing.
+		m.logger.ErrorContext(r.Context(), "collect metrics", slog.Any("error", err))
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
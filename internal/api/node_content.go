@@ -1,9 +1,11 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"strings"
 
@@ -27,6 +29,9 @@ func NewNodeContent(logger *slog.Logger, storage *storage.Storage) (*NodeContent
 type NodeContent struct {
 	logger  *slog.Logger
 	storage *storage.Storage
+
+	// MaxUploadSize limits size of upload request body, no limit if zero.
+	MaxUploadSize int64
 }
 
 type NodeContentUploadResult struct {
@@ -43,7 +48,13 @@ func (nc *NodeContent) Upload(w http.ResponseWriter, r *http.Request) error {
 	if !strings.HasPrefix(contentType, "multipart/form-data;") {
 		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInvalidContentType(contentType))
 	}
-	r.ParseMultipartForm(1024 * 1024)
+	if nc.MaxUploadSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, nc.MaxUploadSize)
+	}
+	err := r.ParseMultipartForm(1024 * 1024)
+	if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrContentTooLarge(maxBytesErr.Limit))
+	}
 	file, handler, err := r.FormFile("file")
 	if err != nil {
 		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInternal(fmt.Errorf("parse form file: %w", err)))
@@ -74,12 +85,11 @@ func (nc *NodeContent) Download(w http.ResponseWriter, r *http.Request) error {
 	}
 	node, ok := nodes[nodeID]
 	if !ok {
-		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrNotFound())
+		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrNotFound("node", nodeID))
 	}
 
 	if r.Method == http.MethodHead {
-		w.Header().Set("Content-Type", node.ContentMimetype)
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", node.ContentLength))
+		setContentHeaders(w, node)
 		w.WriteHeader(http.StatusOK)
 		return nil
 	}
@@ -88,11 +98,33 @@ func (nc *NodeContent) Download(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return jmsgp.WriteHTTPResponse(ctx, w, "", requestID, ErrInternal(fmt.Errorf("load content %q: %w", node.ContentHash, err)))
 	}
-	w.Header().Set("Content-Type", node.ContentMimetype)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", node.ContentLength))
+	setContentHeaders(w, node)
 	_, err = io.Copy(w, content)
 	if err != nil {
 		return fmt.Errorf("write response: %w", err)
 	}
 	return nil
 }
+
+func setContentHeaders(w http.ResponseWriter, node storage.Node) {
+	w.Header().Set("Content-Type", node.ContentMimetype)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", node.ContentLength))
+	// Browser must not guess content type, e.g. run text file which looks like HTML as a page.
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Stored pages (e.g. archived bookmarks) and other documents able to run scripts are opened in sandbox, so they
+	// can't run scripts on the app origin.
+	if isScriptableMimetype(node.ContentMimetype) {
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	}
+}
+
+// isScriptableMimetype reports whether browser may run scripts of document of the type: HTML and any XML, which
+// may embed XHTML or SVG. Unknown types are considered scriptable.
+func isScriptableMimetype(contentType string) bool {
+	mimetype, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	return mimetype == "text/html" || mimetype == "text/xml" || mimetype == "application/xml" ||
+		strings.HasSuffix(mimetype, "+xml")
+}
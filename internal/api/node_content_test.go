@@ -0,0 +1,62 @@
+package api_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brainmorsel/libreta/internal/api"
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeContentDownloadHeaders(t *testing.T) {
+	ctx := context.Background()
+	s := testStorage(t)
+	nc, err := api.NewNodeContent(slog.New(slog.NewTextHandler(io.Discard, nil)), s)
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	mux.Handle("GET /content/{node_id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, nc.Download(w, r))
+	}))
+
+	hash, err := s.NodeContentSave(ctx, strings.NewReader("<x:script xmlns:x=\"http://www.w3.org/1999/xhtml\"/>"))
+	require.NoError(t, err)
+	tests := []struct {
+		mimetype string
+		sandbox  bool
+	}{
+		{"text/html; charset=utf-8", true},
+		{"application/xhtml+xml", true},
+		{"image/svg+xml", true},
+		{"text/xml", true},
+		{"application/xml", true},
+		{"application/rss+xml", true},
+		{"", true},
+		{"text/plain", false},
+		{"image/png", false},
+		{"application/pdf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mimetype, func(t *testing.T) {
+			id, err := s.GenerateNodeID(ctx)
+			require.NoError(t, err)
+			require.NoError(t, s.NodeSave(ctx, storage.Node{ID: id, ContentHash: hash, ContentMimetype: tt.mimetype}))
+
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/content/"+id, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+			if tt.sandbox {
+				assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"))
+			} else {
+				assert.Empty(t, w.Header().Get("Content-Security-Policy"))
+			}
+		})
+	}
+}
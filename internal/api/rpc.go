@@ -3,46 +3,159 @@ package api
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 
+	"github.com/brainmorsel/libreta/internal/core"
 	"github.com/brainmorsel/libreta/internal/storage"
 	"github.com/brainmorsel/libreta/pkg/jmsgp"
 )
 
-func NewRPC(logger *slog.Logger, storage *storage.Storage) (*RPC, error) {
+func NewRPC(logger *slog.Logger, storage *storage.Storage, bookmarks *core.Bookmarks, archiver *core.Archiver) (*RPC, error) {
 	if logger == nil {
 		return nil, fmt.Errorf("logger is nil")
 	}
 	if storage == nil {
 		return nil, fmt.Errorf("storage is nil")
 	}
+	if bookmarks == nil {
+		return nil, fmt.Errorf("bookmarks is nil")
+	}
+	if archiver == nil {
+		return nil, fmt.Errorf("archiver is nil")
+	}
 	rpc := &RPC{
-		logger:  logger,
-		storage: storage,
+		logger:     logger,
+		storage:    storage,
+		microposts: core.NewMicroposts(logger, storage),
+		timeline:   core.NewTimeline(logger, storage),
+		tags:       core.NewTags(logger, storage),
+		bookmarks:  bookmarks,
+		archiver:   archiver,
 	}
+	rpc.hub = rpc.newHub()
 
-	hub := jmsgp.NewHub()
-	hub.AddHandler("GenerateNodeID", jmsgp.RPCHandler(rpc.GenerateNodeID))
-	hub.AddHandler("NodeSave", jmsgp.RPCHandler(rpc.NodeSave))
-
-	rpc.transport = jmsgp.NewHTTPServerTransport(hub)
+	rpc.transport = jmsgp.NewHTTPServerTransport(rpc.hub)
 	rpc.transport.ExtractTargetFunc = jmsgp.TargetFromHTTPRequestURLPathValue("method_name")
 	return rpc, nil
 }
 
+// RPCTargets describes available RPC methods. Used for client code generation, doesn't require storage.
+func RPCTargets() []jmsgp.TargetInfo {
+	return (&RPC{}).newHub().Targets()
+}
+
 type RPC struct {
 	logger    *slog.Logger
 	storage   *storage.Storage
+	hub       *jmsgp.Hub
 	transport *jmsgp.HTTPServerTransport
+
+	microposts *core.Microposts
+	timeline   *core.Timeline
+	tags       *core.Tags
+	bookmarks  *core.Bookmarks
+	archiver   *core.Archiver
+}
+
+// rpcScopes maps RPC targets to token scope required to call them, unlisted targets require write scope.
+var rpcScopes = map[string]string{
+	"GenerateNodeID":  core.ScopeRead,
+	"ErrorCatalog":    core.ScopeRead,
+	"NodeSave":        core.ScopeWrite,
+	"NodesDelete":     core.ScopeWrite,
+	"BookmarkCreate":  core.ScopeWrite,
+	"BookmarkUpdate":  core.ScopeWrite,
+	"BookmarkArchive": core.ScopeWrite,
+	"Post":            core.ScopeWrite,
+	"Timeline":        core.ScopeRead,
+	"TagsList":        core.ScopeRead,
+	"TagsAdd":         core.ScopeWrite,
+	"TagsRemove":      core.ScopeWrite,
+	"TagRename":       core.ScopeWrite,
+	"TagsMerge":       core.ScopeWrite,
+
+	// Principal may cancel only its own calls.
+	jmsgp.CancelTarget: core.ScopeRead,
+}
+
+func authorizeRPC(next jmsgp.HandleFunc) jmsgp.HandleFunc {
+	return func(env jmsgp.Envelope) error {
+		scope, ok := rpcScopes[env.Target()]
+		if !ok {
+			scope = core.ScopeWrite
+		}
+		if err := authorize(env.Context(), scope, env.Target()); err != nil {
+			return err
+		}
+		return next(env)
+	}
+}
+
+// principalOwner identifies principal RPC calls are made on behalf of: API token or user of session. Calls without
+// principal share empty owner.
+func principalOwner(ctx context.Context) string {
+	principal, ok := core.PrincipalFromContext(ctx)
+	switch {
+	case !ok:
+		return ""
+	case principal.TokenID != "":
+		return "token:" + principal.TokenID
+	default:
+		return "user:" + principal.UserName
+	}
+}
+
+func (rpc *RPC) newHub() *jmsgp.Hub {
+	hub := jmsgp.NewHub()
+	hub.OwnerFunc = principalOwner
+	hub.Use(authorizeRPC)
+	jmsgp.AddRPCHandler(hub, "GenerateNodeID", rpc.GenerateNodeID)
+	jmsgp.AddRPCHandler(hub, "NodeSave", rpc.NodeSave)
+	jmsgp.AddRPCHandler(hub, "NodesDelete", rpc.NodesDelete)
+	jmsgp.AddRPCHandler(hub, "ErrorCatalog", rpc.ErrorCatalog)
+	jmsgp.AddRPCHandler(hub, "BookmarkCreate", rpc.BookmarkCreate)
+	jmsgp.AddRPCHandler(hub, "BookmarkUpdate", rpc.BookmarkUpdate)
+	jmsgp.AddRPCHandler(hub, "BookmarkArchive", rpc.BookmarkArchive)
+	jmsgp.AddRPCHandler(hub, "Post", rpc.Post)
+	jmsgp.AddRPCHandler(hub, "Timeline", rpc.Timeline)
+	jmsgp.AddRPCHandler(hub, "TagsList", rpc.TagsList)
+	jmsgp.AddRPCHandler(hub, "TagsAdd", rpc.TagsAdd)
+	jmsgp.AddRPCHandler(hub, "TagsRemove", rpc.TagsRemove)
+	jmsgp.AddRPCHandler(hub, "TagRename", rpc.TagRename)
+	jmsgp.AddRPCHandler(hub, "TagsMerge", rpc.TagsMerge)
+	return hub
+}
+
+// Use adds middleware to RPC message handlers, e.g. for metrics.
+func (rpc *RPC) Use(mw jmsgp.Middleware) {
+	rpc.hub.Use(mw)
 }
 
 func (rpc *RPC) HandleRequest(w http.ResponseWriter, r *http.Request) error {
 	return rpc.transport.HandleRequest(w, r)
 }
 
-func (rpc *RPC) GenerateNodeID(ctx context.Context, _ struct{}) (string, error) {
-	return rpc.storage.GenerateNodeID(ctx)
+// ServeStream serves RPC over byte stream (e.g. stdin/stdout) until r reaches EOF.
+func (rpc *RPC) ServeStream(ctx context.Context, r io.Reader, w io.Writer, framing jmsgp.StreamFraming) error {
+	transport := jmsgp.NewStreamTransport(rpc.hub)
+	transport.Framing = framing
+	return transport.Serve(ctx, r, w)
+}
+
+type GenerateNodeIDParams struct {
+	// ContentHash of node content if already uploaded, used by content hash ID generation strategy.
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+func (rpc *RPC) GenerateNodeID(ctx context.Context, params GenerateNodeIDParams) (string, error) {
+	return rpc.storage.GenerateNodeIDFor(ctx, params.ContentHash)
+}
+
+// ErrorCatalog lists error codes which may be returned by API.
+func (rpc *RPC) ErrorCatalog(ctx context.Context, _ struct{}) ([]jmsgp.ErrorSpec, error) {
+	return jmsgp.DefaultErrorRegistry.Catalog(), nil
 }
 
 type Node struct {
@@ -52,6 +165,7 @@ type Node struct {
 	ContentMimetype string `json:"content_mimetype"`
 }
 
+// NodeSave saves node keeping attributes of existing one, inline hashtags of text content become its tags.
 func (rpc *RPC) NodeSave(ctx context.Context, n Node) (string, error) {
 	node := storage.Node{
 		ID:              n.ID,
@@ -59,9 +173,28 @@ func (rpc *RPC) NodeSave(ctx context.Context, n Node) (string, error) {
 		ContentHash:     n.ContentHash,
 		ContentMimetype: n.ContentMimetype,
 	}
-	err := rpc.storage.NodeSave(ctx, node)
+	attrs, err := rpc.tags.HashtagAttributes(ctx, node)
 	if err != nil {
 		return "", ErrInternal(err)
 	}
+	node.Attributes = attrs
+	err = rpc.storage.NodeSave(ctx, node)
+	if err != nil {
+		return "", ErrInternal(err)
+	}
+	return "ok", nil
+}
+
+type NodesDeleteParams struct {
+	IDs []string `json:"ids"`
+}
+
+func (rpc *RPC) NodesDelete(ctx context.Context, p NodesDeleteParams) (string, error) {
+	if len(p.IDs) == 0 {
+		return "ok", nil
+	}
+	if err := rpc.storage.NodesDelete(ctx, p.IDs); err != nil {
+		return "", ErrInternal(err)
+	}
 	return "ok", nil
 }
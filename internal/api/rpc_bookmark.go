@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+)
+
+type Bookmark struct {
+	ID          string           `json:"id"`
+	URL         string           `json:"url"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Favicon     string           `json:"favicon"`
+	Tags        []string         `json:"tags"`
+	Targets     []BookmarkTarget `json:"targets"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+type BookmarkTarget struct {
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+type BookmarkSaveParams struct {
+	// ID is generated on create when empty.
+	ID          string           `json:"id,omitempty"`
+	URL         string           `json:"url"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Favicon     string           `json:"favicon,omitempty"`
+	Tags        []string         `json:"tags,omitempty"`
+	Targets     []BookmarkTarget `json:"targets,omitempty"`
+	// Fetch fills empty title, description and favicon from the bookmarked page.
+	Fetch bool `json:"fetch,omitempty"`
+}
+
+type BookmarkArchiveParams struct {
+	ID string `json:"id"`
+}
+
+type BookmarkArchiveResult struct {
+	// NodeID is ID of page snapshot node, empty when page failed to load.
+	NodeID string `json:"node_id"`
+	// Status is "ok" or description of page loading failure.
+	Status string `json:"status"`
+	Assets int    `json:"assets"`
+	Size   int64  `json:"size"`
+}
+
+func (p BookmarkSaveParams) bookmark() core.Bookmark {
+	bookmark := core.Bookmark{
+		ID:          p.ID,
+		URL:         p.URL,
+		Title:       p.Title,
+		Description: p.Description,
+		Favicon:     p.Favicon,
+		Tags:        p.Tags,
+	}
+	for _, target := range p.Targets {
+		bookmark.Targets = append(bookmark.Targets, core.BookmarkTarget{Label: target.Label, URL: target.URL})
+	}
+	return bookmark
+}
+
+func bookmarkResult(b core.Bookmark) Bookmark {
+	bookmark := Bookmark{
+		ID:          b.ID,
+		URL:         b.URL,
+		Title:       b.Title,
+		Description: b.Description,
+		Favicon:     b.Favicon,
+		Tags:        b.Tags,
+		Targets:     make([]BookmarkTarget, 0, len(b.Targets)),
+		CreatedAt:   b.CreatedAt,
+		UpdatedAt:   b.UpdatedAt,
+	}
+	if bookmark.Tags == nil {
+		bookmark.Tags = []string{}
+	}
+	for _, target := range b.Targets {
+		bookmark.Targets = append(bookmark.Targets, BookmarkTarget{Label: target.Label, URL: target.URL})
+	}
+	return bookmark
+}
+
+func bookmarkError(id string, err error) error {
+	switch {
+	case errors.Is(err, storage.ErrNoRecord):
+		return ErrNotFound("bookmark", id)
+	case errors.Is(err, core.ErrInvalidBookmark):
+		return &Error{Code: jmsgp.InvalidDataErrCode, Msg: err.Error()}
+	default:
+		return ErrInternal(err)
+	}
+}
+
+func (rpc *RPC) BookmarkCreate(ctx context.Context, p BookmarkSaveParams) (Bookmark, error) {
+	bookmark, err := rpc.bookmarks.Create(ctx, p.bookmark(), p.Fetch)
+	if err != nil {
+		return Bookmark{}, bookmarkError(p.ID, err)
+	}
+	return bookmarkResult(bookmark), nil
+}
+
+func (rpc *RPC) BookmarkUpdate(ctx context.Context, p BookmarkSaveParams) (Bookmark, error) {
+	bookmark, err := rpc.bookmarks.Update(ctx, p.bookmark(), p.Fetch)
+	if err != nil {
+		return Bookmark{}, bookmarkError(p.ID, err)
+	}
+	return bookmarkResult(bookmark), nil
+}
+
+func (rpc *RPC) BookmarkArchive(ctx context.Context, p BookmarkArchiveParams) (BookmarkArchiveResult, error) {
+	result, err := rpc.archiver.Archive(ctx, p.ID)
+	if err != nil {
+		return BookmarkArchiveResult{}, bookmarkError(p.ID, err)
+	}
+	return BookmarkArchiveResult{
+		NodeID: result.NodeID,
+		Status: result.Status,
+		Assets: result.Assets,
+		Size:   result.Size,
+	}, nil
+}
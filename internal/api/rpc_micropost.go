@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+)
+
+type PostImage struct {
+	Name     string `json:"name,omitempty"`
+	Mimetype string `json:"mimetype,omitempty"`
+	// Data is image content, mimetype is detected from it when not given.
+	Data []byte `json:"data,omitempty"`
+	// ContentHash is hash of already uploaded content, it is used instead of data.
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+type PostParams struct {
+	Text   string      `json:"text"`
+	Images []PostImage `json:"images,omitempty"`
+}
+
+type TimelineEntry struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Kind            string    `json:"kind"`
+	ContentHash     string    `json:"content_hash"`
+	ContentMimetype string    `json:"content_mimetype"`
+	ContentLength   int64     `json:"content_length"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	// Text is content of micro post, empty for other nodes.
+	Text string `json:"text"`
+	// Attachments are IDs of images attached to micro post.
+	Attachments []string `json:"attachments"`
+}
+
+type TimelineDay struct {
+	// Date is day in YYYY-MM-DD format.
+	Date    string          `json:"date"`
+	Entries []TimelineEntry `json:"entries"`
+}
+
+type TimelineParams struct {
+	// Kind selects nodes of the kind, e.g. "micro", all nodes are selected when empty.
+	Kind string `json:"kind,omitempty"`
+	// Cursor is next_cursor of previous page.
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	// Desc orders nodes from the newest.
+	Desc bool `json:"desc,omitempty"`
+	// TimeZone is IANA time zone name of days, e.g. "Europe/Berlin", UTC by default.
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+type TimelineResult struct {
+	Days []TimelineDay `json:"days"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"next_cursor"`
+}
+
+// Post creates micro post: short text note with optional images.
+func (rpc *RPC) Post(ctx context.Context, p PostParams) (TimelineEntry, error) {
+	images := make([]core.MicropostImage, 0, len(p.Images))
+	for _, image := range p.Images {
+		images = append(images, core.MicropostImage{
+			Name:        image.Name,
+			Mimetype:    image.Mimetype,
+			Data:        image.Data,
+			ContentHash: image.ContentHash,
+		})
+	}
+	post, err := rpc.microposts.Post(ctx, p.Text, images)
+	if errors.Is(err, core.ErrInvalidMicropost) {
+		return TimelineEntry{}, &Error{Code: jmsgp.InvalidDataErrCode, Msg: err.Error()}
+	}
+	if err != nil {
+		return TimelineEntry{}, ErrInternal(err)
+	}
+	return timelineEntryResult(core.TimelineEntry{
+		Node:          post.Node,
+		Text:          post.Text,
+		AttachmentIDs: post.ImageIDs,
+	}), nil
+}
+
+// Timeline returns page of nodes in order of creation grouped by day.
+func (rpc *RPC) Timeline(ctx context.Context, p TimelineParams) (TimelineResult, error) {
+	q := core.TimelineQuery{
+		Kind:   p.Kind,
+		Cursor: p.Cursor,
+		Limit:  p.Limit,
+		Desc:   p.Desc,
+	}
+	if p.TimeZone != "" {
+		location, err := time.LoadLocation(p.TimeZone)
+		if err != nil {
+			return TimelineResult{}, &Error{Code: jmsgp.InvalidDataErrCode, Msg: fmt.Sprintf("invalid time zone %q", p.TimeZone)}
+		}
+		q.Location = location
+	}
+	page, err := rpc.timeline.Page(ctx, q)
+	if errors.Is(err, core.ErrInvalidTimelineCursor) {
+		return TimelineResult{}, &Error{Code: jmsgp.InvalidDataErrCode, Msg: err.Error()}
+	}
+	if err != nil {
+		return TimelineResult{}, ErrInternal(err)
+	}
+	result := TimelineResult{Days: make([]TimelineDay, 0, len(page.Days)), NextCursor: page.NextCursor}
+	for _, day := range page.Days {
+		entries := make([]TimelineEntry, 0, len(day.Entries))
+		for _, entry := range day.Entries {
+			entries = append(entries, timelineEntryResult(entry))
+		}
+		result.Days = append(result.Days, TimelineDay{Date: day.Date, Entries: entries})
+	}
+	return result, nil
+}
+
+func timelineEntryResult(e core.TimelineEntry) TimelineEntry {
+	entry := TimelineEntry{
+		ID:              e.Node.ID,
+		Name:            e.Node.Name,
+		ContentHash:     e.Node.ContentHash,
+		ContentMimetype: e.Node.ContentMimetype,
+		ContentLength:   e.Node.ContentLength,
+		CreatedAt:       e.Node.CreatedAt,
+		UpdatedAt:       e.Node.UpdatedAt,
+		Text:            e.Text,
+		Attachments:     e.AttachmentIDs,
+	}
+	if entry.Attachments == nil {
+		entry.Attachments = []string{}
+	}
+	for _, attr := range e.Node.Attributes {
+		if attr.Key == storage.NodeAttrKind {
+			entry.Kind = attr.Value
+		}
+	}
+	return entry
+}
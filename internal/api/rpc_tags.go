@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+)
+
+type TagCount struct {
+	Tag string `json:"tag"`
+	// Count is number of nodes with the tag.
+	Count int `json:"count"`
+	// Total is number of uses of the tag and tags nested in it.
+	Total int `json:"total"`
+}
+
+type TagsUpdateParams struct {
+	IDs  []string `json:"ids"`
+	Tags []string `json:"tags"`
+}
+
+type TagRenameParams struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type TagsMergeParams struct {
+	From []string `json:"from"`
+	To   string   `json:"to"`
+}
+
+type TagsUpdateResult struct {
+	// Changed is number of changed nodes.
+	Changed int `json:"changed"`
+}
+
+func tagsError(err error) error {
+	switch {
+	case errors.Is(err, core.ErrInvalidTag):
+		return &Error{Code: jmsgp.InvalidDataErrCode, Msg: err.Error()}
+	case errors.Is(err, storage.ErrNoRecord):
+		return &Error{Code: NotFoundErrCode, Msg: err.Error()}
+	default:
+		return ErrInternal(err)
+	}
+}
+
+// TagsList returns all tags with counts, parents of nested tags are included.
+func (rpc *RPC) TagsList(ctx context.Context, _ struct{}) ([]TagCount, error) {
+	tags, err := rpc.tags.List(ctx)
+	if err != nil {
+		return nil, ErrInternal(err)
+	}
+	result := make([]TagCount, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, TagCount{Tag: tag.Tag, Count: tag.Count, Total: tag.Total})
+	}
+	return result, nil
+}
+
+// TagsAdd adds tags to nodes.
+func (rpc *RPC) TagsAdd(ctx context.Context, p TagsUpdateParams) (TagsUpdateResult, error) {
+	changed, err := rpc.tags.Add(ctx, p.IDs, p.Tags)
+	if err != nil {
+		return TagsUpdateResult{}, tagsError(err)
+	}
+	return TagsUpdateResult{Changed: changed}, nil
+}
+
+// TagsRemove removes tags from nodes.
+func (rpc *RPC) TagsRemove(ctx context.Context, p TagsUpdateParams) (TagsUpdateResult, error) {
+	changed, err := rpc.tags.Remove(ctx, p.IDs, p.Tags)
+	if err != nil {
+		return TagsUpdateResult{}, tagsError(err)
+	}
+	return TagsUpdateResult{Changed: changed}, nil
+}
+
+// TagRename renames tag and tags nested in it on all nodes.
+func (rpc *RPC) TagRename(ctx context.Context, p TagRenameParams) (TagsUpdateResult, error) {
+	changed, err := rpc.tags.Rename(ctx, p.From, p.To)
+	if err != nil {
+		return TagsUpdateResult{}, tagsError(err)
+	}
+	return TagsUpdateResult{Changed: changed}, nil
+}
+
+// TagsMerge renames tags and tags nested in them into one tag on all nodes.
+func (rpc *RPC) TagsMerge(ctx context.Context, p TagsMergeParams) (TagsUpdateResult, error) {
+	changed, err := rpc.tags.Merge(ctx, p.From, p.To)
+	if err != nil {
+		return TagsUpdateResult{}, tagsError(err)
+	}
+	return TagsUpdateResult{Changed: changed}, nil
+}
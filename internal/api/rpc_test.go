@@ -0,0 +1,59 @@
+package api_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brainmorsel/libreta/internal/api"
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPCNodeSave(t *testing.T) {
+	ctx := context.Background()
+	s := testStorage(t)
+	rpc := testRPC(t, slog.New(slog.NewTextHandler(io.Discard, nil)), s)
+
+	saveContent := func(content string) string {
+		hash, err := s.NodeContentSave(ctx, strings.NewReader(content))
+		require.NoError(t, err)
+		return hash
+	}
+	id, err := s.GenerateNodeID(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.NodeSave(ctx, storage.Node{
+		ID:              id,
+		ContentHash:     saveContent("#old note"),
+		ContentMimetype: "text/markdown",
+		Attributes: []storage.NodeAttribute{
+			{Key: storage.NodeAttrKind, Value: storage.NodeAttrKindBookmark},
+			{Key: core.BookmarkURLAttr, Value: "https://example.com/"},
+			{Key: core.TagAttr, Value: "old"},
+			{Key: core.TagAttr, Value: "manual"},
+		},
+	}))
+
+	_, err = rpc.NodeSave(ctx, api.Node{ID: id, Name: "note", ContentHash: saveContent("#new note"), ContentMimetype: "text/markdown"})
+	require.NoError(t, err)
+
+	nodes, err := s.NodesLoad(ctx, []string{id})
+	require.NoError(t, err)
+	var attrs []string
+	for _, attr := range nodes[id].Attributes {
+		attrs = append(attrs, attr.Key+"="+attr.Value)
+	}
+	sort.Strings(attrs)
+	assert.Equal(t, []string{
+		"bookmark.url=https://example.com/",
+		"sys.kind=bookmark",
+		"tag=manual",
+		"tag=new",
+	}, attrs)
+	assert.Equal(t, "note", nodes[id].Name)
+}
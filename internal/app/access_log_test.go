@@ -0,0 +1,63 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(requestIDHandler{slog.NewJSONHandler(&buf, nil)})
+	var handledID string
+	h := accessLog(logger, "POST /api/rpc/{method_name}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handledID = jmsgp.MessageIdFromContext(r.Context())
+		assert.Equal(t, handledID, r.Header.Get(jmsgp.DefaultMessageIdHTTPHeader))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "hello")
+	}))
+	serve := func(requestID string) (string, map[string]any) {
+		buf.Reset()
+		r := httptest.NewRequest(http.MethodPost, "/api/rpc/Post?x=1", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if requestID != "" {
+			r.Header.Set(jmsgp.DefaultMessageIdHTTPHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var record map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		return w.Header().Get(jmsgp.DefaultMessageIdHTTPHeader), record
+	}
+
+	respID, record := serve("client-id-1")
+	assert.Equal(t, "client-id-1", respID)
+	assert.Equal(t, "client-id-1", handledID)
+	assert.Equal(t, "http request", record["msg"])
+	assert.Equal(t, "POST", record["method"])
+	assert.Equal(t, "/api/rpc/Post", record["path"])
+	assert.Equal(t, "POST /api/rpc/{method_name}", record["route"])
+	assert.Equal(t, float64(http.StatusCreated), record["status"])
+	assert.Equal(t, float64(len("hello")), record["bytes"])
+	assert.Contains(t, record, "duration")
+	assert.Equal(t, "192.0.2.1:1234", record["remote_addr"])
+	assert.Equal(t, "client-id-1", record["request_id"])
+
+	// Missing and unsafe ids are replaced with generated one.
+	for _, id := range []string{"", "bad id\n", strings.Repeat("x", maxRequestIDLen+1)} {
+		respID, record = serve(id)
+		assert.Regexp(t, "^[0-9a-f]{16}$", respID)
+		assert.Equal(t, respID, handledID)
+		assert.Equal(t, respID, record["request_id"])
+	}
+}
@@ -5,13 +5,20 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/internal/storage"
 )
 
 const (
 	bindAddrDefault = "127.0.0.1:8899"
-	bindAddrUsage   = "address and port for server"
+	bindAddrUsage   = "address and port for server or unix:/path/to.sock"
 	dataDirDefault  = "./"
 	dataDirUsage    = "path to data directory"
 )
@@ -20,27 +27,121 @@ type Config struct {
 	BindAddr     string
 	DevServerURL url.URL
 	DataDir      string
+	DBUpgrade    bool
+	StdioFraming string
+	AuthEnabled  bool
+
+	SocketMode    fs.FileMode
+	TLSCert       string
+	TLSKey        string
+	TLSSelfSigned bool
+
+	ShutdownTimeout time.Duration
+	MaxUploadSize   int64
+	MetricsEnabled  bool
+
+	FetchPrivateNetworks bool
+
+	BackupDir        string
+	BackupInterval   time.Duration
+	BackupKeepDaily  int
+	BackupKeepWeekly int
+
+	IDGenerator string
+
+	Device       string
+	SyncDir      string
+	SyncInterval time.Duration
+
+	LogLevel      slog.Level
+	LogFormat     string
+	LogFile       string
+	LogMaxSize    int64
+	LogMaxBackups int
 }
 
-func Run(ctx context.Context, stdout, stderr io.Writer, args []string, getenv func(string) string) error {
-	config := Config{}
+func Run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, args []string, getenv func(string) string) error {
+	config := Config{SocketMode: 0o660}
 
 	var flagError = &FlagError{}
 	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
 	flags.SetOutput(&flagError.buf)
 
+	var configPath string
+	flags.StringVar(&configPath, "config", "", "path to JSON config file (default: config.json in data directory)")
 	flags.StringVar(&config.BindAddr, "bind", bindAddrDefault, bindAddrUsage)
 	flags.StringVar(&config.BindAddr, "b", bindAddrDefault, bindAddrUsage+" (shorthand)")
 	flags.StringVar(&config.DataDir, "data-dir", dataDirDefault, dataDirUsage)
 	flags.StringVar(&config.DataDir, "d", dataDirDefault, dataDirUsage+" (shorthand)")
+	flags.BoolVar(&config.DBUpgrade, "upgrade", false, "upgrade database schema if required")
 	flags.Var(&FlagURLValue{&config.DevServerURL}, "dev-server", "ui dev server url (e.g. http://localhost:5173/)")
+	flags.BoolVar(&config.AuthEnabled, "auth", false, "require authentication for API access")
+	flags.Var(&FlagFileModeValue{&config.SocketMode}, "socket-mode", "permissions of unix socket file")
+	flags.StringVar(&config.TLSCert, "tls-cert", "", "path to TLS certificate file (PEM)")
+	flags.StringVar(&config.TLSKey, "tls-key", "", "path to TLS private key file (PEM)")
+	flags.BoolVar(&config.TLSSelfSigned, "tls-self-signed", false, "serve TLS with self-signed certificate generated in data directory")
+	flags.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "time to wait for in-flight requests on shutdown")
+	flags.BoolVar(&config.MetricsEnabled, "metrics", false, "expose metrics in Prometheus text format at /metrics")
+	flags.StringVar(&config.BackupDir, "backup-dir", "", "directory for scheduled backups, disabled if empty")
+	flags.DurationVar(&config.BackupInterval, "backup-interval", 24*time.Hour, "interval between scheduled backups")
+	flags.IntVar(&config.BackupKeepDaily, "backup-keep-daily", 7, "number of daily backups to keep")
+	flags.IntVar(&config.BackupKeepWeekly, "backup-keep-weekly", 4, "number of weekly backups to keep")
+	flags.StringVar(&config.IDGenerator, "id-generator", storage.IDGeneratorTimestamp, "node ID generation strategy: "+strings.Join(storage.IDGenerators, ", "))
+	hostname, _ := os.Hostname()
+	flags.StringVar(&config.Device, "device", hostname, "name of this device for multi-device sync")
+	flags.StringVar(&config.SyncDir, "sync-dir", "", "directory shared between devices (e.g. with Syncthing), sync is disabled if empty")
+	flags.DurationVar(&config.SyncInterval, "sync-interval", 5*time.Minute, "interval between sync rounds")
+	flags.Int64Var(&config.MaxUploadSize, "max-upload-size", 1<<30, "max size of uploaded content in bytes, 0 for no limit")
+	flags.BoolVar(&config.FetchPrivateNetworks, "fetch-private-networks", false, "allow fetching and archiving bookmarks on loopback, private and link-local addresses")
+	flags.StringVar(&config.StdioFraming, "stdio-framing", "ndjson", "message framing for stdio command: ndjson or content-length")
+	flags.TextVar(&config.LogLevel, "log-level", slog.LevelInfo, "log level: debug, info, warn or error")
+	flags.StringVar(&config.LogFormat, "log-format", "text", "log format: text or json")
+	flags.StringVar(&config.LogFile, "log-file", "", "write log to file instead of stderr")
+	flags.Int64Var(&config.LogMaxSize, "log-max-size", 100, "rotate log file when it grows over size in megabytes, 0 to disable")
+	flags.IntVar(&config.LogMaxBackups, "log-max-backups", 5, "number of rotated log files to keep")
 
 	flags.Usage = func() {
 		fmt.Fprintf(flags.Output(), "Usage of %s [command]:\n", flags.Name())
 		fmt.Fprintf(flags.Output(), `
 Commands:
   server (default)
-        run web server
+        run web server, systemd socket activation (LISTEN_FDS) is supported
+  stdio
+        serve RPC API over stdin/stdout
+  user add|passwd <name>
+        create user or change password, password is read from stdin
+  token create [-scopes list] <user> [name]
+        create API token for scripts (Authorization: Bearer <token>),
+        scopes: * (default), read, write, content:upload, rpc:<target>
+  token list [user]
+        list API tokens
+  token revoke <id>
+        revoke API token
+  backup [file]
+        write database backup to file or to backup directory
+  sync [conflicts]
+        run single sync round with other devices or list recorded conflicts
+  import markdown <dir>
+        import directory of markdown files (e.g. Obsidian vault), repeated
+        import updates previously imported nodes
+  import bookmarks <file>
+        import browser bookmarks from HTML export or Firefox JSON backup,
+        bookmarks with already existing URL are skipped
+  export markdown <dir>
+        export nodes into empty directory as markdown files with front matter
+  publish [-title title] [-base-url url] [-theme dir] <query> <dir>
+        render nodes into empty directory as static HTML site with Atom feed,
+        query: tag:<tag>, list:<head node id>, tree:<root node id>,
+        search:<terms>
+  gen-ts [file]
+        generate TypeScript RPC client bindings (to stdout by default)
+  config print
+        print effective configuration as JSON
+
+Configuration sources in order of precedence: flags, environment variables,
+config file, defaults. Config file is a JSON object with flag names as keys,
+e.g. {"bind": "127.0.0.1:8899", "auth": true}. Environment variable names
+are flag names in upper case with LIBRETA_ prefix, e.g. LIBRETA_DATA_DIR.
 
 Flags:
 `)
@@ -50,12 +151,64 @@ Flags:
 	if err := flags.Parse(args[1:]); err != nil {
 		return flagError
 	}
+	if err := applyConfigSources(flags, configPath, getenv); err != nil {
+		return err
+	}
 
-	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	logger, logCloser, err := newLogger(stderr, &config)
+	if err != nil {
+		return err
+	}
+	defer logCloser.Close()
 
 	switch {
 	case flags.Arg(0) == "" || flags.Arg(0) == "server":
-		return cmdServer(ctx, logger, &config)
+		return cmdServer(ctx, logger, &config, getenv)
+	case flags.Arg(0) == "stdio":
+		return cmdStdio(ctx, logger, &config, stdin, stdout)
+	case flags.Arg(0) == "user":
+		return cmdUser(ctx, logger, &config, stdin, stdout, flags.Args()[1:])
+	case flags.Arg(0) == "token":
+		return cmdToken(ctx, logger, &config, stdout, flags.Args()[1:])
+	case flags.Arg(0) == "backup":
+		return cmdBackup(ctx, logger, &config, stdout, flags.Args()[1:])
+	case flags.Arg(0) == "sync":
+		return cmdSync(ctx, logger, &config, stdout, flags.Args()[1:])
+	case flags.Arg(0) == "import":
+		return cmdImport(ctx, logger, &config, stdout, flags.Args()[1:])
+	case flags.Arg(0) == "export":
+		return cmdExport(ctx, logger, &config, stdout, flags.Args()[1:])
+	case flags.Arg(0) == "publish":
+		return cmdPublish(ctx, logger, &config, stdout, flags.Args()[1:])
+	case flags.Arg(0) == "gen-ts":
+		return cmdGenTS(stdout, flags.Arg(1))
+	case flags.Arg(0) == "config" && flags.Arg(1) == "print":
+		return printConfig(stdout, flags)
+	default:
+		return fmt.Errorf("unknown command %q", strings.Join(flags.Args(), " "))
+	}
+}
+
+func (config *Config) backupsConfig() core.BackupsConfig {
+	return core.BackupsConfig{
+		Dir:        config.BackupDir,
+		Interval:   config.BackupInterval,
+		KeepDaily:  config.BackupKeepDaily,
+		KeepWeekly: config.BackupKeepWeekly,
+	}
+}
+
+// bookmarks creates bookmarks and archiver fetching pages according to config.
+func (config *Config) bookmarks(logger *slog.Logger, storage *storage.Storage) (*core.Bookmarks, *core.Archiver) {
+	bookmarks := core.NewBookmarks(logger, storage, core.NewHTTPBookmarkFetcher(config.FetchPrivateNetworks))
+	archiver := core.NewArchiver(logger, storage, core.ArchiverConfig{AllowPrivateNetworks: config.FetchPrivateNetworks})
+	return bookmarks, archiver
+}
+
+func (config *Config) syncConfig() core.SyncConfig {
+	return core.SyncConfig{
+		Dir:      config.SyncDir,
+		Device:   config.Device,
+		Interval: config.SyncInterval,
 	}
-	return nil
 }
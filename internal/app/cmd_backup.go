@@ -0,0 +1,40 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/brainmorsel/libreta/internal/core"
+)
+
+// cmdBackup writes database backup: "backup <file>" or "backup" into backup directory with retention applied.
+func cmdBackup(ctx context.Context, logger *slog.Logger, config *Config, stdout io.Writer, args []string) error {
+	if len(args) > 1 || (len(args) == 0 && config.BackupDir == "") {
+		return fmt.Errorf("usage: backup <file>, or backup with --backup-dir set")
+	}
+
+	storage, err := openStorage(ctx, logger, config, nil)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	path := ""
+	if len(args) == 1 {
+		path = args[0]
+		err = storage.Backup(ctx, path)
+	} else {
+		var backups *core.Backups
+		if backups, err = core.NewBackups(logger, storage, config.backupsConfig()); err != nil {
+			return err
+		}
+		path, err = backups.Backup(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	fmt.Fprintf(stdout, "backup written to %s\n", path)
+	return nil
+}
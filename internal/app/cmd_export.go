@@ -0,0 +1,30 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/brainmorsel/libreta/internal/core"
+)
+
+// cmdExport exports notes into external formats: "export markdown <dir>".
+func cmdExport(ctx context.Context, logger *slog.Logger, config *Config, stdout io.Writer, args []string) error {
+	if len(args) != 2 || args[0] != "markdown" {
+		return fmt.Errorf("usage: export markdown <dir>")
+	}
+
+	storage, err := openStorage(ctx, logger, config, nil)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	result, err := core.NewMarkdownExporter(logger, storage).Export(ctx, args[1])
+	if err != nil {
+		return fmt.Errorf("export markdown: %w", err)
+	}
+	fmt.Fprintf(stdout, "exported: %d notes, %d attachments, %d links\n", result.Notes, result.Attachments, result.Links)
+	return nil
+}
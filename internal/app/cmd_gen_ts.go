@@ -0,0 +1,32 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/brainmorsel/libreta/internal/api"
+	"github.com/brainmorsel/libreta/pkg/jmsgp/tsgen"
+)
+
+const genTSHeader = `Code generated by "libreta gen-ts"; DO NOT EDIT.`
+
+func cmdGenTS(stdout io.Writer, outPath string) (err error) {
+	w := stdout
+	if outPath != "" && outPath != "-" {
+		var f *os.File
+		if f, err = os.Create(outPath); err != nil {
+			return fmt.Errorf("create output file: %w", err)
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("close output file: %w", closeErr)
+			}
+		}()
+		w = f
+	}
+	if err := tsgen.Generate(w, api.RPCTargets(), tsgen.Options{Header: genTSHeader}); err != nil {
+		return fmt.Errorf("generate: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/brainmorsel/libreta/internal/core"
+)
+
+// cmdImport imports notes from external formats: "import markdown <dir>" or "import bookmarks <file>".
+func cmdImport(ctx context.Context, logger *slog.Logger, config *Config, stdout io.Writer, args []string) error {
+	if len(args) != 2 || (args[0] != "markdown" && args[0] != "bookmarks") {
+		return fmt.Errorf("usage: import markdown <dir> | import bookmarks <file>")
+	}
+	if args[0] == "bookmarks" {
+		return importBookmarks(ctx, logger, config, stdout, args[1])
+	}
+
+	storage, err := openStorage(ctx, logger, config, nil)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	result, err := core.NewMarkdownImporter(logger, storage).Import(ctx, args[1])
+	if err != nil {
+		return fmt.Errorf("import markdown: %w", err)
+	}
+	for _, link := range result.Unresolved {
+		fmt.Fprintf(stdout, "unresolved link %s\n", link)
+	}
+	fmt.Fprintf(stdout, "imported: %d created, %d updated, %d unchanged, %d skipped nodes, %d attachments, %d links\n",
+		result.Created, result.Updated, result.Unchanged, result.Skipped, result.Attachments, result.Links)
+	return nil
+}
+
+func importBookmarks(ctx context.Context, logger *slog.Logger, config *Config, stdout io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	items, err := core.ParseBrowserBookmarks(data)
+	if err != nil {
+		return fmt.Errorf("import bookmarks: %w", err)
+	}
+
+	storage, err := openStorage(ctx, logger, config, nil)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	result, err := core.NewBookmarkImporter(logger, storage).Import(ctx, items)
+	if err != nil {
+		return fmt.Errorf("import bookmarks: %w", err)
+	}
+	fmt.Fprintf(stdout, "imported: %d bookmarks, %d folders, %d duplicates, %d skipped\n",
+		result.Created, result.Folders, result.Duplicates, result.Skipped)
+	return nil
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/brainmorsel/libreta/internal/core"
+)
+
+const publishUsage = "usage: publish [-title title] [-base-url url] [-theme dir] <query> <dir>"
+
+// cmdPublish renders nodes selected by query into static HTML site: "publish <query> <dir>".
+func cmdPublish(ctx context.Context, logger *slog.Logger, config *Config, stdout io.Writer, args []string) error {
+	flagError := &FlagError{}
+	flags := flag.NewFlagSet("publish", flag.ContinueOnError)
+	flags.SetOutput(&flagError.buf)
+	var publishConfig core.PublishConfig
+	flags.StringVar(&publishConfig.Title, "title", "", "site title, query by default")
+	flags.StringVar(&publishConfig.BaseURL, "base-url", "", "absolute URL of the site used in Atom feed")
+	flags.StringVar(&publishConfig.ThemeDir, "theme", "", "directory with templates and static files overriding default theme")
+	if err := flags.Parse(args); err != nil {
+		return flagError
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf(publishUsage)
+	}
+	query, err := core.ParseNodeQuery(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	storage, err := openStorage(ctx, logger, config, nil)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	result, err := core.NewPublisher(logger, storage).Publish(ctx, query, flags.Arg(1), publishConfig)
+	if err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	fmt.Fprintf(stdout, "published: %d notes, %d tags, %d attachments\n", result.Notes, result.Tags, result.Attachments)
+	return nil
+}
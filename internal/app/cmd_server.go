@@ -5,32 +5,86 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
-	"sync"
 
 	"github.com/brainmorsel/libreta/internal/api"
 	"github.com/brainmorsel/libreta/internal/core"
-	"github.com/brainmorsel/libreta/internal/storage"
 )
 
-func cmdServer(ctx context.Context, logger *slog.Logger, config *Config) error {
-	storage, err := storage.NewStorage(logger, config.DataDir)
+func cmdServer(ctx context.Context, logger *slog.Logger, config *Config, getenv func(string) string) error {
+	var metrics *appMetrics
+	if config.MetricsEnabled {
+		metrics = newAppMetrics()
+	}
+	storage, err := openStorage(ctx, logger, config, metrics.queryObserver())
 	if err != nil {
-		return fmt.Errorf("new storage: %w", err)
+		return err
+	}
+	defer func() {
+		if err := storage.Close(); err != nil {
+			logger.ErrorContext(ctx, "error closing storage", slog.Any("error", err))
+		}
+	}()
+	var backups *core.Backups
+	if config.BackupDir != "" {
+		if config.BackupInterval <= 0 {
+			return fmt.Errorf("invalid backup interval %s", config.BackupInterval)
+		}
+		if backups, err = core.NewBackups(logger, storage, config.backupsConfig()); err != nil {
+			return err
+		}
 	}
-	if err := storage.Open(ctx, false); err != nil {
-		return fmt.Errorf("open storage: %w", err)
+	var sync *core.Sync
+	if config.SyncDir != "" {
+		if config.SyncInterval <= 0 {
+			return fmt.Errorf("invalid sync interval %s", config.SyncInterval)
+		}
+		if sync, err = core.NewSync(logger, storage, config.syncConfig()); err != nil {
+			return err
+		}
 	}
 	core := core.NewCore(logger, storage)
-	_ = core
+	core.Backups = backups
+	core.Sync = sync
+	if config.AuthEnabled {
+		users, err := core.Auth.UsersCount(ctx)
+		if err != nil {
+			return fmt.Errorf("count users: %w", err)
+		}
+		if users == 0 {
+			logger.WarnContext(ctx, "authentication enabled, but there are no users, add one with \"user add\" command")
+		}
+	}
 
 	apiNodeContent, err := api.NewNodeContent(logger, storage)
 	if err != nil {
 		return fmt.Errorf("new api.NodeContent: %w", err)
 	}
-	apiRPC, err := api.NewRPC(logger, storage)
+	apiNodeContent.MaxUploadSize = config.MaxUploadSize
+	bookmarks, archiver := config.bookmarks(logger, storage)
+	apiRPC, err := api.NewRPC(logger, storage, bookmarks, archiver)
 	if err != nil {
 		return fmt.Errorf("new api.RPC: %w", err)
 	}
+	var apiMetrics *api.Metrics
+	if metrics != nil {
+		metrics.registerStorage(storage)
+		apiRPC.Use(metrics.instrumentRPC)
+		if apiMetrics, err = api.NewMetrics(logger, metrics.registry); err != nil {
+			return fmt.Errorf("new api.Metrics: %w", err)
+		}
+	}
+	apiEvents, err := api.NewEvents(logger, core.Events)
+	if err != nil {
+		return fmt.Errorf("new api.Events: %w", err)
+	}
+	apiFeed, err := api.NewFeed(logger, core.Feeds)
+	if err != nil {
+		return fmt.Errorf("new api.Feed: %w", err)
+	}
+	apiAuth, err := api.NewAuth(logger, core.Auth, config.AuthEnabled)
+	if err != nil {
+		return fmt.Errorf("new api.Auth: %w", err)
+	}
 
 	srv := http.NewServeMux()
 	addRoutes(
@@ -39,26 +93,52 @@ func cmdServer(ctx context.Context, logger *slog.Logger, config *Config) error {
 		config,
 		apiNodeContent,
 		apiRPC,
+		apiEvents,
+		apiFeed,
+		apiAuth,
+		apiMetrics,
+		metrics,
 	)
+	ln, err := listen(ctx, logger, config, getenv)
+	if err != nil {
+		return err
+	}
 	httpServer := &http.Server{
-		Addr:    config.BindAddr,
 		Handler: srv,
 	}
+	serveErr := make(chan error, 1)
 	go func() {
-		logger.InfoContext(ctx, "run server", slog.String("bind", httpServer.Addr))
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.ErrorContext(ctx, "error listening and serving", slog.Any("error", err))
+		logger.InfoContext(ctx, "run server", slog.String("bind", ln.Addr().String()))
+		if err := httpServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
 		}
+		close(serveErr)
 	}()
-	var wg sync.WaitGroup
-	wg.Add(1)
+	coreCtx, coreStop := context.WithCancel(ctx)
+	defer coreStop()
+	coreDone := make(chan struct{})
 	go func() {
-		defer wg.Done()
-		<-ctx.Done()
-		if err := httpServer.Shutdown(ctx); err != nil {
-			logger.ErrorContext(ctx, "error shutting down http server", slog.Any("error", err))
+		defer close(coreDone)
+		if err := core.Run(coreCtx); err != nil {
+			logger.ErrorContext(ctx, "error running core", slog.Any("error", err))
 		}
 	}()
-	wg.Wait()
-	return nil
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		logger.InfoContext(ctx, "shutting down", slog.Duration("timeout", config.ShutdownTimeout))
+	case err := <-serveErr:
+		runErr = fmt.Errorf("serve: %w", err)
+	}
+	// Stopping core first closes event subscriptions, so long-lived event streams don't hold up draining.
+	coreStop()
+	<-coreDone
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.ShutdownTimeout)
+	defer cancel()
+	if serr := httpServer.Shutdown(shutdownCtx); serr != nil {
+		logger.WarnContext(ctx, "drain timeout exceeded, closing connections", slog.Any("error", serr))
+		httpServer.Close()
+	}
+	return runErr
 }
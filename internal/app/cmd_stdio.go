@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/brainmorsel/libreta/internal/api"
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+)
+
+func cmdStdio(ctx context.Context, logger *slog.Logger, config *Config, stdin io.Reader, stdout io.Writer) error {
+	framing, err := jmsgp.ParseStreamFraming(config.StdioFraming)
+	if err != nil {
+		return err
+	}
+	storage, err := openStorage(ctx, logger, config, nil)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	bookmarks, archiver := config.bookmarks(logger, storage)
+	apiRPC, err := api.NewRPC(logger, storage, bookmarks, archiver)
+	if err != nil {
+		return fmt.Errorf("new api.RPC: %w", err)
+	}
+
+	logger.InfoContext(ctx, "serve rpc on stdio", slog.String("framing", config.StdioFraming))
+	if err := apiRPC.ServeStream(ctx, stdin, stdout, framing); err != nil && !errors.Is(err, context.Canceled) {
+		return fmt.Errorf("serve stdio: %w", err)
+	}
+	return nil
+}
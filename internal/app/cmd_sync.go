@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/brainmorsel/libreta/internal/core"
+)
+
+const syncConflictsLimit = 100
+
+// cmdSync runs single sync round ("sync") or lists recent merge conflicts ("sync conflicts").
+func cmdSync(ctx context.Context, logger *slog.Logger, config *Config, stdout io.Writer, args []string) error {
+	if len(args) > 1 || (len(args) == 1 && args[0] != "conflicts") {
+		return fmt.Errorf("usage: sync [conflicts]")
+	}
+	listConflicts := len(args) == 1
+	if !listConflicts && config.SyncDir == "" {
+		return fmt.Errorf("sync directory isn't configured, set --sync-dir")
+	}
+
+	storage, err := openStorage(ctx, logger, config, nil)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	if listConflicts {
+		conflicts, err := storage.SyncConflictsList(ctx, syncConflictsLimit)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tNODE\tDEVICE\tKEPT\tLOCAL NAME\tPEER NAME")
+		for _, c := range conflicts {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				c.CreatedAt.Format("2006-01-02 15:04"), c.NodeID, c.Device, c.Resolution, c.LocalData.Name, c.PeerData.Name)
+		}
+		return tw.Flush()
+	}
+
+	sync, err := core.NewSync(logger, storage, config.syncConfig())
+	if err != nil {
+		return err
+	}
+	report, err := sync.SyncOnce(ctx)
+	if err != nil {
+		return err
+	}
+	devices := make([]string, 0, len(report.Merged))
+	for device := range report.Merged {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	for _, device := range devices {
+		r := report.Merged[device]
+		fmt.Fprintf(stdout, "merged %s: %d nodes, %d edges, %d blobs, %d conflicts\n",
+			device, r.Nodes, r.Edges, r.Blobs, r.Conflicts)
+	}
+	if report.Exported {
+		fmt.Fprintf(stdout, "exported %s\n", config.Device)
+	}
+	return nil
+}
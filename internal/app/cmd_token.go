@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/brainmorsel/libreta/internal/api"
+	"github.com/brainmorsel/libreta/internal/core"
+)
+
+const tokenUsage = "usage: token create [-scopes list] <user> [name] | token list [user] | token revoke <id>"
+
+// cmdToken manages API tokens: "token create|list|revoke".
+func cmdToken(ctx context.Context, logger *slog.Logger, config *Config, stdout io.Writer, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(tokenUsage)
+	}
+	var (
+		scopes    []string
+		cmdArgs   []string
+		subcmd    = args[0]
+		flagError = &FlagError{}
+	)
+	switch subcmd {
+	case "create":
+		flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+		flags.SetOutput(&flagError.buf)
+		scopesFlag := flags.String("scopes", core.ScopeAll, "comma separated token scopes: *, read, write, content:upload, rpc:<target>")
+		if err := flags.Parse(args[1:]); err != nil {
+			return flagError
+		}
+		cmdArgs = flags.Args()
+		if len(cmdArgs) < 1 || len(cmdArgs) > 2 {
+			return fmt.Errorf(tokenUsage)
+		}
+		var err error
+		if scopes, err = parseScopes(*scopesFlag); err != nil {
+			return err
+		}
+	case "list":
+		cmdArgs = args[1:]
+		if len(cmdArgs) > 1 {
+			return fmt.Errorf(tokenUsage)
+		}
+	case "revoke":
+		cmdArgs = args[1:]
+		if len(cmdArgs) != 1 {
+			return fmt.Errorf(tokenUsage)
+		}
+	default:
+		return fmt.Errorf(tokenUsage)
+	}
+
+	storage, err := openStorage(ctx, logger, config, nil)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	core := core.NewCore(logger, storage)
+
+	switch subcmd {
+	case "create":
+		var name string
+		if len(cmdArgs) == 2 {
+			name = cmdArgs[1]
+		}
+		id, token, err := core.Auth.TokenCreate(ctx, cmdArgs[0], name, scopes)
+		if err != nil {
+			return fmt.Errorf("create token: %w", err)
+		}
+		fmt.Fprintf(stdout, "id: %s\ntoken: %s\n", id, token)
+	case "list":
+		var userName string
+		if len(cmdArgs) == 1 {
+			userName = cmdArgs[0]
+		}
+		tokens, err := core.Auth.TokensList(ctx, userName)
+		if err != nil {
+			return fmt.Errorf("list tokens: %w", err)
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUSER\tNAME\tSCOPES\tCREATED\tLAST USED")
+		for _, t := range tokens {
+			lastUsed := "-"
+			if !t.LastUsedAt.IsZero() {
+				lastUsed = t.LastUsedAt.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.ID, t.UserName, t.Name, strings.Join(t.Scopes, ","), t.CreatedAt.Format("2006-01-02 15:04"), lastUsed)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	case "revoke":
+		if err := core.Auth.TokenRevoke(ctx, cmdArgs[0]); err != nil {
+			return fmt.Errorf("revoke token %q: %w", cmdArgs[0], err)
+		}
+		fmt.Fprintf(stdout, "token %s revoked\n", cmdArgs[0])
+	}
+	return nil
+}
+
+// parseScopes parses comma separated scopes list, "rpc:<target>" scopes are checked against existing RPC targets.
+func parseScopes(s string) ([]string, error) {
+	targets := make(map[string]bool)
+	for _, t := range api.RPCTargets() {
+		targets[t.Target] = true
+	}
+	var scopes []string
+	for _, scope := range strings.Split(s, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !core.ValidScope(scope) {
+			return nil, fmt.Errorf("invalid scope %q", scope)
+		}
+		if target, ok := strings.CutPrefix(scope, core.ScopeRPCPrefix); ok && !targets[target] {
+			return nil, fmt.Errorf("invalid scope %q: unknown RPC target", scope)
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("token scopes are empty")
+	}
+	return scopes, nil
+}
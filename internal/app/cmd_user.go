@@ -0,0 +1,39 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/brainmorsel/libreta/internal/core"
+)
+
+// cmdUser manages users: "user add <name>" and "user passwd <name>", password is read from the first line of stdin.
+func cmdUser(ctx context.Context, logger *slog.Logger, config *Config, stdin io.Reader, stdout io.Writer, args []string) error {
+	if len(args) != 2 || (args[0] != "add" && args[0] != "passwd") {
+		return fmt.Errorf("usage: user add|passwd <name>")
+	}
+	name := args[1]
+
+	password, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	storage, err := openStorage(ctx, logger, config, nil)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	core := core.NewCore(logger, storage)
+
+	if err := core.Auth.UserSetPassword(ctx, name, password); err != nil {
+		return fmt.Errorf("set password: %w", err)
+	}
+	fmt.Fprintf(stdout, "user %q saved\n", name)
+	return nil
+}
@@ -0,0 +1,164 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	configFileName  = "config.json"
+	configEnvPrefix = "LIBRETA_"
+)
+
+// configFlagAliases maps shorthand flags to config keys.
+var configFlagAliases = map[string]string{
+	"b": "bind",
+	"d": "data-dir",
+}
+
+// configNotKeys are flags which can't be set in config file or environment.
+var configNotKeys = map[string]bool{
+	"config": true,
+	"b":      true,
+	"d":      true,
+}
+
+// applyConfigSources fills flags not set on command line from environment variables and config file.
+// Config keys are long flag names, environment variable names are derived from them: "data-dir" is LIBRETA_DATA_DIR.
+// Precedence is: flags > environment > config file > defaults. Config file is --config, LIBRETA_CONFIG
+// or config.json in data directory if it exists.
+func applyConfigSources(flags *flag.FlagSet, configPath string, getenv func(string) string) error {
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if alias, ok := configFlagAliases[name]; ok {
+			name = alias
+		}
+		explicit[name] = true
+	})
+
+	required := true
+	if configPath == "" {
+		configPath = getenv(configEnvPrefix + "CONFIG")
+	}
+	if configPath == "" {
+		dataDir := flags.Lookup("data-dir").Value.String()
+		if !explicit["data-dir"] {
+			if v := getenv(configEnvName("data-dir")); v != "" {
+				dataDir = v
+			}
+		}
+		configPath = filepath.Join(dataDir, configFileName)
+		required = false
+	}
+	fileValues, err := readConfigFile(configPath)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		fileValues = nil
+	} else if err != nil {
+		return err
+	}
+
+	var errs []error
+	flags.VisitAll(func(f *flag.Flag) {
+		if configNotKeys[f.Name] || explicit[f.Name] {
+			return
+		}
+		if v := getenv(configEnvName(f.Name)); v != "" {
+			if err := flags.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("environment variable %s: %w", configEnvName(f.Name), err))
+			}
+			return
+		}
+		if v, ok := fileValues[f.Name]; ok {
+			if err := flags.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("config file %s: key %q: %w", configPath, f.Name, err))
+			}
+		}
+	})
+	for key := range fileValues {
+		if f := flags.Lookup(key); f == nil || configNotKeys[key] {
+			errs = append(errs, fmt.Errorf("config file %s: unknown key %q", configPath, key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func configEnvName(key string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// readConfigFile reads JSON object with scalar values and returns them as strings suitable for flag.Value.Set.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for key, rawValue := range raw {
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(rawValue))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("parse config file %s: key %q: %w", path, key, err)
+		}
+		switch v := v.(type) {
+		case string:
+			values[key] = v
+		case bool, json.Number:
+			values[key] = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("config file %s: key %q: value must be string, number or boolean", path, key)
+		}
+	}
+	return values, nil
+}
+
+// printConfig writes effective configuration as JSON, output may be used as config file.
+func printConfig(w io.Writer, flags *flag.FlagSet) error {
+	var keys []string
+	flags.VisitAll(func(f *flag.Flag) {
+		if !configNotKeys[f.Name] {
+			keys = append(keys, f.Name)
+		}
+	})
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	for i, key := range keys {
+		var value any = flags.Lookup(key).Value.String()
+		if getter, ok := flags.Lookup(key).Value.(flag.Getter); ok {
+			switch v := getter.Get().(type) {
+			case bool, int, int64, uint, uint64, float64:
+				value = v
+			}
+		}
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "  %s: %s", k, v)
+		if i < len(keys)-1 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("}\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyConfigSources(t *testing.T) {
+	dataDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dataDir, configFileName), []byte(`{"bind": "file:1", "auth": true, "stdio-framing": "content-length"}`), 0o644)
+	require.NoError(t, err)
+
+	var bind, framing string
+	var auth bool
+	var dataDirFlag string
+	newFlags := func() *flag.FlagSet {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.String("config", "", "")
+		flags.StringVar(&bind, "bind", "default:1", "")
+		flags.StringVar(&bind, "b", "default:1", "")
+		flags.StringVar(&dataDirFlag, "data-dir", "./", "")
+		flags.StringVar(&dataDirFlag, "d", "./", "")
+		flags.BoolVar(&auth, "auth", false, "")
+		flags.StringVar(&framing, "stdio-framing", "ndjson", "")
+		return flags
+	}
+	env := map[string]string{"LIBRETA_BIND": "env:1", "LIBRETA_DATA_DIR": dataDir}
+
+	flags := newFlags()
+	require.NoError(t, flags.Parse([]string{"-b", "flag:1"}))
+	require.NoError(t, applyConfigSources(flags, "", func(k string) string { return env[k] }))
+	assert.Equal(t, "flag:1", bind)
+	assert.Equal(t, dataDir, dataDirFlag)
+	assert.True(t, auth)
+	assert.Equal(t, "content-length", framing)
+
+	flags = newFlags()
+	require.NoError(t, flags.Parse([]string{"--auth=false"}))
+	require.NoError(t, applyConfigSources(flags, "", func(k string) string { return env[k] }))
+	assert.Equal(t, "env:1", bind)
+	assert.False(t, auth)
+
+	flags = newFlags()
+	require.NoError(t, flags.Parse(nil))
+	assert.Error(t, applyConfigSources(flags, filepath.Join(dataDir, "missing.json"), func(string) string { return "" }))
+
+	flags = newFlags()
+	require.NoError(t, flags.Parse([]string{"-d", t.TempDir()}))
+	require.NoError(t, applyConfigSources(flags, "", func(string) string { return "" }))
+	assert.Equal(t, "default:1", bind)
+}
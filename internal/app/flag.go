@@ -1,7 +1,10 @@
 package app
 
 import (
+	"fmt"
+	"io/fs"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -32,3 +35,27 @@ func (v FlagURLValue) Set(s string) error {
 	}
 	return nil
 }
+
+// FlagFileModeValue parses octal file permissions, e.g. "0660".
+type FlagFileModeValue struct {
+	Mode *fs.FileMode
+}
+
+func (v FlagFileModeValue) String() string {
+	if v.Mode != nil {
+		return fmt.Sprintf("%#o", uint32(*v.Mode))
+	}
+	return ""
+}
+
+func (v FlagFileModeValue) Set(s string) error {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid file mode %q", s)
+	}
+	if mode&^uint64(fs.ModePerm) != 0 {
+		return fmt.Errorf("invalid file mode %q: only permission bits allowed", s)
+	}
+	*v.Mode = fs.FileMode(mode)
+	return nil
+}
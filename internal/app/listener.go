@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	unixBindPrefix  = "unix:"
+	systemdFDsStart = 3
+)
+
+// listen creates server listener. Socket passed by systemd (socket activation) takes precedence over bind address,
+// which is either "host:port" or "unix:/path/to.sock". Listener is wrapped with TLS if certificate is configured.
+func listen(ctx context.Context, logger *slog.Logger, config *Config, getenv func(string) string) (net.Listener, error) {
+	ln, err := systemdListener(getenv)
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket activation: %w", err)
+	}
+	if ln != nil {
+		logger.InfoContext(ctx, "use socket passed by systemd", slog.String("addr", ln.Addr().String()))
+	} else if path, ok := strings.CutPrefix(config.BindAddr, unixBindPrefix); ok {
+		if ln, err = listenUnix(path, config.SocketMode); err != nil {
+			return nil, err
+		}
+	} else {
+		if ln, err = net.Listen("tcp", config.BindAddr); err != nil {
+			return nil, fmt.Errorf("listen %q: %w", config.BindAddr, err)
+		}
+	}
+
+	tlsConfig, err := serverTLSConfig(ctx, logger, config)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+// listenUnix listens on unix socket, stale socket file left by previous run is removed.
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("unix socket path is empty")
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("listen %q: file exists and isn't a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("listen %q: socket is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("stat %q: %w", path, err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen %q: %w", path, err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	return ln, nil
+}
+
+// systemdListener returns listener for the first socket passed with LISTEN_FDS protocol or nil if there is none.
+// Variables of the protocol are removed from environment, so child processes don't inherit them. See sd_listen_fds(3).
+func systemdListener(getenv func(string) string) (net.Listener, error) {
+	pid, err := strconv.Atoi(getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		if err := os.Unsetenv(key); err != nil {
+			return nil, err
+		}
+	}
+	n, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("expected one socket, got %d", n)
+	}
+	f := os.NewFile(systemdFDsStart, "systemd-socket")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, err
+	}
+	return ln, nil
+}
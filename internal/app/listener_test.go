@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noEnv(string) string { return "" }
+
+func TestListenUnix(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "app.sock")
+	config := &Config{BindAddr: unixBindPrefix + path, SocketMode: 0o600}
+
+	ln, err := listen(ctx, logger, config, noEnv)
+	require.NoError(t, err)
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSocket|0o600, fi.Mode())
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	conn.Close()
+
+	// Socket of running server isn't taken over.
+	_, err = listen(ctx, logger, config, noEnv)
+	assert.ErrorContains(t, err, "socket is in use")
+
+	// Stale socket left by crashed server is replaced.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, ln.Close())
+	ln, err = listen(ctx, logger, config, noEnv)
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+
+	// Regular file isn't removed.
+	filePath := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0o600))
+	_, err = listen(ctx, logger, &Config{BindAddr: unixBindPrefix + filePath}, noEnv)
+	assert.ErrorContains(t, err, "isn't a socket")
+	_, err = os.Stat(filePath)
+	assert.NoError(t, err)
+
+	_, err = listen(ctx, logger, &Config{BindAddr: unixBindPrefix}, noEnv)
+	assert.Error(t, err)
+}
+
+func TestSystemdListenerIgnoresOtherProcess(t *testing.T) {
+	ln, err := systemdListener(func(key string) string {
+		return map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}[key]
+	})
+	require.NoError(t, err)
+	assert.Nil(t, ln)
+}
+
+func TestSystemdListenerUnsetsEnv(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "0")
+	t.Setenv("LISTEN_FDNAMES", "")
+	ln, err := systemdListener(os.Getenv)
+	require.NoError(t, err)
+	assert.Nil(t, ln)
+	for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_, ok := os.LookupEnv(key)
+		assert.False(t, ok, key)
+	}
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/metrics"
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+)
+
+// appMetrics holds metrics collected by server. Nil *appMetrics is valid and collects nothing.
+type appMetrics struct {
+	registry *metrics.Registry
+
+	httpRequests  *metrics.CounterVec
+	httpDuration  *metrics.HistogramVec
+	rpcRequests   *metrics.CounterVec
+	rpcDuration   *metrics.HistogramVec
+	queryDuration *metrics.HistogramVec
+}
+
+func newAppMetrics() *appMetrics {
+	m := &appMetrics{
+		registry: metrics.NewRegistry(),
+		httpRequests: metrics.NewCounterVec("libreta_http_requests_total",
+			"HTTP requests by route, method and status code.", "route", "method", "code"),
+		httpDuration: metrics.NewHistogramVec("libreta_http_request_duration_seconds",
+			"HTTP request duration by route.", metrics.DefaultBuckets, "route"),
+		rpcRequests: metrics.NewCounterVec("libreta_rpc_requests_total",
+			"RPC requests by target and error code (empty on success).", "target", "error"),
+		rpcDuration: metrics.NewHistogramVec("libreta_rpc_request_duration_seconds",
+			"RPC request duration by target.", metrics.DefaultBuckets, "target"),
+		queryDuration: metrics.NewHistogramVec("libreta_storage_query_duration_seconds",
+			"Database query duration by connection (read or write) and statement kind.", metrics.DefaultBuckets, "db", "op"),
+	}
+	m.registry.Register(m.httpRequests)
+	m.registry.Register(m.httpDuration)
+	m.registry.Register(m.rpcRequests)
+	m.registry.Register(m.rpcDuration)
+	m.registry.Register(m.queryDuration)
+	return m
+}
+
+// queryObserver returns nil if metrics are disabled, so storage doesn't wrap database driver.
+func (m *appMetrics) queryObserver() storage.QueryObserver {
+	if m == nil {
+		return nil
+	}
+	return func(db, op string, d time.Duration) {
+		m.queryDuration.ObserveDuration(d, db, op)
+	}
+}
+
+// registerStorage adds database size and contents gauges collected on scrape.
+func (m *appMetrics) registerStorage(s *storage.Storage) {
+	if m == nil {
+		return
+	}
+	m.registry.Register(metrics.CollectorFunc(func(ctx context.Context) ([]metrics.Family, error) {
+		stats, err := s.Stats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []metrics.Family{
+			metrics.Gauge("libreta_sqlite_page_count", "Number of pages in database file.", float64(stats.PageCount)),
+			metrics.Gauge("libreta_sqlite_page_size_bytes", "Database page size.", float64(stats.PageSize)),
+			metrics.Gauge("libreta_sqlite_wal_size_bytes", "Size of write-ahead log file.", float64(stats.WALSize)),
+			{
+				Name: "libreta_nodes",
+				Help: "Number of nodes by state.",
+				Type: metrics.TypeGauge,
+				Samples: []metrics.Sample{
+					{Labels: []metrics.Label{{Name: "state", Value: "active"}}, Value: float64(stats.Nodes)},
+					{Labels: []metrics.Label{{Name: "state", Value: "deleted"}}, Value: float64(stats.DeletedNodes)},
+				},
+			},
+			metrics.Gauge("libreta_edges", "Number of edges.", float64(stats.Edges)),
+			metrics.Gauge("libreta_blobs", "Number of stored content blobs.", float64(stats.Blobs)),
+			metrics.Gauge("libreta_content_bytes", "Total size of stored content blobs.", float64(stats.ContentBytes)),
+		}, nil
+	}))
+}
+
+func (m *appMetrics) instrumentHTTP(route string, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.httpRequests.Inc(route, r.Method, strconv.Itoa(status))
+		m.httpDuration.ObserveDuration(time.Since(start), route)
+	})
+}
+
+func (m *appMetrics) instrumentRPC(next jmsgp.HandleFunc) jmsgp.HandleFunc {
+	return func(env jmsgp.Envelope) error {
+		start := time.Now()
+		err := next(env)
+		m.rpcRequests.Inc(env.Target(), jmsgp.ErrorCode(err))
+		m.rpcDuration.ObserveDuration(time.Since(start), env.Target())
+		return err
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http/httputil"
 
 	"github.com/brainmorsel/libreta/internal/api"
+	"github.com/brainmorsel/libreta/internal/core"
 	"github.com/brainmorsel/libreta/ui"
 )
 
@@ -15,15 +16,38 @@ func addRoutes(
 	config *Config,
 	apiNodeContent *api.NodeContent,
 	apiRPC *api.RPC,
+	apiEvents *api.Events,
+	apiFeed *api.Feed,
+	apiAuth *api.Auth,
+	apiMetrics *api.Metrics,
+	metrics *appMetrics,
 ) {
-	mux.Handle("POST /api/rpc/{method_name}", logErrorHandler{logger, apiRPC.HandleRequest})
-	mux.Handle("POST /api/content", logErrorHandler{logger, apiNodeContent.Upload})
-	mux.Handle("GET /api/content/{node_id}", logErrorHandler{logger, apiNodeContent.Download})
+	handle := func(pattern string, h http.Handler) {
+		mux.Handle(pattern, accessLog(logger, pattern, metrics.instrumentHTTP(pattern, h)))
+	}
+	protect := func(scope string, h http.Handler) http.Handler {
+		return apiAuth.Middleware(apiAuth.RequireScope(scope)(h))
+	}
+	handle("POST /api/auth/login", logErrorHandler{logger, apiAuth.Login})
+	handle("POST /api/auth/logout", logErrorHandler{logger, apiAuth.Logout})
+	handle("GET /api/auth/session", logErrorHandler{logger, apiAuth.Session})
+	// RPC checks token scopes per target.
+	handle("POST /api/rpc/{method_name}", apiAuth.Middleware(logErrorHandler{logger, apiRPC.HandleRequest}))
+	handle("POST /api/content", protect(core.ScopeContentUpload, logErrorHandler{logger, apiNodeContent.Upload}))
+	handle("GET /api/content/{node_id}", protect(core.ScopeRead, logErrorHandler{logger, apiNodeContent.Download}))
+	handle("GET /api/events", protect(core.ScopeRead, logErrorHandler{logger, apiEvents.Stream}))
+	// Feed name is query, ID of saved search or list node with ".atom" or ".rss" extension.
+	handle("GET /feed/{name}", protect(core.ScopeRead, logErrorHandler{logger, apiFeed.Handle}))
+	if apiMetrics != nil {
+		handle("GET /metrics", protect(core.ScopeRead, logErrorHandler{logger, apiMetrics.Handle}))
+	}
+	// Deny access to unknown API endpoints before falling through to UI handler.
+	handle("/api/", apiAuth.Middleware(http.NotFoundHandler()))
 	if config.DevServerURL.String() != "" {
 		logger.Info("proxy to dev server used", slog.String("url", config.DevServerURL.String()))
-		mux.Handle("/", httputil.NewSingleHostReverseProxy(&config.DevServerURL))
+		handle("/", httputil.NewSingleHostReverseProxy(&config.DevServerURL))
 	} else {
-		mux.Handle("/", ui.FileServer())
+		handle("/", ui.FileServer())
 	}
 }
 
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/brainmorsel/libreta/internal/core"
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+func openStorage(ctx context.Context, logger *slog.Logger, config *Config, queryObserver storage.QueryObserver) (*storage.Storage, error) {
+	// Device name is recorded in change log and names sync file, so it must be valid for sync as well.
+	if config.Device != "" && !core.ValidDeviceName(config.Device) {
+		return nil, fmt.Errorf("invalid device name %q", config.Device)
+	}
+	idGen, err := storage.NewIDGenerator(config.IDGenerator, config.Device)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := storage.NewStorage(logger, config.DataDir)
+	if err != nil {
+		return nil, fmt.Errorf("new storage: %w", err)
+	}
+	storage.SetQueryObserver(queryObserver)
+	storage.SetIDGenerator(idGen)
+	if err := storage.Open(ctx, config.DBUpgrade); err != nil {
+		return nil, fmt.Errorf("open storage: %w", err)
+	}
+	if config.Device != "" {
+		if err := storage.SetDevice(ctx, config.Device); err != nil {
+			return nil, errors.Join(fmt.Errorf("set device: %w", err), storage.Close())
+		}
+	}
+	return storage, nil
+}
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenStorageDevice(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, device := range []string{"../laptop", "my laptop", ".hidden", "phone.tmp"} {
+		config := &Config{DataDir: t.TempDir(), IDGenerator: storage.IDGeneratorTimestamp, Device: device}
+		_, err := openStorage(ctx, logger, config, nil)
+		assert.ErrorContains(t, err, "invalid device name", device)
+	}
+
+	config := &Config{DataDir: t.TempDir(), IDGenerator: storage.IDGeneratorTimestamp, Device: "laptop-1"}
+	s, err := openStorage(ctx, logger, config, nil)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenTLSSelfSigned(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	config := &Config{BindAddr: "127.0.0.1:0", DataDir: t.TempDir(), TLSSelfSigned: true}
+
+	ln, err := listen(ctx, logger, config, noEnv)
+	require.NoError(t, err)
+	defer ln.Close()
+	certFile := filepath.Join(config.DataDir, selfSignedCertFile)
+	certPEM, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	fi, err := os.Stat(filepath.Join(config.DataDir, selfSignedKeyFile))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("ok"))
+	}()
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(certPEM))
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	require.NoError(t, err)
+	defer conn.Close()
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+
+	// Valid certificate is reused.
+	generated, err := ensureSelfSignedCert(certFile, filepath.Join(config.DataDir, selfSignedKeyFile), config.BindAddr)
+	require.NoError(t, err)
+	assert.False(t, generated)
+	reused, err := os.ReadFile(certFile)
+	require.NoError(t, err)
+	assert.Equal(t, certPEM, reused)
+
+	// Key file readable by others is restricted on reuse.
+	keyFile := filepath.Join(config.DataDir, selfSignedKeyFile)
+	require.NoError(t, os.Chmod(keyFile, 0o644))
+	generated, err = ensureSelfSignedCert(certFile, keyFile, config.BindAddr)
+	require.NoError(t, err)
+	assert.False(t, generated)
+	fi, err = os.Stat(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+}
+
+func TestSelfSignedCertHosts(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	generated, err := ensureSelfSignedCert(certFile, keyFile, "notes.example.com:8899")
+	require.NoError(t, err)
+	assert.True(t, generated)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost", "notes.example.com"}, leaf.DNSNames)
+	assert.True(t, leaf.IPAddresses[0].Equal(net.IPv4(127, 0, 0, 1)))
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tlsConfig, err := serverTLSConfig(ctx, logger, &Config{})
+	require.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	_, err = serverTLSConfig(ctx, logger, &Config{TLSCert: "cert.pem"})
+	assert.ErrorContains(t, err, "both TLS certificate and key are required")
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	_, err = serverTLSConfig(ctx, logger, &Config{TLSCert: certFile, TLSKey: keyFile})
+	assert.ErrorContains(t, err, "load TLS certificate")
+
+	_, err = ensureSelfSignedCert(certFile, keyFile, "")
+	require.NoError(t, err)
+	tlsConfig, err = serverTLSConfig(ctx, logger, &Config{TLSCert: certFile, TLSKey: keyFile})
+	require.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+}
@@ -0,0 +1,437 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/brainmorsel/libreta/pkg/htmlscan"
+)
+
+// Archive attributes. Archive node has all of them, bookmark node gets status and time of the latest attempt.
+const (
+	ArchiveURLAttr       = "archive.url"
+	ArchiveStatusAttr    = "archive.status"
+	ArchiveFetchedAtAttr = "archive.fetched_at"
+
+	ArchiveStatusOK = "ok"
+)
+
+const (
+	archiveTimeout   = 2 * time.Minute
+	archiveMaxSize   = 50 << 20
+	archiveMaxAssets = 300
+	// archiveMaxCSSDepth limits nesting of inlined stylesheets imported by other stylesheets.
+	archiveMaxCSSDepth = 3
+)
+
+// ArchiveResult describes archiving attempt.
+type ArchiveResult struct {
+	// NodeID is ID of snapshot node, empty when page failed to load.
+	NodeID string
+	// Status is ArchiveStatusOK or description of page loading failure.
+	Status string
+	Assets int
+	Size   int64
+}
+
+// ArchiverConfig configures Archiver.
+type ArchiverConfig struct {
+	// Client defaults to client with archiveTimeout, which can't connect to loopback, private and link-local addresses
+	// unless AllowPrivateNetworks is set.
+	Client               *http.Client
+	AllowPrivateNetworks bool
+	UserAgent            string
+	// MaxSize limits total size of page and its assets, default is archiveMaxSize.
+	MaxSize int64
+}
+
+// Archiver saves offline snapshots of bookmarked pages.
+//
+// HTML page is stored as single self-contained HTML file: same-origin images, stylesheets, fonts and icons are
+// inlined as data URLs, stylesheets are inlined into <style> elements, other URLs are resolved against the page URL
+// with <base> element. Scripts and event handler attributes are removed, so snapshot is static and can't run code
+// when opened. Other content types are stored as is. Snapshot is a node linked from the bookmark by "archive" edge.
+type Archiver struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+	config  ArchiverConfig
+}
+
+func NewArchiver(logger *slog.Logger, storage *storage.Storage, config ArchiverConfig) *Archiver {
+	if config.Client == nil {
+		config.Client = newFetchClient(archiveTimeout, config.AllowPrivateNetworks)
+	}
+	if config.UserAgent == "" {
+		config.UserAgent = bookmarkFetchUserAgent
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = archiveMaxSize
+	}
+	return &Archiver{
+		logger:  logger,
+		storage: storage,
+		config:  config,
+	}
+}
+
+// Archive saves snapshot of bookmark page, status of the attempt is recorded in bookmark attributes. Failure to
+// load the page isn't an error, it is reported by result status.
+func (a *Archiver) Archive(ctx context.Context, bookmarkID string) (ArchiveResult, error) {
+	nodes, err := a.storage.NodesLoad(ctx, []string{bookmarkID})
+	if err != nil {
+		return ArchiveResult{}, err
+	}
+	bookmarkNode, ok := nodes[bookmarkID]
+	if !ok || bookmarkNode.IsDeleted() {
+		return ArchiveResult{}, fmt.Errorf("bookmark %q: %w", bookmarkID, storage.ErrNoRecord)
+	}
+	if !IsBookmark(bookmarkNode) {
+		return ArchiveResult{}, fmt.Errorf("node %q is not a bookmark: %w", bookmarkID, ErrInvalidBookmark)
+	}
+	bookmark := bookmarkFromNode(bookmarkNode)
+
+	fetchedAt := time.Now()
+	page := &archivePage{
+		Archiver: a,
+		assets:   make(map[string]string),
+		budget:   a.config.MaxSize,
+	}
+	result := ArchiveResult{Status: ArchiveStatusOK}
+	body, mimetype, pageURL, err := page.fetch(ctx, bookmark.URL)
+	if err != nil {
+		a.logger.WarnContext(ctx, "archive bookmark", slog.String("url", bookmark.URL), slog.Any("error", err))
+		result.Status = err.Error()
+	} else {
+		if mimetype == "text/html" || mimetype == "application/xhtml+xml" {
+			body = page.rewriteHTML(ctx, body, pageURL)
+			mimetype = "text/html"
+		}
+		result.NodeID, err = a.save(ctx, bookmark, body, mimetype, pageURL, fetchedAt)
+		if err != nil {
+			return ArchiveResult{}, err
+		}
+		result.Assets = page.assetsCount
+		result.Size = int64(len(body))
+	}
+
+	// Page fetch takes a while, so status is written to the current version of bookmark node.
+	err = a.storage.NodesUpdate(ctx, []string{bookmarkID}, func(nodes map[string]storage.Node) ([]storage.Node, error) {
+		node, ok := nodes[bookmarkID]
+		if !ok || node.IsDeleted() {
+			return nil, fmt.Errorf("bookmark %q: %w", bookmarkID, storage.ErrNoRecord)
+		}
+		attrs := make([]storage.NodeAttribute, 0, len(node.Attributes)+2)
+		for _, attr := range node.Attributes {
+			if attr.Key != ArchiveStatusAttr && attr.Key != ArchiveFetchedAtAttr {
+				attrs = append(attrs, attr)
+			}
+		}
+		node.Attributes = append(attrs,
+			storage.NodeAttribute{Key: ArchiveStatusAttr, Value: result.Status},
+			storage.NodeAttribute{Key: ArchiveFetchedAtAttr, Value: fetchedAt.UTC().Format(time.RFC3339)},
+		)
+		return []storage.Node{node}, nil
+	})
+	if err != nil {
+		return ArchiveResult{}, fmt.Errorf("save archive status: %w", err)
+	}
+	return result, nil
+}
+
+// save stores snapshot node linked from the bookmark and returns its ID.
+func (a *Archiver) save(ctx context.Context, bookmark Bookmark, body []byte, mimetype string, pageURL *url.URL, fetchedAt time.Time) (string, error) {
+	hash, err := a.storage.NodeContentSave(ctx, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	id, err := a.storage.GenerateNodeIDFor(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	name := bookmark.Title
+	if name == "" {
+		name = bookmark.URL
+	}
+	err = a.storage.NodeSave(ctx, storage.Node{
+		ID:              id,
+		Name:            name + " (archived " + fetchedAt.Format(time.DateOnly) + ")",
+		ContentHash:     hash,
+		ContentMimetype: mimetype,
+		Attributes: []storage.NodeAttribute{
+			{Key: ArchiveURLAttr, Value: pageURL.String()},
+			{Key: ArchiveStatusAttr, Value: ArchiveStatusOK},
+			{Key: ArchiveFetchedAtAttr, Value: fetchedAt.UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	err = a.storage.EdgesAdd(ctx, []storage.Edge{{SrcID: bookmark.ID, DstID: id, Relation: storage.EdgeRelArchive}})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// archivePage keeps state of single page archiving.
+type archivePage struct {
+	*Archiver
+	origin      *url.URL
+	assets      map[string]string // asset URL -> data URL, empty on failure
+	assetsCount int
+	budget      int64
+}
+
+// fetch downloads URL, returns body, media type and final URL after redirects.
+func (p *archivePage) fetch(ctx context.Context, rawURL string) ([]byte, string, *url.URL, error) {
+	if p.budget <= 0 {
+		return nil, "", nil, fmt.Errorf("size limit of %d bytes exceeded", p.config.MaxSize)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	req.Header.Set("User-Agent", p.config.UserAgent)
+	resp, err := p.config.Client.Do(req)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", nil, fmt.Errorf("unexpected response status %q", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.budget+1))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if int64(len(body)) > p.budget {
+		return nil, "", nil, fmt.Errorf("size limit of %d bytes exceeded", p.config.MaxSize)
+	}
+	p.budget -= int64(len(body))
+	mimetype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mimetype == "" {
+		mimetype = http.DetectContentType(body)
+		mimetype, _, _ = mime.ParseMediaType(mimetype)
+	}
+	if p.origin == nil {
+		p.origin = resp.Request.URL
+	}
+	return body, mimetype, resp.Request.URL, nil
+}
+
+// asset returns data URL of same-origin asset, or empty string if asset is from other origin or failed to load.
+func (p *archivePage) asset(ctx context.Context, ref string, base *url.URL, depth int) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || u.Scheme != p.origin.Scheme || u.Host != p.origin.Host {
+		return ""
+	}
+	u.Fragment = ""
+	key := u.String()
+	if dataURL, ok := p.assets[key]; ok {
+		return dataURL
+	}
+	p.assets[key] = ""
+	if len(p.assets) > archiveMaxAssets {
+		return ""
+	}
+	body, mimetype, assetURL, err := p.fetch(ctx, key)
+	if err != nil {
+		p.logger.DebugContext(ctx, "archive asset", slog.String("url", key), slog.Any("error", err))
+		return ""
+	}
+	if mimetype == "text/css" && depth < archiveMaxCSSDepth {
+		body = []byte(p.rewriteCSS(ctx, string(body), assetURL, depth+1))
+	}
+	dataURL := "data:" + mimetype + ";base64," + base64.StdEncoding.EncodeToString(body)
+	p.assets[key] = dataURL
+	p.assetsCount++
+	return dataURL
+}
+
+// cssURLRe matches url() references and @import rules with plain strings.
+var cssURLRe = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)|@import\s+(?:"([^"]*)"|'([^']*)')`)
+
+// rewriteCSS inlines same-origin url() references of stylesheet, other relative references are made absolute.
+func (p *archivePage) rewriteCSS(ctx context.Context, css string, base *url.URL, depth int) string {
+	return cssURLRe.ReplaceAllStringFunc(css, func(m string) string {
+		sub := cssURLRe.FindStringSubmatch(m)
+		ref := sub[1] + sub[2] + sub[3] + sub[4] + sub[5]
+		if ref == "" || strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "#") {
+			return m
+		}
+		target := p.asset(ctx, ref, base, depth)
+		if target == "" {
+			u, err := base.Parse(ref)
+			if err != nil {
+				return m
+			}
+			target = u.String()
+		}
+		if strings.HasPrefix(m, "@import") {
+			return `@import url("` + target + `")`
+		}
+		return `url("` + target + `")`
+	})
+}
+
+// archiveAssetAttrs are attributes of tags referencing assets inlined into snapshot.
+var archiveAssetAttrs = map[string][]string{
+	"img":    {"src"},
+	"input":  {"src"},
+	"source": {"src"},
+	"video":  {"poster"},
+	"audio":  {"src"},
+	"track":  {"src"},
+	"image":  {"href", "xlink:href"},
+}
+
+type archiveEdit struct {
+	start, end int
+	text       string
+}
+
+// rewriteHTML makes HTML page self-contained.
+func (p *archivePage) rewriteHTML(ctx context.Context, page []byte, pageURL *url.URL) []byte {
+	tags := htmlscan.Tags(page)
+	base := pageURL
+	for _, tag := range tags {
+		if href, ok := tag.Attr("href"); ok && tag.Name == "base" && !tag.Closing {
+			if u, err := pageURL.Parse(strings.TrimSpace(href)); err == nil {
+				base = u
+			}
+			break
+		}
+	}
+
+	var edits []archiveEdit
+	replaceValue := func(attr htmlscan.Attr, value string) {
+		if attr.ValueStart < 0 {
+			return
+		}
+		// Quotes are added for unquoted values, value is escaped for both quote kinds.
+		start, end := attr.ValueStart, attr.ValueEnd
+		quoted := start > 0 && (page[start-1] == '"' || page[start-1] == '\'')
+		if quoted {
+			start, end = start-1, end+1
+		}
+		edits = append(edits, archiveEdit{start, end, `"` + html.EscapeString(value) + `"`})
+	}
+	headInserted := false
+	for i := 0; i < len(tags); i++ {
+		tag := tags[i]
+		if tag.Closing {
+			continue
+		}
+		switch tag.Name {
+		case "script":
+			end := tag.End
+			if i+1 < len(tags) && tags[i+1].Closing && tags[i+1].Name == "script" {
+				end = tags[i+1].End
+				i++
+			}
+			edits = append(edits, archiveEdit{tag.Start, end, ""})
+			continue
+		case "base":
+			edits = append(edits, archiveEdit{tag.Start, tag.End, ""})
+			continue
+		case "head":
+			edits = append(edits, archiveEdit{tag.End, tag.End, archiveBaseTag(base)})
+			headInserted = true
+		case "style":
+			if i+1 < len(tags) {
+				css := string(page[tag.End:tags[i+1].Start])
+				edits = append(edits, archiveEdit{tag.End, tags[i+1].Start, p.rewriteCSS(ctx, css, base, 0)})
+			}
+		case "link":
+			rel, _ := tag.Attr("rel")
+			href, ok := tag.Attr("href")
+			rels := strings.Fields(strings.ToLower(rel))
+			switch {
+			case !ok:
+			case slices.Contains(rels, "stylesheet"):
+				if dataURL := p.asset(ctx, href, base, 0); dataURL != "" {
+					css, err := decodeDataURL(dataURL)
+					if err == nil {
+						media, _ := tag.Attr("media")
+						style := "<style>"
+						if media != "" {
+							style = `<style media="` + html.EscapeString(media) + `">`
+						}
+						edits = append(edits, archiveEdit{tag.Start, tag.End, style + strings.ReplaceAll(css, "</", `<\/`) + "</style>"})
+						continue
+					}
+				}
+			case slices.Contains(rels, "icon") || slices.Contains(rels, "apple-touch-icon"):
+				if dataURL := p.asset(ctx, href, base, 0); dataURL != "" {
+					for _, attr := range tag.Attrs {
+						if attr.Name == "href" {
+							replaceValue(attr, dataURL)
+						}
+					}
+				}
+			case slices.Contains(rels, "preload") || slices.Contains(rels, "modulepreload") || slices.Contains(rels, "prefetch"):
+				edits = append(edits, archiveEdit{tag.Start, tag.End, ""})
+				continue
+			}
+		}
+		for _, attr := range tag.Attrs {
+			switch {
+			case strings.HasPrefix(attr.Name, "on"):
+				edits = append(edits, archiveEdit{attr.Start, attr.End, ""})
+			case attr.Name == "srcset":
+				replaceValue(attr, "")
+			case attr.Name == "style":
+				replaceValue(attr, p.rewriteCSS(ctx, attr.Value, base, 0))
+			case (attr.Name == "href" || attr.Name == "src" || attr.Name == "action") &&
+				strings.HasPrefix(strings.ToLower(strings.TrimSpace(attr.Value)), "javascript:"):
+				replaceValue(attr, "#")
+			case slices.Contains(archiveAssetAttrs[tag.Name], attr.Name):
+				if dataURL := p.asset(ctx, attr.Value, base, 0); dataURL != "" {
+					replaceValue(attr, dataURL)
+				}
+			}
+		}
+	}
+	if !headInserted {
+		edits = append(edits, archiveEdit{0, 0, archiveBaseTag(base)})
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	out := new(bytes.Buffer)
+	offset := 0
+	for _, edit := range edits {
+		if edit.start < offset {
+			continue
+		}
+		out.Write(page[offset:edit.start])
+		out.WriteString(edit.text)
+		offset = edit.end
+	}
+	out.Write(page[offset:])
+	return out.Bytes()
+}
+
+// archiveBaseTag returns <base> element resolving relative links of snapshot against the original page.
+func archiveBaseTag(base *url.URL) string {
+	return `<base href="` + html.EscapeString(base.String()) + `">`
+}
+
+func decodeDataURL(dataURL string) (string, error) {
+	_, data, _ := strings.Cut(dataURL, ";base64,")
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	return string(decoded), err
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiver(t *testing.T) {
+	ctx := context.Background()
+	s := testStorage(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to other origin: %s", r.URL)
+	}))
+	t.Cleanup(other.Close)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, `<!DOCTYPE html><html><HEAD><base href="/static/">
+<title>Article</title>
+<link rel="stylesheet" href="style.css" media="screen">
+<link rel="preload" href="font.woff2" as="font">
+<script src="app.js"></script>
+<script>document.write("<p>")</script>
+<style>body { background: url('bg.png') }</style>
+</head><body onload="init()">
+<img src="img.png" srcset="img@2x.png 2x" alt=x>
+<img src=`+other.URL+`/remote.png>
+<img src="missing.png">
+<a href="javascript:alert(1)" onclick='go()'>Link</a> <a href="../next">Next</a>
+<div style="background-image: url(img.png)"></div>
+</body></html>`)
+	})
+	mux.HandleFunc("/static/style.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		io.WriteString(w, `@import "print.css"; body { color: red } @font-face { src: url("font.woff2") }`)
+	})
+	mux.HandleFunc("/static/print.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		io.WriteString(w, `p { color: black }`)
+	})
+	for _, name := range []string{"bg.png", "img.png", "font.woff2"} {
+		mux.HandleFunc("/static/"+name, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			io.WriteString(w, name)
+		})
+	}
+	mux.HandleFunc("/static/app.js", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("script must not be loaded")
+	})
+	mux.HandleFunc("/file.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "plain text")
+	})
+	// changed is updated by request to /changed, as if bookmark were edited while page is loading.
+	var changed Bookmark
+	mux.HandleFunc("/changed", func(w http.ResponseWriter, r *http.Request) {
+		changed.Title = "Edited"
+		_, err := NewBookmarks(logger, s, nil).Update(r.Context(), changed, false)
+		assert.NoError(t, err)
+		io.WriteString(w, "changed")
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	bookmarks := NewBookmarks(logger, s, nil)
+	a := NewArchiver(logger, s, ArchiverConfig{Client: srv.Client()})
+
+	bookmark, err := bookmarks.Create(ctx, Bookmark{URL: srv.URL + "/article", Title: "Article"}, false)
+	require.NoError(t, err)
+	result, err := a.Archive(ctx, bookmark.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveStatusOK, result.Status)
+	assert.Equal(t, 5, result.Assets)
+
+	nodes, err := s.NodesLoad(ctx, []string{bookmark.ID, result.NodeID})
+	require.NoError(t, err)
+	snapshot := nodes[result.NodeID]
+	assert.Equal(t, "text/html", snapshot.ContentMimetype)
+	assert.Equal(t, result.Size, snapshot.ContentLength)
+	assert.Contains(t, clearAttrTimes(snapshot.Attributes), storage.NodeAttribute{Key: ArchiveURLAttr, Value: srv.URL + "/article"})
+	assert.Contains(t, clearAttrTimes(nodes[bookmark.ID].Attributes), storage.NodeAttribute{Key: ArchiveStatusAttr, Value: ArchiveStatusOK})
+	edges, err := s.EdgesForNodes(ctx, []string{bookmark.ID})
+	require.NoError(t, err)
+	require.Len(t, edges, 1)
+	assert.Equal(t, storage.Edge{SrcID: bookmark.ID, DstID: result.NodeID, Relation: storage.EdgeRelArchive}, storage.Edge{SrcID: edges[0].SrcID, DstID: edges[0].DstID, Relation: edges[0].Relation})
+
+	content, err := loadNodeContent(ctx, s, snapshot.ContentHash)
+	require.NoError(t, err)
+	page := string(content)
+	dataURL := func(mimetype, data string) string {
+		return "data:" + mimetype + ";base64," + base64.StdEncoding.EncodeToString([]byte(data))
+	}
+	assert.Contains(t, page, `<HEAD><base href="`+srv.URL+`/static/">`)
+	assert.Equal(t, 1, strings.Count(page, "<base "))
+	assert.NotContains(t, page, "<script")
+	assert.NotContains(t, page, "onload")
+	assert.NotContains(t, page, "onclick")
+	assert.NotContains(t, page, "preload")
+	assert.NotContains(t, page, "javascript:")
+	assert.Contains(t, page, `<style media="screen">@import url("`+dataURL("text/css", "p { color: black }")+`"); body { color: red } `+
+		`@font-face { src: url("`+dataURL("application/octet-stream", "font.woff2")+`") }</style>`)
+	assert.Contains(t, page, `<style>body { background: url("`+dataURL("application/octet-stream", "bg.png")+`") }</style>`)
+	assert.Contains(t, page, `<img src="`+dataURL("application/octet-stream", "img.png")+`" srcset="" alt=x>`)
+	assert.Contains(t, page, `<div style="background-image: url(&#34;`+dataURL("application/octet-stream", "img.png")+`&#34;)"></div>`)
+	assert.Contains(t, page, `<img src=`+other.URL+`/remote.png>`)
+	assert.Contains(t, page, `<img src="missing.png">`)
+	assert.Contains(t, page, `<a href="#" >Link</a> <a href="../next">Next</a>`)
+
+	t.Run("not html", func(t *testing.T) {
+		bookmark, err := bookmarks.Create(ctx, Bookmark{URL: srv.URL + "/file.txt"}, false)
+		require.NoError(t, err)
+		result, err := a.Archive(ctx, bookmark.ID)
+		require.NoError(t, err)
+		nodes, err := s.NodesLoad(ctx, []string{result.NodeID})
+		require.NoError(t, err)
+		assert.Equal(t, "text/plain", nodes[result.NodeID].ContentMimetype)
+		content, err := loadNodeContent(ctx, s, nodes[result.NodeID].ContentHash)
+		require.NoError(t, err)
+		assert.Equal(t, "plain text", string(content))
+	})
+
+	t.Run("concurrent change", func(t *testing.T) {
+		var err error
+		changed, err = bookmarks.Create(ctx, Bookmark{URL: srv.URL + "/changed", Title: "Original"}, false)
+		require.NoError(t, err)
+		result, err := a.Archive(ctx, changed.ID)
+		require.NoError(t, err)
+		assert.Equal(t, ArchiveStatusOK, result.Status)
+		loaded, err := bookmarks.Load(ctx, changed.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Edited", loaded.Title)
+		nodes, err := s.NodesLoad(ctx, []string{changed.ID})
+		require.NoError(t, err)
+		assert.Contains(t, clearAttrTimes(nodes[changed.ID].Attributes), storage.NodeAttribute{Key: ArchiveStatusAttr, Value: ArchiveStatusOK})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		bookmark, err := bookmarks.Create(ctx, Bookmark{URL: srv.URL + "/missing"}, false)
+		require.NoError(t, err)
+		result, err := a.Archive(ctx, bookmark.ID)
+		require.NoError(t, err)
+		assert.Empty(t, result.NodeID)
+		assert.Contains(t, result.Status, "404")
+		loaded, err := s.NodesLoad(ctx, []string{bookmark.ID})
+		require.NoError(t, err)
+		assert.Contains(t, clearAttrTimes(loaded[bookmark.ID].Attributes), storage.NodeAttribute{Key: ArchiveStatusAttr, Value: result.Status})
+
+		limited := NewArchiver(logger, s, ArchiverConfig{Client: srv.Client(), MaxSize: 10})
+		result, err = limited.Archive(ctx, bookmark.ID)
+		require.NoError(t, err)
+		assert.Contains(t, result.Status, "404")
+		article, err := bookmarks.Create(ctx, Bookmark{URL: srv.URL + "/article"}, false)
+		require.NoError(t, err)
+		result, err = limited.Archive(ctx, article.ID)
+		require.NoError(t, err)
+		assert.Empty(t, result.NodeID)
+		assert.Contains(t, result.Status, "size limit")
+
+		_, err = a.Archive(ctx, "missing")
+		assert.ErrorIs(t, err, storage.ErrNoRecord)
+		_, err = a.Archive(ctx, snapshot.ID)
+		assert.ErrorIs(t, err, ErrInvalidBookmark)
+	})
+}
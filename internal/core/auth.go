@@ -0,0 +1,257 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	SessionTTL = 30 * 24 * time.Hour
+
+	PrincipalKindSession = "session"
+	PrincipalKindToken   = "token"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUnauthenticated    = errors.New("unauthenticated")
+)
+
+// Token scopes. Besides listed ones, scope "rpc:<target>" allows calling particular RPC target.
+const (
+	ScopeAll           = "*"
+	ScopeRead          = "read"
+	ScopeWrite         = "write"
+	ScopeContentUpload = "content:upload"
+	ScopeRPCPrefix     = "rpc:"
+)
+
+// ValidScope reports whether scope is well-formed. RPC target existence isn't checked.
+func ValidScope(scope string) bool {
+	switch {
+	case scope == ScopeAll, scope == ScopeRead, scope == ScopeWrite, scope == ScopeContentUpload:
+		return true
+	case strings.HasPrefix(scope, ScopeRPCPrefix) && len(scope) > len(ScopeRPCPrefix):
+		return true
+	default:
+		return false
+	}
+}
+
+// Principal is an authenticated user on whose behalf request is made.
+type Principal struct {
+	UserName string
+	Kind     string
+	// TokenID is set for principals authenticated with API token.
+	TokenID string
+	Scopes  []string
+}
+
+// Allows reports whether principal may perform action requiring scope. Target is a name of called RPC target,
+// empty for non-RPC actions. Write scope implies read and content upload.
+func (p Principal) Allows(scope, target string) bool {
+	for _, s := range p.Scopes {
+		switch {
+		case s == ScopeAll || s == scope:
+			return true
+		case s == ScopeWrite && (scope == ScopeRead || scope == ScopeContentUpload):
+			return true
+		case target != "" && s == ScopeRPCPrefix+target:
+			return true
+		}
+	}
+	return false
+}
+
+type principalCtxKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(Principal)
+	return p, ok
+}
+
+type Auth struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+}
+
+func NewAuth(logger *slog.Logger, storage *storage.Storage) *Auth {
+	return &Auth{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+// NewSession is returned on successful login, Token is known only to the client.
+type NewSession struct {
+	Token     string
+	CSRFToken string
+	ExpiresAt time.Time
+}
+
+func (a *Auth) UserSetPassword(ctx context.Context, name, password string) error {
+	if name == "" {
+		return fmt.Errorf("user name is empty")
+	}
+	if password == "" {
+		return fmt.Errorf("password is empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	return a.storage.UserSave(ctx, storage.User{Name: name, PasswordHash: string(hash)})
+}
+
+func (a *Auth) UsersCount(ctx context.Context) (int, error) {
+	return a.storage.UsersCount(ctx)
+}
+
+func (a *Auth) Login(ctx context.Context, name, password string) (NewSession, error) {
+	user, err := a.storage.UserLoad(ctx, name)
+	if errors.Is(err, storage.ErrNoRecord) {
+		// Spend comparable time to not reveal user existence.
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return NewSession{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return NewSession{}, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return NewSession{}, ErrInvalidCredentials
+	}
+
+	if err := a.storage.SessionsDeleteExpired(ctx); err != nil {
+		a.logger.WarnContext(ctx, "delete expired sessions", slog.Any("error", err))
+	}
+	token, err := randomToken()
+	if err != nil {
+		return NewSession{}, err
+	}
+	csrfToken, err := randomToken()
+	if err != nil {
+		return NewSession{}, err
+	}
+	now := time.Now()
+	session := storage.Session{
+		TokenHash: hashToken(token),
+		UserName:  user.Name,
+		CSRFToken: csrfToken,
+		CreatedAt: now,
+		ExpiresAt: now.Add(SessionTTL),
+	}
+	if err := a.storage.SessionSave(ctx, session); err != nil {
+		return NewSession{}, err
+	}
+	return NewSession{Token: token, CSRFToken: csrfToken, ExpiresAt: session.ExpiresAt}, nil
+}
+
+func (a *Auth) Logout(ctx context.Context, sessionToken string) error {
+	return a.storage.SessionDelete(ctx, hashToken(sessionToken))
+}
+
+// AuthenticateSession returns principal and CSRF token of the session.
+func (a *Auth) AuthenticateSession(ctx context.Context, sessionToken string) (Principal, string, error) {
+	session, err := a.storage.SessionLoad(ctx, hashToken(sessionToken))
+	if errors.Is(err, storage.ErrNoRecord) {
+		return Principal{}, "", ErrUnauthenticated
+	}
+	if err != nil {
+		return Principal{}, "", err
+	}
+	return Principal{UserName: session.UserName, Kind: PrincipalKindSession, Scopes: []string{ScopeAll}}, session.CSRFToken, nil
+}
+
+func (a *Auth) AuthenticateToken(ctx context.Context, token string) (Principal, error) {
+	apiToken, err := a.storage.APITokenLoadByHash(ctx, hashToken(token))
+	if errors.Is(err, storage.ErrNoRecord) {
+		return Principal{}, ErrUnauthenticated
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{
+		UserName: apiToken.UserName,
+		Kind:     PrincipalKindToken,
+		TokenID:  apiToken.ID,
+		Scopes:   apiToken.Scopes,
+	}, nil
+}
+
+// TokenCreate creates API token for user, returns token id and secret token value which isn't stored anywhere.
+func (a *Auth) TokenCreate(ctx context.Context, userName, name string, scopes []string) (string, string, error) {
+	if len(scopes) == 0 {
+		return "", "", fmt.Errorf("token scopes are empty")
+	}
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return "", "", fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+	if _, err := a.storage.UserLoad(ctx, userName); err != nil {
+		return "", "", fmt.Errorf("load user %q: %w", userName, err)
+	}
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", fmt.Errorf("generate token id: %w", err)
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	apiToken := storage.APIToken{
+		ID:        hex.EncodeToString(id),
+		TokenHash: hashToken(token),
+		UserName:  userName,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if err := a.storage.APITokenSave(ctx, apiToken); err != nil {
+		return "", "", err
+	}
+	return apiToken.ID, token, nil
+}
+
+func (a *Auth) TokensList(ctx context.Context, userName string) ([]storage.APIToken, error) {
+	return a.storage.APITokensList(ctx, userName)
+}
+
+func (a *Auth) TokenRevoke(ctx context.Context, id string) error {
+	return a.storage.APITokenDelete(ctx, id)
+}
+
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken is used to store tokens. Tokens have enough entropy, so plain hash is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
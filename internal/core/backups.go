@@ -0,0 +1,182 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+const (
+	backupFilePrefix     = "libreta-"
+	backupFileSuffix     = ".db"
+	backupFileTimeLayout = "20060102T150405Z"
+	backupRetryInterval  = 10 * time.Minute
+)
+
+// BackupsConfig configures scheduled backups. Retention keeps the latest backup of each of KeepDaily last days
+// and each of KeepWeekly last ISO weeks, other backups are removed.
+type BackupsConfig struct {
+	Dir        string
+	Interval   time.Duration
+	KeepDaily  int
+	KeepWeekly int
+}
+
+// Backups periodically writes database backups into directory.
+type Backups struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+	config  BackupsConfig
+}
+
+func NewBackups(logger *slog.Logger, storage *storage.Storage, config BackupsConfig) (*Backups, error) {
+	if logger == nil {
+		return nil, fmt.Errorf("logger is nil")
+	}
+	if storage == nil {
+		return nil, fmt.Errorf("storage is nil")
+	}
+	return &Backups{
+		logger:  logger,
+		storage: storage,
+		config:  config,
+	}, nil
+}
+
+// Run makes backup when the latest one is older than interval, until ctx is done.
+func (b *Backups) Run(ctx context.Context) error {
+	for {
+		wait := b.config.Interval
+		if last, err := b.lastBackupTime(); err != nil {
+			b.logger.ErrorContext(ctx, "list backups", slog.Any("error", err))
+			wait = backupRetryInterval
+		} else if since := time.Since(last); since < b.config.Interval {
+			wait = b.config.Interval - since
+		} else if _, err := b.Backup(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			b.logger.ErrorContext(ctx, "scheduled backup", slog.Any("error", err))
+			wait = backupRetryInterval
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Backup writes new backup and applies retention, returns backup file path.
+func (b *Backups) Backup(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(b.config.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("create backup dir: %w", err)
+	}
+	now := time.Now().UTC()
+	path := filepath.Join(b.config.Dir, backupFilePrefix+now.Format(backupFileTimeLayout)+backupFileSuffix)
+	start := time.Now()
+	if err := b.storage.Backup(ctx, path); err != nil {
+		return "", err
+	}
+	b.logger.InfoContext(ctx, "backup written", slog.String("path", path), slog.Duration("duration", time.Since(start)))
+	if err := b.prune(ctx); err != nil {
+		return path, fmt.Errorf("prune backups: %w", err)
+	}
+	return path, nil
+}
+
+func (b *Backups) lastBackupTime() (time.Time, error) {
+	backups, err := b.list()
+	if err != nil || len(backups) == 0 {
+		return time.Time{}, err
+	}
+	return backups[len(backups)-1].time, nil
+}
+
+type backupFile struct {
+	path string
+	time time.Time
+}
+
+// list returns backups sorted from oldest to newest.
+func (b *Backups) list() ([]backupFile, error) {
+	entries, err := os.ReadDir(b.config.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []backupFile
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasPrefix(name, backupFilePrefix) || !strings.HasSuffix(name, backupFileSuffix) {
+			continue
+		}
+		t, err := time.Parse(backupFileTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, backupFilePrefix), backupFileSuffix))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{path: filepath.Join(b.config.Dir, name), time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.Before(backups[j].time) })
+	return backups, nil
+}
+
+func (b *Backups) prune(ctx context.Context) error {
+	backups, err := b.list()
+	if err != nil {
+		return err
+	}
+	times := make([]time.Time, len(backups))
+	for i, backup := range backups {
+		times[i] = backup.time
+	}
+	keep := backupsToKeep(times, b.config.KeepDaily, b.config.KeepWeekly)
+	for i, backup := range backups {
+		if keep[i] {
+			continue
+		}
+		if err := os.Remove(backup.path); err != nil {
+			return err
+		}
+		b.logger.DebugContext(ctx, "backup removed", slog.String("path", backup.path))
+	}
+	return nil
+}
+
+// backupsToKeep returns indexes of backups to keep, times must be sorted from oldest to newest. The newest backup
+// is always kept.
+func backupsToKeep(times []time.Time, keepDaily, keepWeekly int) map[int]bool {
+	keep := make(map[int]bool)
+	if len(times) == 0 {
+		return keep
+	}
+	keep[len(times)-1] = true
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	for i := len(times) - 1; i >= 0; i-- {
+		t := times[i].UTC()
+		day := t.Format("2006-01-02")
+		if !days[day] && len(days) < keepDaily {
+			days[day] = true
+			keep[i] = true
+		}
+		year, week := t.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+		if !weeks[weekKey] && len(weeks) < keepWeekly {
+			weeks[weekKey] = true
+			keep[i] = true
+		}
+	}
+	return keep
+}
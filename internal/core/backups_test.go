@@ -0,0 +1,49 @@
+package core
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBackups(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	_, err := NewBackups(nil, testStorage(t), BackupsConfig{})
+	assert.Error(t, err)
+	_, err = NewBackups(logger, nil, BackupsConfig{})
+	assert.Error(t, err)
+	_, err = NewBackups(logger, testStorage(t), BackupsConfig{})
+	assert.NoError(t, err)
+}
+
+func TestBackupsToKeep(t *testing.T) {
+	base := time.Date(2024, 3, 4, 3, 0, 0, 0, time.UTC) // Monday
+	var times []time.Time
+	// Two backups a day for three weeks.
+	for day := 0; day < 21; day++ {
+		times = append(times, base.AddDate(0, 0, day), base.AddDate(0, 0, day).Add(12*time.Hour))
+	}
+
+	keep := backupsToKeep(times, 3, 2)
+	var kept []time.Time
+	for i, ok := range keep {
+		if ok {
+			kept = append(kept, times[i])
+		}
+	}
+	assert.ElementsMatch(t, []time.Time{
+		// Latest of the last three days, the latest of the current week is among them.
+		base.AddDate(0, 0, 20).Add(12 * time.Hour),
+		base.AddDate(0, 0, 19).Add(12 * time.Hour),
+		base.AddDate(0, 0, 18).Add(12 * time.Hour),
+		// Latest of the previous week (Sunday).
+		base.AddDate(0, 0, 13).Add(12 * time.Hour),
+	}, kept)
+
+	keep = backupsToKeep(times, 0, 0)
+	assert.Equal(t, map[int]bool{len(times) - 1: true}, keep)
+	assert.Empty(t, backupsToKeep(nil, 1, 1))
+}
@@ -0,0 +1,288 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+// Bookmark node attributes. Title is node name, node content is text/uri-list of bookmark URL and alternative
+// target URLs, so they are found by full text search.
+const (
+	BookmarkURLAttr         = "bookmark.url"
+	BookmarkDescriptionAttr = "bookmark.description"
+	BookmarkFaviconAttr     = "bookmark.favicon"
+	// BookmarkTargetAttr holds alternative target as JSON, one attribute value per target.
+	BookmarkTargetAttr = "bookmark.target"
+
+	bookmarkMimetype = "text/uri-list"
+)
+
+var ErrInvalidBookmark = errors.New("invalid bookmark")
+
+// Bookmark is node of kind "bookmark": URL with title, description and tags.
+type Bookmark struct {
+	ID          string
+	URL         string
+	Title       string
+	Description string
+	Favicon     string
+	Tags        []string
+	// Targets are alternative targets of the bookmark, e.g. copy in web archive.
+	Targets   []BookmarkTarget
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type BookmarkTarget struct {
+	// Label describes target, e.g. "archive" or "mirror".
+	Label string `json:"label"`
+	URL   string `json:"url"`
+}
+
+// BookmarkMetadata is page metadata extracted by BookmarkFetcher.
+type BookmarkMetadata struct {
+	// URL is final page URL after redirects.
+	URL         string
+	Title       string
+	Description string
+	Favicon     string
+}
+
+// BookmarkFetcher extracts metadata of page by URL.
+type BookmarkFetcher interface {
+	Fetch(ctx context.Context, url string) (BookmarkMetadata, error)
+}
+
+// Bookmarks creates and updates bookmark nodes. Metadata of bookmarked page fills empty bookmark fields when
+// fetcher is set.
+type Bookmarks struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+	fetcher BookmarkFetcher
+}
+
+// NewBookmarks creates bookmarks, fetcher may be nil to disable metadata fetching.
+func NewBookmarks(logger *slog.Logger, storage *storage.Storage, fetcher BookmarkFetcher) *Bookmarks {
+	return &Bookmarks{
+		logger:  logger,
+		storage: storage,
+		fetcher: fetcher,
+	}
+}
+
+// Create saves new bookmark, ID is generated unless given, CreatedAt is kept if set. If fetch is set, empty title,
+// description and favicon are filled from the page. Fetch failure is logged and doesn't prevent saving.
+func (b *Bookmarks) Create(ctx context.Context, bookmark Bookmark, fetch bool) (Bookmark, error) {
+	if err := validateBookmark(bookmark); err != nil {
+		return Bookmark{}, err
+	}
+	if bookmark.ID == "" {
+		id, err := b.storage.GenerateNodeID(ctx)
+		if err != nil {
+			return Bookmark{}, err
+		}
+		bookmark.ID = id
+	} else if nodes, err := b.storage.NodesLoad(ctx, []string{bookmark.ID}); err != nil {
+		return Bookmark{}, err
+	} else if _, ok := nodes[bookmark.ID]; ok {
+		return Bookmark{}, fmt.Errorf("%w: node %q already exists", ErrInvalidBookmark, bookmark.ID)
+	}
+	if fetch {
+		bookmark = b.fetch(ctx, bookmark)
+	}
+	if err := b.save(ctx, bookmark, nil); err != nil {
+		return Bookmark{}, err
+	}
+	return b.Load(ctx, bookmark.ID)
+}
+
+// Update replaces fields of existing bookmark, other node attributes are kept. If fetch is set, empty title,
+// description and favicon are filled from the page.
+func (b *Bookmarks) Update(ctx context.Context, bookmark Bookmark, fetch bool) (Bookmark, error) {
+	if err := validateBookmark(bookmark); err != nil {
+		return Bookmark{}, err
+	}
+	node, err := b.loadNode(ctx, bookmark.ID)
+	if err != nil {
+		return Bookmark{}, err
+	}
+	if fetch {
+		bookmark = b.fetch(ctx, bookmark)
+	}
+	var kept []storage.NodeAttribute
+	for _, attr := range node.Attributes {
+		if !isBookmarkAttr(attr.Key) {
+			kept = append(kept, attr)
+		}
+	}
+	if err := b.save(ctx, bookmark, kept); err != nil {
+		return Bookmark{}, err
+	}
+	return b.Load(ctx, bookmark.ID)
+}
+
+// Load returns bookmark by node ID.
+func (b *Bookmarks) Load(ctx context.Context, id string) (Bookmark, error) {
+	node, err := b.loadNode(ctx, id)
+	if err != nil {
+		return Bookmark{}, err
+	}
+	return bookmarkFromNode(node), nil
+}
+
+func (b *Bookmarks) loadNode(ctx context.Context, id string) (storage.Node, error) {
+	nodes, err := b.storage.NodesLoad(ctx, []string{id})
+	if err != nil {
+		return storage.Node{}, err
+	}
+	node, ok := nodes[id]
+	if !ok || node.IsDeleted() {
+		return storage.Node{}, fmt.Errorf("bookmark %q: %w", id, storage.ErrNoRecord)
+	}
+	if !IsBookmark(node) {
+		return storage.Node{}, fmt.Errorf("node %q is not a bookmark: %w", id, ErrInvalidBookmark)
+	}
+	return node, nil
+}
+
+// IsBookmark reports whether node is of bookmark kind.
+func IsBookmark(node storage.Node) bool {
+	for _, attr := range node.Attributes {
+		if attr.Key == storage.NodeAttrKind && attr.Value == storage.NodeAttrKindBookmark {
+			return true
+		}
+	}
+	return false
+}
+
+func isBookmarkAttr(key string) bool {
+	switch key {
+	case storage.NodeAttrKind, TagAttr, BookmarkURLAttr, BookmarkDescriptionAttr, BookmarkFaviconAttr, BookmarkTargetAttr:
+		return true
+	}
+	return false
+}
+
+func validateBookmark(bookmark Bookmark) error {
+	if err := validateBookmarkURL(bookmark.URL); err != nil {
+		return err
+	}
+	for _, target := range bookmark.Targets {
+		if err := validateBookmarkURL(target.URL); err != nil {
+			return fmt.Errorf("target %q: %w", target.Label, err)
+		}
+	}
+	return nil
+}
+
+func validateBookmarkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: URL %q must be absolute http or https URL", ErrInvalidBookmark, s)
+	}
+	return nil
+}
+
+// fetch fills empty fields of bookmark from page metadata.
+func (b *Bookmarks) fetch(ctx context.Context, bookmark Bookmark) Bookmark {
+	if b.fetcher == nil {
+		return bookmark
+	}
+	meta, err := b.fetcher.Fetch(ctx, bookmark.URL)
+	if err != nil {
+		b.logger.WarnContext(ctx, "fetch bookmark metadata", slog.String("url", bookmark.URL), slog.Any("error", err))
+		return bookmark
+	}
+	if bookmark.Title == "" {
+		bookmark.Title = meta.Title
+	}
+	if bookmark.Description == "" {
+		bookmark.Description = meta.Description
+	}
+	if bookmark.Favicon == "" {
+		bookmark.Favicon = meta.Favicon
+	}
+	return bookmark
+}
+
+func (b *Bookmarks) save(ctx context.Context, bookmark Bookmark, attrs []storage.NodeAttribute) error {
+	attrs = append(attrs,
+		storage.NodeAttribute{Key: storage.NodeAttrKind, Value: storage.NodeAttrKindBookmark},
+		storage.NodeAttribute{Key: BookmarkURLAttr, Value: bookmark.URL},
+	)
+	if bookmark.Description != "" {
+		attrs = append(attrs, storage.NodeAttribute{Key: BookmarkDescriptionAttr, Value: bookmark.Description})
+	}
+	if bookmark.Favicon != "" {
+		attrs = append(attrs, storage.NodeAttribute{Key: BookmarkFaviconAttr, Value: bookmark.Favicon})
+	}
+	for _, tag := range bookmark.Tags {
+		attrs = append(attrs, storage.NodeAttribute{Key: TagAttr, Value: tag})
+	}
+	content := new(bytes.Buffer)
+	content.WriteString(bookmark.URL + "\r\n")
+	for _, target := range bookmark.Targets {
+		data, err := json.Marshal(target)
+		if err != nil {
+			return fmt.Errorf("encode target: %w", err)
+		}
+		attrs = append(attrs, storage.NodeAttribute{Key: BookmarkTargetAttr, Value: string(data)})
+		content.WriteString(target.URL + "\r\n")
+	}
+	hash, err := b.storage.NodeContentSave(ctx, content)
+	if err != nil {
+		return err
+	}
+	return b.storage.NodeSave(ctx, storage.Node{
+		ID:              bookmark.ID,
+		Name:            bookmark.Title,
+		ContentHash:     hash,
+		ContentMimetype: bookmarkMimetype,
+		CreatedAt:       bookmark.CreatedAt,
+		Attributes:      attrs,
+	})
+}
+
+func bookmarkFromNode(node storage.Node) Bookmark {
+	bookmark := Bookmark{
+		ID:        node.ID,
+		Title:     node.Name,
+		CreatedAt: node.CreatedAt,
+		UpdatedAt: node.UpdatedAt,
+	}
+	// Attributes order isn't preserved by storage, targets are ordered by label.
+	for _, attr := range node.Attributes {
+		switch attr.Key {
+		case BookmarkURLAttr:
+			bookmark.URL = attr.Value
+		case BookmarkDescriptionAttr:
+			bookmark.Description = attr.Value
+		case BookmarkFaviconAttr:
+			bookmark.Favicon = attr.Value
+		case TagAttr:
+			bookmark.Tags = append(bookmark.Tags, attr.Value)
+		case BookmarkTargetAttr:
+			var target BookmarkTarget
+			if err := json.Unmarshal([]byte(attr.Value), &target); err == nil {
+				bookmark.Targets = append(bookmark.Targets, target)
+			}
+		}
+	}
+	sort.Strings(bookmark.Tags)
+	sort.Slice(bookmark.Targets, func(i, j int) bool {
+		if bookmark.Targets[i].Label != bookmark.Targets[j].Label {
+			return bookmark.Targets[i].Label < bookmark.Targets[j].Label
+		}
+		return bookmark.Targets[i].URL < bookmark.Targets[j].URL
+	})
+	return bookmark
+}
@@ -0,0 +1,220 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/brainmorsel/libreta/pkg/htmlscan"
+)
+
+const (
+	bookmarkFetchMaxSize   = 2 << 20
+	bookmarkFetchTimeout   = 30 * time.Second
+	bookmarkFetchUserAgent = "libreta"
+)
+
+// HTTPBookmarkFetcher fetches page over HTTP and extracts metadata from HTML: title, description and favicon,
+// falling back to Open Graph properties and "/favicon.ico".
+type HTTPBookmarkFetcher struct {
+	// Client defaults to http.DefaultClient.
+	Client    *http.Client
+	UserAgent string
+	// MaxSize limits size of read page, default is 2 MiB.
+	MaxSize int64
+}
+
+// NewHTTPBookmarkFetcher creates fetcher which can't connect to loopback, private and link-local addresses unless
+// allowPrivateNetworks is set.
+func NewHTTPBookmarkFetcher(allowPrivateNetworks bool) *HTTPBookmarkFetcher {
+	return &HTTPBookmarkFetcher{Client: newFetchClient(bookmarkFetchTimeout, allowPrivateNetworks)}
+}
+
+// ErrForbiddenAddress is returned when fetched URL resolves to loopback, private or link-local address.
+var ErrForbiddenAddress = errors.New("forbidden address")
+
+// newFetchClient creates HTTP client for fetching user given URLs. Unless allowPrivateNetworks is set, it refuses
+// to connect to addresses of the host itself and its networks, so bookmarks can't be used to reach internal
+// services. Address is checked when connection is made, after DNS resolution and on every redirect. Proxy from
+// environment isn't used then, since it would connect on our behalf.
+func newFetchClient(timeout time.Duration, allowPrivateNetworks bool) *http.Client {
+	if allowPrivateNetworks {
+		return &http.Client{Timeout: timeout}
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: publicAddressControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// forbiddenPrefixes lists IANA special-purpose address blocks and multicast. Besides private and host's own networks
+// they include shared address space of carrier-grade NAT, benchmarking networks and translation prefixes like NAT64
+// and 6to4, which embed IPv4 addresses of other blocks.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this" network
+	netip.MustParsePrefix("10.0.0.0/8"),      // private
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // link-local
+	netip.MustParsePrefix("172.16.0.0/12"),   // private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.31.196.0/24"), // AS112-v4
+	netip.MustParsePrefix("192.52.193.0/24"), // AMT
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("192.168.0.0/16"),  // private
+	netip.MustParsePrefix("192.175.48.0/24"), // direct delegation AS112
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved and limited broadcast
+	netip.MustParsePrefix("::/128"),          // unspecified
+	netip.MustParsePrefix("::1/128"),         // loopback
+	netip.MustParsePrefix("::ffff:0:0/96"),   // IPv4-mapped
+	netip.MustParsePrefix("64:ff9b::/96"),    // IPv4-IPv6 translation
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use IPv4-IPv6 translation
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments, including Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("3fff::/20"),       // documentation
+	netip.MustParsePrefix("5f00::/16"),       // segment routing SIDs
+	netip.MustParsePrefix("fc00::/7"),        // unique local
+	netip.MustParsePrefix("fe80::/10"),       // link-local
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+}
+
+// publicAddressControl is net.Dialer control hook which fails for addresses of forbiddenPrefixes.
+func publicAddressControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrForbiddenAddress, address)
+	}
+	addr := addrPort.Addr().Unmap().WithZone("")
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %s (%s)", ErrForbiddenAddress, addr, prefix)
+		}
+	}
+	return nil
+}
+
+func (f *HTTPBookmarkFetcher) Fetch(ctx context.Context, pageURL string) (BookmarkMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return BookmarkMetadata{}, err
+	}
+	userAgent := f.UserAgent
+	if userAgent == "" {
+		userAgent = bookmarkFetchUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return BookmarkMetadata{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return BookmarkMetadata{}, fmt.Errorf("unexpected response status %q", resp.Status)
+	}
+	base := resp.Request.URL
+	meta := BookmarkMetadata{
+		URL:     base.String(),
+		Favicon: base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String(),
+	}
+	if mimetype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mimetype != "text/html" &&
+		mimetype != "application/xhtml+xml" {
+		return meta, nil
+	}
+	maxSize := f.MaxSize
+	if maxSize <= 0 {
+		maxSize = bookmarkFetchMaxSize
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return BookmarkMetadata{}, fmt.Errorf("read page: %w", err)
+	}
+	parseHTMLMetadata(page, base, &meta)
+	return meta, nil
+}
+
+// parseHTMLMetadata fills metadata from HTML page, relative URLs are resolved against base URL or <base> tag.
+func parseHTMLMetadata(page []byte, base *url.URL, meta *BookmarkMetadata) {
+	tags := htmlscan.Tags(page)
+	var ogTitle, ogDescription, favicon string
+	for i, tag := range tags {
+		if tag.Closing {
+			if tag.Name == "head" {
+				break
+			}
+			continue
+		}
+		switch tag.Name {
+		case "base":
+			if href, ok := tag.Attr("href"); ok {
+				if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+					base = u
+				}
+			}
+		case "title":
+			if meta.Title == "" {
+				meta.Title = cleanText(htmlscan.Text(page, tags, i))
+			}
+		case "meta":
+			content, _ := tag.Attr("content")
+			name, _ := tag.Attr("name")
+			property, _ := tag.Attr("property")
+			switch {
+			case strings.EqualFold(name, "description"):
+				meta.Description = cleanText(content)
+			case strings.EqualFold(property, "og:title"):
+				ogTitle = cleanText(content)
+			case strings.EqualFold(property, "og:description"):
+				ogDescription = cleanText(content)
+			}
+		case "link":
+			rel, _ := tag.Attr("rel")
+			href, ok := tag.Attr("href")
+			if !ok || favicon != "" {
+				continue
+			}
+			for _, r := range strings.Fields(strings.ToLower(rel)) {
+				if r == "icon" {
+					favicon = strings.TrimSpace(href)
+				}
+			}
+		}
+	}
+	if meta.Title == "" {
+		meta.Title = ogTitle
+	}
+	if meta.Description == "" {
+		meta.Description = ogDescription
+	}
+	if favicon != "" {
+		if u, err := base.Parse(favicon); err == nil {
+			meta.Favicon = u.String()
+		}
+	}
+}
+
+// cleanText collapses whitespace of text extracted from HTML.
+func cleanText(s string) string {
+	return strings.Join(strings.Fields(strings.ToValidUTF8(s, "")), " ")
+}
@@ -0,0 +1,396 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/brainmorsel/libreta/pkg/htmlscan"
+)
+
+// BookmarkFolderAttr is attribute key of folder node created by bookmarks import, it holds slash separated path of
+// the folder, so the same folder is reused on repeated import. Slashes and backslashes in folder titles are escaped
+// with backslash.
+const BookmarkFolderAttr = "bookmark.folder"
+
+const bookmarkImportBatchSize = 500
+
+// BrowserBookmark is bookmark or folder of browser bookmarks export. Folder has no URL.
+type BrowserBookmark struct {
+	Title       string
+	URL         string
+	Description string
+	Tags        []string
+	AddedAt     time.Time
+	Children    []BrowserBookmark
+}
+
+// ParseBrowserBookmarks parses Firefox JSON backup or bookmarks HTML file in Netscape format, which is exported by
+// all major browsers.
+func ParseBrowserBookmarks(data []byte) ([]BrowserBookmark, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return ParseFirefoxBookmarks(data)
+	}
+	return ParseNetscapeBookmarks(data)
+}
+
+// ParseNetscapeBookmarks parses bookmarks HTML file in Netscape format: <DL> lists of <DT> items, where folder is
+// <H3> title followed by nested list and bookmark is <A> link optionally followed by <DD> description.
+func ParseNetscapeBookmarks(data []byte) ([]BrowserBookmark, error) {
+	tags := htmlscan.Tags(data)
+	for i, tag := range tags {
+		if tag.Name == "dl" && !tag.Closing {
+			items, _ := parseNetscapeList(data, tags, i+1)
+			return items, nil
+		}
+	}
+	return nil, errors.New("invalid bookmarks file: no bookmark list found")
+}
+
+// parseNetscapeList parses list items starting at tag i, returns them and index of tag after the end of list.
+func parseNetscapeList(data []byte, tags []htmlscan.Tag, i int) ([]BrowserBookmark, int) {
+	var items []BrowserBookmark
+	// folder is the last folder title, its list follows it.
+	var folder *BrowserBookmark
+	flush := func() {
+		if folder != nil {
+			items = append(items, *folder)
+			folder = nil
+		}
+	}
+	lastBookmark := -1
+	for i < len(tags) {
+		tag := tags[i]
+		switch {
+		case tag.Closing && tag.Name == "dl":
+			flush()
+			return items, i + 1
+		case tag.Closing:
+		case tag.Name == "dl":
+			children, next := parseNetscapeList(data, tags, i+1)
+			if folder != nil {
+				folder.Children = children
+				flush()
+			} else {
+				items = append(items, children...)
+			}
+			lastBookmark = -1
+			i = next
+			continue
+		case tag.Name == "h3":
+			flush()
+			addDate, _ := tag.Attr("add_date")
+			folder = &BrowserBookmark{Title: cleanText(htmlscan.Text(data, tags, i)), AddedAt: parseBookmarkTime(addDate)}
+			lastBookmark = -1
+		case tag.Name == "a":
+			flush()
+			href, _ := tag.Attr("href")
+			addDate, _ := tag.Attr("add_date")
+			tagList, _ := tag.Attr("tags")
+			items = append(items, BrowserBookmark{
+				Title:   cleanText(htmlscan.Text(data, tags, i)),
+				URL:     strings.TrimSpace(href),
+				Tags:    splitBookmarkTags(tagList),
+				AddedAt: parseBookmarkTime(addDate),
+			})
+			lastBookmark = len(items) - 1
+		case tag.Name == "dd":
+			if lastBookmark >= 0 && items[lastBookmark].Description == "" {
+				items[lastBookmark].Description = cleanText(htmlscan.Text(data, tags, i))
+			}
+			lastBookmark = -1
+		}
+		i++
+	}
+	flush()
+	return items, i
+}
+
+// firefoxBookmark is item of Firefox JSON bookmarks backup.
+type firefoxBookmark struct {
+	Title string `json:"title"`
+	Type  string `json:"type"`
+	URI   string `json:"uri"`
+	// Root names built-in folders.
+	Root string `json:"root"`
+	// DateAdded is time in microseconds.
+	DateAdded int64             `json:"dateAdded"`
+	Tags      string            `json:"tags"`
+	Children  []firefoxBookmark `json:"children"`
+}
+
+const (
+	firefoxContainerType = "text/x-moz-place-container"
+	firefoxPlaceType     = "text/x-moz-place"
+)
+
+// firefoxRootTitles are titles of built-in folders, which have internal names in backup.
+var firefoxRootTitles = map[string]string{
+	"bookmarksMenuFolder":    "Bookmarks Menu",
+	"toolbarFolder":          "Bookmarks Toolbar",
+	"unfiledBookmarksFolder": "Other Bookmarks",
+	"mobileFolder":           "Mobile Bookmarks",
+}
+
+// ParseFirefoxBookmarks parses Firefox JSON bookmarks backup. Items of the root folder are returned.
+func ParseFirefoxBookmarks(data []byte) ([]BrowserBookmark, error) {
+	var root firefoxBookmark
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid bookmarks file: %w", err)
+	}
+	if root.Type != firefoxContainerType {
+		return nil, fmt.Errorf("invalid bookmarks file: unexpected root type %q", root.Type)
+	}
+	return firefoxBookmarks(root.Children), nil
+}
+
+func firefoxBookmarks(items []firefoxBookmark) []BrowserBookmark {
+	var bookmarks []BrowserBookmark
+	for _, item := range items {
+		bookmark := BrowserBookmark{
+			Title: item.Title,
+			URL:   item.URI,
+			Tags:  splitBookmarkTags(item.Tags),
+		}
+		if item.DateAdded > 0 {
+			bookmark.AddedAt = time.UnixMicro(item.DateAdded)
+		}
+		switch item.Type {
+		case firefoxContainerType:
+			if title, ok := firefoxRootTitles[item.Root]; ok {
+				bookmark.Title = title
+			}
+			bookmark.Children = firefoxBookmarks(item.Children)
+		case firefoxPlaceType:
+		default:
+			// Separators aren't imported.
+			continue
+		}
+		bookmarks = append(bookmarks, bookmark)
+	}
+	return bookmarks
+}
+
+// parseBookmarkTime parses Unix time of bookmarks HTML file, which is in seconds, but some browsers write it in
+// milliseconds or microseconds.
+func parseBookmarkTime(s string) time.Time {
+	t, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	switch {
+	case err != nil || t <= 0:
+		return time.Time{}
+	case t > 1e14:
+		return time.UnixMicro(t)
+	case t > 1e11:
+		return time.UnixMilli(t)
+	}
+	return time.Unix(t, 0)
+}
+
+func splitBookmarkTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// BookmarkImportResult counts imported bookmarks and folders. Duplicates are bookmarks with URL of existing bookmark,
+// skipped are bookmarks with unsupported URL (e.g. "javascript:" or "place:").
+type BookmarkImportResult struct {
+	Created    int
+	Duplicates int
+	Skipped    int
+	Folders    int
+}
+
+// BookmarkImporter imports browser bookmarks. Bookmarks become bookmark nodes keeping time they were added, folders
+// become nodes with child edges to their items. Bookmarks are de-duplicated by URL against existing nodes, including
+// deleted ones, and folders are found by path, so repeated import adds only new bookmarks. Duplicates are still linked
+// to their folders unless deleted.
+type BookmarkImporter struct {
+	logger    *slog.Logger
+	storage   *storage.Storage
+	bookmarks *Bookmarks
+}
+
+func NewBookmarkImporter(logger *slog.Logger, storage *storage.Storage) *BookmarkImporter {
+	return &BookmarkImporter{
+		logger:    logger,
+		storage:   storage,
+		bookmarks: NewBookmarks(logger, storage, nil),
+	}
+}
+
+type bookmarkImport struct {
+	*BookmarkImporter
+	result  BookmarkImportResult
+	urls    map[string]string // bookmark URL -> node ID
+	folders map[string]string // folder path -> node ID
+	edges   []storage.Edge
+}
+
+// Import imports bookmarks and folders.
+func (im *BookmarkImporter) Import(ctx context.Context, items []BrowserBookmark) (BookmarkImportResult, error) {
+	urls, err := im.storage.QueryAttributeIndex(ctx, BookmarkURLAttr)
+	if err != nil {
+		return BookmarkImportResult{}, err
+	}
+	folders, err := im.storage.QueryAttributeIndex(ctx, BookmarkFolderAttr)
+	if err != nil {
+		return BookmarkImportResult{}, err
+	}
+	imp := &bookmarkImport{
+		BookmarkImporter: im,
+		urls:             urls,
+		folders:          folders,
+	}
+	if err := imp.importItems(ctx, items, "", ""); err != nil {
+		return imp.result, err
+	}
+	sort.Slice(imp.edges, func(i, j int) bool {
+		if imp.edges[i].SrcID != imp.edges[j].SrcID {
+			return imp.edges[i].SrcID < imp.edges[j].SrcID
+		}
+		return imp.edges[i].DstID < imp.edges[j].DstID
+	})
+	for edges := imp.edges; len(edges) > 0; {
+		n := min(len(edges), bookmarkImportBatchSize)
+		batch, err := imp.liveEdges(ctx, edges[:n])
+		if err != nil {
+			return imp.result, err
+		}
+		if len(batch) > 0 {
+			if err := im.storage.EdgesAdd(ctx, batch); err != nil {
+				return imp.result, err
+			}
+		}
+		edges = edges[n:]
+	}
+	return imp.result, nil
+}
+
+// liveEdges returns edges to nodes that aren't deleted, duplicates may refer to deleted bookmarks.
+func (imp *bookmarkImport) liveEdges(ctx context.Context, edges []storage.Edge) ([]storage.Edge, error) {
+	ids := make([]string, 0, len(edges))
+	for _, edge := range edges {
+		ids = append(ids, edge.DstID)
+	}
+	nodes, err := imp.storage.NodesLoad(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	live := edges[:0:0]
+	for _, edge := range edges {
+		if node, ok := nodes[edge.DstID]; ok && !node.IsDeleted() {
+			live = append(live, edge)
+		}
+	}
+	return live, nil
+}
+
+// bookmarkFolderPath returns path of folder with title in folder at path.
+func bookmarkFolderPath(path, title string) string {
+	title = bookmarkFolderPathEscaper.Replace(title)
+	if path == "" {
+		return title
+	}
+	return path + "/" + title
+}
+
+var bookmarkFolderPathEscaper = strings.NewReplacer(`\`, `\\`, "/", `\/`)
+
+// importItems imports items of folder at path, parentID is ID of the folder node, it is empty for top level items
+// and for items of deleted folder.
+func (imp *bookmarkImport) importItems(ctx context.Context, items []BrowserBookmark, path, parentID string) error {
+	for _, item := range items {
+		var id string
+		if item.URL == "" {
+			itemPath := bookmarkFolderPath(path, item.Title)
+			var err error
+			if id, err = imp.folder(ctx, item, itemPath); err != nil {
+				return fmt.Errorf("import folder %q: %w", itemPath, err)
+			}
+			if err := imp.importItems(ctx, item.Children, itemPath, id); err != nil {
+				return err
+			}
+		} else {
+			if existing, ok := imp.urls[item.URL]; ok {
+				imp.result.Duplicates++
+				if parentID != "" {
+					imp.edges = append(imp.edges, storage.Edge{SrcID: parentID, DstID: existing, Relation: storage.EdgeRelChild})
+				}
+				continue
+			}
+			bookmark, err := imp.bookmarks.Create(ctx, Bookmark{
+				URL:         item.URL,
+				Title:       item.Title,
+				Description: item.Description,
+				Tags:        item.Tags,
+				CreatedAt:   item.AddedAt,
+			}, false)
+			if errors.Is(err, ErrInvalidBookmark) {
+				imp.logger.DebugContext(ctx, "skip bookmark", slog.String("url", item.URL), slog.Any("error", err))
+				imp.result.Skipped++
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("import bookmark %q: %w", item.URL, err)
+			}
+			id = bookmark.ID
+			imp.urls[item.URL] = id
+			imp.result.Created++
+		}
+		if parentID != "" && id != "" {
+			imp.edges = append(imp.edges, storage.Edge{SrcID: parentID, DstID: id, Relation: storage.EdgeRelChild})
+		}
+	}
+	return nil
+}
+
+// folder returns ID of folder node at path, creating it if needed. Empty ID is returned for deleted folder.
+func (imp *bookmarkImport) folder(ctx context.Context, item BrowserBookmark, path string) (string, error) {
+	if id, ok := imp.folders[path]; ok {
+		nodes, err := imp.storage.NodesLoad(ctx, []string{id})
+		if err != nil {
+			return "", err
+		}
+		if node, ok := nodes[id]; ok {
+			if node.IsDeleted() {
+				return "", nil
+			}
+			return id, nil
+		}
+	}
+	hash, err := imp.storage.NodeContentSave(ctx, bytes.NewReader(nil))
+	if err != nil {
+		return "", err
+	}
+	id, err := imp.storage.GenerateNodeID(ctx)
+	if err != nil {
+		return "", err
+	}
+	err = imp.storage.NodeSave(ctx, storage.Node{
+		ID:              id,
+		Name:            item.Title,
+		ContentHash:     hash,
+		ContentMimetype: markdownMimetype,
+		CreatedAt:       item.AddedAt,
+		Attributes:      []storage.NodeAttribute{{Key: BookmarkFolderAttr, Value: path}},
+	})
+	if err != nil {
+		return "", err
+	}
+	imp.folders[path] = id
+	imp.result.Folders++
+	return id, nil
+}
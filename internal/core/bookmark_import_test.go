@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testNetscapeBookmarks = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file. -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1600000000" PERSONAL_TOOLBAR_FOLDER="true">Bookmarks bar</H3>
+    <DL><p>
+        <DT><A HREF="https://go.dev/" ADD_DATE="1600000100" ICON="data:image/png;base64,AA==" TAGS="go,dev">The Go
+            Programming Language</A>
+        <DD>Go &amp; more
+        <DT><H3 ADD_DATE="1600000200">Empty</H3>
+        <DL><p>
+        </DL><p>
+        <DT><A HREF="javascript:alert(1)">Bookmarklet</A>
+    </DL><p>
+    <DT><A HREF="https://example.com/" ADD_DATE="1600000300000">Example</A>
+</DL><p>
+`
+
+const testFirefoxBookmarks = `{"guid":"root________","title":"","index":0,"dateAdded":1600000000000000,
+"typeCode":2,"type":"text/x-moz-place-container","root":"placesRoot","children":[
+  {"guid":"menu________","title":"menu","dateAdded":1600000000000000,"type":"text/x-moz-place-container",
+   "root":"bookmarksMenuFolder","children":[
+    {"title":"Go","type":"text/x-moz-place","uri":"https://go.dev/","dateAdded":1600000100000000,"tags":"go, lang"},
+    {"type":"text/x-moz-place-separator"},
+    {"title":"Docs","type":"text/x-moz-place-container","dateAdded":1600000200000000,"children":[
+      {"title":"Recent","type":"text/x-moz-place","uri":"place:sort=8&maxResults=10"},
+      {"title":"SQLite","type":"text/x-moz-place","uri":"https://sqlite.org/"}
+    ]}
+  ]}
+]}`
+
+func TestParseBrowserBookmarks(t *testing.T) {
+	items, err := ParseBrowserBookmarks([]byte(testNetscapeBookmarks))
+	require.NoError(t, err)
+	assert.Equal(t, []BrowserBookmark{
+		{Title: "Bookmarks bar", AddedAt: time.Unix(1600000000, 0), Children: []BrowserBookmark{
+			{
+				Title:       "The Go Programming Language",
+				URL:         "https://go.dev/",
+				Description: "Go & more",
+				Tags:        []string{"go", "dev"},
+				AddedAt:     time.Unix(1600000100, 0),
+			},
+			{Title: "Empty", AddedAt: time.Unix(1600000200, 0)},
+			{Title: "Bookmarklet", URL: "javascript:alert(1)"},
+		}},
+		{Title: "Example", URL: "https://example.com/", AddedAt: time.UnixMilli(1600000300000)},
+	}, items)
+
+	items, err = ParseBrowserBookmarks([]byte(testFirefoxBookmarks))
+	require.NoError(t, err)
+	assert.Equal(t, []BrowserBookmark{
+		{Title: "Bookmarks Menu", AddedAt: time.Unix(1600000000, 0), Children: []BrowserBookmark{
+			{Title: "Go", URL: "https://go.dev/", Tags: []string{"go", "lang"}, AddedAt: time.Unix(1600000100, 0)},
+			{Title: "Docs", AddedAt: time.Unix(1600000200, 0), Children: []BrowserBookmark{
+				{Title: "Recent", URL: "place:sort=8&maxResults=10"},
+				{Title: "SQLite", URL: "https://sqlite.org/"},
+			}},
+		}},
+	}, items)
+
+	_, err = ParseBrowserBookmarks([]byte("<html></html>"))
+	assert.Error(t, err)
+	_, err = ParseBrowserBookmarks([]byte(`{"type":"text/x-moz-place"}`))
+	assert.Error(t, err)
+}
+
+func TestBookmarkImporter(t *testing.T) {
+	ctx := context.Background()
+	s := testStorage(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	im := NewBookmarkImporter(logger, s)
+
+	items, err := ParseNetscapeBookmarks([]byte(testNetscapeBookmarks))
+	require.NoError(t, err)
+	result, err := im.Import(ctx, items)
+	require.NoError(t, err)
+	assert.Equal(t, BookmarkImportResult{Created: 2, Skipped: 1, Folders: 2}, result)
+
+	folders, err := s.QueryAttributeIndex(ctx, BookmarkFolderAttr)
+	require.NoError(t, err)
+	urls, err := s.QueryAttributeIndex(ctx, BookmarkURLAttr)
+	require.NoError(t, err)
+	bar := folders["Bookmarks bar"]
+	require.NotEmpty(t, bar)
+	require.NotEmpty(t, folders["Bookmarks bar/Empty"])
+	ids, err := s.QueryWalk(ctx, bar, storage.EdgeRelChild)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{urls["https://go.dev/"], folders["Bookmarks bar/Empty"]}, ids)
+
+	bookmark, err := NewBookmarks(logger, s, nil).Load(ctx, urls["https://go.dev/"])
+	require.NoError(t, err)
+	assert.Equal(t, "The Go Programming Language", bookmark.Title)
+	assert.Equal(t, "Go & more", bookmark.Description)
+	assert.Equal(t, []string{"dev", "go"}, bookmark.Tags)
+	assert.True(t, bookmark.CreatedAt.Equal(time.Unix(1600000100, 0)))
+
+	// Repeated import and import from other browser add only new bookmarks.
+	result, err = im.Import(ctx, items)
+	require.NoError(t, err)
+	assert.Equal(t, BookmarkImportResult{Duplicates: 2, Skipped: 1}, result)
+	items, err = ParseFirefoxBookmarks([]byte(testFirefoxBookmarks))
+	require.NoError(t, err)
+	result, err = im.Import(ctx, items)
+	require.NoError(t, err)
+	assert.Equal(t, BookmarkImportResult{Created: 1, Duplicates: 1, Skipped: 1, Folders: 2}, result)
+	folders, err = s.QueryAttributeIndex(ctx, BookmarkFolderAttr)
+	require.NoError(t, err)
+	urls, err = s.QueryAttributeIndex(ctx, BookmarkURLAttr)
+	require.NoError(t, err)
+	// Duplicate is linked to folder of other browser too.
+	ids, err = s.QueryWalk(ctx, folders["Bookmarks Menu"], storage.EdgeRelChild)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{urls["https://go.dev/"], folders["Bookmarks Menu/Docs"], urls["https://sqlite.org/"]}, ids)
+
+	t.Run("folder_path", func(t *testing.T) {
+		s := testStorage(t)
+		im := NewBookmarkImporter(logger, s)
+		result, err := im.Import(ctx, []BrowserBookmark{
+			{Title: "a/b", Children: []BrowserBookmark{{Title: "One", URL: "https://one.example/"}}},
+			{Title: "a", Children: []BrowserBookmark{
+				{Title: "b", Children: []BrowserBookmark{{Title: "Two", URL: "https://two.example/"}}},
+				{Title: `c\`, Children: []BrowserBookmark{{Title: "One", URL: "https://one.example/"}}},
+			}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, BookmarkImportResult{Created: 2, Duplicates: 1, Folders: 4}, result)
+		folders, err := s.QueryAttributeIndex(ctx, BookmarkFolderAttr)
+		require.NoError(t, err)
+		assert.Len(t, folders, 4)
+		urls, err := s.QueryAttributeIndex(ctx, BookmarkURLAttr)
+		require.NoError(t, err)
+		for path, url := range map[string]string{
+			`a\/b`:  "https://one.example/",
+			"a/b":   "https://two.example/",
+			`a/c\\`: "https://one.example/",
+		} {
+			ids, err := s.QueryWalk(ctx, folders[path], storage.EdgeRelChild)
+			require.NoError(t, err)
+			assert.Equal(t, []string{urls[url]}, ids, path)
+		}
+	})
+
+	t.Run("deleted_duplicate", func(t *testing.T) {
+		s := testStorage(t)
+		im := NewBookmarkImporter(logger, s)
+		items := []BrowserBookmark{{Title: "Folder", Children: []BrowserBookmark{{Title: "Go", URL: "https://go.dev/"}}}}
+		_, err := im.Import(ctx, items[0].Children)
+		require.NoError(t, err)
+		urls, err := s.QueryAttributeIndex(ctx, BookmarkURLAttr)
+		require.NoError(t, err)
+		require.NoError(t, s.NodesDelete(ctx, []string{urls["https://go.dev/"]}))
+
+		result, err := im.Import(ctx, items)
+		require.NoError(t, err)
+		assert.Equal(t, BookmarkImportResult{Duplicates: 1, Folders: 1}, result)
+		folders, err := s.QueryAttributeIndex(ctx, BookmarkFolderAttr)
+		require.NoError(t, err)
+		ids, err := s.QueryWalk(ctx, folders["Folder"], storage.EdgeRelChild)
+		require.NoError(t, err)
+		assert.Empty(t, ids)
+	})
+}
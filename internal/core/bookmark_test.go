@@ -0,0 +1,214 @@
+package core
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPageServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, `<!DOCTYPE html><html><head>
+<title>
+  Page &amp; title
+</title>
+<meta name="description" content="Page description">
+<meta property="og:title" content="OG title">
+<link rel="stylesheet" href="style.css">
+<link rel="shortcut icon" href="/static/icon.png">
+</head><body><img src="img.png"></body></html>`)
+	})
+	mux.HandleFunc("/og", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<head><base href="/sub/"><meta property="og:title" content="OG title">`+
+			`<meta property="og:description" content="OG description"><link rel=icon href=fav.svg></head>`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	mux.HandleFunc("/file.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(w, "%PDF")
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPBookmarkFetcher(t *testing.T) {
+	ctx := context.Background()
+	srv := testPageServer(t)
+	f := &HTTPBookmarkFetcher{Client: srv.Client()}
+
+	meta, err := f.Fetch(ctx, srv.URL+"/redirect")
+	require.NoError(t, err)
+	assert.Equal(t, BookmarkMetadata{
+		URL:         srv.URL + "/page",
+		Title:       "Page & title",
+		Description: "Page description",
+		Favicon:     srv.URL + "/static/icon.png",
+	}, meta)
+
+	meta, err = f.Fetch(ctx, srv.URL+"/og")
+	require.NoError(t, err)
+	assert.Equal(t, BookmarkMetadata{
+		URL:         srv.URL + "/og",
+		Title:       "OG title",
+		Description: "OG description",
+		Favicon:     srv.URL + "/sub/fav.svg",
+	}, meta)
+
+	meta, err = f.Fetch(ctx, srv.URL+"/file.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, BookmarkMetadata{URL: srv.URL + "/file.pdf", Favicon: srv.URL + "/favicon.ico"}, meta)
+
+	_, err = f.Fetch(ctx, srv.URL+"/missing")
+	assert.Error(t, err)
+}
+
+func TestHTTPBookmarkFetcherPrivateNetworks(t *testing.T) {
+	ctx := context.Background()
+	srv := testPageServer(t)
+
+	_, err := NewHTTPBookmarkFetcher(false).Fetch(ctx, srv.URL+"/page")
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+	meta, err := NewHTTPBookmarkFetcher(true).Fetch(ctx, srv.URL+"/page")
+	require.NoError(t, err)
+	assert.Equal(t, "Page & title", meta.Title)
+
+}
+
+func TestPublicAddressControl(t *testing.T) {
+	tests := []struct {
+		address   string
+		forbidden bool
+	}{
+		{"0.0.0.0:80", true},
+		{"10.1.2.3:80", true},
+		{"100.64.0.1:80", true},
+		{"100.127.255.254:80", true},
+		{"127.0.0.1:80", true},
+		{"169.254.169.254:80", true},
+		{"172.16.0.1:80", true},
+		{"172.31.255.255:80", true},
+		{"192.0.0.8:80", true},
+		{"192.0.2.1:80", true},
+		{"192.31.196.1:80", true},
+		{"192.52.193.1:80", true},
+		{"192.88.99.1:80", true},
+		{"192.168.0.1:80", true},
+		{"192.175.48.1:80", true},
+		{"198.18.0.1:80", true},
+		{"198.19.255.255:80", true},
+		{"198.51.100.1:80", true},
+		{"203.0.113.1:80", true},
+		{"224.0.0.1:80", true},
+		{"240.0.0.1:80", true},
+		{"255.255.255.255:80", true},
+		{"[::]:80", true},
+		{"[::1]:80", true},
+		{"[::ffff:127.0.0.1]:80", true},
+		{"[::ffff:10.0.0.1]:80", true},
+		{"[64:ff9b::7f00:1]:80", true},
+		{"[64:ff9b:1::a00:1]:80", true},
+		{"[100::1]:80", true},
+		{"[2001::1]:80", true},
+		{"[2001:db8::1]:80", true},
+		{"[2002:7f00:1::1]:80", true},
+		{"[3fff::1]:80", true},
+		{"[5f00::1]:80", true},
+		{"[fd00::1]:80", true},
+		{"[fe80::1%eth0]:80", true},
+		{"[ff02::1]:80", true},
+		{"invalid", true},
+		{"93.184.216.34:443", false},
+		{"100.63.255.255:443", false},
+		{"100.128.0.1:443", false},
+		{"172.32.0.1:443", false},
+		{"198.20.0.1:443", false},
+		{"[::ffff:93.184.216.34]:443", false},
+		{"[2606:2800:220:1::]:443", false},
+		{"[2001:200::1]:443", false},
+	}
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			err := publicAddressControl("tcp", test.address, nil)
+			if test.forbidden {
+				assert.ErrorIs(t, err, ErrForbiddenAddress)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	ctx := context.Background()
+	s := testStorage(t)
+	srv := testPageServer(t)
+	b := NewBookmarks(slog.New(slog.NewTextHandler(io.Discard, nil)), s, &HTTPBookmarkFetcher{Client: srv.Client()})
+
+	created, err := b.Create(ctx, Bookmark{
+		URL:     srv.URL + "/page",
+		Title:   "My title",
+		Tags:    []string{"web", "dev"},
+		Targets: []BookmarkTarget{{Label: "archive", URL: "https://web.archive.org/web/" + srv.URL + "/page"}},
+	}, true)
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "My title", created.Title)
+	assert.Equal(t, "Page description", created.Description)
+	assert.Equal(t, srv.URL+"/static/icon.png", created.Favicon)
+	assert.Equal(t, []string{"dev", "web"}, created.Tags)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	nodes, err := s.NodesLoad(ctx, []string{created.ID})
+	require.NoError(t, err)
+	assert.True(t, IsBookmark(nodes[created.ID]))
+	assert.Equal(t, bookmarkMimetype, nodes[created.ID].ContentMimetype)
+	ids, err := s.QueryFullTextSearch(ctx, `"web.archive.org"`, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{created.ID}, ids)
+
+	// Other attributes are kept on update.
+	node := nodes[created.ID]
+	node.Attributes = append(node.Attributes, storage.NodeAttribute{Key: "color", Value: "red"})
+	require.NoError(t, s.NodeSave(ctx, node))
+	updated, err := b.Update(ctx, Bookmark{ID: created.ID, URL: srv.URL + "/og"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, Bookmark{
+		ID:        created.ID,
+		URL:       srv.URL + "/og",
+		CreatedAt: created.CreatedAt,
+		UpdatedAt: updated.UpdatedAt,
+	}, updated)
+	nodes, err = s.NodesLoad(ctx, []string{created.ID})
+	require.NoError(t, err)
+	assert.Contains(t, clearAttrTimes(nodes[created.ID].Attributes), storage.NodeAttribute{Key: "color", Value: "red"})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := b.Create(ctx, Bookmark{URL: "ftp://example.com"}, false)
+		assert.ErrorIs(t, err, ErrInvalidBookmark)
+		_, err = b.Create(ctx, Bookmark{URL: "https://example.com", Targets: []BookmarkTarget{{URL: "/rel"}}}, false)
+		assert.ErrorIs(t, err, ErrInvalidBookmark)
+		_, err = b.Create(ctx, Bookmark{ID: created.ID, URL: "https://example.com"}, false)
+		assert.ErrorIs(t, err, ErrInvalidBookmark)
+		_, err = b.Update(ctx, Bookmark{ID: "missing", URL: "https://example.com"}, false)
+		assert.ErrorIs(t, err, storage.ErrNoRecord)
+
+		// Fetch failure doesn't prevent saving.
+		bookmark, err := b.Create(ctx, Bookmark{URL: srv.URL + "/missing"}, true)
+		require.NoError(t, err)
+		assert.Empty(t, bookmark.Title)
+	})
+}
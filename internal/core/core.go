@@ -1,7 +1,10 @@
 package core
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"sync"
 
 	"github.com/brainmorsel/libreta/internal/storage"
 )
@@ -9,11 +12,46 @@ import (
 type Core struct {
 	logger  *slog.Logger
 	storage *storage.Storage
+
+	Events *Events
+	Auth   *Auth
+	Feeds  *Feeds
+	// Backups is set when scheduled backups are enabled.
+	Backups *Backups
+	// Sync is set when multi-device sync is enabled.
+	Sync *Sync
 }
 
 func NewCore(logger *slog.Logger, storage *storage.Storage) *Core {
 	return &Core{
 		logger:  logger,
 		storage: storage,
+		Events:  NewEvents(logger, storage),
+		Auth:    NewAuth(logger, storage),
+		Feeds:   NewFeeds(logger, storage),
+	}
+}
+
+// Run runs background workers until ctx is done and waits for all of them to stop.
+func (c *Core) Run(ctx context.Context) error {
+	workers := []func(context.Context) error{
+		c.Events.Run,
+	}
+	if c.Backups != nil {
+		workers = append(workers, c.Backups.Run)
+	}
+	if c.Sync != nil {
+		workers = append(workers, c.Sync.Run)
+	}
+	errs := make([]error, len(workers))
+	var wg sync.WaitGroup
+	for i, run := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = run(ctx)
+		}()
 	}
+	wg.Wait()
+	return errors.Join(errs...)
 }
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+const (
+	eventsPollInterval  = 2 * time.Second
+	eventsBatchSize     = 500
+	eventsSubscriberBuf = 256
+)
+
+// Event is a change notification, Type is "<entity>.<op>", e.g. "node.save" or "edge.remove".
+type Event struct {
+	Seq       int64             `json:"seq"`
+	Type      string            `json:"type"`
+	NodeID    string            `json:"node_id,omitempty"`
+	Data      map[string]string `json:"data,omitempty"`
+	Device    string            `json:"device,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+func eventFromChange(change storage.Change) Event {
+	return Event{
+		Seq:       change.Seq,
+		Type:      change.Entity + "." + change.Op,
+		NodeID:    change.NodeID,
+		Data:      change.Data,
+		Device:    change.Device,
+		CreatedAt: change.CreatedAt,
+	}
+}
+
+// Events reads storage change log and broadcasts events to subscribers. Changes made by this process are picked up
+// immediately, others (e.g. by CLI commands) with poll interval.
+type Events struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+
+	mu      sync.Mutex
+	lastSeq int64
+	subs    map[*Subscription]struct{}
+}
+
+func NewEvents(logger *slog.Logger, storage *storage.Storage) *Events {
+	return &Events{
+		logger:  logger,
+		storage: storage,
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives events published after subscribing. C is closed if subscriber can't keep up with events
+// or on Unsubscribe.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	events *Events
+}
+
+func (e *Events) Subscribe() *Subscription {
+	c := make(chan Event, eventsSubscriberBuf)
+	sub := &Subscription{C: c, c: c, events: e}
+	e.mu.Lock()
+	e.subs[sub] = struct{}{}
+	e.mu.Unlock()
+	return sub
+}
+
+func (sub *Subscription) Unsubscribe() {
+	sub.events.mu.Lock()
+	defer sub.events.mu.Unlock()
+	if _, ok := sub.events.subs[sub]; ok {
+		delete(sub.events.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Since returns up to limit events with sequence number greater than seq from persisted change log.
+func (e *Events) Since(ctx context.Context, seq int64, limit int) ([]Event, error) {
+	changes, err := e.storage.ChangesAfter(ctx, seq, limit)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(changes))
+	for _, change := range changes {
+		events = append(events, eventFromChange(change))
+	}
+	return events, nil
+}
+
+// Run publishes events until ctx is done.
+func (e *Events) Run(ctx context.Context) error {
+	lastSeq, err := e.storage.LastChangeSeq(ctx)
+	if err != nil {
+		return fmt.Errorf("get last change seq: %w", err)
+	}
+	e.mu.Lock()
+	e.lastSeq = lastSeq
+	e.mu.Unlock()
+
+	ticker := time.NewTicker(eventsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			e.closeSubscriptions()
+			return nil
+		case <-e.storage.ChangeNotify():
+		case <-ticker.C:
+		}
+		if err := e.publish(ctx); err != nil && ctx.Err() == nil {
+			e.logger.ErrorContext(ctx, "publish events", slog.Any("error", err))
+		}
+	}
+}
+
+func (e *Events) publish(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		lastSeq := e.lastSeq
+		e.mu.Unlock()
+
+		events, err := e.Since(ctx, lastSeq, eventsBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		e.mu.Lock()
+		for _, event := range events {
+			for sub := range e.subs {
+				select {
+				case sub.c <- event:
+				default:
+					e.logger.WarnContext(ctx, "drop slow events subscriber")
+					delete(e.subs, sub)
+					close(sub.c)
+				}
+			}
+		}
+		e.lastSeq = events[len(events)-1].Seq
+		e.mu.Unlock()
+	}
+}
+
+func (e *Events) closeSubscriptions() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for sub := range e.subs {
+		delete(e.subs, sub)
+		close(sub.c)
+	}
+}
@@ -0,0 +1,360 @@
+package core
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+const (
+	AtomMimetype = "application/atom+xml"
+	RSSMimetype  = "application/rss+xml"
+
+	// feedLimit is number of the latest nodes in feed.
+	feedLimit     = 50
+	feedBatchSize = 500
+)
+
+// Feed is syndication feed of nodes.
+type Feed struct {
+	ID    string
+	Title string
+	// Author defaults to the title, Atom requires feed author.
+	Author  string
+	Link    string
+	Updated time.Time
+	Entries []FeedEntry
+}
+
+type FeedEntry struct {
+	ID         string
+	Title      string
+	Link       string
+	Published  time.Time
+	Updated    time.Time
+	Tags       []string
+	HTML       string
+	Enclosures []FeedEnclosure
+}
+
+// FeedEnclosure is attachment of feed entry.
+type FeedEnclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	// Base is URL relative links of content are resolved against.
+	Base string `xml:"http://www.w3.org/XML/1998/namespace base,attr,omitempty"`
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// WriteAtom writes feed in Atom format.
+func (f *Feed) WriteAtom(w io.Writer) error {
+	feed := atomFeed{
+		ID:      f.ID,
+		Title:   f.Title,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: f.Author},
+	}
+	if feed.Author.Name == "" {
+		feed.Author.Name = f.Title
+	}
+	if f.Link != "" {
+		feed.Links = append(feed.Links, atomLink{Href: f.Link, Rel: "alternate", Type: "text/html"})
+	}
+	for _, entry := range f.Entries {
+		e := atomEntry{
+			ID:        entry.ID,
+			Title:     entry.Title,
+			Published: entry.Published.UTC().Format(time.RFC3339),
+			Updated:   entry.Updated.UTC().Format(time.RFC3339),
+			Content:   atomContent{Base: entry.Link, Type: "html", Body: entry.HTML},
+		}
+		if entry.Link != "" {
+			e.Links = append(e.Links, atomLink{Href: entry.Link, Rel: "alternate", Type: "text/html"})
+		}
+		for _, enclosure := range entry.Enclosures {
+			e.Links = append(e.Links, atomLink{
+				Href:   enclosure.URL,
+				Rel:    "enclosure",
+				Type:   enclosure.Type,
+				Length: enclosure.Length,
+			})
+		}
+		for _, tag := range entry.Tags {
+			e.Categories = append(e.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return fmt.Errorf("encode atom feed: %w", err)
+	}
+	return nil
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Categories  []string      `xml:"category"`
+	Description string        `xml:"description"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+// WriteRSS writes feed in RSS 2.0 format. RSS allows single enclosure per item, so only the first one is written.
+func (f *Feed) WriteRSS(w io.Writer) error {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.Link,
+			Description: f.Title,
+		},
+	}
+	if !f.Updated.IsZero() {
+		feed.Channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, entry := range f.Entries {
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			GUID:        rssGUID{Value: entry.ID},
+			PubDate:     entry.Published.UTC().Format(time.RFC1123Z),
+			Categories:  entry.Tags,
+			Description: entry.HTML,
+		}
+		if len(entry.Enclosures) > 0 {
+			enclosure := entry.Enclosures[0]
+			item.Enclosure = &rssEnclosure{URL: enclosure.URL, Type: enclosure.Type, Length: enclosure.Length}
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return fmt.Errorf("encode rss feed: %w", err)
+	}
+	return nil
+}
+
+// Feeds builds feeds of the latest nodes selected by query, saved search or list.
+type Feeds struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+}
+
+func NewFeeds(logger *slog.Logger, storage *storage.Storage) *Feeds {
+	return &Feeds{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+// Feed returns feed of nodes selected by query or by ID of saved search or list node (see ResolveNodeQuery), newest
+// first. Text nodes are rendered to HTML, other nodes and nodes they link to are enclosures. Links point to content
+// download API at baseURL.
+func (f *Feeds) Feed(ctx context.Context, queryOrID, baseURL string) (*Feed, error) {
+	q, title, err := ResolveNodeQuery(ctx, f.storage, queryOrID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := QueryNodes(ctx, f.storage, q)
+	if err != nil {
+		return nil, fmt.Errorf("query nodes: %w", err)
+	}
+	nodes := make([]storage.Node, 0, len(ids))
+	for batch := ids; len(batch) > 0; {
+		n := min(len(batch), feedBatchSize)
+		loaded, err := f.storage.NodesLoad(ctx, batch[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range loaded {
+			if !node.IsDeleted() {
+				nodes = append(nodes, node)
+			}
+		}
+		batch = batch[n:]
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if !nodes[i].CreatedAt.Equal(nodes[j].CreatedAt) {
+			return nodes[i].CreatedAt.After(nodes[j].CreatedAt)
+		}
+		return nodes[i].ID > nodes[j].ID
+	})
+	nodes = nodes[:min(len(nodes), feedLimit)]
+
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	contentURL := func(id string) string {
+		return baseURL + "/api/content/" + url.PathEscape(id)
+	}
+	known := make(map[string]storage.Node)
+	entryIDs := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		known[node.ID] = node
+		entryIDs = append(entryIDs, node.ID)
+	}
+	var edges []storage.Edge
+	if len(entryIDs) > 0 {
+		if edges, err = f.storage.EdgesForNodes(ctx, entryIDs); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(edges, func(i, j int) bool { return edges[i].CreatedAt.Before(edges[j].CreatedAt) })
+	var linkedIDs []string
+	for _, edge := range edges {
+		if _, ok := known[edge.SrcID]; ok && edge.Relation != storage.EdgeRelChain {
+			linkedIDs = append(linkedIDs, edge.DstID)
+		}
+	}
+	attachments := make(map[string][]storage.Node)
+	if len(linkedIDs) > 0 {
+		linked, err := f.storage.NodesLoad(ctx, linkedIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, edge := range edges {
+			dst, ok := linked[edge.DstID]
+			src, srcOK := known[edge.SrcID]
+			if !ok || !srcOK || edge.Relation == storage.EdgeRelChain || dst.IsDeleted() || edge.SrcID == edge.DstID ||
+				storage.IsTextMimetype(dst.ContentMimetype) || !storage.IsTextMimetype(src.ContentMimetype) {
+				continue
+			}
+			if _, ok := known[dst.ID]; !ok {
+				known[dst.ID] = dst
+			}
+			attachments[edge.SrcID] = append(attachments[edge.SrcID], dst)
+		}
+	}
+	links := newNoteLinks(func(id string) (string, bool) {
+		return contentURL(id), strings.HasPrefix(known[id].ContentMimetype, "image/")
+	})
+	for _, node := range known {
+		links.add(node)
+	}
+
+	feed := &Feed{
+		ID:    "urn:libreta:feed:" + url.PathEscape(queryOrID),
+		Title: title,
+		Link:  baseURL + "/",
+	}
+	for _, node := range nodes {
+		if node.UpdatedAt.After(feed.Updated) {
+			feed.Updated = node.UpdatedAt
+		}
+		entry := FeedEntry{
+			ID:        nodeURN(node.ID),
+			Title:     nodeTitle(node),
+			Link:      contentURL(node.ID),
+			Published: node.CreatedAt,
+			Updated:   node.UpdatedAt,
+		}
+		for _, attr := range node.Attributes {
+			if attr.Key == TagAttr {
+				entry.Tags = append(entry.Tags, attr.Value)
+			}
+		}
+		if storage.IsTextMimetype(node.ContentMimetype) {
+			content, err := loadNodeContent(ctx, f.storage, node.ContentHash)
+			if err != nil {
+				return nil, fmt.Errorf("load node %q: %w", node.ID, err)
+			}
+			entry.HTML = renderNoteHTML(content, node.ContentMimetype, links)
+		} else {
+			if strings.HasPrefix(node.ContentMimetype, "image/") {
+				entry.HTML = `<img src="` + html.EscapeString(contentURL(node.ID)) + `" alt="` + html.EscapeString(node.Name) + `">`
+			}
+			attachments[node.ID] = append([]storage.Node{node}, attachments[node.ID]...)
+		}
+		for _, attachment := range attachments[node.ID] {
+			entry.Enclosures = append(entry.Enclosures, FeedEnclosure{
+				URL:    contentURL(attachment.ID),
+				Type:   attachment.ContentMimetype,
+				Length: attachment.ContentLength,
+			})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed, nil
+}
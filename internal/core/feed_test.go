@@ -0,0 +1,87 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeds(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := testStorage(t)
+	save := func(id, name, mimetype, content string, created time.Time, attrs ...storage.NodeAttribute) {
+		t.Helper()
+		hash, err := s.NodeContentSave(ctx, bytes.NewReader([]byte(content)))
+		require.NoError(t, err)
+		require.NoError(t, s.NodeImport(ctx, storage.Node{
+			ID: id, Name: name, ContentHash: hash, ContentMimetype: mimetype,
+			CreatedAt: created, UpdatedAt: created, Attributes: attrs,
+		}))
+	}
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	save("list", "My posts", "text/plain", "", day)
+	save("p1", "", markdownMimetype, "*first* with ![[pic.png]]", day.Add(time.Hour), storage.NodeAttribute{Key: TagAttr, Value: "blog"})
+	save("p2", "Second", "text/plain", "a < b", day.Add(2*time.Hour))
+	save("pic", "pic.png", "image/png", "PNG", day.Add(3*time.Hour))
+	save("search", "Blog", "text/plain", "", day, storage.NodeAttribute{Key: QueryAttr, Value: "tag:blog"})
+	require.NoError(t, s.EdgesAdd(ctx, []storage.Edge{
+		{SrcID: "list", DstID: "p1", Relation: storage.EdgeRelChain},
+		{SrcID: "p1", DstID: "p2", Relation: storage.EdgeRelChain},
+		{SrcID: "p2", DstID: "pic", Relation: storage.EdgeRelChain},
+		{SrcID: "p1", DstID: "pic", Relation: storage.EdgeRelLink},
+	}))
+	feeds := NewFeeds(logger, s)
+
+	feed, err := feeds.Feed(ctx, "list", "https://example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, "My posts", feed.Title)
+	assert.Equal(t, day.Add(3*time.Hour), feed.Updated.UTC())
+	require.Len(t, feed.Entries, 3)
+	pic, p2, p1 := feed.Entries[0], feed.Entries[1], feed.Entries[2]
+	assert.Equal(t, []FeedEnclosure{{URL: "https://example.com/api/content/pic", Type: "image/png", Length: 3}}, pic.Enclosures)
+	assert.Equal(t, `<img src="https://example.com/api/content/pic" alt="pic.png">`, pic.HTML)
+	assert.Equal(t, "Second", p2.Title)
+	assert.Equal(t, "<pre>a &lt; b</pre>\n", p2.HTML)
+	assert.Equal(t, "p1", p1.Title)
+	assert.Equal(t, "urn:libreta:node:p1", p1.ID)
+	assert.Equal(t, []string{"blog"}, p1.Tags)
+	assert.Equal(t, `<p><em>first</em> with <img src="https://example.com/api/content/pic" alt="pic.png"></p>`+"\n", p1.HTML)
+	assert.Equal(t, pic.Enclosures, p1.Enclosures)
+
+	feed, err = feeds.Feed(ctx, "search", "https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "Blog", feed.Title)
+	require.Len(t, feed.Entries, 1)
+	assert.Equal(t, "urn:libreta:node:p1", feed.Entries[0].ID)
+
+	feed, err = feeds.Feed(ctx, "tag:blog", "")
+	require.NoError(t, err)
+	assert.Equal(t, "tag:blog", feed.Title)
+	assert.Len(t, feed.Entries, 1)
+
+	_, err = feeds.Feed(ctx, "missing", "")
+	assert.ErrorIs(t, err, storage.ErrNoRecord)
+
+	t.Run("write", func(t *testing.T) {
+		feed, err := feeds.Feed(ctx, "list", "https://example.com")
+		require.NoError(t, err)
+		var atom, rss bytes.Buffer
+		require.NoError(t, feed.WriteAtom(&atom))
+		require.NoError(t, feed.WriteRSS(&rss))
+		assert.Contains(t, atom.String(), `<link href="https://example.com/api/content/pic" rel="enclosure" type="image/png" length="3"></link>`)
+		assert.Contains(t, atom.String(), `<updated>2024-01-01T03:00:00Z</updated>`)
+		assert.Contains(t, rss.String(), `<rss version="2.0">`)
+		assert.Contains(t, rss.String(), `<guid isPermaLink="false">urn:libreta:node:p1</guid>`)
+		assert.Contains(t, rss.String(), `<pubDate>Mon, 01 Jan 2024 01:00:00 +0000</pubDate>`)
+		assert.Contains(t, rss.String(), `<enclosure url="https://example.com/api/content/pic" type="image/png" length="3"></enclosure>`)
+		assert.Contains(t, rss.String(), `<description>&lt;pre&gt;a &amp;lt; b&lt;/pre&gt;&#xA;</description>`)
+	})
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	markdownMimetype = "text/markdown"
+	markdownExt      = ".md"
+
+	// MarkdownPathAttr keeps path of imported file relative to the imported directory, so re-import updates
+	// the same nodes.
+	MarkdownPathAttr = "import.path"
+	// MarkdownVaultAttr keeps absolute path of the imported directory, so files with the same path in different
+	// directories are different nodes.
+	MarkdownVaultAttr = "import.vault"
+	// MarkdownLinkAttr and MarkdownChildAttr keep IDs of nodes importer linked the node to, so re-import removes
+	// only edges it made itself.
+	MarkdownLinkAttr  = "import.link"
+	MarkdownChildAttr = "import.child"
+
+	// markdownImportAttrPrefix is prefix of attributes kept by importer, they aren't exported.
+	markdownImportAttrPrefix = "import."
+)
+
+// Front matter keys mapped to node fields and edges, other keys are stored as node attributes.
+const (
+	frontMatterID      = "id"
+	frontMatterTitle   = "title"
+	frontMatterCreated = "created"
+	frontMatterUpdated = "updated"
+	// frontMatterLinks lists wikilinks to nodes not referenced in note text.
+	frontMatterLinks = "links"
+	// frontMatterTags lists tags, stored as TagAttr attributes.
+	frontMatterTags = "tags"
+)
+
+// Front matter keys used by other tools for timestamps, read on import only.
+var frontMatterTimeAliases = map[string]string{
+	"date":     frontMatterCreated,
+	"modified": frontMatterUpdated,
+}
+
+// frontMatterAttrPrefix escapes attributes with reserved front matter keys, e.g. attribute "title" is written as
+// "attr.title". Keys with the prefix are escaped too, so escaping is reversible.
+const frontMatterAttrPrefix = "attr."
+
+func isReservedFrontMatterKey(key string) bool {
+	switch key {
+	case frontMatterID, frontMatterTitle, frontMatterCreated, frontMatterUpdated, frontMatterLinks, frontMatterTags:
+		return true
+	}
+	_, ok := frontMatterTimeAliases[key]
+	return ok
+}
+
+// escapeFrontMatterKey returns front matter key of attribute.
+func escapeFrontMatterKey(key string) string {
+	if key == TagAttr {
+		return frontMatterTags
+	}
+	if isReservedFrontMatterKey(key) || strings.HasPrefix(key, frontMatterAttrPrefix) {
+		return frontMatterAttrPrefix + key
+	}
+	return key
+}
+
+// unescapeFrontMatterKey returns attribute key of front matter key, reverting escapeFrontMatterKey.
+func unescapeFrontMatterKey(key string) string {
+	if key == frontMatterTags {
+		return TagAttr
+	}
+	rest, ok := strings.CutPrefix(key, frontMatterAttrPrefix)
+	if ok && (isReservedFrontMatterKey(rest) || strings.HasPrefix(rest, frontMatterAttrPrefix)) {
+		return rest
+	}
+	return key
+}
+
+var (
+	// wikilinkRe matches [[target]], [[target#heading]], [[target|alias]] and embeds ![[target]].
+	wikilinkRe = regexp.MustCompile(`(!?)\[\[([^\[\]|#]*)(#[^\[\]|]*)?(\|[^\[\]]*)?\]\]`)
+	// mdLinkRe matches [text](target) and images ![alt](target "title").
+	mdLinkRe = regexp.MustCompile(`(!?)\[[^\]]*\]\(<?([^)\s>]+)>?(?:\s+"[^"]*")?\)`)
+)
+
+var frontMatterDelim = []byte("---")
+
+// splitFrontMatter splits YAML front matter delimited by "---" lines from markdown body.
+func splitFrontMatter(data []byte) (frontMatter, body []byte) {
+	first, rest, ok := bytes.Cut(data, []byte("\n"))
+	if !ok || !bytes.Equal(bytes.TrimRight(first, "\r"), frontMatterDelim) {
+		return nil, data
+	}
+	for offset := 0; offset < len(rest); {
+		line, _, _ := bytes.Cut(rest[offset:], []byte("\n"))
+		next := offset + len(line) + 1
+		if bytes.Equal(bytes.TrimRight(line, "\r"), frontMatterDelim) {
+			return rest[:offset], rest[min(next, len(rest)):]
+		}
+		offset = next
+	}
+	return nil, data
+}
+
+var frontMatterTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func parseFrontMatterTime(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range frontMatterTimeLayouts {
+			if t, err := time.ParseInLocation(layout, strings.TrimSpace(v), time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// frontMatterValues converts front matter value to attribute values: lists give value per item, maps are
+// stored as JSON.
+func frontMatterValues(v any) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, frontMatterValues(item)...)
+		}
+		return values
+	case string:
+		return []string{v}
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return []string{v.Format(time.DateOnly)}
+		}
+		return []string{v.Format(time.RFC3339)}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case map[string]any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return []string{fmt.Sprint(v)}
+		}
+		return []string{string(data)}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,422 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	markdownExportBatchSize = 500
+	// exportHashNameLen is length of content hash prefix used as name of attachment without name.
+	exportHashNameLen = 12
+)
+
+// MarkdownExportResult counts exported files.
+type MarkdownExportResult struct {
+	Notes       int
+	Attachments int
+	Links       int
+}
+
+// MarkdownExporter writes nodes into directory of markdown files in the format read by MarkdownImporter.
+//
+// Each non-deleted text node is written as "<name>.md" with YAML front matter (id, title, timestamps and
+// attributes), other nodes are written as attachment files named by node name or content hash. Imported nodes
+// keep name of imported file. Node with child nodes gets folder "<name>" next to its file. Attachments without
+// parent node are placed next to the first note linking to them. Link edges not referenced in note text are
+// listed as wikilinks in "links" front matter key. Attributes with reserved front matter keys are escaped with
+// "attr." prefix.
+type MarkdownExporter struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+}
+
+func NewMarkdownExporter(logger *slog.Logger, storage *storage.Storage) *MarkdownExporter {
+	return &MarkdownExporter{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+type markdownExport struct {
+	*MarkdownExporter
+	dir    string
+	result MarkdownExportResult
+
+	nodes    map[string]storage.Node
+	parent   map[string]string   // node ID -> parent node ID
+	children map[string][]string // node ID -> child node IDs
+	links    map[string][]string // node ID -> linked node IDs
+	paths    map[string]string   // node ID -> slash separated path of exported file
+	taken    map[string]bool     // lower case paths of files and folders
+}
+
+// Export writes nodes into dir, which must be empty or not exist.
+func (ex *MarkdownExporter) Export(ctx context.Context, dir string) (MarkdownExportResult, error) {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return MarkdownExportResult{}, fmt.Errorf("directory %q is not empty", dir)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return MarkdownExportResult{}, err
+	}
+	exp := &markdownExport{
+		MarkdownExporter: ex,
+		dir:              dir,
+		nodes:            make(map[string]storage.Node),
+		parent:           make(map[string]string),
+		children:         make(map[string][]string),
+		links:            make(map[string][]string),
+		paths:            make(map[string]string),
+		taken:            make(map[string]bool),
+	}
+	if err := exp.load(ctx); err != nil {
+		return exp.result, err
+	}
+	exp.placeNotes("", exp.roots())
+	exp.placeAttachments()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return exp.result, err
+	}
+	ids := make([]string, 0, len(exp.paths))
+	for id := range exp.paths {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := exp.write(ctx, exp.nodes[id]); err != nil {
+			return exp.result, fmt.Errorf("export node %q: %w", id, err)
+		}
+	}
+	return exp.result, nil
+}
+
+// load reads non-deleted nodes and edges between them.
+func (exp *markdownExport) load(ctx context.Context) error {
+	ids, err := exp.storage.QueryNodeIDs(ctx)
+	if err != nil {
+		return err
+	}
+	var edges []storage.Edge
+	for batch := ids; len(batch) > 0; {
+		n := min(len(batch), markdownExportBatchSize)
+		nodes, err := exp.storage.NodesLoad(ctx, batch[:n])
+		if err != nil {
+			return err
+		}
+		for id, node := range nodes {
+			exp.nodes[id] = node
+		}
+		batchEdges, err := exp.storage.EdgesForNodes(ctx, batch[:n])
+		if err != nil {
+			return err
+		}
+		edges = append(edges, batchEdges...)
+		batch = batch[n:]
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].SrcID != edges[j].SrcID {
+			return edges[i].SrcID < edges[j].SrcID
+		}
+		return edges[i].DstID < edges[j].DstID
+	})
+	seen := make(map[storage.Edge]bool)
+	for _, edge := range edges {
+		edge.CreatedAt = time.Time{}
+		src, srcOK := exp.nodes[edge.SrcID]
+		_, dstOK := exp.nodes[edge.DstID]
+		if seen[edge] || !srcOK || !dstOK || edge.SrcID == edge.DstID || !storage.IsTextMimetype(src.ContentMimetype) {
+			continue
+		}
+		seen[edge] = true
+		switch edge.Relation {
+		case storage.EdgeRelChild:
+			if _, ok := exp.parent[edge.DstID]; !ok && !exp.isAncestor(edge.DstID, edge.SrcID) {
+				exp.parent[edge.DstID] = edge.SrcID
+				exp.children[edge.SrcID] = append(exp.children[edge.SrcID], edge.DstID)
+			}
+		case storage.EdgeRelLink:
+			exp.links[edge.SrcID] = append(exp.links[edge.SrcID], edge.DstID)
+		}
+	}
+	return nil
+}
+
+// isAncestor reports whether node a is ancestor of node b, so making a child of b would create a cycle.
+func (exp *markdownExport) isAncestor(a, b string) bool {
+	for id := b; id != ""; id = exp.parent[id] {
+		if id == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (exp *markdownExport) roots() []string {
+	var roots []string
+	for id := range exp.nodes {
+		if _, ok := exp.parent[id]; !ok {
+			roots = append(roots, id)
+		}
+	}
+	return roots
+}
+
+func (exp *markdownExport) isNote(id string) bool {
+	return storage.IsTextMimetype(exp.nodes[id].ContentMimetype)
+}
+
+// placeNotes assigns paths to notes in dir and recursively to their children.
+func (exp *markdownExport) placeNotes(dir string, ids []string) {
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := exp.nodes[ids[i]], exp.nodes[ids[j]]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	for _, id := range ids {
+		if !exp.isNote(id) {
+			continue
+		}
+		name := exp.fileName(exp.nodes[id])
+		if strings.EqualFold(path.Ext(name), markdownExt) {
+			name = strings.TrimSuffix(name, path.Ext(name))
+		}
+		p := exp.place(dir, exportFileName(name, id), markdownExt)
+		exp.paths[id] = p
+		if len(exp.children[id]) > 0 {
+			exp.placeNotes(strings.TrimSuffix(p, markdownExt), exp.children[id])
+		}
+	}
+}
+
+// placeAttachments assigns paths to non-text nodes: into folder of parent node, next to the first note linking
+// to them, or into the root.
+func (exp *markdownExport) placeAttachments() {
+	linkedFrom := make(map[string]string)
+	sources := make([]string, 0, len(exp.links))
+	for id := range exp.links {
+		sources = append(sources, id)
+	}
+	sort.Strings(sources)
+	for _, src := range sources {
+		for _, dst := range exp.links[src] {
+			if _, ok := linkedFrom[dst]; !ok {
+				linkedFrom[dst] = src
+			}
+		}
+	}
+	ids := make([]string, 0)
+	for id := range exp.nodes {
+		if !exp.isNote(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		dir := ""
+		if parent, ok := exp.parent[id]; ok {
+			dir = strings.TrimSuffix(exp.paths[parent], markdownExt)
+		} else if src, ok := linkedFrom[id]; ok {
+			dir = path.Dir(exp.paths[src])
+		}
+		if dir == "." {
+			dir = ""
+		}
+		node := exp.nodes[id]
+		name := exp.fileName(node)
+		ext := path.Ext(name)
+		if ext == "" || exportFileName(name, "") == "" {
+			name, ext = node.ContentHash[:min(len(node.ContentHash), exportHashNameLen)], ""
+			if exts, _ := mime.ExtensionsByType(node.ContentMimetype); len(exts) > 0 {
+				ext = exts[0]
+			}
+		}
+		exp.paths[id] = exp.place(dir, exportFileName(strings.TrimSuffix(name, path.Ext(name)), id), ext)
+	}
+}
+
+// fileName returns name of imported file, so links to it by file name keep resolving, or node name.
+func (exp *markdownExport) fileName(node storage.Node) string {
+	for _, attr := range node.Attributes {
+		if attr.Key == MarkdownPathAttr {
+			return path.Base(strings.TrimSuffix(attr.Value, "/"))
+		}
+	}
+	return node.Name
+}
+
+// place returns unique path for file with name and extension in dir. Note file and its folder share the name.
+func (exp *markdownExport) place(dir, name, ext string) string {
+	p := path.Join(dir, name)
+	for n := 2; exp.taken[strings.ToLower(p)] || exp.taken[strings.ToLower(p+ext)]; n++ {
+		p = path.Join(dir, fmt.Sprintf("%s (%d)", name, n))
+	}
+	exp.taken[strings.ToLower(p)] = true
+	exp.taken[strings.ToLower(p+ext)] = true
+	return p + ext
+}
+
+var exportFileNameReplacer = strings.NewReplacer(
+	"/", "-", "\\", "-", ":", "-", "*", "-", "?", "-", "\"", "-", "<", "-", ">", "-", "|", "-",
+	"[", "(", "]", ")", "#", "-", "^", "-",
+)
+
+// exportFileName returns name safe for file systems and wikilinks, or fallback for empty name.
+func exportFileName(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, exportFileNameReplacer.Replace(name))
+	name = strings.Trim(name, " .")
+	if len(name) > 200 {
+		name = strings.ToValidUTF8(name[:200], "")
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+func (exp *markdownExport) write(ctx context.Context, node storage.Node) error {
+	r, err := exp.storage.NodeContentLoad(ctx, node.ContentHash)
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(r)
+	if err := errors.Join(err, r.Close()); err != nil {
+		return err
+	}
+	p := exp.paths[node.ID]
+	if exp.isNote(node.ID) {
+		if content, err = exp.note(node, content); err != nil {
+			return err
+		}
+		exp.result.Notes++
+	} else {
+		exp.result.Attachments++
+	}
+	filePath := filepath.Join(exp.dir, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, content, 0o644); err != nil {
+		return err
+	}
+	return os.Chtimes(filePath, node.UpdatedAt, node.UpdatedAt)
+}
+
+// note returns note file content: front matter and body.
+func (exp *markdownExport) note(node storage.Node, body []byte) ([]byte, error) {
+	fm := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key string, value *yaml.Node) {
+		fm.Content = append(fm.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	}
+	str := func(s string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+	}
+	add(frontMatterID, str(node.ID))
+	add(frontMatterTitle, str(node.Name))
+	add(frontMatterCreated, &yaml.Node{Kind: yaml.ScalarNode, Value: node.CreatedAt.Format(time.RFC3339)})
+	add(frontMatterUpdated, &yaml.Node{Kind: yaml.ScalarNode, Value: node.UpdatedAt.Format(time.RFC3339)})
+
+	values := make(map[string][]string)
+	var keys []string
+	for _, attr := range node.Attributes {
+		if strings.HasPrefix(attr.Key, markdownImportAttrPrefix) {
+			continue
+		}
+		if _, ok := values[attr.Key]; !ok {
+			keys = append(keys, attr.Key)
+		}
+		values[attr.Key] = append(values[attr.Key], attr.Value)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if len(values[key]) == 1 {
+			add(escapeFrontMatterKey(key), str(values[key][0]))
+			continue
+		}
+		seq := &yaml.Node{Kind: yaml.SequenceNode}
+		sort.Strings(values[key])
+		for _, value := range values[key] {
+			seq.Content = append(seq.Content, str(value))
+		}
+		add(escapeFrontMatterKey(key), seq)
+	}
+
+	referenced := markdownReferences(body)
+	links := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, dst := range exp.links[node.ID] {
+		exp.result.Links++
+		p := exp.paths[dst]
+		target := p
+		if exp.isNote(dst) {
+			target = strings.TrimSuffix(p, markdownExt)
+		}
+		if referenced[strings.ToLower(target)] || referenced[strings.ToLower(path.Base(target))] ||
+			referenced[strings.ToLower(exp.nodes[dst].Name)] {
+			continue
+		}
+		links.Content = append(links.Content, str("[["+target+"]]"))
+	}
+	if len(links.Content) > 0 {
+		add(frontMatterLinks, links)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Write(frontMatterDelim)
+	buf.WriteString("\n")
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(fm); err != nil {
+		return nil, fmt.Errorf("encode front matter: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encode front matter: %w", err)
+	}
+	buf.Write(frontMatterDelim)
+	buf.WriteString("\n")
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// markdownReferences returns lower case link targets found in body: wikilink targets and relative link paths,
+// both with and without extension.
+func markdownReferences(body []byte) map[string]bool {
+	refs := make(map[string]bool)
+	add := func(target string) {
+		target = strings.ToLower(strings.TrimSpace(target))
+		refs[target] = true
+		if strings.EqualFold(path.Ext(target), markdownExt) {
+			refs[strings.TrimSuffix(target, path.Ext(target))] = true
+		}
+	}
+	for _, m := range wikilinkRe.FindAllSubmatch(body, -1) {
+		add(string(m[2]))
+	}
+	for _, m := range mdLinkRe.FindAllSubmatch(body, -1) {
+		target, _, _ := strings.Cut(string(m[2]), "#")
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+		add(path.Base(target))
+	}
+	return refs
+}
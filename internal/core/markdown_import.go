@@ -0,0 +1,654 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+const markdownImportBatchSize = 500
+
+// MarkdownImportResult counts imported nodes (including folders and attachments) and lists links which didn't
+// resolve to any file.
+type MarkdownImportResult struct {
+	Created     int
+	Updated     int
+	Unchanged   int
+	Skipped     int
+	Attachments int
+	Links       int
+	Unresolved  []string
+}
+
+// MarkdownImporter imports directory of markdown files with YAML front matter, e.g. Obsidian or Zettelkasten vault.
+//
+// Each file becomes a text/markdown node named by front matter title or file name, other front matter keys are
+// stored as attributes. Folders become nodes with child edges to their entries, note "dir.md" next to folder "dir"
+// is the node of that folder. Wikilinks and relative links to notes become link edges, embedded files (e.g. images)
+// are imported as nodes linked from the note. Nodes are found by import path within the directory or front matter id
+// on re-import, so importing the same directory again updates them. Nodes deleted since the previous import are
+// skipped. Re-import removes only edges made by the previous import, edges added by hand are kept.
+type MarkdownImporter struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+}
+
+func NewMarkdownImporter(logger *slog.Logger, storage *storage.Storage) *MarkdownImporter {
+	return &MarkdownImporter{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+// mdEntry is imported note or folder.
+type mdEntry struct {
+	// path is slash separated path relative to imported directory, folder paths end with "/".
+	path   string
+	fmID   string
+	links  []string
+	node   storage.Node
+	prev   *storage.Node // node saved by previous import
+	body   []byte
+	folder bool
+	status nodeSaveStatus
+}
+
+type markdownImport struct {
+	*MarkdownImporter
+	dir    string
+	vault  string // absolute path of dir
+	result MarkdownImportResult
+
+	existing     map[string]string // import path -> node ID
+	usedIDs      map[string]bool
+	entries      []*mdEntry
+	notes        map[string]*mdEntry // lower case path without extension -> note
+	notesByName  map[string][]*mdEntry
+	notesByTitle map[string]*mdEntry
+	folders      map[string]*mdEntry // folder path without trailing slash -> folder entry
+	files        map[string]bool
+	filesByName  map[string][]string
+	attachments  map[string]string // path -> node ID, empty if skipped
+	edges        map[storage.Edge]bool
+	recorded     map[storage.Edge]bool // edges made by previous import from nodes imported now
+}
+
+// Import imports markdown files from dir.
+func (im *MarkdownImporter) Import(ctx context.Context, dir string) (MarkdownImportResult, error) {
+	vault, err := filepath.Abs(dir)
+	if err != nil {
+		return MarkdownImportResult{}, err
+	}
+	existing, err := im.storage.QueryAttributeIndexScoped(ctx, MarkdownPathAttr, MarkdownVaultAttr, vault)
+	if err != nil {
+		return MarkdownImportResult{}, err
+	}
+	imp := &markdownImport{
+		MarkdownImporter: im,
+		dir:              dir,
+		vault:            vault,
+		existing:         existing,
+		usedIDs:          make(map[string]bool),
+		notes:            make(map[string]*mdEntry),
+		notesByName:      make(map[string][]*mdEntry),
+		notesByTitle:     make(map[string]*mdEntry),
+		folders:          make(map[string]*mdEntry),
+		files:            make(map[string]bool),
+		filesByName:      make(map[string][]string),
+		attachments:      make(map[string]string),
+		edges:            make(map[storage.Edge]bool),
+		recorded:         make(map[storage.Edge]bool),
+	}
+	if err := imp.scan(); err != nil {
+		return imp.result, err
+	}
+	for _, e := range imp.entries {
+		if err := imp.prepareEntry(ctx, e); err != nil {
+			return imp.result, fmt.Errorf("import %q: %w", e.path, err)
+		}
+	}
+	for _, e := range imp.entries {
+		if err := imp.resolveEntry(ctx, e); err != nil {
+			return imp.result, fmt.Errorf("import %q: %w", e.path, err)
+		}
+	}
+	// Nodes are saved after links are resolved, so they record edges made from them.
+	edgeAttrs := imp.edgeAttributes()
+	for _, e := range imp.entries {
+		if err := imp.saveEntry(ctx, e, edgeAttrs[e.node.ID]); err != nil {
+			return imp.result, fmt.Errorf("import %q: %w", e.path, err)
+		}
+	}
+	if err := imp.saveEdges(ctx); err != nil {
+		return imp.result, err
+	}
+	return imp.result, nil
+}
+
+// scan reads notes and lists folders and other files.
+func (imp *markdownImport) scan() error {
+	var dirs []string
+	err := filepath.WalkDir(imp.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(imp.dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			if !d.IsDir() {
+				return fmt.Errorf("%q is not a directory", imp.dir)
+			}
+			return nil
+		}
+		// Skip hidden entries, e.g. .obsidian, .git or .trash.
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, rel)
+		case !d.Type().IsRegular():
+		case strings.EqualFold(path.Ext(rel), markdownExt):
+			return imp.readNote(p, rel, d)
+		default:
+			imp.files[rel] = true
+			name := strings.ToLower(path.Base(rel))
+			imp.filesByName[name] = append(imp.filesByName[name], rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if note, ok := imp.notes[strings.ToLower(dir)]; ok {
+			imp.folders[dir] = note
+			continue
+		}
+		info, err := os.Stat(filepath.Join(imp.dir, filepath.FromSlash(dir)))
+		if err != nil {
+			return err
+		}
+		e := &mdEntry{
+			path:   dir + "/",
+			folder: true,
+			node: storage.Node{
+				Name:            path.Base(dir),
+				ContentMimetype: markdownMimetype,
+				CreatedAt:       info.ModTime(),
+				UpdatedAt:       info.ModTime(),
+			},
+		}
+		imp.folders[dir] = e
+		imp.entries = append(imp.entries, e)
+	}
+	// Shorter paths win for notes with the same name, as in Obsidian.
+	for _, notes := range imp.notesByName {
+		sort.SliceStable(notes, func(i, j int) bool {
+			return strings.Count(notes[i].path, "/") < strings.Count(notes[j].path, "/")
+		})
+	}
+	for _, e := range imp.entries {
+		if e.fmID != "" && !imp.usedIDs[e.fmID] {
+			e.node.ID = e.fmID
+			imp.usedIDs[e.fmID] = true
+		}
+	}
+	return nil
+}
+
+func (imp *markdownImport) readNote(p, rel string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	frontMatter, body := splitFrontMatter(data)
+	meta := make(map[string]any)
+	if err := yaml.Unmarshal(frontMatter, &meta); err != nil {
+		imp.logger.Warn("invalid front matter", slog.String("path", rel), slog.Any("error", err))
+		meta = make(map[string]any)
+	}
+
+	e := &mdEntry{
+		path: rel,
+		body: body,
+		node: storage.Node{
+			Name:            strings.TrimSuffix(path.Base(rel), path.Ext(rel)),
+			ContentMimetype: markdownMimetype,
+			CreatedAt:       info.ModTime(),
+			UpdatedAt:       info.ModTime(),
+		},
+	}
+	for alias, key := range frontMatterTimeAliases {
+		if v, ok := meta[alias]; ok {
+			if _, ok := meta[key]; !ok {
+				meta[key] = v
+			}
+			delete(meta, alias)
+		}
+	}
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v := meta[key]
+		switch key {
+		case frontMatterID:
+			if values := frontMatterValues(v); len(values) == 1 {
+				e.fmID = values[0]
+			}
+		case frontMatterTitle:
+			if values := frontMatterValues(v); len(values) == 1 && values[0] != "" {
+				e.node.Name = values[0]
+			}
+		case frontMatterCreated:
+			if t, ok := parseFrontMatterTime(v); ok {
+				e.node.CreatedAt = t
+			}
+		case frontMatterUpdated:
+			if t, ok := parseFrontMatterTime(v); ok {
+				e.node.UpdatedAt = t
+			}
+		case frontMatterLinks:
+			for _, value := range frontMatterValues(v) {
+				for _, m := range wikilinkRe.FindAllStringSubmatch(value, -1) {
+					e.links = append(e.links, m[2])
+				}
+			}
+		default:
+			if strings.HasPrefix(key, markdownImportAttrPrefix) {
+				break // Set by importer.
+			}
+			for _, value := range frontMatterValues(v) {
+				e.node.Attributes = append(e.node.Attributes, storage.NodeAttribute{Key: unescapeFrontMatterKey(key), Value: value})
+			}
+		}
+	}
+
+	imp.entries = append(imp.entries, e)
+	imp.notes[strings.ToLower(strings.TrimSuffix(rel, path.Ext(rel)))] = e
+	name := strings.ToLower(strings.TrimSuffix(path.Base(rel), path.Ext(rel)))
+	imp.notesByName[name] = append(imp.notesByName[name], e)
+	if _, ok := imp.notesByTitle[strings.ToLower(e.node.Name)]; !ok {
+		imp.notesByTitle[strings.ToLower(e.node.Name)] = e
+	}
+	return nil
+}
+
+type nodeSaveStatus int
+
+const (
+	nodeCreated nodeSaveStatus = iota
+	nodeUpdated
+	nodeUnchanged
+	nodeSkipped
+)
+
+// prepareEntry saves entry content and assigns ID to its node.
+func (imp *markdownImport) prepareEntry(ctx context.Context, e *mdEntry) error {
+	contentHash, err := imp.storage.NodeContentSave(ctx, bytes.NewReader(e.body))
+	if err != nil {
+		return err
+	}
+	e.node.ContentHash = contentHash
+	e.node.Attributes = append(e.node.Attributes,
+		storage.NodeAttribute{Key: MarkdownPathAttr, Value: e.path},
+		storage.NodeAttribute{Key: MarkdownVaultAttr, Value: imp.vault},
+	)
+	e.prev, err = imp.assignNode(ctx, e.path, &e.node)
+	if err != nil {
+		return err
+	}
+	if e.prev != nil && e.prev.IsDeleted() {
+		imp.result.Skipped++
+		e.status = nodeSkipped
+	}
+	return nil
+}
+
+// saveEntry saves entry node with attributes recording edges made from it.
+func (imp *markdownImport) saveEntry(ctx context.Context, e *mdEntry, edgeAttrs []storage.NodeAttribute) error {
+	if e.status == nodeSkipped {
+		return nil
+	}
+	e.node.Attributes = append(e.node.Attributes, edgeAttrs...)
+	var err error
+	e.status, err = imp.saveNode(ctx, &e.node, e.prev)
+	return err
+}
+
+// assignNode assigns ID to node and returns node saved by previous import, if any. Edges made by previous import
+// from it are recorded, so ones not made again are removed.
+func (imp *markdownImport) assignNode(ctx context.Context, importPath string, node *storage.Node) (*storage.Node, error) {
+	if node.ID == "" {
+		if id, ok := imp.existing[importPath]; ok && !imp.usedIDs[id] {
+			node.ID = id
+		}
+	}
+	for node.ID == "" {
+		id, err := imp.storage.GenerateNodeIDFor(ctx, node.ContentHash)
+		if err != nil {
+			return nil, err
+		}
+		if !imp.usedIDs[id] {
+			node.ID = id
+		}
+	}
+	imp.usedIDs[node.ID] = true
+
+	nodes, err := imp.storage.NodesLoad(ctx, []string{node.ID})
+	if err != nil {
+		return nil, err
+	}
+	prev, ok := nodes[node.ID]
+	if !ok {
+		return nil, nil
+	}
+	if !prev.IsDeleted() {
+		for _, attr := range prev.Attributes {
+			switch attr.Key {
+			case MarkdownLinkAttr:
+				imp.recorded[storage.Edge{SrcID: prev.ID, DstID: attr.Value, Relation: storage.EdgeRelLink}] = true
+			case MarkdownChildAttr:
+				imp.recorded[storage.Edge{SrcID: prev.ID, DstID: attr.Value, Relation: storage.EdgeRelChild}] = true
+			}
+		}
+	}
+	return &prev, nil
+}
+
+// saveNode saves node unless unchanged since previous import.
+func (imp *markdownImport) saveNode(ctx context.Context, node *storage.Node, prev *storage.Node) (nodeSaveStatus, error) {
+	status := nodeCreated
+	if prev != nil {
+		if nodeEqual(*prev, *node) {
+			imp.result.Unchanged++
+			return nodeUnchanged, nil
+		}
+		// Keep timestamps increasing, so the change wins on multi-device sync.
+		if !node.UpdatedAt.After(prev.UpdatedAt) {
+			node.UpdatedAt = time.Now()
+		}
+		status = nodeUpdated
+	}
+	if err := imp.storage.NodeImport(ctx, *node); err != nil {
+		return 0, err
+	}
+	if status == nodeCreated {
+		imp.result.Created++
+	} else {
+		imp.result.Updated++
+	}
+	return status, nil
+}
+
+func nodeEqual(a, b storage.Node) bool {
+	if a.Name != b.Name || a.ContentHash != b.ContentHash || a.ContentMimetype != b.ContentMimetype {
+		return false
+	}
+	attrs := func(n storage.Node) []string {
+		s := make([]string, 0, len(n.Attributes))
+		for _, attr := range n.Attributes {
+			s = append(s, attr.Key+"="+attr.Value)
+		}
+		sort.Strings(s)
+		return slices.Compact(s)
+	}
+	return slices.Equal(attrs(a), attrs(b))
+}
+
+// resolveEntry collects child edge from parent folder and edges to link targets.
+func (imp *markdownImport) resolveEntry(ctx context.Context, e *mdEntry) error {
+	if e.status == nodeSkipped {
+		return nil
+	}
+	imp.addParentEdge(e.path, e.node.ID)
+	if e.folder {
+		return nil
+	}
+
+	targets := e.links
+	for _, m := range wikilinkRe.FindAllSubmatch(e.body, -1) {
+		targets = append(targets, string(m[2]))
+	}
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		if err := imp.resolveLink(ctx, e, target, true); err != nil {
+			return err
+		}
+	}
+	for _, m := range mdLinkRe.FindAllSubmatch(e.body, -1) {
+		target := string(m[2])
+		if strings.Contains(target, ":") || strings.HasPrefix(target, "#") {
+			continue // URL or anchor
+		}
+		target, _, _ = strings.Cut(target, "#")
+		if unescaped, err := url.PathUnescape(target); err == nil {
+			target = unescaped
+		}
+		isNote := strings.EqualFold(path.Ext(target), markdownExt)
+		if !isNote && len(m[1]) == 0 && !imp.files[path.Join(path.Dir(e.path), target)] {
+			continue // link to something outside of the directory
+		}
+		if err := imp.resolveLink(ctx, e, target, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (imp *markdownImport) resolveLink(ctx context.Context, e *mdEntry, target string, wikilink bool) error {
+	var (
+		dstID string
+		found bool
+	)
+	if ext := path.Ext(target); ext != "" && !strings.EqualFold(ext, markdownExt) {
+		if file := imp.findFile(e, target, wikilink); file != "" {
+			id, err := imp.attachment(ctx, file)
+			if err != nil {
+				return err
+			}
+			dstID, found = id, true
+		}
+	}
+	if !found {
+		if note := imp.findNote(e, target, wikilink); note != nil {
+			found = true
+			if note.status != nodeSkipped {
+				dstID = note.node.ID
+			}
+		}
+	}
+	if !found {
+		imp.result.Unresolved = append(imp.result.Unresolved, fmt.Sprintf("%s: %s", e.path, target))
+		return nil
+	}
+	edge := storage.Edge{SrcID: e.node.ID, DstID: dstID, Relation: storage.EdgeRelLink}
+	if dstID != "" && dstID != e.node.ID && !imp.edges[edge] {
+		imp.edges[edge] = true
+		imp.result.Links++
+	}
+	return nil
+}
+
+// addParentEdge adds child edge from folder containing entry at p.
+func (imp *markdownImport) addParentEdge(p, id string) {
+	dir := path.Dir(strings.TrimSuffix(p, "/"))
+	if dir == "." || id == "" {
+		return
+	}
+	if parent := imp.folders[dir]; parent != nil && parent.status != nodeSkipped {
+		imp.edges[storage.Edge{SrcID: parent.node.ID, DstID: id, Relation: storage.EdgeRelChild}] = true
+	}
+}
+
+// findNote resolves link target: path relative to the note, path from the root (wikilinks only), then note
+// file name and title (wikilinks only).
+func (imp *markdownImport) findNote(e *mdEntry, target string, wikilink bool) *mdEntry {
+	key := strings.ToLower(target)
+	if strings.EqualFold(path.Ext(key), markdownExt) {
+		key = strings.TrimSuffix(key, path.Ext(key))
+	}
+	if note, ok := imp.notes[path.Join(strings.ToLower(path.Dir(e.path)), key)]; ok {
+		return note
+	}
+	if !wikilink {
+		return nil
+	}
+	if note, ok := imp.notes[strings.TrimPrefix(path.Clean("/"+key), "/")]; ok {
+		return note
+	}
+	if notes := imp.notesByName[path.Base(key)]; len(notes) > 0 && !strings.Contains(key, "/") {
+		return notes[0]
+	}
+	return imp.notesByTitle[strings.ToLower(target)]
+}
+
+// findFile resolves path of embedded file like findNote.
+func (imp *markdownImport) findFile(e *mdEntry, target string, wikilink bool) string {
+	if p := path.Join(path.Dir(e.path), target); imp.files[p] {
+		return p
+	}
+	if !wikilink {
+		return ""
+	}
+	if p := strings.TrimPrefix(path.Clean("/"+target), "/"); imp.files[p] {
+		return p
+	}
+	if files := imp.filesByName[strings.ToLower(target)]; len(files) > 0 {
+		return files[0]
+	}
+	return ""
+}
+
+// attachment imports file once, returns node ID or empty string if node was deleted.
+func (imp *markdownImport) attachment(ctx context.Context, p string) (string, error) {
+	if id, ok := imp.attachments[p]; ok {
+		return id, nil
+	}
+	filePath := filepath.Join(imp.dir, filepath.FromSlash(p))
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	contentHash, err := imp.storage.NodeContentSave(ctx, f)
+	if err := errors.Join(err, f.Close()); err != nil {
+		return "", err
+	}
+	mimetype := "application/octet-stream"
+	if mt, _, err := mime.ParseMediaType(mime.TypeByExtension(path.Ext(p))); err == nil {
+		mimetype = mt
+	}
+	node := storage.Node{
+		Name:            path.Base(p),
+		ContentHash:     contentHash,
+		ContentMimetype: mimetype,
+		CreatedAt:       info.ModTime(),
+		UpdatedAt:       info.ModTime(),
+		Attributes: []storage.NodeAttribute{
+			{Key: MarkdownPathAttr, Value: p},
+			{Key: MarkdownVaultAttr, Value: imp.vault},
+		},
+	}
+	prev, err := imp.assignNode(ctx, p, &node)
+	if err != nil {
+		return "", err
+	}
+	imp.result.Attachments++
+	if prev != nil && prev.IsDeleted() {
+		imp.result.Skipped++
+		node.ID = ""
+	} else if _, err := imp.saveNode(ctx, &node, prev); err != nil {
+		return "", err
+	}
+	imp.attachments[p] = node.ID
+	imp.addParentEdge(p, node.ID)
+	return node.ID, nil
+}
+
+// edgeAttributes returns attributes recording collected edges by source node ID.
+func (imp *markdownImport) edgeAttributes() map[string][]storage.NodeAttribute {
+	attrs := make(map[string][]storage.NodeAttribute)
+	for edge := range imp.edges {
+		key := MarkdownLinkAttr
+		if edge.Relation == storage.EdgeRelChild {
+			key = MarkdownChildAttr
+		}
+		attrs[edge.SrcID] = append(attrs[edge.SrcID], storage.NodeAttribute{Key: key, Value: edge.DstID})
+	}
+	for _, a := range attrs {
+		sort.Slice(a, func(i, j int) bool {
+			if a[i].Key != a[j].Key {
+				return a[i].Key < a[j].Key
+			}
+			return a[i].Value < a[j].Value
+		})
+	}
+	return attrs
+}
+
+// saveEdges adds collected edges and removes edges made by previous import which aren't in the files anymore.
+func (imp *markdownImport) saveEdges(ctx context.Context) error {
+	edges := make([]storage.Edge, 0, len(imp.edges))
+	for edge := range imp.edges {
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].SrcID != edges[j].SrcID {
+			return edges[i].SrcID < edges[j].SrcID
+		}
+		return edges[i].DstID < edges[j].DstID
+	})
+	for len(edges) > 0 {
+		n := min(len(edges), markdownImportBatchSize)
+		if err := imp.storage.EdgesAdd(ctx, edges[:n]); err != nil {
+			return err
+		}
+		edges = edges[n:]
+	}
+
+	var stale []storage.Edge
+	for edge := range imp.recorded {
+		if !imp.edges[edge] {
+			stale = append(stale, edge)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return imp.storage.EdgesRemove(ctx, stale)
+}
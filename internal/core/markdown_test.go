@@ -0,0 +1,256 @@
+package core
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	fm, body := splitFrontMatter([]byte("---\ntitle: A\r\n---\r\nbody\n"))
+	assert.Equal(t, "title: A\r\n", string(fm))
+	assert.Equal(t, "body\n", string(body))
+
+	fm, body = splitFrontMatter([]byte("---\ntitle: A\n"))
+	assert.Nil(t, fm)
+	assert.Equal(t, "---\ntitle: A\n", string(body))
+
+	fm, body = splitFrontMatter([]byte("# Title\n---\n"))
+	assert.Nil(t, fm)
+	assert.Equal(t, "# Title\n---\n", string(body))
+}
+
+func testStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+	ctx := context.Background()
+	s, err := storage.NewStorage(slog.New(slog.NewTextHandler(io.Discard, nil)), t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Open(ctx, false))
+	t.Cleanup(func() { require.NoError(t, s.Close()) })
+	return s
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+}
+
+func TestMarkdownImport(t *testing.T) {
+	ctx := context.Background()
+	s := testStorage(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"Home.md": "---\ntitle: Home page\ntags: [a, b]\ncreated: 2023-01-02 10:00\n---\n" +
+			"[[Plan]], [[sub/Note|note]], [[Missing]]\n![[logo.png]]\n",
+		"sub/Plan.md":        "---\nid: plan-1\n---\nback to [[Home]]\n",
+		"sub/Note.md":        "![img](../img/logo.png)\n",
+		"img/logo.png":       "PNG",
+		".obsidian/app.json": "{}",
+	})
+
+	im := NewMarkdownImporter(slog.New(slog.NewTextHandler(io.Discard, nil)), s)
+	result, err := im.Import(ctx, dir)
+	require.NoError(t, err)
+	assert.Equal(t, MarkdownImportResult{
+		Created:     6, // 3 notes, 2 folders, 1 attachment
+		Attachments: 1,
+		Links:       5,
+		Unresolved:  []string{"Home.md: Missing"},
+	}, result)
+
+	paths, err := s.QueryAttributeIndex(ctx, MarkdownPathAttr)
+	require.NoError(t, err)
+	assert.Equal(t, "plan-1", paths["sub/Plan.md"])
+	nodes, err := s.NodesLoad(ctx, []string{paths["Home.md"], paths["img/logo.png"]})
+	require.NoError(t, err)
+	home := nodes[paths["Home.md"]]
+	assert.Equal(t, "Home page", home.Name)
+	assert.Equal(t, markdownMimetype, home.ContentMimetype)
+	assert.Equal(t, time.Date(2023, 1, 2, 10, 0, 0, 0, time.Local), home.CreatedAt.Local())
+	vault, err := filepath.Abs(dir)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []storage.NodeAttribute{
+		{Key: TagAttr, Value: "a"}, {Key: TagAttr, Value: "b"},
+		{Key: MarkdownPathAttr, Value: "Home.md"}, {Key: MarkdownVaultAttr, Value: vault},
+		{Key: MarkdownLinkAttr, Value: "plan-1"},
+		{Key: MarkdownLinkAttr, Value: paths["sub/Note.md"]},
+		{Key: MarkdownLinkAttr, Value: paths["img/logo.png"]},
+	}, clearAttrTimes(home.Attributes))
+	assert.Equal(t, "image/png", nodes[paths["img/logo.png"]].ContentMimetype)
+
+	edges, err := s.EdgesForNodes(ctx, []string{paths["sub/"], paths["img/"]})
+	require.NoError(t, err)
+	assert.Len(t, edges, 3)
+
+	t.Run("reimport", func(t *testing.T) {
+		// Edge added by hand is kept on re-import.
+		require.NoError(t, s.EdgesAdd(ctx, []storage.Edge{
+			{SrcID: paths["Home.md"], DstID: paths["sub/"], Relation: storage.EdgeRelLink},
+		}))
+		writeFiles(t, dir, map[string]string{"Home.md": "only [[Plan]]\n"})
+		result, err := im.Import(ctx, dir)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Updated)
+		assert.Equal(t, 5, result.Unchanged)
+		assert.Empty(t, result.Unresolved)
+
+		paths2, err := s.QueryAttributeIndexScoped(ctx, MarkdownPathAttr, MarkdownVaultAttr, vault)
+		require.NoError(t, err)
+		assert.Equal(t, paths, paths2)
+		edges, err := s.EdgesForNodes(ctx, []string{paths["Home.md"]})
+		require.NoError(t, err)
+		var links []string
+		for _, edge := range edges {
+			if edge.SrcID == paths["Home.md"] {
+				links = append(links, edge.DstID)
+			}
+		}
+		assert.ElementsMatch(t, []string{"plan-1", paths["sub/"]}, links)
+	})
+
+	t.Run("other_directory", func(t *testing.T) {
+		other := t.TempDir()
+		writeFiles(t, other, map[string]string{"Home.md": "other [[Plan]]\n", "Plan.md": "plan\n"})
+		result, err := im.Import(ctx, other)
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Created)
+		assert.Zero(t, result.Updated)
+
+		otherVault, err := filepath.Abs(other)
+		require.NoError(t, err)
+		otherPaths, err := s.QueryAttributeIndexScoped(ctx, MarkdownPathAttr, MarkdownVaultAttr, otherVault)
+		require.NoError(t, err)
+		assert.NotEqual(t, paths["Home.md"], otherPaths["Home.md"])
+		paths2, err := s.QueryAttributeIndexScoped(ctx, MarkdownPathAttr, MarkdownVaultAttr, vault)
+		require.NoError(t, err)
+		assert.Equal(t, paths, paths2)
+	})
+}
+
+func clearAttrTimes(attrs []storage.NodeAttribute) []storage.NodeAttribute {
+	for i := range attrs {
+		attrs[i].CreatedAt = time.Time{}
+	}
+	return attrs
+}
+
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		rel, _ := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestMarkdownExport(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := testStorage(t)
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"Home.md":      "---\ntitle: 'Home: start'\ncreated: 2023-01-02T10:00:00Z\nupdated: 2023-01-03T10:00:00Z\ntags: [a, b]\n---\nsee [[Plan]]\n",
+		"sub/Plan.md":  "---\nid: plan-1\n---\nback to [[Home]]\n",
+		"img/logo.png": "PNG",
+		"Note.md":      "![[logo.png]]\n",
+	})
+	_, err := NewMarkdownImporter(logger, s).Import(ctx, src)
+	require.NoError(t, err)
+
+	exported := filepath.Join(t.TempDir(), "export")
+	result, err := NewMarkdownExporter(logger, s).Export(ctx, exported)
+	require.NoError(t, err)
+	assert.Equal(t, MarkdownExportResult{Notes: 5, Attachments: 1, Links: 3}, result)
+	files := readFiles(t, exported)
+	assert.ElementsMatch(t, []string{"Home.md", "Note.md", "img.md", "img/logo.png", "sub.md", "sub/Plan.md"}, keys(files))
+	paths, err := s.QueryAttributeIndex(ctx, MarkdownPathAttr)
+	require.NoError(t, err)
+	assert.Equal(t, "---\n"+
+		"id: "+paths["Home.md"]+"\n"+
+		"title: 'Home: start'\n"+
+		"created: 2023-01-02T10:00:00Z\n"+
+		"updated: 2023-01-03T10:00:00Z\n"+
+		"tags:\n  - a\n  - b\n"+
+		"---\nsee [[Plan]]\n", files["Home.md"])
+	// Link by file name resolves, so it isn't listed in front matter.
+	assert.Contains(t, files["sub/Plan.md"], "id: plan-1\n")
+	assert.NotContains(t, files["sub/Plan.md"], "links:")
+
+	_, err = NewMarkdownExporter(logger, s).Export(ctx, exported)
+	assert.Error(t, err, "not empty")
+
+	t.Run("round_trip", func(t *testing.T) {
+		s2 := testStorage(t)
+		result, err := NewMarkdownImporter(logger, s2).Import(ctx, exported)
+		require.NoError(t, err)
+		assert.Equal(t, 6, result.Created)
+		assert.Empty(t, result.Unresolved)
+		exported2 := filepath.Join(t.TempDir(), "export")
+		_, err = NewMarkdownExporter(logger, s2).Export(ctx, exported2)
+		require.NoError(t, err)
+		assert.Equal(t, files, readFiles(t, exported2))
+	})
+
+	t.Run("reserved_keys", func(t *testing.T) {
+		s := testStorage(t)
+		hash, err := s.NodeContentSave(ctx, strings.NewReader("text"))
+		require.NoError(t, err)
+		attrs := []storage.NodeAttribute{
+			{Key: "title", Value: "attr title"},
+			{Key: "date", Value: "2020-01-01"},
+			{Key: "attr.links", Value: "escaped"},
+			{Key: "color", Value: "red"},
+			{Key: TagAttr, Value: "tagged"},
+			{Key: "tags", Value: "plain"},
+		}
+		require.NoError(t, s.NodeSave(ctx, storage.Node{
+			ID: "reserved", Name: "Reserved", ContentHash: hash, ContentMimetype: markdownMimetype, Attributes: attrs,
+		}))
+		exported := filepath.Join(t.TempDir(), "export")
+		_, err = NewMarkdownExporter(logger, s).Export(ctx, exported)
+		require.NoError(t, err)
+		files := readFiles(t, exported)
+		assert.Contains(t, files["Reserved.md"], "title: Reserved\n")
+		assert.Contains(t, files["Reserved.md"], "attr.title: attr title\n")
+		assert.Contains(t, files["Reserved.md"], "attr.attr.links: escaped\n")
+		assert.Contains(t, files["Reserved.md"], "tags: tagged\n")
+		assert.Contains(t, files["Reserved.md"], "attr.tags: plain\n")
+
+		s2 := testStorage(t)
+		_, err = NewMarkdownImporter(logger, s2).Import(ctx, exported)
+		require.NoError(t, err)
+		nodes, err := s2.NodesLoad(ctx, []string{"reserved"})
+		require.NoError(t, err)
+		require.Contains(t, nodes, "reserved")
+		assert.Equal(t, "Reserved", nodes["reserved"].Name)
+		assert.Subset(t, clearAttrTimes(nodes["reserved"].Attributes), attrs)
+	})
+}
+
+func keys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+const (
+	// micropostMaxLength limits length of micro post text in characters.
+	micropostMaxLength = 5000
+	// micropostNameLength limits length of node name made of the first line of text.
+	micropostNameLength = 80
+)
+
+var ErrInvalidMicropost = errors.New("invalid micro post")
+
+// MicropostImage is image attached to micro post, given either as data or as hash of uploaded content.
+type MicropostImage struct {
+	Name        string
+	Mimetype    string
+	Data        []byte
+	ContentHash string
+}
+
+// Micropost is saved micro post.
+type Micropost struct {
+	Node storage.Node
+	Text string
+	// ImageIDs are IDs of attached image nodes in order.
+	ImageIDs []string
+}
+
+// Microposts creates micro posts: short timestamped markdown notes of kind "micro" like messenger messages. Inline
+// hashtags of the text become tags, attached images are nodes linked from the post by "attachment" edges.
+type Microposts struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+}
+
+func NewMicroposts(logger *slog.Logger, storage *storage.Storage) *Microposts {
+	return &Microposts{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+// Post creates micro post with text and images, at least one of them is required.
+func (m *Microposts) Post(ctx context.Context, text string, images []MicropostImage) (Micropost, error) {
+	text = strings.TrimSpace(text)
+	if text == "" && len(images) == 0 {
+		return Micropost{}, fmt.Errorf("%w: text or image is required", ErrInvalidMicropost)
+	}
+	if n := utf8.RuneCountInString(text); n > micropostMaxLength {
+		return Micropost{}, fmt.Errorf("%w: text is %d characters long, limit is %d", ErrInvalidMicropost, n, micropostMaxLength)
+	}
+
+	// Post is saved with its images in one transaction, so it is either saved entirely or not at all.
+	post := Micropost{Text: text, ImageIDs: make([]string, 0, len(images))}
+	nodes := make([]storage.Node, 0, len(images)+1)
+	for i, image := range images {
+		node, err := m.imageNode(ctx, image)
+		if err != nil {
+			return Micropost{}, fmt.Errorf("image %d: %w", i+1, err)
+		}
+		nodes = append(nodes, node)
+		post.ImageIDs = append(post.ImageIDs, node.ID)
+	}
+
+	hash, err := m.storage.NodeContentSave(ctx, strings.NewReader(text))
+	if err != nil {
+		return Micropost{}, err
+	}
+	id, err := m.storage.GenerateNodeIDFor(ctx, hash)
+	if err != nil {
+		return Micropost{}, err
+	}
+	name, _, _ := strings.Cut(text, "\n")
+	if utf8.RuneCountInString(name) > micropostNameLength {
+		name = string([]rune(name)[:micropostNameLength-1]) + "…"
+	}
+	attrs := []storage.NodeAttribute{{Key: storage.NodeAttrKind, Value: storage.NodeAttrKindMicro}}
+	for _, tag := range ExtractHashtags(text) {
+		attrs = append(attrs, storage.NodeAttribute{Key: TagAttr, Value: tag})
+	}
+	nodes = append(nodes, storage.Node{
+		ID:              id,
+		Name:            strings.TrimSpace(name),
+		ContentHash:     hash,
+		ContentMimetype: markdownMimetype,
+		Attributes:      attrs,
+	})
+	edges := make([]storage.Edge, 0, len(post.ImageIDs))
+	for _, imageID := range post.ImageIDs {
+		edges = append(edges, storage.Edge{SrcID: id, DstID: imageID, Relation: storage.EdgeRelAttachment})
+	}
+	if err := m.storage.NodesSaveWithEdges(ctx, nodes, edges); err != nil {
+		return Micropost{}, err
+	}
+
+	saved, err := m.storage.NodesLoad(ctx, []string{id})
+	if err != nil {
+		return Micropost{}, err
+	}
+	post.Node = saved[id]
+	return post, nil
+}
+
+// imageNode returns node of attached image, its content is saved unless given by hash.
+func (m *Microposts) imageNode(ctx context.Context, image MicropostImage) (storage.Node, error) {
+	hash := image.ContentHash
+	mimetype := image.Mimetype
+	switch {
+	case len(image.Data) > 0 && hash != "":
+		return storage.Node{}, fmt.Errorf("%w: either data or content hash of image is expected", ErrInvalidMicropost)
+	case len(image.Data) > 0:
+		if mimetype == "" {
+			mimetype = http.DetectContentType(image.Data)
+		}
+		if !isImageMimetype(mimetype) {
+			return storage.Node{}, fmt.Errorf("%w: %q is not an image", ErrInvalidMicropost, mimetype)
+		}
+		var err error
+		if hash, err = m.storage.NodeContentSave(ctx, bytes.NewReader(image.Data)); err != nil {
+			return storage.Node{}, err
+		}
+	case hash != "":
+		r, err := m.storage.NodeContentLoad(ctx, hash)
+		if errors.Is(err, storage.ErrNoRecord) {
+			return storage.Node{}, fmt.Errorf("%w: content %q not found", ErrInvalidMicropost, hash)
+		}
+		if err != nil {
+			return storage.Node{}, err
+		}
+		head, err := io.ReadAll(io.LimitReader(r, 512))
+		if err = errors.Join(err, r.Close()); err != nil {
+			return storage.Node{}, err
+		}
+		if mimetype == "" {
+			mimetype = http.DetectContentType(head)
+		}
+		if !isImageMimetype(mimetype) {
+			return storage.Node{}, fmt.Errorf("%w: %q is not an image", ErrInvalidMicropost, mimetype)
+		}
+	default:
+		return storage.Node{}, fmt.Errorf("%w: image data is empty", ErrInvalidMicropost)
+	}
+	id, err := m.storage.GenerateNodeIDFor(ctx, hash)
+	if err != nil {
+		return storage.Node{}, err
+	}
+	return storage.Node{
+		ID:              id,
+		Name:            image.Name,
+		ContentHash:     hash,
+		ContentMimetype: mimetype,
+	}, nil
+}
+
+func isImageMimetype(mimetype string) bool {
+	mediaType, _, _ := mime.ParseMediaType(mimetype)
+	return strings.HasPrefix(mediaType, "image/")
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPNG is 1x1 PNG image.
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89" +
+	"\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func TestMicroposts(t *testing.T) {
+	ctx := context.Background()
+	s := testStorage(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := NewMicroposts(logger, s)
+
+	post, err := m.Post(ctx, "  First line #dev\nsecond line ", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "First line #dev", post.Node.Name)
+	assert.Equal(t, "First line #dev\nsecond line", post.Text)
+	assert.Equal(t, markdownMimetype, post.Node.ContentMimetype)
+	assert.True(t, isMicropost(post.Node))
+	assert.Empty(t, post.ImageIDs)
+
+	uploaded, err := s.NodeContentSave(ctx, strings.NewReader(string(testPNG)))
+	require.NoError(t, err)
+	withImages, err := m.Post(ctx, "", []MicropostImage{
+		{Name: "a.png", Data: testPNG},
+		{ContentHash: uploaded},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, withImages.Node.Name)
+	require.Len(t, withImages.ImageIDs, 2)
+	nodes, err := s.NodesLoad(ctx, withImages.ImageIDs)
+	require.NoError(t, err)
+	assert.Equal(t, "a.png", nodes[withImages.ImageIDs[0]].Name)
+	assert.Equal(t, "image/png", nodes[withImages.ImageIDs[0]].ContentMimetype)
+	assert.Equal(t, "image/png", nodes[withImages.ImageIDs[1]].ContentMimetype)
+
+	long, err := m.Post(ctx, strings.Repeat("й", 100), nil)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("й", micropostNameLength-1)+"…", long.Node.Name)
+
+	t.Run("errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			text   string
+			images []MicropostImage
+		}{
+			{text: " \n"},
+			{text: strings.Repeat("a", micropostMaxLength+1)},
+			{images: []MicropostImage{{}}},
+			{images: []MicropostImage{{Data: []byte("text")}}},
+			{images: []MicropostImage{{Data: testPNG, Mimetype: "application/pdf"}}},
+			{images: []MicropostImage{{Data: testPNG, ContentHash: uploaded}}},
+			{images: []MicropostImage{{ContentHash: "missing"}}},
+		} {
+			_, err := m.Post(ctx, tc.text, tc.images)
+			assert.ErrorIs(t, err, ErrInvalidMicropost)
+		}
+	})
+
+	t.Run("nothing saved on error", func(t *testing.T) {
+		before, err := s.QueryTimeline(ctx, "", storage.TimelineCursor{}, false, 1000)
+		require.NoError(t, err)
+		_, err = m.Post(ctx, "text", []MicropostImage{{Data: testPNG}, {ContentHash: "missing"}})
+		assert.ErrorIs(t, err, ErrInvalidMicropost)
+		after, err := s.QueryTimeline(ctx, "", storage.TimelineCursor{}, false, 1000)
+		require.NoError(t, err)
+		assert.Equal(t, before, after)
+	})
+}
+
+func TestTimeline(t *testing.T) {
+	ctx := context.Background()
+	s := testStorage(t)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := NewMicroposts(logger, s)
+	tl := NewTimeline(logger, s)
+
+	day := time.Date(2024, 5, 1, 22, 30, 0, 0, time.UTC)
+	// Posts made in the past, two of them per day.
+	var ids []string
+	for i := range 5 {
+		hash, err := s.NodeContentSave(ctx, strings.NewReader("post "+string(rune('a'+i))))
+		require.NoError(t, err)
+		id, err := s.GenerateNodeID(ctx)
+		require.NoError(t, err)
+		require.NoError(t, s.NodeSave(ctx, storage.Node{
+			ID:              id,
+			ContentHash:     hash,
+			ContentMimetype: markdownMimetype,
+			CreatedAt:       day.Add(time.Duration(i) * 12 * time.Hour),
+			Attributes:      []storage.NodeAttribute{{Key: storage.NodeAttrKind, Value: storage.NodeAttrKindMicro}},
+		}))
+		ids = append(ids, id)
+	}
+	image, err := m.Post(ctx, "with image", []MicropostImage{{Data: testPNG}})
+	require.NoError(t, err)
+
+	entryIDs := func(page TimelinePage) map[string][]string {
+		days := make(map[string][]string)
+		for _, day := range page.Days {
+			for _, entry := range day.Entries {
+				days[day.Date] = append(days[day.Date], entry.Node.ID)
+			}
+		}
+		return days
+	}
+
+	page, err := tl.Page(ctx, TimelineQuery{Kind: storage.NodeAttrKindMicro, Limit: 3})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"2024-05-01": {ids[0]},
+		"2024-05-02": {ids[1], ids[2]},
+	}, entryIDs(page))
+	assert.Equal(t, "post a", page.Days[0].Entries[0].Text)
+	require.NotEmpty(t, page.NextCursor)
+
+	page, err = tl.Page(ctx, TimelineQuery{Kind: storage.NodeAttrKindMicro, Limit: 3, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Days, 2)
+	assert.Equal(t, []string{ids[3], ids[4]}, entryIDs(page)["2024-05-03"])
+	last := page.Days[1].Entries[0]
+	assert.Equal(t, image.Node.ID, last.Node.ID)
+	assert.Equal(t, image.ImageIDs, last.AttachmentIDs)
+	assert.Empty(t, page.NextCursor)
+
+	// All nodes include attached image, days are in given time zone.
+	location := time.FixedZone("UTC+3", 3*60*60)
+	page, err = tl.Page(ctx, TimelineQuery{Desc: true, Limit: 10, Location: location})
+	require.NoError(t, err)
+	assert.Len(t, page.Days, 4)
+	assert.Equal(t, []string{ids[4]}, entryIDs(page)["2024-05-04"])
+	assert.Equal(t, []string{ids[3], ids[2]}, entryIDs(page)["2024-05-03"])
+	assert.Equal(t, []string{ids[1], ids[0]}, entryIDs(page)["2024-05-02"])
+	assert.Len(t, page.Days[0].Entries, 2)
+
+	_, err = tl.Page(ctx, TimelineQuery{Cursor: "invalid"})
+	assert.ErrorIs(t, err, ErrInvalidTimelineCursor)
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+const (
+	// TagAttr is attribute key of node tags.
+	TagAttr = "tag"
+	// QueryAttr is attribute key of saved search node holding NodeQuery.
+	QueryAttr = "query"
+)
+
+// Kinds of NodeQuery.
+const (
+	NodeQueryTag    = "tag"
+	NodeQueryList   = "list"
+	NodeQueryTree   = "tree"
+	NodeQuerySearch = "search"
+)
+
+// nodeQuerySearchLimit limits number of nodes selected by full text search.
+const nodeQuerySearchLimit = 1000
+
+// NodeQuery selects set of nodes to publish or syndicate:
+//   - "tag:<tag>" selects nodes with the tag or tags nested in it, e.g. "dev/db" for "dev";
+//   - "list:<node id>" selects items of the list, chained from the head node;
+//   - "tree:<node id>" selects the node and all its descendants;
+//   - "search:<terms>" selects nodes found by full text search.
+type NodeQuery struct {
+	Kind  string
+	Value string
+}
+
+func ParseNodeQuery(s string) (NodeQuery, error) {
+	kind, value, ok := strings.Cut(s, ":")
+	if !ok || value == "" {
+		return NodeQuery{}, fmt.Errorf("invalid query %q: expected <kind>:<value>", s)
+	}
+	switch kind {
+	case NodeQueryTag, NodeQueryList, NodeQueryTree, NodeQuerySearch:
+		return NodeQuery{Kind: kind, Value: value}, nil
+	}
+	return NodeQuery{}, fmt.Errorf("invalid query %q: unknown kind %q", s, kind)
+}
+
+func (q NodeQuery) String() string {
+	return q.Kind + ":" + q.Value
+}
+
+// Ordered reports whether query results have meaningful order, otherwise they are sorted by time.
+func (q NodeQuery) Ordered() bool {
+	return q.Kind == NodeQueryList || q.Kind == NodeQueryTree
+}
+
+// QueryNodes returns IDs of non-deleted nodes selected by query.
+func QueryNodes(ctx context.Context, s *storage.Storage, q NodeQuery) ([]string, error) {
+	switch q.Kind {
+	case NodeQueryTag:
+		return s.QueryByAttributeTree(ctx, TagAttr, q.Value)
+	case NodeQueryList:
+		return s.QueryWalk(ctx, q.Value, storage.EdgeRelChain)
+	case NodeQueryTree:
+		nodes, err := s.NodesLoad(ctx, []string{q.Value})
+		if err != nil {
+			return nil, err
+		}
+		if root, ok := nodes[q.Value]; !ok || root.IsDeleted() {
+			return nil, fmt.Errorf("node %q: %w", q.Value, storage.ErrNoRecord)
+		}
+		ids, err := s.QueryWalk(ctx, q.Value, storage.EdgeRelChild)
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{q.Value}, ids...), nil
+	case NodeQuerySearch:
+		return s.QueryFullTextSearch(ctx, q.Value, nodeQuerySearchLimit)
+	}
+	return nil, fmt.Errorf("unknown query kind %q", q.Kind)
+}
+
+// ResolveNodeQuery returns query given as query string, as ID of saved search node or as ID of list head node, and
+// title of the selection: name of the node or the query itself.
+func ResolveNodeQuery(ctx context.Context, s *storage.Storage, queryOrID string) (NodeQuery, string, error) {
+	if q, err := ParseNodeQuery(queryOrID); err == nil {
+		return q, q.String(), nil
+	}
+	nodes, err := s.NodesLoad(ctx, []string{queryOrID})
+	if err != nil {
+		return NodeQuery{}, "", err
+	}
+	node, ok := nodes[queryOrID]
+	if !ok || node.IsDeleted() {
+		return NodeQuery{}, "", fmt.Errorf("node %q: %w", queryOrID, storage.ErrNoRecord)
+	}
+	q := NodeQuery{Kind: NodeQueryList, Value: node.ID}
+	for _, attr := range node.Attributes {
+		if attr.Key == QueryAttr {
+			if q, err = ParseNodeQuery(attr.Value); err != nil {
+				return NodeQuery{}, "", fmt.Errorf("saved search %q: %w", node.ID, err)
+			}
+			break
+		}
+	}
+	return q, nodeTitle(node), nil
+}
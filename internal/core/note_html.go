@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"html"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/brainmorsel/libreta/pkg/mdhtml"
+)
+
+// noteLinks resolves wikilinks and relative links of notes rendered to HTML into URLs of known nodes.
+type noteLinks struct {
+	ids map[string]string // lower case node ID, name or import path -> node ID
+	url func(id string) (href string, image bool)
+}
+
+func newNoteLinks(url func(id string) (href string, image bool)) *noteLinks {
+	return &noteLinks{
+		ids: make(map[string]string),
+		url: url,
+	}
+}
+
+// add makes node resolvable by ID, name and import path.
+func (l *noteLinks) add(node storage.Node) {
+	keys := []string{node.ID, node.Name, strings.TrimSuffix(node.Name, markdownExt)}
+	for _, attr := range node.Attributes {
+		if attr.Key == MarkdownPathAttr {
+			p := strings.TrimSuffix(attr.Value, markdownExt)
+			keys = append(keys, attr.Value, p, path.Base(attr.Value), path.Base(p))
+		}
+	}
+	for _, key := range keys {
+		key = strings.ToLower(key)
+		if _, ok := l.ids[key]; !ok && key != "" {
+			l.ids[key] = node.ID
+		}
+	}
+}
+
+// resolve returns URL of node for wikilink target.
+func (l *noteLinks) resolve(target string) (href string, image bool, ok bool) {
+	key := strings.ToLower(strings.TrimSpace(target))
+	id, ok := l.ids[key]
+	if !ok {
+		id, ok = l.ids[path.Base(key)]
+	}
+	if !ok {
+		return "", false, false
+	}
+	href, image = l.url(id)
+	return href, image, true
+}
+
+// resolveURL rewrites relative link destination to URL of node, other destinations are kept.
+func (l *noteLinks) resolveURL(dest string) string {
+	u, err := url.Parse(dest)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return dest
+	}
+	href, _, ok := l.resolve(path.Clean(u.Path))
+	if !ok {
+		return dest
+	}
+	if u.Fragment != "" {
+		href += "#" + u.EscapedFragment()
+	}
+	return href
+}
+
+// renderNoteHTML renders markdown note to HTML, other text is rendered preformatted.
+func renderNoteHTML(content []byte, mimetype string, links *noteLinks) string {
+	if mimetype, _, _ := mime.ParseMediaType(mimetype); mimetype != markdownMimetype && mimetype != "text/x-markdown" {
+		return "<pre>" + html.EscapeString(string(content)) + "</pre>\n"
+	}
+	_, body := splitFrontMatter(content)
+	return mdhtml.Render(body, mdhtml.Options{
+		Wikilink: func(target string, _ bool) (string, bool, bool) { return links.resolve(target) },
+		URL:      links.resolveURL,
+	})
+}
+
+func loadNodeContent(ctx context.Context, s *storage.Storage, hash string) ([]byte, error) {
+	r, err := s.NodeContentLoad(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(r)
+	return content, errors.Join(err, r.Close())
+}
@@ -0,0 +1,568 @@
+package core
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+const (
+	publishBatchSize = 500
+	publishFeedFile  = "feed.atom"
+	publishFeedLimit = 50
+)
+
+//go:embed themes/default
+var defaultThemeFS embed.FS
+
+// PublishConfig customizes published site.
+type PublishConfig struct {
+	Title string
+	// BaseURL is absolute URL of the site used in the feed, links are relative when empty.
+	BaseURL string
+	// ThemeDir overrides files of the default theme: templates "layout.html", "index.html", "note.html",
+	// "tag.html" and static files, e.g. "style.css".
+	ThemeDir string
+}
+
+// PublishResult counts published pages and files.
+type PublishResult struct {
+	Notes       int
+	Tags        int
+	Attachments int
+}
+
+// Publisher renders nodes selected by query into static HTML site.
+//
+// Text nodes become pages "notes/<id>.html" with backlinks from other published notes, markdown is rendered to
+// HTML with wikilinks resolved to published nodes only. Other selected nodes and nodes linked from published notes
+// are copied into "files". Site also has index page, page per tag "tags/<tag>.html" and Atom feed of the latest
+// notes.
+type Publisher struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+}
+
+func NewPublisher(logger *slog.Logger, storage *storage.Storage) *Publisher {
+	return &Publisher{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+type publishSite struct {
+	Title     string
+	Feed      string
+	Generated time.Time
+	Notes     []*publishNote
+	Tags      []*publishTag
+}
+
+type publishNote struct {
+	ID        string
+	Title     string
+	URL       string
+	Created   time.Time
+	Updated   time.Time
+	HTML      template.HTML
+	Tags      []*publishTag
+	Backlinks []*publishNote
+	Files     []*publishFile
+
+	node storage.Node
+}
+
+type publishTag struct {
+	Name  string
+	URL   string
+	Notes []*publishNote
+}
+
+type publishFile struct {
+	Name     string
+	URL      string
+	Mimetype string
+	Size     int64
+
+	node storage.Node
+}
+
+// publishPage is data of page template. URLs of notes, tags and files are relative to the site root, Root is
+// relative path from the page to the site root.
+type publishPage struct {
+	Site  *publishSite
+	Root  string
+	Title string
+	Notes []*publishNote
+	Tags  []*publishTag
+	Note  *publishNote
+	Tag   *publishTag
+}
+
+type publish struct {
+	*Publisher
+	dir    string
+	config PublishConfig
+	result PublishResult
+
+	site  publishSite
+	notes map[string]*publishNote
+	files map[string]*publishFile
+	links *noteLinks
+	taken map[string]bool // lower case paths of output files
+}
+
+// Publish writes site of nodes selected by query into dir, which must be empty or not exist.
+func (p *Publisher) Publish(ctx context.Context, query NodeQuery, dir string, config PublishConfig) (PublishResult, error) {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return PublishResult{}, fmt.Errorf("directory %q is not empty", dir)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return PublishResult{}, err
+	}
+	if config.Title == "" {
+		config.Title = query.String()
+	}
+	if config.BaseURL != "" && !strings.HasSuffix(config.BaseURL, "/") {
+		config.BaseURL += "/"
+	}
+	tmpl, err := loadTheme(config.ThemeDir)
+	if err != nil {
+		return PublishResult{}, err
+	}
+	pub := &publish{
+		Publisher: p,
+		dir:       dir,
+		config:    config,
+		site:      publishSite{Title: config.Title, Feed: publishFeedFile, Generated: time.Now()},
+		notes:     make(map[string]*publishNote),
+		files:     make(map[string]*publishFile),
+		taken:     make(map[string]bool),
+	}
+	pub.links = newNoteLinks(pub.url)
+	ids, err := QueryNodes(ctx, p.storage, query)
+	if err != nil {
+		return pub.result, fmt.Errorf("query nodes: %w", err)
+	}
+	if err := pub.load(ctx, ids); err != nil {
+		return pub.result, err
+	}
+	if !query.Ordered() {
+		sort.SliceStable(pub.site.Notes, func(i, j int) bool {
+			return pub.site.Notes[i].Created.After(pub.site.Notes[j].Created)
+		})
+		for _, tag := range pub.site.Tags {
+			sort.SliceStable(tag.Notes, func(i, j int) bool {
+				return tag.Notes[i].Created.After(tag.Notes[j].Created)
+			})
+		}
+	}
+	for _, note := range pub.site.Notes {
+		if err := pub.render(ctx, note); err != nil {
+			return pub.result, fmt.Errorf("render node %q: %w", note.ID, err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return pub.result, err
+	}
+	if err := pub.writePage(tmpl, "index.html", "index.html", publishPage{
+		Notes: pub.site.Notes,
+		Tags:  pub.site.Tags,
+	}); err != nil {
+		return pub.result, err
+	}
+	for _, note := range pub.site.Notes {
+		if err := pub.writePage(tmpl, "note.html", note.URL, publishPage{
+			Title: note.Title,
+			Tags:  note.Tags,
+			Note:  note,
+		}); err != nil {
+			return pub.result, err
+		}
+		pub.result.Notes++
+	}
+	for _, tag := range pub.site.Tags {
+		if err := pub.writePage(tmpl, "tag.html", tag.URL, publishPage{
+			Title: "#" + tag.Name,
+			Notes: tag.Notes,
+			Tag:   tag,
+		}); err != nil {
+			return pub.result, err
+		}
+		pub.result.Tags++
+	}
+	for _, file := range pub.files {
+		if err := pub.writeFile(ctx, file); err != nil {
+			return pub.result, fmt.Errorf("copy node %q: %w", file.node.ID, err)
+		}
+		pub.result.Attachments++
+	}
+	if err := pub.writeFeed(); err != nil {
+		return pub.result, err
+	}
+	if err := pub.copyThemeFiles(); err != nil {
+		return pub.result, fmt.Errorf("copy theme files: %w", err)
+	}
+	return pub.result, nil
+}
+
+// loadTheme parses default templates and overrides them by templates of themeDir with the same names.
+func loadTheme(themeDir string) (*template.Template, error) {
+	tmpl, err := template.ParseFS(defaultThemeFS, "themes/default/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("parse default theme: %w", err)
+	}
+	if themeDir == "" {
+		return tmpl, nil
+	}
+	files, err := filepath.Glob(filepath.Join(themeDir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		if tmpl, err = tmpl.ParseFiles(files...); err != nil {
+			return nil, fmt.Errorf("parse theme: %w", err)
+		}
+	}
+	return tmpl, nil
+}
+
+// load reads selected nodes, files they link to and links between notes.
+func (pub *publish) load(ctx context.Context, ids []string) error {
+	nodes, err := pub.loadNodes(ctx, ids)
+	if err != nil {
+		return err
+	}
+	var edges []storage.Edge
+	for batch := ids; len(batch) > 0; {
+		n := min(len(batch), publishBatchSize)
+		batchEdges, err := pub.storage.EdgesForNodes(ctx, batch[:n])
+		if err != nil {
+			return err
+		}
+		edges = append(edges, batchEdges...)
+		batch = batch[n:]
+	}
+	sort.SliceStable(edges, func(i, j int) bool {
+		return edges[i].CreatedAt.Before(edges[j].CreatedAt)
+	})
+	var linked []string
+	for _, edge := range edges {
+		_, srcOK := nodes[edge.SrcID]
+		if _, ok := nodes[edge.DstID]; srcOK && !ok && edge.Relation != storage.EdgeRelChain {
+			linked = append(linked, edge.DstID)
+		}
+	}
+	linkedNodes, err := pub.loadNodes(ctx, linked)
+	if err != nil {
+		return err
+	}
+
+	tags := make(map[string]*publishTag)
+	for _, id := range ids {
+		node, ok := nodes[id]
+		if !ok || pub.notes[id] != nil || pub.files[id] != nil {
+			continue
+		}
+		if !storage.IsTextMimetype(node.ContentMimetype) {
+			pub.addFile(node)
+			continue
+		}
+		note := &publishNote{
+			ID:      id,
+			Title:   nodeTitle(node),
+			URL:     pub.place("notes", exportFileName(id, "note"), ".html"),
+			Created: node.CreatedAt,
+			Updated: node.UpdatedAt,
+			node:    node,
+		}
+		for _, attr := range node.Attributes {
+			if attr.Key != TagAttr {
+				continue
+			}
+			tag, ok := tags[attr.Value]
+			if !ok {
+				tag = &publishTag{Name: attr.Value, URL: pub.place("tags", tagFileName(attr.Value), ".html")}
+				tags[attr.Value] = tag
+				pub.site.Tags = append(pub.site.Tags, tag)
+			}
+			tag.Notes = append(tag.Notes, note)
+			note.Tags = append(note.Tags, tag)
+		}
+		pub.notes[id] = note
+		pub.site.Notes = append(pub.site.Notes, note)
+		pub.links.add(node)
+	}
+	sort.Slice(pub.site.Tags, func(i, j int) bool { return pub.site.Tags[i].Name < pub.site.Tags[j].Name })
+
+	for _, edge := range edges {
+		if edge.Relation == storage.EdgeRelChain || edge.SrcID == edge.DstID {
+			continue
+		}
+		src, ok := pub.notes[edge.SrcID]
+		if !ok {
+			continue
+		}
+		if dst, ok := pub.notes[edge.DstID]; ok {
+			if edge.Relation == storage.EdgeRelLink && !contains(dst.Backlinks, src) {
+				dst.Backlinks = append(dst.Backlinks, src)
+			}
+			continue
+		}
+		file := pub.files[edge.DstID]
+		if file == nil {
+			node, ok := linkedNodes[edge.DstID]
+			if !ok || storage.IsTextMimetype(node.ContentMimetype) {
+				continue
+			}
+			file = pub.addFile(node)
+		}
+		if !contains(src.Files, file) {
+			src.Files = append(src.Files, file)
+		}
+	}
+	return nil
+}
+
+func contains[T comparable](items []T, item T) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// loadNodes returns non-deleted nodes by IDs.
+func (pub *publish) loadNodes(ctx context.Context, ids []string) (map[string]storage.Node, error) {
+	nodes := make(map[string]storage.Node)
+	for batch := ids; len(batch) > 0; {
+		n := min(len(batch), publishBatchSize)
+		loaded, err := pub.storage.NodesLoad(ctx, batch[:n])
+		if err != nil {
+			return nil, err
+		}
+		for id, node := range loaded {
+			if !node.IsDeleted() {
+				nodes[id] = node
+			}
+		}
+		batch = batch[n:]
+	}
+	return nodes, nil
+}
+
+func (pub *publish) addFile(node storage.Node) *publishFile {
+	name, ext := node.Name, path.Ext(node.Name)
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(node.ContentMimetype); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	if name == "" {
+		name = node.ID + ext
+	}
+	file := &publishFile{
+		Name:     name,
+		URL:      pub.place("files", exportFileName(node.ID, "file"), ext),
+		Mimetype: node.ContentMimetype,
+		Size:     node.ContentLength,
+		node:     node,
+	}
+	pub.files[node.ID] = file
+	pub.links.add(node)
+	return file
+}
+
+// url returns URL of published node relative to note page.
+func (pub *publish) url(id string) (href string, image bool) {
+	if note, ok := pub.notes[id]; ok {
+		return "../" + escapePath(note.URL), false
+	}
+	file := pub.files[id]
+	return "../" + escapePath(file.URL), strings.HasPrefix(file.Mimetype, "image/")
+}
+
+func (pub *publish) render(ctx context.Context, note *publishNote) error {
+	content, err := loadNodeContent(ctx, pub.storage, note.node.ContentHash)
+	if err != nil {
+		return err
+	}
+	note.HTML = template.HTML(renderNoteHTML(content, note.node.ContentMimetype, pub.links))
+	return nil
+}
+
+func (pub *publish) writePage(tmpl *template.Template, name, p string, page publishPage) error {
+	page.Site = &pub.site
+	page.Root = strings.Repeat("../", strings.Count(p, "/"))
+	filePath := filepath.Join(pub.dir, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.ExecuteTemplate(f, name, page); err != nil {
+		return errors.Join(fmt.Errorf("render %s: %w", p, err), f.Close())
+	}
+	return f.Close()
+}
+
+func (pub *publish) writeFile(ctx context.Context, file *publishFile) error {
+	r, err := pub.storage.NodeContentLoad(ctx, file.node.ContentHash)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	filePath := filepath.Join(pub.dir, filepath.FromSlash(file.URL))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(filePath, file.node.UpdatedAt, file.node.UpdatedAt)
+}
+
+// writeFeed writes Atom feed of the latest notes. Entry links are relative to the feed unless base URL is set.
+func (pub *publish) writeFeed() error {
+	notes := append([]*publishNote(nil), pub.site.Notes...)
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].Created.After(notes[j].Created) })
+	feed := Feed{
+		ID:    pub.config.BaseURL,
+		Title: pub.config.Title,
+		Link:  pub.config.BaseURL + "index.html",
+	}
+	if feed.ID == "" {
+		feed.ID = "urn:libreta:site:" + url.PathEscape(pub.config.Title)
+	}
+	for _, note := range notes[:min(len(notes), publishFeedLimit)] {
+		if note.Updated.After(feed.Updated) {
+			feed.Updated = note.Updated
+		}
+		entry := FeedEntry{
+			ID:        nodeURN(note.ID),
+			Title:     note.Title,
+			Link:      pub.config.BaseURL + escapePath(note.URL),
+			Published: note.Created,
+			Updated:   note.Updated,
+			HTML:      string(note.HTML),
+		}
+		for _, tag := range note.Tags {
+			entry.Tags = append(entry.Tags, tag.Name)
+		}
+		for _, file := range note.Files {
+			entry.Enclosures = append(entry.Enclosures, FeedEnclosure{
+				URL:    pub.config.BaseURL + escapePath(file.URL),
+				Type:   file.Mimetype,
+				Length: file.Size,
+			})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	f, err := os.Create(filepath.Join(pub.dir, publishFeedFile))
+	if err != nil {
+		return err
+	}
+	if err := feed.WriteAtom(f); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	return f.Close()
+}
+
+// copyThemeFiles copies static files of the default theme and the theme dir, except templates.
+func (pub *publish) copyThemeFiles() error {
+	theme, err := fs.Sub(defaultThemeFS, "themes/default")
+	if err != nil {
+		return err
+	}
+	themes := []fs.FS{theme}
+	if pub.config.ThemeDir != "" {
+		themes = append(themes, os.DirFS(pub.config.ThemeDir))
+	}
+	for _, fsys := range themes {
+		err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") || path.Ext(p) == ".html" {
+				return err
+			}
+			data, err := fs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			filePath := filepath.Join(pub.dir, filepath.FromSlash(p))
+			if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+				return err
+			}
+			return os.WriteFile(filePath, data, 0o644)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// place returns unique path for file with name and extension in dir.
+func (pub *publish) place(dir, name, ext string) string {
+	p := path.Join(dir, name)
+	for n := 2; pub.taken[strings.ToLower(p+ext)]; n++ {
+		p = path.Join(dir, fmt.Sprintf("%s-%d", name, n))
+	}
+	pub.taken[strings.ToLower(p+ext)] = true
+	return p + ext
+}
+
+func escapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// tagFileName returns file name of tag page keeping letters and digits only.
+func tagFileName(tag string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, tag)
+	if name = strings.Trim(name, "-"); name == "" {
+		return "tag"
+	}
+	return name
+}
+
+// nodeTitle returns node name or, for unnamed node, its ID.
+func nodeTitle(node storage.Node) string {
+	if node.Name != "" {
+		return node.Name
+	}
+	return node.ID
+}
+
+// nodeURN returns node ID in form of URI, used as stable ID of feed entries.
+func nodeURN(id string) string {
+	return "urn:libreta:node:" + url.PathEscape(id)
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNodeQuery(t *testing.T) {
+	q, err := ParseNodeQuery("tag:blog:2024")
+	require.NoError(t, err)
+	assert.Equal(t, NodeQuery{Kind: NodeQueryTag, Value: "blog:2024"}, q)
+	assert.Equal(t, "tag:blog:2024", q.String())
+
+	for _, s := range []string{"", "tag", "tag:", "folder:x"} {
+		_, err := ParseNodeQuery(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := testStorage(t)
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"Post.md":      "---\ntitle: First <post>\ntags: [blog, go lang]\ncreated: 2024-01-02T10:00:00Z\n---\n# Hi\n[[Other]] [[Private]] ![[logo.png]]\n",
+		"Other.md":     "---\ntags: [blog]\ncreated: 2024-01-03T10:00:00Z\n---\nsee [post](Post.md)\n",
+		"Private.md":   "secret\n",
+		"img/logo.png": "PNG",
+	})
+	_, err := NewMarkdownImporter(logger, s).Import(ctx, src)
+	require.NoError(t, err)
+	paths, err := s.QueryAttributeIndex(ctx, MarkdownPathAttr)
+	require.NoError(t, err)
+	post, other := paths["Post.md"], paths["Other.md"]
+
+	themeDir := t.TempDir()
+	writeFiles(t, themeDir, map[string]string{
+		"tag.html":  `{{template "head" .}}custom {{.Tag.Name}}: {{range .Notes}}{{.Title}};{{end}}{{template "foot" .}}`,
+		"style.css": "body {}",
+		"font.woff": "FONT",
+	})
+	dir := filepath.Join(t.TempDir(), "site")
+	result, err := NewPublisher(logger, s).Publish(ctx, NodeQuery{Kind: NodeQueryTag, Value: "blog"}, dir, PublishConfig{
+		Title:    "Blog",
+		BaseURL:  "https://example.com/blog",
+		ThemeDir: themeDir,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, PublishResult{Notes: 2, Tags: 2, Attachments: 1}, result)
+
+	files := readFiles(t, dir)
+	assert.ElementsMatch(t, []string{
+		"index.html", "notes/" + post + ".html", "notes/" + other + ".html", "tags/blog.html", "tags/go-lang.html",
+		"files/" + paths["img/logo.png"] + ".png", "feed.atom", "style.css", "font.woff",
+	}, keys(files))
+	assert.Equal(t, "PNG", files["files/"+paths["img/logo.png"]+".png"])
+	assert.Equal(t, "body {}", files["style.css"])
+
+	index := files["index.html"]
+	assert.Contains(t, index, `<title>Blog</title>`)
+	assert.Regexp(t, `(?s)notes/`+other+`\.html">Other<.*notes/`+post+`\.html">First &lt;post&gt;<`, index)
+	assert.Contains(t, index, `<a href="tags/go-lang.html">#go lang</a>`)
+
+	page := files["notes/"+post+".html"]
+	assert.Contains(t, page, `<link rel="stylesheet" href="../style.css">`)
+	assert.Contains(t, page, "<h1>Hi</h1>")
+	assert.Contains(t, page, `<a class="wikilink" href="../notes/`+other+`.html">Other</a>`)
+	assert.Contains(t, page, `<span class="wikilink-unresolved">Private</span>`)
+	assert.Contains(t, page, `<img src="../files/`+paths["img/logo.png"]+`.png" alt="logo.png">`)
+	assert.Regexp(t, `(?s)Backlinks.*notes/`+other+`\.html">Other<`, page)
+	assert.Regexp(t, `(?s)Backlinks.*notes/`+post+`\.html">First &lt;post&gt;<`, files["notes/"+other+".html"])
+	assert.Contains(t, files["notes/"+other+".html"], `<a href="../notes/`+post+`.html">post</a>`)
+
+	assert.Contains(t, files["tags/blog.html"], "custom blog: Other;First &lt;post&gt;;")
+
+	feed := files["feed.atom"]
+	assert.Contains(t, feed, `<id>https://example.com/blog/</id>`)
+	assert.Contains(t, feed, `<id>urn:libreta:node:`+post+`</id>`)
+	assert.Contains(t, feed, `<link href="https://example.com/blog/notes/`+post+`.html" rel="alternate" type="text/html"></link>`)
+	assert.Contains(t, feed, `<link href="https://example.com/blog/files/`+paths["img/logo.png"]+`.png" rel="enclosure" type="image/png" length="3"></link>`)
+	assert.Contains(t, feed, `<category term="go lang"></category>`)
+	assert.Contains(t, feed, `&lt;h1&gt;Hi&lt;/h1&gt;`)
+
+	t.Run("tree", func(t *testing.T) {
+		require.NoError(t, s.EdgesAdd(ctx, []storage.Edge{{SrcID: paths["img/"], DstID: other, Relation: storage.EdgeRelChild}}))
+		result, err := NewPublisher(logger, s).Publish(ctx, NodeQuery{Kind: NodeQueryTree, Value: paths["img/"]}, t.TempDir(), PublishConfig{})
+		require.NoError(t, err)
+		assert.Equal(t, PublishResult{Notes: 2, Tags: 1, Attachments: 1}, result)
+
+		_, err = NewPublisher(logger, s).Publish(ctx, NodeQuery{Kind: NodeQueryTree, Value: "missing"}, t.TempDir(), PublishConfig{})
+		assert.ErrorIs(t, err, storage.ErrNoRecord)
+	})
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+const syncFileSuffix = ".db"
+
+var deviceNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidDeviceName reports whether name may be used as device name, it is part of sync file name.
+func ValidDeviceName(name string) bool {
+	return deviceNameRe.MatchString(name) && !strings.HasSuffix(name, ".tmp")
+}
+
+// SyncConfig configures multi-device sync through shared directory (e.g. synced with Syncthing).
+// Each device writes its database copy to "<Dir>/<Device>.db" and merges other devices' copies.
+type SyncConfig struct {
+	Dir      string
+	Device   string
+	Interval time.Duration
+}
+
+// Sync exports own database copy to sync directory and merges copies of other devices. Database file
+// itself is never synced, so concurrent writes on devices can't corrupt it.
+type Sync struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+	config  SyncConfig
+
+	exportedSeq int64
+}
+
+func NewSync(logger *slog.Logger, storage *storage.Storage, config SyncConfig) (*Sync, error) {
+	if !ValidDeviceName(config.Device) {
+		return nil, fmt.Errorf("invalid device name %q", config.Device)
+	}
+	return &Sync{
+		logger:      logger,
+		storage:     storage,
+		config:      config,
+		exportedSeq: -1,
+	}, nil
+}
+
+// SyncReport describes results of sync round.
+type SyncReport struct {
+	Exported bool
+	Merged   map[string]storage.MergeResult
+}
+
+// Run syncs with interval until ctx is done.
+func (s *Sync) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.SyncOnce(ctx); err != nil && ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "sync", slog.Any("error", err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncOnce merges changed files of other devices, then exports own copy if there are changes.
+// Failed peers are logged and skipped, they are retried on next round.
+func (s *Sync) SyncOnce(ctx context.Context) (SyncReport, error) {
+	report := SyncReport{Merged: make(map[string]storage.MergeResult)}
+	if err := os.MkdirAll(s.config.Dir, 0o755); err != nil {
+		return report, fmt.Errorf("create sync dir: %w", err)
+	}
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return report, fmt.Errorf("read sync dir: %w", err)
+	}
+	for _, e := range entries {
+		device, ok := strings.CutSuffix(e.Name(), syncFileSuffix)
+		if !ok || !e.Type().IsRegular() || device == s.config.Device || !ValidDeviceName(device) {
+			continue
+		}
+		result, merged, err := s.mergePeer(ctx, device, filepath.Join(s.config.Dir, e.Name()))
+		if err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			s.logger.ErrorContext(ctx, "merge device", slog.String("device", device), slog.Any("error", err))
+			continue
+		}
+		if merged {
+			report.Merged[device] = result
+			s.logger.InfoContext(ctx, "merged device",
+				slog.String("device", device),
+				slog.Int("nodes", result.Nodes),
+				slog.Int("edges", result.Edges),
+				slog.Int("blobs", result.Blobs),
+				slog.Int("conflicts", result.Conflicts),
+			)
+		}
+	}
+
+	seq, err := s.storage.LastChangeSeq(ctx)
+	if err != nil {
+		return report, fmt.Errorf("get last change seq: %w", err)
+	}
+	ownPath := filepath.Join(s.config.Dir, s.config.Device+syncFileSuffix)
+	if _, statErr := os.Stat(ownPath); seq != s.exportedSeq || statErr != nil {
+		if err := s.storage.Backup(ctx, ownPath); err != nil {
+			return report, fmt.Errorf("export: %w", err)
+		}
+		s.exportedSeq = seq
+		report.Exported = true
+	}
+	return report, nil
+}
+
+// mergePeer merges copy of peer file if it was modified since the previous merge.
+func (s *Sync) mergePeer(ctx context.Context, device, path string) (storage.MergeResult, bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return storage.MergeResult{}, false, err
+	}
+	peer, err := s.storage.SyncPeerLoad(ctx, device)
+	if err != nil {
+		return storage.MergeResult{}, false, err
+	}
+	if peer.FileModTime.Equal(fi.ModTime()) {
+		return storage.MergeResult{}, false, nil
+	}
+
+	// File may be replaced by sync tool at any moment, merge a private copy.
+	tmp, err := copyToTemp(path)
+	if err != nil {
+		return storage.MergeResult{}, false, fmt.Errorf("copy %q: %w", path, err)
+	}
+	defer os.Remove(tmp)
+	result, err := s.storage.MergeFrom(ctx, device, tmp, fi.ModTime())
+	return result, err == nil, err
+}
+
+func copyToTemp(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp("", "libreta-sync-*.db")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
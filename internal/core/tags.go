@@ -0,0 +1,330 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+var ErrInvalidTag = errors.New("invalid tag")
+
+// TagCount is tag with number of tagged nodes.
+type TagCount struct {
+	Tag string
+	// Count is number of nodes with the tag, it is zero for parent of nested tags which isn't used by itself.
+	Count int
+	// Total is number of uses of the tag and all tags nested in it, node with several of them is counted several
+	// times.
+	Total int
+}
+
+// Tags manages node tags (channels): values of TagAttr attribute. Tags are hierarchical: "dev/db" is nested in
+// "dev", so tag queries, renames and merges of "dev" include it.
+type Tags struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+}
+
+func NewTags(logger *slog.Logger, storage *storage.Storage) *Tags {
+	return &Tags{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+// NormalizeTag trims spaces, leading "#" and slashes around tag and checks that it has no empty path segments.
+func NormalizeTag(tag string) (string, error) {
+	normalized := strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "#"), "/")
+	if normalized == "" || strings.Contains(normalized, "//") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+	}
+	return normalized, nil
+}
+
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// List returns all tags of non-deleted nodes with their parents, sorted by tag.
+func (t *Tags) List(ctx context.Context) ([]TagCount, error) {
+	counts, err := t.storage.QueryAttributeCounts(ctx, TagAttr)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]*TagCount, len(counts))
+	for tag, count := range counts {
+		for parent := tag; ; {
+			tc, ok := tags[parent]
+			if !ok {
+				tc = &TagCount{Tag: parent}
+				tags[parent] = tc
+			}
+			if parent == tag {
+				tc.Count = count
+			}
+			tc.Total += count
+			i := strings.LastIndexByte(parent, '/')
+			if i <= 0 {
+				break
+			}
+			parent = parent[:i]
+		}
+	}
+	list := make([]TagCount, 0, len(tags))
+	for _, tc := range tags {
+		list = append(list, *tc)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Tag < list[j].Tag })
+	return list, nil
+}
+
+// Add adds tags to nodes, returns number of changed nodes.
+func (t *Tags) Add(ctx context.Context, ids []string, tags []string) (int, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return 0, err
+	}
+	return t.update(ctx, ids, true, func(tag string) []string {
+		return []string{tag}
+	}, tags)
+}
+
+// Remove removes tags from nodes, nested tags are kept. Returns number of changed nodes.
+func (t *Tags) Remove(ctx context.Context, ids []string, tags []string) (int, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return 0, err
+	}
+	removed := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		removed[tag] = true
+	}
+	return t.update(ctx, ids, true, func(tag string) []string {
+		if removed[tag] {
+			return nil
+		}
+		return []string{tag}
+	}, nil)
+}
+
+// Rename renames tag and tags nested in it on all nodes, renaming into existing tag merges them. Returns number of
+// changed nodes.
+func (t *Tags) Rename(ctx context.Context, from, to string) (int, error) {
+	return t.Merge(ctx, []string{from}, to)
+}
+
+// Merge renames tags and tags nested in them into tag to on all nodes, e.g. merge of "db" into "dev/db" turns
+// "db/sqlite" into "dev/db/sqlite". Tag can't be merged into tag nested in it. Returns number of changed nodes.
+func (t *Tags) Merge(ctx context.Context, from []string, to string) (int, error) {
+	from, err := normalizeTags(from)
+	if err != nil {
+		return 0, err
+	}
+	if to, err = NormalizeTag(to); err != nil {
+		return 0, err
+	}
+	for _, tag := range from {
+		if strings.HasPrefix(to, tag+"/") {
+			return 0, fmt.Errorf("%w: %q can't be merged into nested tag %q", ErrInvalidTag, tag, to)
+		}
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, tag := range from {
+		tagIDs, err := t.storage.QueryByAttributeTree(ctx, TagAttr, tag)
+		if err != nil {
+			return 0, err
+		}
+		for _, id := range tagIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return t.update(ctx, ids, false, func(tag string) []string {
+		for _, f := range from {
+			if tag == f {
+				return []string{to}
+			}
+			if rest, ok := strings.CutPrefix(tag, f+"/"); ok {
+				return []string{to + "/" + rest}
+			}
+		}
+		return []string{tag}
+	}, nil)
+}
+
+// update replaces each tag of nodes by result of f and adds tags extra. Unless strict, missing and deleted nodes are
+// ignored, otherwise nothing is changed if any of them is missing. All nodes are changed in single transaction.
+func (t *Tags) update(ctx context.Context, ids []string, strict bool, f func(tag string) []string, extra []string) (int, error) {
+	changed := 0
+	err := t.storage.NodesUpdate(ctx, ids, func(loaded map[string]storage.Node) ([]storage.Node, error) {
+		var nodes []storage.Node
+		for _, id := range ids {
+			node, ok := loaded[id]
+			if !ok || node.IsDeleted() {
+				if strict {
+					return nil, fmt.Errorf("node %q: %w", id, storage.ErrNoRecord)
+				}
+				continue
+			}
+			if updateNodeTags(&node, f, extra) {
+				nodes = append(nodes, node)
+			}
+		}
+		changed = len(nodes)
+		return nodes, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+// updateNodeTags replaces each tag of node by result of f and adds tags extra, returns whether tags are changed.
+func updateNodeTags(node *storage.Node, f func(tag string) []string, extra []string) bool {
+	attrs := make([]storage.NodeAttribute, 0, len(node.Attributes)+len(extra))
+	var oldTags, newTags []string
+	seen := make(map[string]bool)
+	addTag := func(tag string) {
+		if !seen[tag] {
+			seen[tag] = true
+			newTags = append(newTags, tag)
+		}
+	}
+	for _, attr := range node.Attributes {
+		if attr.Key != TagAttr {
+			attrs = append(attrs, attr)
+			continue
+		}
+		oldTags = append(oldTags, attr.Value)
+		for _, tag := range f(attr.Value) {
+			addTag(tag)
+		}
+	}
+	for _, tag := range extra {
+		addTag(tag)
+	}
+	if equalTagSets(oldTags, newTags) {
+		return false
+	}
+	for _, tag := range newTags {
+		attrs = append(attrs, storage.NodeAttribute{Key: TagAttr, Value: tag})
+	}
+	node.Attributes = attrs
+	return true
+}
+
+func equalTagSets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, tag := range a {
+		set[tag] = true
+	}
+	for _, tag := range b {
+		if !set[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	// hashtagRe matches "#tag" which doesn't follow word character, slash, "&" or "#", so URL fragments, HTML
+	// entities and markdown headings aren't matched.
+	hashtagRe = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/#])#([\p{L}\p{N}_][\p{L}\p{N}_/-]*)`)
+	// markdownCodeRe matches fenced code blocks and code spans.
+	markdownCodeRe = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
+)
+
+// ExtractHashtags returns inline "#tags" of text in order of appearance without duplicates, e.g. "#dev" and
+// "#dev/db". Tags in markdown code and numeric tags like "#1" are skipped.
+func ExtractHashtags(text string) []string {
+	text = markdownCodeRe.ReplaceAllString(text, " ")
+	var tags []string
+	seen := make(map[string]bool)
+	for _, m := range hashtagRe.FindAllStringSubmatch(text, -1) {
+		tag := strings.TrimRight(m[1], "/-")
+		if tag == "" || strings.Trim(tag, "0123456789") == "" || strings.Contains(tag, "//") || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// HashtagAttributes returns attributes node with new content is saved with: attributes of already existing node are
+// kept, except tags which are hashtags of its old content, and hashtags of new content are added as tags. So tags
+// added with Add survive content change unless they were written inline and then removed from text.
+func (t *Tags) HashtagAttributes(ctx context.Context, node storage.Node) ([]storage.NodeAttribute, error) {
+	var attrs []storage.NodeAttribute
+	oldHashtags := make(map[string]bool)
+	if node.ID != "" {
+		nodes, err := t.storage.NodesLoad(ctx, []string{node.ID})
+		if err != nil {
+			return nil, fmt.Errorf("load node: %w", err)
+		}
+		if old, ok := nodes[node.ID]; ok {
+			tags, err := t.NodeHashtags(ctx, old)
+			if err != nil {
+				return nil, err
+			}
+			for _, tag := range tags {
+				oldHashtags[tag] = true
+			}
+			for _, attr := range old.Attributes {
+				if attr.Key != TagAttr || !oldHashtags[attr.Value] {
+					attrs = append(attrs, attr)
+				}
+			}
+		}
+	}
+	tags, err := t.NodeHashtags(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if !slices.ContainsFunc(attrs, func(attr storage.NodeAttribute) bool {
+			return attr.Key == TagAttr && attr.Value == tag
+		}) {
+			attrs = append(attrs, storage.NodeAttribute{Key: TagAttr, Value: tag})
+		}
+	}
+	return attrs, nil
+}
+
+// NodeHashtags returns inline hashtags of markdown or plain text node content, other nodes have none.
+func (t *Tags) NodeHashtags(ctx context.Context, node storage.Node) ([]string, error) {
+	mimetype, _, _ := mime.ParseMediaType(node.ContentMimetype)
+	if mimetype != markdownMimetype && mimetype != "text/plain" {
+		return nil, nil
+	}
+	content, err := loadNodeContent(ctx, t.storage, node.ContentHash)
+	if errors.Is(err, storage.ErrNoRecord) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ExtractHashtags(string(content)), nil
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		tags []string
+	}{
+		{"#dev #db fixed", []string{"dev", "db"}},
+		{"# Heading\n## Sub\n#dev/db/ and #dev/db, #dev", []string{"dev/db", "dev"}},
+		{"issue #12, see https://example.com/page#anchor and a#b &#39;", nil},
+		{"`#code` ```\n#block\n``` #тег_1 (#go-lang)", []string{"тег_1", "go-lang"}},
+	} {
+		assert.Equal(t, tc.tags, ExtractHashtags(tc.text), tc.text)
+	}
+}
+
+func TestTags(t *testing.T) {
+	ctx := context.Background()
+	s := testStorage(t)
+	tags := NewTags(slog.New(slog.NewTextHandler(io.Discard, nil)), s)
+
+	nodeTags := func(id string) []string {
+		nodes, err := s.NodesLoad(ctx, []string{id})
+		require.NoError(t, err)
+		var tags []string
+		for _, attr := range nodes[id].Attributes {
+			if attr.Key == TagAttr {
+				tags = append(tags, attr.Value)
+			}
+		}
+		sort.Strings(tags)
+		return tags
+	}
+	var ids []string
+	for _, nodeTags := range [][]string{{"dev", "dev/db"}, {"dev/db/sqlite"}, {"db"}, {}} {
+		hash, err := s.NodeContentSave(ctx, strings.NewReader("note"))
+		require.NoError(t, err)
+		id, err := s.GenerateNodeID(ctx)
+		require.NoError(t, err)
+		attrs := []storage.NodeAttribute{{Key: "color", Value: "red"}}
+		for _, tag := range nodeTags {
+			attrs = append(attrs, storage.NodeAttribute{Key: TagAttr, Value: tag})
+		}
+		require.NoError(t, s.NodeSave(ctx, storage.Node{ID: id, ContentHash: hash, Attributes: attrs}))
+		ids = append(ids, id)
+	}
+
+	list, err := tags.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []TagCount{
+		{Tag: "db", Count: 1, Total: 1},
+		{Tag: "dev", Count: 1, Total: 3},
+		{Tag: "dev/db", Count: 1, Total: 2},
+		{Tag: "dev/db/sqlite", Count: 1, Total: 1},
+	}, list)
+
+	nested, err := QueryNodes(ctx, s, NodeQuery{Kind: NodeQueryTag, Value: "dev/db"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{ids[0], ids[1]}, nested)
+
+	nodes, err := s.NodesLoad(ctx, []string{ids[3]})
+	require.NoError(t, err)
+	updatedAt := nodes[ids[3]].UpdatedAt
+	changed, err := tags.Add(ctx, []string{ids[2], ids[3]}, []string{"#db", " new/ "})
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+	assert.Equal(t, []string{"db", "new"}, nodeTags(ids[2]))
+	assert.Equal(t, []string{"db", "new"}, nodeTags(ids[3]))
+	nodes, err = s.NodesLoad(ctx, []string{ids[3]})
+	require.NoError(t, err)
+	assert.Contains(t, clearAttrTimes(nodes[ids[3]].Attributes), storage.NodeAttribute{Key: "color", Value: "red"})
+	// Changed nodes must be picked up by sync.
+	assert.True(t, nodes[ids[3]].UpdatedAt.After(updatedAt))
+
+	changed, err = tags.Remove(ctx, []string{ids[0], ids[3]}, []string{"dev", "new"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+	assert.Equal(t, []string{"dev/db"}, nodeTags(ids[0]))
+	assert.Equal(t, []string{"db"}, nodeTags(ids[3]))
+
+	changed, err = tags.Rename(ctx, "dev/db", "databases")
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+	assert.Equal(t, []string{"databases"}, nodeTags(ids[0]))
+	assert.Equal(t, []string{"databases/sqlite"}, nodeTags(ids[1]))
+
+	changed, err = tags.Merge(ctx, []string{"db", "new"}, "databases")
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+	assert.Equal(t, []string{"databases"}, nodeTags(ids[2]))
+	assert.Equal(t, []string{"databases"}, nodeTags(ids[3]))
+
+	list, err = tags.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []TagCount{
+		{Tag: "databases", Count: 3, Total: 4},
+		{Tag: "databases/sqlite", Count: 1, Total: 1},
+	}, list)
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := tags.Add(ctx, ids, []string{"a//b"})
+		assert.ErrorIs(t, err, ErrInvalidTag)
+		_, err = tags.Rename(ctx, "databases", " # ")
+		assert.ErrorIs(t, err, ErrInvalidTag)
+		_, err = tags.Add(ctx, []string{ids[0], "missing"}, []string{"x"})
+		assert.ErrorIs(t, err, storage.ErrNoRecord)
+		assert.Equal(t, []string{"databases"}, nodeTags(ids[0]))
+		// Merge into nested tag would nest it again and again, e.g. "databases/sqlite/sqlite".
+		_, err = tags.Merge(ctx, []string{"databases"}, "databases/sqlite")
+		assert.ErrorIs(t, err, ErrInvalidTag)
+		assert.Equal(t, []string{"databases/sqlite"}, nodeTags(ids[1]))
+	})
+
+	t.Run("hashtags", func(t *testing.T) {
+		hash, err := s.NodeContentSave(ctx, strings.NewReader("Fixed #dev/db bug"))
+		require.NoError(t, err)
+		found, err := tags.NodeHashtags(ctx, storage.Node{ContentHash: hash, ContentMimetype: "text/markdown; charset=utf-8"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dev/db"}, found)
+		found, err = tags.NodeHashtags(ctx, storage.Node{ContentHash: hash, ContentMimetype: "text/html"})
+		require.NoError(t, err)
+		assert.Empty(t, found)
+
+		post, err := NewMicroposts(slog.New(slog.NewTextHandler(io.Discard, nil)), s).Post(ctx, "#dev #db done", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"db", "dev"}, nodeTags(post.Node.ID))
+	})
+}
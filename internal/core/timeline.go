@@ -0,0 +1,198 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brainmorsel/libreta/internal/storage"
+)
+
+const (
+	timelineDefaultLimit = 50
+	timelineMaxLimit     = 500
+)
+
+var ErrInvalidTimelineCursor = errors.New("invalid timeline cursor")
+
+// TimelineQuery selects page of timeline.
+type TimelineQuery struct {
+	// Kind selects nodes by kind attribute, e.g. "micro", all nodes are selected when empty.
+	Kind string
+	// Cursor is NextCursor of previous page, the first page is returned when empty.
+	Cursor string
+	// Limit is number of nodes per page, timelineDefaultLimit is used when zero.
+	Limit int
+	// Desc orders nodes from the newest.
+	Desc bool
+	// Location is time zone of days, UTC is used when nil.
+	Location *time.Location
+}
+
+// TimelineEntry is timeline node. Content of micro posts is included, as they are short.
+type TimelineEntry struct {
+	Node storage.Node
+	// Text is content of micro post.
+	Text string
+	// AttachmentIDs are IDs of nodes attached to micro post.
+	AttachmentIDs []string
+}
+
+// TimelineDay groups entries created on the same day.
+type TimelineDay struct {
+	// Date is day in YYYY-MM-DD format.
+	Date    string
+	Entries []TimelineEntry
+}
+
+type TimelinePage struct {
+	Days []TimelineDay
+	// NextCursor points after the last entry of the page, it is empty on the last page.
+	NextCursor string
+}
+
+// Timeline lists nodes in order of creation, grouped by day.
+type Timeline struct {
+	logger  *slog.Logger
+	storage *storage.Storage
+}
+
+func NewTimeline(logger *slog.Logger, storage *storage.Storage) *Timeline {
+	return &Timeline{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+// Page returns page of timeline selected by query.
+func (t *Timeline) Page(ctx context.Context, q TimelineQuery) (TimelinePage, error) {
+	cursor, err := parseTimelineCursor(q.Cursor)
+	if err != nil {
+		return TimelinePage{}, err
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = timelineDefaultLimit
+	}
+	limit = min(limit, timelineMaxLimit)
+	location := q.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	// One more node is selected to find out whether there is next page.
+	ids, err := t.storage.QueryTimeline(ctx, q.Kind, cursor, q.Desc, limit+1)
+	if err != nil {
+		return TimelinePage{}, err
+	}
+	var page TimelinePage
+	more := len(ids) > limit
+	if more {
+		ids = ids[:limit]
+	}
+	if len(ids) == 0 {
+		return page, nil
+	}
+	nodes, err := t.storage.NodesLoad(ctx, ids)
+	if err != nil {
+		return TimelinePage{}, err
+	}
+	attachments, err := t.attachments(ctx, nodes)
+	if err != nil {
+		return TimelinePage{}, err
+	}
+	for _, id := range ids {
+		node, ok := nodes[id]
+		if !ok {
+			continue
+		}
+		entry := TimelineEntry{Node: node, AttachmentIDs: attachments[id]}
+		if isMicropost(node) {
+			content, err := loadNodeContent(ctx, t.storage, node.ContentHash)
+			if err != nil {
+				return TimelinePage{}, fmt.Errorf("load micro post %q: %w", id, err)
+			}
+			entry.Text = string(content)
+		}
+		date := node.CreatedAt.In(location).Format(time.DateOnly)
+		if len(page.Days) == 0 || page.Days[len(page.Days)-1].Date != date {
+			page.Days = append(page.Days, TimelineDay{Date: date})
+		}
+		day := &page.Days[len(page.Days)-1]
+		day.Entries = append(day.Entries, entry)
+	}
+	if more {
+		last := nodes[ids[len(ids)-1]]
+		page.NextCursor = formatTimelineCursor(storage.TimelineCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+// attachments returns IDs of nodes attached to micro posts by post ID.
+func (t *Timeline) attachments(ctx context.Context, nodes map[string]storage.Node) (map[string][]string, error) {
+	var posts []string
+	for id, node := range nodes {
+		if isMicropost(node) {
+			posts = append(posts, id)
+		}
+	}
+	if len(posts) == 0 {
+		return nil, nil
+	}
+	edges, err := t.storage.EdgesForNodes(ctx, posts)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if !edges[i].CreatedAt.Equal(edges[j].CreatedAt) {
+			return edges[i].CreatedAt.Before(edges[j].CreatedAt)
+		}
+		return edges[i].DstID < edges[j].DstID
+	})
+	attachments := make(map[string][]string)
+	for _, edge := range edges {
+		if edge.Relation == storage.EdgeRelAttachment && isMicropost(nodes[edge.SrcID]) {
+			attachments[edge.SrcID] = append(attachments[edge.SrcID], edge.DstID)
+		}
+	}
+	return attachments, nil
+}
+
+func isMicropost(node storage.Node) bool {
+	for _, attr := range node.Attributes {
+		if attr.Key == storage.NodeAttrKind && attr.Value == storage.NodeAttrKindMicro {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTimelineCursor encodes cursor as opaque string. Time keeps its zone offset, so it is compared with stored
+// creation time as is.
+func formatTimelineCursor(c storage.TimelineCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.Format(time.RFC3339Nano) + " " + c.ID))
+}
+
+func parseTimelineCursor(s string) (storage.TimelineCursor, error) {
+	if s == "" {
+		return storage.TimelineCursor{}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return storage.TimelineCursor{}, fmt.Errorf("%w: %q", ErrInvalidTimelineCursor, s)
+	}
+	createdAt, id, ok := strings.Cut(string(data), " ")
+	if !ok || id == "" {
+		return storage.TimelineCursor{}, fmt.Errorf("%w: %q", ErrInvalidTimelineCursor, s)
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return storage.TimelineCursor{}, fmt.Errorf("%w: %q", ErrInvalidTimelineCursor, s)
+	}
+	return storage.TimelineCursor{CreatedAt: t, ID: id}, nil
+}
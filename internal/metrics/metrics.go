@@ -0,0 +1,310 @@
+// Package metrics implements minimal metrics registry exposed in Prometheus text format.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefaultBuckets are histogram buckets in seconds suitable for request latencies.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of metric family. Suffix is appended to family name, e.g. "_bucket".
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+type Collector interface {
+	Collect(ctx context.Context) ([]Family, error)
+}
+
+// CollectorFunc collects metrics on scrape, e.g. gauges read from database.
+type CollectorFunc func(ctx context.Context) ([]Family, error)
+
+func (f CollectorFunc) Collect(ctx context.Context) ([]Family, error) {
+	return f(ctx)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText collects all metrics and writes them in Prometheus text exposition format.
+// Metrics of failed collectors are skipped, errors are returned after writing the rest.
+func (r *Registry) WriteText(ctx context.Context, w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	var (
+		families []Family
+		errs     []error
+	)
+	for _, c := range collectors {
+		f, err := c.Collect(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		families = append(families, f...)
+	}
+	sort.SliceStable(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+
+	var b strings.Builder
+	for _, f := range families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.Samples {
+			b.WriteString(f.Name)
+			b.WriteString(s.Suffix)
+			writeLabels(&b, s.Labels)
+			b.WriteByte(' ')
+			b.WriteString(formatValue(s.Value))
+			b.WriteByte('\n')
+		}
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("collect metrics: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func writeLabels(b *strings.Builder, labels []Label) {
+	if len(labels) == 0 {
+		return
+	}
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(l.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpReplacer.Replace(s) }
+func escapeLabelValue(s string) string { return labelReplacer.Replace(s) }
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// vec keeps per label values series of a metric.
+type vec[T any] struct {
+	name   string
+	help   string
+	labels []string
+	newT   func() *T
+
+	mu     sync.Mutex
+	series map[string]*series[T]
+}
+
+type series[T any] struct {
+	labels []Label
+	value  *T
+}
+
+func (v *vec[T]) with(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		labels := make([]Label, len(v.labels))
+		for i, name := range v.labels {
+			labels[i] = Label{Name: name, Value: labelValues[i]}
+		}
+		s = &series[T]{labels: labels, value: v.newT()}
+		v.series[key] = s
+	}
+	return s.value
+}
+
+// sorted returns series sorted by label values for stable output. Caller must hold v.mu.
+func (v *vec[T]) sorted() []*series[T] {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*series[T], len(keys))
+	for i, k := range keys {
+		out[i] = v.series[k]
+	}
+	return out
+}
+
+type counter struct {
+	value float64
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	vec[counter]
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{vec[counter]{
+		name:   name,
+		help:   help,
+		labels: labels,
+		newT:   func() *counter { return &counter{} },
+		series: make(map[string]*series[counter]),
+	}}
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	cnt := c.with(labelValues)
+	c.mu.Lock()
+	cnt.value += delta
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Collect(context.Context) ([]Family, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := Family{Name: c.name, Help: c.help, Type: TypeCounter}
+	for _, s := range c.sorted() {
+		f.Samples = append(f.Samples, Sample{Labels: s.labels, Value: s.value.value})
+	}
+	return []Family{f}, nil
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	vec[histogram]
+	buckets []float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{
+		vec: vec[histogram]{
+			name:   name,
+			help:   help,
+			labels: labels,
+			newT:   func() *histogram { return &histogram{counts: make([]uint64, len(buckets))} },
+			series: make(map[string]*series[histogram]),
+		},
+		buckets: buckets,
+	}
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	hist := h.with(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, le := range h.buckets {
+		if v <= le {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+// ObserveDuration observes duration in seconds.
+func (h *HistogramVec) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) Collect(context.Context) ([]Family, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f := Family{Name: h.name, Help: h.help, Type: TypeHistogram}
+	for _, s := range h.sorted() {
+		for i, le := range h.buckets {
+			f.Samples = append(f.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: append(append([]Label(nil), s.labels...), Label{Name: "le", Value: formatValue(le)}),
+				Value:  float64(s.value.counts[i]),
+			})
+		}
+		f.Samples = append(f.Samples,
+			Sample{Suffix: "_bucket", Labels: append(append([]Label(nil), s.labels...), Label{Name: "le", Value: "+Inf"}), Value: float64(s.value.count)},
+			Sample{Suffix: "_sum", Labels: s.labels, Value: s.value.sum},
+			Sample{Suffix: "_count", Labels: s.labels, Value: float64(s.value.count)},
+		)
+	}
+	return []Family{f}, nil
+}
+
+// Gauge returns family with single unlabeled gauge sample, helper for CollectorFunc.
+func Gauge(name, help string, value float64) Family {
+	return Family{Name: name, Help: help, Type: TypeGauge, Samples: []Sample{{Value: value}}}
+}
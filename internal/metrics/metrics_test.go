@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	reg := NewRegistry()
+	requests := NewCounterVec("test_requests_total", "Requests count.", "target", "code")
+	requests.Inc("b", "")
+	requests.Inc("a", "x.err")
+	requests.Add(2, "a", "x.err")
+	reg.Register(requests)
+
+	latency := NewHistogramVec("test_duration_seconds", "Latency.", []float64{1, 0.1}, "target")
+	latency.Observe(0.05, "a")
+	latency.Observe(0.5, "a")
+	reg.Register(latency)
+
+	reg.Register(CollectorFunc(func(ctx context.Context) ([]Family, error) {
+		return []Family{Gauge("test_gauge", "Gauge with \"quotes\"\nand newline.", 42)}, nil
+	}))
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(context.Background(), &buf))
+	assert.Equal(t, `# HELP test_duration_seconds Latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{target="a",le="0.1"} 1
+test_duration_seconds_bucket{target="a",le="1"} 2
+test_duration_seconds_bucket{target="a",le="+Inf"} 2
+test_duration_seconds_sum{target="a"} 0.55
+test_duration_seconds_count{target="a"} 2
+# HELP test_gauge Gauge with "quotes"\nand newline.
+# TYPE test_gauge gauge
+test_gauge 42
+# HELP test_requests_total Requests count.
+# TYPE test_requests_total counter
+test_requests_total{target="a",code="x.err"} 3
+test_requests_total{target="b",code=""} 1
+`, buf.String())
+}
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type User struct {
+	Name         string
+	PasswordHash string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type userRow struct {
+	Name         string    `db:"name"`
+	PasswordHash string    `db:"password_hash"`
+	CreatedAt    Timestamp `db:"created_at"`
+	UpdatedAt    Timestamp `db:"updated_at"`
+}
+
+type Session struct {
+	TokenHash string
+	UserName  string
+	CSRFToken string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type sessionRow struct {
+	TokenHash string    `db:"token_hash"`
+	UserName  string    `db:"user_name"`
+	CSRFToken string    `db:"csrf_token"`
+	CreatedAt Timestamp `db:"created_at"`
+	ExpiresAt Timestamp `db:"expires_at"`
+}
+
+type APIToken struct {
+	ID         string
+	TokenHash  string
+	UserName   string
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+type apiTokenRow struct {
+	ID         string    `db:"id"`
+	TokenHash  string    `db:"token_hash"`
+	UserName   string    `db:"user_name"`
+	Name       string    `db:"name"`
+	Scopes     string    `db:"scopes"`
+	CreatedAt  Timestamp `db:"created_at"`
+	LastUsedAt Timestamp `db:"last_used_at"`
+}
+
+func (row *apiTokenRow) apiToken() APIToken {
+	return APIToken{
+		ID:         row.ID,
+		TokenHash:  row.TokenHash,
+		UserName:   row.UserName,
+		Name:       row.Name,
+		Scopes:     strings.Fields(row.Scopes),
+		CreatedAt:  row.CreatedAt.Time,
+		LastUsedAt: row.LastUsedAt.Time,
+	}
+}
+
+// UserSave creates user or updates password hash of existing one.
+func (s *Storage) UserSave(ctx context.Context, user User) error {
+	now := Timestamp{time.Now()}
+	_, err := s.writeDB.NamedExecContext(
+		ctx,
+		`INSERT INTO user(name, password_hash, created_at, updated_at)
+			VALUES (:name, :password_hash, :created_at, :updated_at)
+			ON CONFLICT(name) DO UPDATE
+				SET password_hash=excluded.password_hash,
+					updated_at=excluded.updated_at`,
+		&userRow{
+			Name:         user.Name,
+			PasswordHash: user.PasswordHash,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("upsert user: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) UserLoad(ctx context.Context, name string) (User, error) {
+	var row userRow
+	err := s.readDB.GetContext(ctx, &row, `SELECT name, password_hash, created_at, updated_at FROM user WHERE name = $1`, name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return User{}, ErrNoRecord
+	case err != nil:
+		return User{}, fmt.Errorf("select user: %w", err)
+	}
+	return User{
+		Name:         row.Name,
+		PasswordHash: row.PasswordHash,
+		CreatedAt:    row.CreatedAt.Time,
+		UpdatedAt:    row.UpdatedAt.Time,
+	}, nil
+}
+
+func (s *Storage) UsersCount(ctx context.Context) (int, error) {
+	var count int
+	if err := s.readDB.GetContext(ctx, &count, `SELECT COUNT(*) FROM user`); err != nil {
+		return 0, fmt.Errorf("select users count: %w", err)
+	}
+	return count, nil
+}
+
+func (s *Storage) SessionSave(ctx context.Context, session Session) error {
+	_, err := s.writeDB.NamedExecContext(
+		ctx,
+		`INSERT INTO session(token_hash, user_name, csrf_token, created_at, expires_at)
+			VALUES (:token_hash, :user_name, :csrf_token, :created_at, :expires_at)`,
+		&sessionRow{
+			TokenHash: session.TokenHash,
+			UserName:  session.UserName,
+			CSRFToken: session.CSRFToken,
+			CreatedAt: Timestamp{session.CreatedAt},
+			ExpiresAt: Timestamp{session.ExpiresAt},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("insert session: %w", err)
+	}
+	return nil
+}
+
+// SessionLoad returns not expired session.
+func (s *Storage) SessionLoad(ctx context.Context, tokenHash string) (Session, error) {
+	var row sessionRow
+	err := s.readDB.GetContext(
+		ctx, &row,
+		`SELECT token_hash, user_name, csrf_token, created_at, expires_at FROM session WHERE token_hash = $1 AND expires_at > $2`,
+		tokenHash, Timestamp{time.Now()},
+	)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return Session{}, ErrNoRecord
+	case err != nil:
+		return Session{}, fmt.Errorf("select session: %w", err)
+	}
+	return Session{
+		TokenHash: row.TokenHash,
+		UserName:  row.UserName,
+		CSRFToken: row.CSRFToken,
+		CreatedAt: row.CreatedAt.Time,
+		ExpiresAt: row.ExpiresAt.Time,
+	}, nil
+}
+
+func (s *Storage) SessionDelete(ctx context.Context, tokenHash string) error {
+	if _, err := s.writeDB.ExecContext(ctx, `DELETE FROM session WHERE token_hash = $1`, tokenHash); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) SessionsDeleteExpired(ctx context.Context) error {
+	if _, err := s.writeDB.ExecContext(ctx, `DELETE FROM session WHERE expires_at <= $1`, Timestamp{time.Now()}); err != nil {
+		return fmt.Errorf("delete sessions: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) APITokenSave(ctx context.Context, token APIToken) error {
+	_, err := s.writeDB.NamedExecContext(
+		ctx,
+		`INSERT INTO api_token(id, token_hash, user_name, name, scopes, created_at)
+			VALUES (:id, :token_hash, :user_name, :name, :scopes, :created_at)`,
+		&apiTokenRow{
+			ID:        token.ID,
+			TokenHash: token.TokenHash,
+			UserName:  token.UserName,
+			Name:      token.Name,
+			Scopes:    strings.Join(token.Scopes, " "),
+			CreatedAt: Timestamp{token.CreatedAt},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("insert api token: %w", err)
+	}
+	return nil
+}
+
+// APITokenLoadByHash loads token and updates its last usage time.
+func (s *Storage) APITokenLoadByHash(ctx context.Context, tokenHash string) (APIToken, error) {
+	var row apiTokenRow
+	err := s.readDB.GetContext(
+		ctx, &row,
+		`SELECT id, token_hash, user_name, name, scopes, created_at, last_used_at FROM api_token WHERE token_hash = $1`,
+		tokenHash,
+	)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return APIToken{}, ErrNoRecord
+	case err != nil:
+		return APIToken{}, fmt.Errorf("select api token: %w", err)
+	}
+	now := time.Now()
+	// Don't hit write connection on every request.
+	if now.Sub(row.LastUsedAt.Time) > time.Minute {
+		_, err := s.writeDB.ExecContext(ctx, `UPDATE api_token SET last_used_at = $1 WHERE id = $2`, Timestamp{now}, row.ID)
+		if err != nil {
+			return APIToken{}, fmt.Errorf("update api token: %w", err)
+		}
+		row.LastUsedAt = Timestamp{now}
+	}
+	return row.apiToken(), nil
+}
+
+// APITokensList returns tokens of the user or all tokens if userName is empty.
+func (s *Storage) APITokensList(ctx context.Context, userName string) ([]APIToken, error) {
+	rows, err := s.readDB.QueryxContext(
+		ctx,
+		`SELECT id, token_hash, user_name, name, scopes, created_at, last_used_at
+			FROM api_token
+			WHERE $1 = '' OR user_name = $1
+			ORDER BY user_name, created_at`,
+		userName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select api tokens: %w", err)
+	}
+	tokens := make([]APIToken, 0)
+	row := apiTokenRow{}
+	for rows.Next() {
+		if err := rows.StructScan(&row); err != nil {
+			return nil, fmt.Errorf("scan api token: %w", errors.Join(err, rows.Close()))
+		}
+		tokens = append(tokens, row.apiToken())
+	}
+	return tokens, nil
+}
+
+func (s *Storage) APITokenDelete(ctx context.Context, id string) error {
+	res, err := s.writeDB.ExecContext(ctx, `DELETE FROM api_token WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete api token: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Backup writes consistent copy of database to dstPath using VACUUM INTO, it is safe to run while database
+// is in use. Backup is written to temporary file first, so dstPath never contains partial copy. Existing dstPath
+// is replaced.
+func (s *Storage) Backup(ctx context.Context, dstPath string) error {
+	tmpPath := dstPath + ".tmp"
+	if err := os.Remove(tmpPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove stale temporary file: %w", err)
+	}
+	if _, err := s.readDB.ExecContext(ctx, `VACUUM INTO $1`, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("vacuum into %q: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("rename backup: %w", err)
+	}
+	return nil
+}
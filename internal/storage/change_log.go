@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Change log entities and operations, see change_log triggers in dbschema.go.
+const (
+	ChangeEntityNode      = "node"
+	ChangeEntityEdge      = "edge"
+	ChangeEntityContent   = "content"
+	ChangeEntityAttribute = "attribute"
+
+	ChangeOpSave   = "save"
+	ChangeOpDelete = "delete"
+	ChangeOpAdd    = "add"
+	ChangeOpRemove = "remove"
+	ChangeOpUpload = "upload"
+)
+
+// Change is a change log record. Removals are recorded as well (tombstones), so replicas can apply them.
+// Seq is local order of records, Device and DeviceSeq identify the record across devices.
+type Change struct {
+	Seq       int64
+	Entity    string
+	Op        string
+	NodeID    string
+	Data      map[string]string
+	Device    string
+	DeviceSeq int64
+	CreatedAt time.Time
+}
+
+type changeRow struct {
+	Seq       int64     `db:"seq"`
+	Entity    string    `db:"entity"`
+	Op        string    `db:"op"`
+	NodeID    string    `db:"node_id"`
+	Data      string    `db:"data"`
+	Device    string    `db:"device"`
+	DeviceSeq int64     `db:"device_seq"`
+	CreatedAt Timestamp `db:"created_at"`
+}
+
+func (row *changeRow) change() (Change, error) {
+	change := Change{
+		Seq:       row.Seq,
+		Entity:    row.Entity,
+		Op:        row.Op,
+		NodeID:    row.NodeID,
+		Device:    row.Device,
+		DeviceSeq: row.DeviceSeq,
+		CreatedAt: row.CreatedAt.Time,
+	}
+	if err := json.Unmarshal([]byte(row.Data), &change.Data); err != nil {
+		return Change{}, fmt.Errorf("unmarshal change %d data: %w", row.Seq, err)
+	}
+	return change, nil
+}
+
+// ChangeCursor is a replication position. Devices holds the latest seen sequence number of each origin device, so
+// cursor may be passed to other replica. Records replicated out of order, after records of their device with greater
+// sequence numbers, are found by Seq: local sequence number of the latest seen record. Seq is meaningful only for
+// the replica which returned the cursor, other replicas may return some seen records again.
+type ChangeCursor struct {
+	Seq     int64            `json:"seq"`
+	Devices map[string]int64 `json:"devices"`
+}
+
+// Advance moves cursor past change.
+func (c *ChangeCursor) Advance(change Change) {
+	if c.Devices == nil {
+		c.Devices = make(map[string]int64)
+	}
+	if change.DeviceSeq > c.Devices[change.Device] {
+		c.Devices[change.Device] = change.DeviceSeq
+	}
+	if change.Seq > c.Seq {
+		c.Seq = change.Seq
+	}
+}
+
+// SetDevice sets name of local device recorded in change log.
+func (s *Storage) SetDevice(ctx context.Context, name string) error {
+	_, err := s.writeDB.ExecContext(ctx, `
+		INSERT INTO local_device(id, name) VALUES (1, $1)
+			ON CONFLICT(id) DO UPDATE SET name=excluded.name WHERE name != excluded.name`,
+		name)
+	if err != nil {
+		return fmt.Errorf("save local device: %w", err)
+	}
+	return nil
+}
+
+// ChangeNotify returns channel which receives a value after successful writes. Notifications are coalesced,
+// so receiver must read change log to find out what has changed. Writes made by other processes are not notified.
+func (s *Storage) ChangeNotify() <-chan struct{} {
+	return s.changeNotify
+}
+
+func (s *Storage) notifyChanged() {
+	select {
+	case s.changeNotify <- struct{}{}:
+	default:
+	}
+}
+
+// ChangesAfter returns up to limit change log records with sequence number greater than seq.
+func (s *Storage) ChangesAfter(ctx context.Context, seq int64, limit int) ([]Change, error) {
+	rows, err := s.readDB.QueryxContext(
+		ctx,
+		`SELECT seq, entity, op, node_id, data, device, device_seq, created_at
+			FROM change_log WHERE seq > $1 ORDER BY seq LIMIT $2`,
+		seq, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select changes: %w", err)
+	}
+	changes := make([]Change, 0)
+	row := changeRow{}
+	for rows.Next() {
+		if err := rows.StructScan(&row); err != nil {
+			return nil, fmt.Errorf("scan change: %w", errors.Join(err, rows.Close()))
+		}
+		change, err := row.change()
+		if err != nil {
+			return nil, errors.Join(err, rows.Close())
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// ChangesSince returns up to limit change log records not yet seen according to cursor, in local order,
+// and cursor advanced past returned records. Cursor isn't modified.
+func (s *Storage) ChangesSince(ctx context.Context, cursor ChangeCursor, limit int) ([]Change, ChangeCursor, error) {
+	// Records are selected per device, so (device, device_seq) index is used. Records are taken in local order,
+	// so ones left out by limit come after returned ones and aren't skipped by advanced cursor.
+	var devices []string
+	if err := s.readDB.SelectContext(ctx, &devices, `SELECT DISTINCT device FROM change_log`); err != nil {
+		return nil, ChangeCursor{}, fmt.Errorf("select devices: %w", err)
+	}
+	var rows []changeRow
+	for _, device := range devices {
+		var deviceRows []changeRow
+		err := s.readDB.SelectContext(ctx, &deviceRows, `
+			SELECT seq, entity, op, node_id, data, device, device_seq, created_at
+				FROM change_log
+				WHERE device = $1 AND (device_seq > $2 OR seq > $3)
+				ORDER BY seq LIMIT $4`,
+			device, cursor.Devices[device], cursor.Seq, limit)
+		if err != nil {
+			return nil, ChangeCursor{}, fmt.Errorf("select device %q changes: %w", device, err)
+		}
+		rows = append(rows, deviceRows...)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Seq < rows[j].Seq })
+	rows = rows[:min(len(rows), limit)]
+	next := ChangeCursor{Seq: cursor.Seq, Devices: make(map[string]int64, len(cursor.Devices))}
+	for device, seq := range cursor.Devices {
+		next.Devices[device] = seq
+	}
+	changes := make([]Change, 0, len(rows))
+	for _, row := range rows {
+		change, err := row.change()
+		if err != nil {
+			return nil, ChangeCursor{}, err
+		}
+		next.Advance(change)
+		changes = append(changes, change)
+	}
+	return changes, next, nil
+}
+
+// LastChangeSeq returns sequence number of the latest change log record or 0 if log is empty.
+func (s *Storage) LastChangeSeq(ctx context.Context) (int64, error) {
+	var seq int64
+	err := s.readDB.GetContext(ctx, &seq, `SELECT COALESCE(MAX(seq), 0) FROM change_log`)
+	if err != nil {
+		return 0, fmt.Errorf("select last seq: %w", err)
+	}
+	return seq, nil
+}
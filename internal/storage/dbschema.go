@@ -2,12 +2,16 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 )
 
-const schemaVersion = 1
+// schemaVersion is version of base schema with all migrations applied.
+var schemaVersion = 1 + len(migrations)
 
 const schema = `
 CREATE TABLE schema_version (
@@ -94,6 +98,190 @@ CREATE TRIGGER node_au AFTER UPDATE ON node BEGIN
 END;
 `
 
+// migrations[N] upgrades schema from version N+1 to N+2.
+var migrations = []string{
+	// 2: change log for change notifications.
+	`
+CREATE TABLE change_log (
+	seq INTEGER PRIMARY KEY AUTOINCREMENT,
+	entity TEXT NOT NULL,
+	op TEXT NOT NULL,
+	node_id TEXT NOT NULL,
+	data TEXT NOT NULL,
+	created_at TEXT NOT NULL
+) STRICT;
+
+CREATE TRIGGER change_log_node_ai AFTER INSERT ON node BEGIN
+	INSERT INTO change_log(entity, op, node_id, data, created_at)
+		VALUES ('node', 'save', new.id, json_object('name', new.name), strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+END;
+CREATE TRIGGER change_log_node_au AFTER UPDATE ON node BEGIN
+	INSERT INTO change_log(entity, op, node_id, data, created_at)
+		VALUES (
+			'node',
+			IIF(new.deleted_at IS NOT NULL AND old.deleted_at IS NULL, 'delete', 'save'),
+			new.id,
+			json_object('name', new.name),
+			strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+END;
+CREATE TRIGGER change_log_node_ad AFTER DELETE ON node BEGIN
+	INSERT INTO change_log(entity, op, node_id, data, created_at)
+		VALUES ('node', 'delete', old.id, json_object('name', old.name), strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+END;
+CREATE TRIGGER change_log_edge_ai AFTER INSERT ON edge BEGIN
+	INSERT INTO change_log(entity, op, node_id, data, created_at)
+		VALUES (
+			'edge', 'add', new.src_id,
+			json_object('src_id', new.src_id, 'dst_id', new.dst_id, 'relation', new.relation),
+			strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+END;
+CREATE TRIGGER change_log_edge_ad AFTER DELETE ON edge BEGIN
+	INSERT INTO change_log(entity, op, node_id, data, created_at)
+		VALUES (
+			'edge', 'remove', old.src_id,
+			json_object('src_id', old.src_id, 'dst_id', old.dst_id, 'relation', old.relation),
+			strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+END;
+-- Content is inserted with temporary hash which is replaced by real one, see NodeContentSave.
+CREATE TRIGGER change_log_node_content_au AFTER UPDATE OF hash ON node_content WHEN old.hash LIKE 'tmp:%' BEGIN
+	INSERT INTO change_log(entity, op, node_id, data, created_at)
+		VALUES ('content', 'upload', '', json_object('hash', new.hash), strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+END;
+`,
+	// 3: users, sessions and API tokens.
+	`
+CREATE TABLE user (
+	name TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	PRIMARY KEY (name)
+) STRICT;
+
+CREATE TABLE session (
+	token_hash TEXT NOT NULL,
+	user_name TEXT NOT NULL,
+	csrf_token TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	expires_at TEXT NOT NULL,
+	FOREIGN KEY (user_name) REFERENCES user(name) ON DELETE CASCADE,
+	PRIMARY KEY (token_hash)
+) STRICT;
+
+CREATE TABLE api_token (
+	id TEXT NOT NULL,
+	token_hash TEXT NOT NULL,
+	user_name TEXT NOT NULL,
+	name TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	last_used_at TEXT NULL,
+	FOREIGN KEY (user_name) REFERENCES user(name) ON DELETE CASCADE,
+	UNIQUE (token_hash),
+	PRIMARY KEY (id)
+) STRICT;
+`,
+	// 4: API token scopes, space separated. Tokens created before have full access.
+	`
+ALTER TABLE api_token ADD COLUMN scopes TEXT NOT NULL DEFAULT '*';
+`,
+	// 5: multi-device sync state and merge conflicts.
+	`
+CREATE TABLE sync_peer (
+	device TEXT NOT NULL,
+	cursor TEXT NULL,
+	file_mod_time TEXT NULL,
+	merged_at TEXT NULL,
+	PRIMARY KEY (device)
+) STRICT;
+
+CREATE TABLE sync_conflict (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	node_id TEXT NOT NULL,
+	device TEXT NOT NULL,
+	resolution TEXT NOT NULL,
+	local_data TEXT NOT NULL,
+	peer_data TEXT NOT NULL,
+	created_at TEXT NOT NULL
+) STRICT;
+`,
+	// 6: attribute changes and origin device with per-device sequence number in change log.
+	`
+CREATE TABLE local_device (
+	id INTEGER NOT NULL CHECK (id = 1),
+	name TEXT NOT NULL,
+	PRIMARY KEY (id)
+) STRICT;
+
+ALTER TABLE change_log ADD COLUMN device TEXT NOT NULL DEFAULT '';
+ALTER TABLE change_log ADD COLUMN device_seq INTEGER NOT NULL DEFAULT 0;
+UPDATE change_log SET device_seq = seq;
+CREATE INDEX change_log_device_seq_idx ON change_log(device, device_seq);
+
+-- Records made on this device get local device name and sequence number, records replicated from other
+-- devices are inserted with their origin device_seq.
+CREATE TRIGGER change_log_ai AFTER INSERT ON change_log WHEN new.device_seq = 0 BEGIN
+	UPDATE change_log
+		SET device = COALESCE((SELECT name FROM local_device WHERE id = 1), ''), device_seq = new.seq
+		WHERE seq = new.seq;
+END;
+
+CREATE TRIGGER change_log_node_attribute_ai AFTER INSERT ON node_attribute BEGIN
+	INSERT INTO change_log(entity, op, node_id, data, created_at)
+		VALUES (
+			'attribute', 'add', new.node_id,
+			json_object('key', new.key, 'value', new.value),
+			strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+END;
+CREATE TRIGGER change_log_node_attribute_ad AFTER DELETE ON node_attribute BEGIN
+	INSERT INTO change_log(entity, op, node_id, data, created_at)
+		VALUES (
+			'attribute', 'remove', old.node_id,
+			json_object('key', old.key, 'value', old.value),
+			strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+END;
+`,
+	// 7: merged positions of peer and local change logs. Peers merged before are assumed merged up to now.
+	`
+ALTER TABLE sync_peer ADD COLUMN change_seq INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sync_peer ADD COLUMN local_seq INTEGER NOT NULL DEFAULT 0;
+UPDATE sync_peer SET local_seq = (SELECT COALESCE(MAX(seq), 0) FROM change_log);
+`,
+	// 8: tag attribute key is "tag" instead of "tags", one attribute per tag as before.
+	`
+UPDATE OR IGNORE node_attribute SET key = 'tag' WHERE key = 'tags';
+DELETE FROM node_attribute WHERE key = 'tags';
+`,
+	// 9: node timestamps in UTC, so they are ordered as text. Fractional seconds are kept as is. Change log trigger
+	// is recreated around the update, since it isn't a change of nodes.
+	`
+DROP TRIGGER change_log_node_au;
+UPDATE node SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)
+		|| substr(created_at, 20, length(created_at) - 19
+			- IIF(created_at GLOB '*[+-][0-9][0-9]:[0-9][0-9]', 6, IIF(created_at GLOB '*Z', 1, 0)))
+		|| '+00:00'
+	WHERE created_at NOT GLOB '*+00:00' AND strftime('%Y-%m-%d %H:%M:%S', created_at) IS NOT NULL;
+UPDATE node SET updated_at = strftime('%Y-%m-%d %H:%M:%S', updated_at)
+		|| substr(updated_at, 20, length(updated_at) - 19
+			- IIF(updated_at GLOB '*[+-][0-9][0-9]:[0-9][0-9]', 6, IIF(updated_at GLOB '*Z', 1, 0)))
+		|| '+00:00'
+	WHERE updated_at NOT GLOB '*+00:00' AND strftime('%Y-%m-%d %H:%M:%S', updated_at) IS NOT NULL;
+UPDATE node SET deleted_at = strftime('%Y-%m-%d %H:%M:%S', deleted_at)
+		|| substr(deleted_at, 20, length(deleted_at) - 19
+			- IIF(deleted_at GLOB '*[+-][0-9][0-9]:[0-9][0-9]', 6, IIF(deleted_at GLOB '*Z', 1, 0)))
+		|| '+00:00'
+	WHERE deleted_at NOT GLOB '*+00:00' AND strftime('%Y-%m-%d %H:%M:%S', deleted_at) IS NOT NULL;
+CREATE TRIGGER change_log_node_au AFTER UPDATE ON node BEGIN
+	INSERT INTO change_log(entity, op, node_id, data, created_at)
+		VALUES (
+			'node',
+			IIF(new.deleted_at IS NOT NULL AND old.deleted_at IS NULL, 'delete', 'save'),
+			new.id,
+			json_object('name', new.name),
+			strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'));
+END;
+`,
+}
+
 func (s *Storage) GetSchemaVersion(ctx context.Context) (int, error) {
 	var version int
 	err := s.readDB.Get(&version, `SELECT MAX(version) FROM schema_version`)
@@ -118,20 +306,47 @@ func (s *Storage) CheckSchemaVersion(ctx context.Context, upgrade bool) error {
 		// Freshly created db file.
 		return s.setupNewDB(ctx)
 	}
+	if version > schemaVersion {
+		return fmt.Errorf("schema version %d is newer than supported %d", version, schemaVersion)
+	}
 	if !upgrade {
 		return fmt.Errorf("schema upgrade required from %d to %d", version, schemaVersion)
 	}
-	// TODO: upgrade db schema.
-	return fmt.Errorf("schema upgrade required from %d to %d", version, schemaVersion)
+	return s.upgradeDB(ctx, version)
 }
 
 func (s *Storage) setupNewDB(ctx context.Context) error {
 	if _, err := s.writeDB.ExecContext(ctx, schema); err != nil {
 		return fmt.Errorf("apply schema: %w", err)
 	}
+	for n, migration := range migrations {
+		if _, err := s.writeDB.ExecContext(ctx, migration); err != nil {
+			return fmt.Errorf("apply migration %d: %w", n+2, err)
+		}
+	}
 	if _, err := s.writeDB.ExecContext(ctx, "INSERT INTO schema_version (version, created_at) VALUES ($1, $2)", schemaVersion, time.Now()); err != nil {
 		return fmt.Errorf("update schema version: %w", err)
 	}
 
 	return nil
 }
+
+func (s *Storage) upgradeDB(ctx context.Context, version int) error {
+	for ; version < schemaVersion; version++ {
+		s.logger.InfoContext(ctx, "upgrade db schema", slog.Int("from", version), slog.Int("to", version+1))
+		tx, err := s.writeDB.BeginTxx(ctx, &sql.TxOptions{})
+		if err != nil {
+			return fmt.Errorf("begin tx: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, migrations[version-1]); err != nil {
+			return errors.Join(fmt.Errorf("apply migration %d: %w", version+1, err), tx.Rollback())
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_version (version, created_at) VALUES ($1, $2)", version+1, time.Now()); err != nil {
+			return errors.Join(fmt.Errorf("update schema version: %w", err), tx.Rollback())
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+	}
+	return nil
+}
@@ -6,12 +6,18 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 const (
 	EdgeRelChild = "child"
 	EdgeRelLink  = "link"
 	EdgeRelChain = "chain"
+	// EdgeRelArchive links bookmark to offline snapshot of its page.
+	EdgeRelArchive = "archive"
+	// EdgeRelAttachment links micro post to attached image.
+	EdgeRelAttachment = "attachment"
 )
 
 type Edge struct {
@@ -29,6 +35,15 @@ type edgeRow struct {
 }
 
 func (s *Storage) EdgesAdd(ctx context.Context, edges []Edge) error {
+	if err := edgesAdd(ctx, s.writeDB, edges); err != nil {
+		return err
+	}
+	s.notifyChanged()
+
+	return nil
+}
+
+func edgesAdd(ctx context.Context, db sqlx.ExtContext, edges []Edge) error {
 	now := time.Now()
 	rows := make([]edgeRow, 0, len(edges))
 	for _, edge := range edges {
@@ -39,8 +54,9 @@ func (s *Storage) EdgesAdd(ctx context.Context, edges []Edge) error {
 			CreatedAt: Timestamp{now},
 		})
 	}
-	_, err := s.writeDB.NamedExecContext(
+	_, err := sqlx.NamedExecContext(
 		ctx,
+		db,
 		`INSERT INTO edge(src_id, dst_id, relation, created_at)
 			VALUES (:src_id, :dst_id, :relation, :created_at)
 			ON CONFLICT DO NOTHING`,
@@ -49,29 +65,24 @@ func (s *Storage) EdgesAdd(ctx context.Context, edges []Edge) error {
 	if err != nil {
 		return fmt.Errorf("insert edges: %w", err)
 	}
-
 	return nil
 }
 
 func (s *Storage) EdgesRemove(ctx context.Context, edges []Edge) error {
-	rows := make([]edgeRow, 0, len(edges))
+	if len(edges) == 0 {
+		return nil
+	}
+	query := `WITH remove(src_id, dst_id, relation) AS (VALUES ` + sqlTupleList(3, len(edges)) + `)
+		DELETE FROM edge WHERE EXISTS (
+			SELECT 1 FROM remove WHERE edge.src_id = remove.src_id AND edge.dst_id = remove.dst_id AND edge.relation = remove.relation)`
+	args := make([]any, 0, 3*len(edges))
 	for _, edge := range edges {
-		rows = append(rows, edgeRow{
-			SrcID:    edge.SrcID,
-			DstID:    edge.DstID,
-			Relation: edge.Relation,
-		})
+		args = append(args, edge.SrcID, edge.DstID, edge.Relation)
 	}
-	_, err := s.writeDB.NamedExecContext(
-		ctx,
-		`WITH remove(src_id, dst_id, relation) AS (VALUES (:src_id, :dst_id, :relation))
-			DELETE FROM edge WHERE EXISTS (
-				SELECT 1 FROM remove WHERE edge.src_id = remove.src_id AND edge.dst_id = remove.dst_id AND edge.relation = remove.relation)`,
-		rows,
-	)
-	if err != nil {
+	if _, err := s.writeDB.ExecContext(ctx, query, args...); err != nil {
 		return fmt.Errorf("delete edges: %w", err)
 	}
+	s.notifyChanged()
 	return nil
 }
 
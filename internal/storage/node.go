@@ -15,7 +15,9 @@ const (
 )
 
 const (
-	NodeAttrKindRoot = "root"
+	NodeAttrKindRoot     = "root"
+	NodeAttrKindBookmark = "bookmark"
+	NodeAttrKindMicro    = "micro"
 )
 
 type Node struct {
@@ -59,22 +61,102 @@ type nodeAttributeRow struct {
 	CreatedAt Timestamp `db:"created_at"`
 }
 
-func (s *Storage) GenerateNodeID(ctx context.Context) (string, error) {
-	// TODO: configurable ID generation.
-	nodeID := time.Now().Format("20060102-150405")
-	s.nodeIDMu.Lock()
-	defer s.nodeIDMu.Unlock()
-	if nodeID == s.nodeIDLast {
-		s.nodeIDCounter += 1
-		nodeID = fmt.Sprintf("%s-%d", nodeID, s.nodeIDCounter)
-	} else {
-		s.nodeIDLast = nodeID
-		s.nodeIDCounter = 0
+// NodeSave creates or updates node. CreatedAt is set to current time unless given, CreatedAt of existing node isn't
+// changed. UpdatedAt is always set to current time, so the change is picked up by sync.
+func (s *Storage) NodeSave(ctx context.Context, node Node) error {
+	return s.nodeSave(ctx, node, false)
+}
+
+// NodeImport saves node like NodeSave, but keeps given UpdatedAt (e.g. modification time of imported file).
+// Importer is responsible for keeping timestamps of changed nodes increasing.
+func (s *Storage) NodeImport(ctx context.Context, node Node) error {
+	return s.nodeSave(ctx, node, true)
+}
+
+func (s *Storage) nodeSave(ctx context.Context, node Node, keepUpdatedAt bool) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := s.writeDB.BeginTxx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	if err := nodeSaveTx(txCtx, tx, node, keepUpdatedAt); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
 	}
-	return nodeID, nil
+	s.notifyChanged()
+	return nil
 }
 
-func (s *Storage) NodeSave(ctx context.Context, node Node) error {
+// NodesSaveWithEdges saves nodes like NodeSave and adds edges in single transaction, e.g. node with its attachments.
+func (s *Storage) NodesSaveWithEdges(ctx context.Context, nodes []Node, edges []Edge) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := s.writeDB.BeginTxx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	for _, node := range nodes {
+		if err := nodeSaveTx(txCtx, tx, node, false); err != nil {
+			return fmt.Errorf("save node %q: %w", node.ID, err)
+		}
+	}
+	if len(edges) > 0 {
+		if err := edgesAdd(txCtx, tx, edges); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	s.notifyChanged()
+	return nil
+}
+
+// NodesUpdate loads existing nodes by ids and saves nodes returned by update in single transaction, so bulk changes
+// are applied entirely or not at all and concurrent writes aren't lost in between. Missing nodes are absent from
+// the map passed to update.
+func (s *Storage) NodesUpdate(ctx context.Context, ids []string, update func(nodes map[string]Node) ([]Node, error)) error {
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := s.writeDB.BeginTxx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	nodes := make(map[string]Node, len(ids))
+	for batch := ids; len(batch) > 0; {
+		n := min(len(batch), nodesLoadBatchSize)
+		loaded, err := nodesLoad(txCtx, tx, batch[:n])
+		if err != nil {
+			return err
+		}
+		for id, node := range loaded {
+			nodes[id] = node
+		}
+		batch = batch[n:]
+	}
+	changed, err := update(nodes)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	for _, node := range changed {
+		if err := nodeSaveTx(txCtx, tx, node, false); err != nil {
+			return fmt.Errorf("save node %q: %w", node.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	s.notifyChanged()
+	return nil
+}
+
+func nodeSaveTx(ctx context.Context, tx *sqlx.Tx, node Node, keepUpdatedAt bool) error {
 	now := time.Now()
 	row := nodeRow{
 		ID:              node.ID,
@@ -84,6 +166,12 @@ func (s *Storage) NodeSave(ctx context.Context, node Node) error {
 		CreatedAt:       Timestamp{now},
 		UpdatedAt:       Timestamp{now},
 	}
+	if !node.CreatedAt.IsZero() {
+		row.CreatedAt = Timestamp{node.CreatedAt}
+	}
+	if keepUpdatedAt && !node.UpdatedAt.IsZero() {
+		row.UpdatedAt = Timestamp{node.UpdatedAt}
+	}
 	attrRows := make([]nodeAttributeRow, 0, len(node.Attributes))
 	for _, attr := range node.Attributes {
 		attrRows = append(attrRows, nodeAttributeRow{
@@ -94,14 +182,8 @@ func (s *Storage) NodeSave(ctx context.Context, node Node) error {
 		})
 	}
 
-	txCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	tx, err := s.writeDB.BeginTxx(txCtx, &sql.TxOptions{})
-	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
-	}
-	_, err = tx.NamedExecContext(
-		txCtx,
+	_, err := tx.NamedExecContext(
+		ctx,
 		`INSERT INTO node(id, name, content_hash, content_mimetype, created_at, updated_at)
 			VALUES (:id, :name, :content_hash, :content_mimetype, :created_at, :updated_at)
 			ON CONFLICT(id) DO UPDATE
@@ -138,7 +220,7 @@ func (s *Storage) NodeSave(ctx context.Context, node Node) error {
 		return fmt.Errorf("prepare delete attrs query: %w", err)
 	}
 	query = tx.Rebind(query)
-	_, err = tx.ExecContext(txCtx, query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("delete attrs: %w", err)
 	}
@@ -155,21 +237,49 @@ func (s *Storage) NodeSave(ctx context.Context, node Node) error {
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit: %w", err)
+	return nil
+}
+
+// NodesDelete marks nodes as deleted. Already deleted nodes are left intact.
+func (s *Storage) NodesDelete(ctx context.Context, ids []string) error {
+	now := Timestamp{time.Now()}
+	query, args, err := sqlx.In(
+		`UPDATE node SET deleted_at = ?, updated_at = ? WHERE id IN (?) AND deleted_at IS NULL`,
+		now, now, ids,
+	)
+	if err != nil {
+		return fmt.Errorf("prepare delete query: %w", err)
 	}
+	query = s.writeDB.Rebind(query)
+	if _, err := s.writeDB.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("update nodes: %w", err)
+	}
+	s.notifyChanged()
 	return nil
 }
 
+// nodesLoadBatchSize limits number of nodes loaded by single query.
+const nodesLoadBatchSize = 500
+
+// queryer is implemented by both sqlx.DB and sqlx.Tx.
+type queryer interface {
+	sqlx.QueryerContext
+	Rebind(query string) string
+}
+
 func (s *Storage) NodesLoad(ctx context.Context, ids []string) (map[string]Node, error) {
+	return nodesLoad(ctx, s.readDB, ids)
+}
+
+func nodesLoad(ctx context.Context, db queryer, ids []string) (map[string]Node, error) {
 	query, args, err := sqlx.In(
 		`SELECT node_id, key, value, created_at FROM node_attribute WHERE node_id IN (?)`, ids,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("prepare attrs query: %w", err)
 	}
-	query = s.readDB.Rebind(query)
-	rows, err := s.readDB.QueryxContext(ctx, query, args...)
+	query = db.Rebind(query)
+	rows, err := db.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("select node: %w", err)
 	}
@@ -198,8 +308,8 @@ func (s *Storage) NodesLoad(ctx context.Context, ids []string) (map[string]Node,
 	if err != nil {
 		return nil, fmt.Errorf("prepare node query: %w", err)
 	}
-	query = s.readDB.Rebind(query)
-	rows, err = s.readDB.QueryxContext(ctx, query, args...)
+	query = db.Rebind(query)
+	rows, err = db.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("select node: %w", err)
 	}
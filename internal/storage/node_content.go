@@ -84,6 +84,7 @@ func (s *Storage) NodeContentSave(ctx context.Context, r io.Reader) (string, err
 	if err := tx.Commit(); err != nil {
 		return "", fmt.Errorf("commit: %w", err)
 	}
+	s.notifyChanged()
 
 	return hash, nil
 }
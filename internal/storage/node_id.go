@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Node ID generation strategies.
+const (
+	IDGeneratorTimestamp       = "timestamp"
+	IDGeneratorTimestampDevice = "timestamp-device"
+	IDGeneratorULID            = "ulid"
+	IDGeneratorUUIDv7          = "uuidv7"
+	IDGeneratorContentHash     = "content-hash"
+)
+
+// IDGenerators lists names of available node ID generation strategies.
+var IDGenerators = []string{
+	IDGeneratorTimestamp,
+	IDGeneratorTimestampDevice,
+	IDGeneratorULID,
+	IDGeneratorUUIDv7,
+	IDGeneratorContentHash,
+}
+
+const (
+	nodeIDMaxAttempts = 100
+	// Issued IDs are remembered for some time, so IDs given out but not yet saved aren't issued twice.
+	nodeIDIssuedTTL = 10 * time.Minute
+)
+
+// IDGenerator produces candidate node IDs. Attempt is 0 for the first candidate and is increased while candidates
+// collide with existing or recently issued IDs. ContentHash may be empty if node content isn't known yet.
+type IDGenerator interface {
+	NodeID(now time.Time, contentHash string, attempt int) (string, error)
+}
+
+// NewIDGenerator returns generator by strategy name. Device is used by "timestamp-device" strategy.
+func NewIDGenerator(name, device string) (IDGenerator, error) {
+	switch name {
+	case IDGeneratorTimestamp:
+		return TimestampIDGenerator{}, nil
+	case IDGeneratorTimestampDevice:
+		suffix := strings.Trim(nodeIDUnsafeRe.ReplaceAllString(strings.ToLower(device), "-"), "-")
+		if suffix == "" {
+			return nil, fmt.Errorf("id generator %q: device name required", name)
+		}
+		return TimestampIDGenerator{Suffix: suffix}, nil
+	case IDGeneratorULID:
+		return ULIDGenerator{}, nil
+	case IDGeneratorUUIDv7:
+		return UUIDv7Generator{}, nil
+	case IDGeneratorContentHash:
+		return ContentHashIDGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown id generator %q, available: %s", name, strings.Join(IDGenerators, ", "))
+	}
+}
+
+var nodeIDUnsafeRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// TimestampIDGenerator produces Zettelkasten-like IDs "20060102-150405[-suffix][-N]" in local time.
+type TimestampIDGenerator struct {
+	Suffix string
+}
+
+func (g TimestampIDGenerator) NodeID(now time.Time, _ string, attempt int) (string, error) {
+	id := now.Format("20060102-150405")
+	if g.Suffix != "" {
+		id += "-" + g.Suffix
+	}
+	if attempt > 0 {
+		id = fmt.Sprintf("%s-%d", id, attempt)
+	}
+	return id, nil
+}
+
+// ULIDGenerator produces lowercase ULIDs: 48 bit millisecond timestamp and 80 random bits in Crockford's base32.
+type ULIDGenerator struct{}
+
+const crockfordAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+func (ULIDGenerator) NodeID(now time.Time, _ string, _ int) (string, error) {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixMilli())<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", fmt.Errorf("read random: %w", err)
+	}
+	// 128 bits are encoded as 26 characters, the first one holds only 3 bits.
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	id := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		id[i] = crockfordAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id), nil
+}
+
+// UUIDv7Generator produces RFC 9562 version 7 UUIDs in canonical lowercase form.
+type UUIDv7Generator struct{}
+
+func (UUIDv7Generator) NodeID(now time.Time, _ string, _ int) (string, error) {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(now.UnixMilli())<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", fmt.Errorf("read random: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// ContentHashIDGenerator produces IDs from content hash prefix, prefix is lengthened on the first collisions. Further
+// candidates are prefix with random suffix, so many nodes with the same content get unique IDs. Without content hash,
+// hash of random bytes is used.
+type ContentHashIDGenerator struct{}
+
+const (
+	contentHashIDLen = 12
+	// contentHashIDLengthenAttempts is number of attempts lengthening prefix before random suffix is used.
+	contentHashIDLengthenAttempts = 4
+	contentHashIDSuffixLen        = 4 // bytes
+)
+
+func (ContentHashIDGenerator) NodeID(_ time.Time, contentHash string, attempt int) (string, error) {
+	if contentHash == "" {
+		var b [32]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", fmt.Errorf("read random: %w", err)
+		}
+		sum := sha256.Sum256(b[:])
+		contentHash = hex.EncodeToString(sum[:])
+	}
+	if attempt < contentHashIDLengthenAttempts {
+		return contentHash[:min(contentHashIDLen+2*attempt, len(contentHash))], nil
+	}
+	var suffix [contentHashIDSuffixLen]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", fmt.Errorf("read random: %w", err)
+	}
+	return contentHash[:min(contentHashIDLen, len(contentHash))] + "-" + hex.EncodeToString(suffix[:]), nil
+}
+
+// SetIDGenerator sets node ID generation strategy, TimestampIDGenerator is used by default.
+func (s *Storage) SetIDGenerator(gen IDGenerator) {
+	s.nodeIDMu.Lock()
+	defer s.nodeIDMu.Unlock()
+	s.nodeIDGen = gen
+}
+
+// GenerateNodeID returns new node ID not used by existing nodes.
+func (s *Storage) GenerateNodeID(ctx context.Context) (string, error) {
+	return s.GenerateNodeIDFor(ctx, "")
+}
+
+// GenerateNodeIDFor returns new node ID for node with given content, which is used by content hash strategy.
+func (s *Storage) GenerateNodeIDFor(ctx context.Context, contentHash string) (string, error) {
+	s.nodeIDMu.Lock()
+	defer s.nodeIDMu.Unlock()
+	gen := s.nodeIDGen
+	if gen == nil {
+		gen = TimestampIDGenerator{}
+	}
+	now := time.Now()
+	for id, issuedAt := range s.nodeIDIssued {
+		if now.Sub(issuedAt) > nodeIDIssuedTTL {
+			delete(s.nodeIDIssued, id)
+		}
+	}
+	base, err := gen.NodeID(now, contentHash, 0)
+	if err != nil {
+		return "", fmt.Errorf("generate node id: %w", err)
+	}
+	// Continue after the last attempt with the same base, e.g. for many nodes created within one second.
+	start := 0
+	if base == s.nodeIDLastBase {
+		start = s.nodeIDLastAttempt + 1
+	}
+	for attempt := start; attempt < start+nodeIDMaxAttempts; attempt++ {
+		id := base
+		if attempt > 0 {
+			if id, err = gen.NodeID(now, contentHash, attempt); err != nil {
+				return "", fmt.Errorf("generate node id: %w", err)
+			}
+		}
+		if _, ok := s.nodeIDIssued[id]; ok {
+			continue
+		}
+		var exists bool
+		if err := s.readDB.GetContext(ctx, &exists, `SELECT EXISTS(SELECT 1 FROM node WHERE id = $1)`, id); err != nil {
+			return "", fmt.Errorf("check node id: %w", err)
+		}
+		if exists {
+			continue
+		}
+		s.nodeIDIssued[id] = now
+		s.nodeIDLastBase, s.nodeIDLastAttempt = base, attempt
+		return id, nil
+	}
+	return "", fmt.Errorf("generate node id: no unique id after %d attempts", nodeIDMaxAttempts)
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDGenerators(t *testing.T) {
+	now := time.Date(2024, 3, 5, 7, 9, 11, 0, time.UTC)
+	tests := []struct {
+		name    string
+		device  string
+		attempt int
+		re      string
+	}{
+		{IDGeneratorTimestamp, "", 0, `^20240305-070911$`},
+		{IDGeneratorTimestamp, "", 2, `^20240305-070911-2$`},
+		{IDGeneratorTimestampDevice, "My Laptop.local", 1, `^20240305-070911-my-laptop-local-1$`},
+		{IDGeneratorULID, "", 0, `^01hr[0-9a-hjkmnp-tv-z]{22}$`},
+		{IDGeneratorUUIDv7, "", 0, `^018e0d71-e1d8-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+		{IDGeneratorContentHash, "", 0, `^[0-9a-f]{12}$`},
+		{IDGeneratorContentHash, "", 50, `^[0-9a-f]{12}-[0-9a-f]{8}$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewIDGenerator(tt.name, tt.device)
+			require.NoError(t, err)
+			id, err := gen.NodeID(now, "", tt.attempt)
+			require.NoError(t, err)
+			assert.Regexp(t, regexp.MustCompile(tt.re), id)
+		})
+	}
+
+	_, err := NewIDGenerator("nope", "")
+	assert.Error(t, err)
+	_, err = NewIDGenerator(IDGeneratorTimestampDevice, "")
+	assert.Error(t, err)
+}
+
+func TestStorageGenerateNodeID(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewStorage(testLogger(t), t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Open(ctx, false))
+	defer func() { require.NoError(t, s.Close()) }()
+
+	t.Run("timestamp", func(t *testing.T) {
+		seen := make(map[string]bool)
+		for i := 0; i < 300; i++ {
+			id, err := s.GenerateNodeID(ctx)
+			require.NoError(t, err)
+			require.False(t, seen[id], id)
+			seen[id] = true
+		}
+	})
+
+	t.Run("content_hash", func(t *testing.T) {
+		s.SetIDGenerator(ContentHashIDGenerator{})
+		defer s.SetIDGenerator(nil)
+		contentHash, err := s.NodeContentSave(ctx, bytes.NewReader([]byte(`CONTENT ID`)))
+		require.NoError(t, err)
+
+		id1, err := s.GenerateNodeIDFor(ctx, contentHash)
+		require.NoError(t, err)
+		assert.Equal(t, contentHash[:12], id1)
+		require.NoError(t, s.NodeSave(ctx, Node{ID: id1, Name: "node", ContentHash: contentHash, ContentMimetype: "text/plain"}))
+
+		// Restart forgets issued IDs, existing node must still be respected.
+		s.nodeIDIssued = make(map[string]time.Time)
+		s.nodeIDLastBase = ""
+		id2, err := s.GenerateNodeIDFor(ctx, contentHash)
+		require.NoError(t, err)
+		assert.Equal(t, contentHash[:14], id2)
+
+		// Many nodes with the same content get random suffix when prefix lengthening is exhausted.
+		seen := map[string]bool{id1: true, id2: true}
+		for i := 0; i < 40; i++ {
+			id, err := s.GenerateNodeIDFor(ctx, contentHash)
+			require.NoError(t, err)
+			require.False(t, seen[id], id)
+			seen[id] = true
+			require.NoError(t, s.NodeSave(ctx, Node{ID: id, Name: "node", ContentHash: contentHash, ContentMimetype: "text/plain"}))
+			if i >= contentHashIDLengthenAttempts {
+				assert.Regexp(t, "^"+contentHash[:12]+"-[0-9a-f]{8}$", id)
+			}
+		}
+	})
+}
@@ -2,8 +2,12 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 func (s *Storage) QueryByAttribute(ctx context.Context, key, value string) ([]string, error) {
@@ -30,6 +34,211 @@ func (s *Storage) QueryByAttribute(ctx context.Context, key, value string) ([]st
 	return nodeIDs, nil
 }
 
+// QueryByAttributeTree returns IDs of non-deleted nodes with attribute value equal to value or nested in it as
+// slash separated path, e.g. "dev/db" is nested in "dev".
+func (s *Storage) QueryByAttributeTree(ctx context.Context, key, value string) ([]string, error) {
+	nodeIDs := make([]string, 0)
+	err := s.readDB.SelectContext(
+		ctx,
+		&nodeIDs,
+		`SELECT DISTINCT a.node_id FROM node_attribute AS a JOIN node AS n ON a.node_id = n.id AND n.deleted_at IS NULL
+			WHERE a.key = $1 AND (a.value = $2 OR substr(a.value, 1, length($2) + 1) = $2 || '/')
+			ORDER BY n.created_at, n.id`,
+		key, value,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select node ids: %w", err)
+	}
+	return nodeIDs, nil
+}
+
+// QueryAttributeCounts returns number of non-deleted nodes by value of attribute key.
+func (s *Storage) QueryAttributeCounts(ctx context.Context, key string) (map[string]int, error) {
+	rows, err := s.readDB.QueryxContext(
+		ctx,
+		`SELECT a.value, COUNT(DISTINCT a.node_id) FROM node_attribute AS a
+			JOIN node AS n ON a.node_id = n.id AND n.deleted_at IS NULL
+			WHERE a.key = $1
+			GROUP BY a.value`,
+		key,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select attributes: %w", err)
+	}
+	counts := make(map[string]int)
+	var value string
+	var count int
+	for rows.Next() {
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, fmt.Errorf("scan attribute: %w", errors.Join(err, rows.Close()))
+		}
+		counts[value] = count
+	}
+	return counts, nil
+}
+
+// QueryNodeIDs returns IDs of all non-deleted nodes in order of creation.
+func (s *Storage) QueryNodeIDs(ctx context.Context) ([]string, error) {
+	nodeIDs := make([]string, 0)
+	err := s.readDB.SelectContext(ctx, &nodeIDs, `SELECT id FROM node WHERE deleted_at IS NULL ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("select node ids: %w", err)
+	}
+	return nodeIDs, nil
+}
+
+// TimelineCursor is position in timeline after node with given creation time and ID.
+type TimelineCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// QueryTimeline returns up to limit IDs of non-deleted nodes ordered by creation time and ID, starting after cursor,
+// or the newest first when desc is set. Zero cursor starts from the beginning. Non-empty kind selects only nodes of
+// the kind.
+func (s *Storage) QueryTimeline(ctx context.Context, kind string, cursor TimelineCursor, desc bool, limit int) ([]string, error) {
+	query := `SELECT n.id FROM node AS n WHERE n.deleted_at IS NULL`
+	args := map[string]any{
+		"kind_key":   NodeAttrKind,
+		"kind":       kind,
+		"created_at": Timestamp{cursor.CreatedAt},
+		"id":         cursor.ID,
+		"limit":      limit,
+	}
+	if kind != "" {
+		query += ` AND EXISTS (SELECT 1 FROM node_attribute AS a
+			WHERE a.node_id = n.id AND a.key = :kind_key AND a.value = :kind)`
+	}
+	switch {
+	case cursor.CreatedAt.IsZero():
+	case desc:
+		query += ` AND (n.created_at, n.id) < (:created_at, :id)`
+	default:
+		query += ` AND (n.created_at, n.id) > (:created_at, :id)`
+	}
+	if desc {
+		query += ` ORDER BY n.created_at DESC, n.id DESC LIMIT :limit`
+	} else {
+		query += ` ORDER BY n.created_at, n.id LIMIT :limit`
+	}
+	rows, err := s.readDB.NamedQueryContext(ctx, query, args)
+	if err != nil {
+		return nil, fmt.Errorf("select node ids: %w", err)
+	}
+	defer rows.Close()
+	nodeIDs := make([]string, 0)
+	var nodeID string
+	for rows.Next() {
+		if err := rows.Scan(&nodeID); err != nil {
+			return nil, fmt.Errorf("scan node id: %w", err)
+		}
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select node ids: %w", err)
+	}
+	return nodeIDs, nil
+}
+
+// QueryAttributeIndex returns IDs of nodes, including deleted ones, by value of attribute key. If several nodes have
+// the same value, any of them is returned.
+func (s *Storage) QueryAttributeIndex(ctx context.Context, key string) (map[string]string, error) {
+	rows, err := s.readDB.QueryxContext(ctx, `SELECT value, node_id FROM node_attribute WHERE key = $1`, key)
+	if err != nil {
+		return nil, fmt.Errorf("select attributes: %w", err)
+	}
+	index := make(map[string]string)
+	var value, nodeID string
+	for rows.Next() {
+		if err := rows.Scan(&value, &nodeID); err != nil {
+			return nil, fmt.Errorf("scan attribute: %w", errors.Join(err, rows.Close()))
+		}
+		index[value] = nodeID
+	}
+	return index, nil
+}
+
+// QueryAttributeIndexScoped is like QueryAttributeIndex, but only for nodes with attribute scopeKey equal to
+// scopeValue or without scopeKey attribute at all. Nodes of the scope win over ones without it.
+func (s *Storage) QueryAttributeIndexScoped(ctx context.Context, key, scopeKey, scopeValue string) (map[string]string, error) {
+	rows, err := s.readDB.QueryxContext(
+		ctx,
+		`SELECT a.value, a.node_id FROM node_attribute AS a
+			LEFT JOIN node_attribute AS scope ON scope.node_id = a.node_id AND scope.key = $1
+			WHERE a.key = $2 AND (scope.value = $3 OR scope.value IS NULL)
+			ORDER BY scope.value IS NOT NULL`,
+		scopeKey, key, scopeValue,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select attributes: %w", err)
+	}
+	defer rows.Close()
+	index := make(map[string]string)
+	var value, nodeID string
+	for rows.Next() {
+		if err := rows.Scan(&value, &nodeID); err != nil {
+			return nil, fmt.Errorf("scan attribute: %w", err)
+		}
+		index[value] = nodeID
+	}
+	return index, rows.Err()
+}
+
+// walkMaxDepth limits edge traversal depth, each level of the walk is a separate query.
+const walkMaxDepth = 1000
+
+// QueryWalk returns IDs of non-deleted nodes reachable from rootID by edges of relation, excluding the root, closest
+// first. Walking chain edges from list head gives list items in order. Every node is visited once, so cycles and
+// shared descendants don't multiply the work.
+func (s *Storage) QueryWalk(ctx context.Context, rootID, relation string) ([]string, error) {
+	tx, err := s.readDB.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	nodeIDs := make([]string, 0)
+	visited := map[string]bool{rootID: true}
+	frontier := []string{rootID}
+	for depth := 0; depth < walkMaxDepth && len(frontier) > 0; depth++ {
+		query, args, err := sqlx.In(
+			`SELECT e.dst_id, n.deleted_at IS NOT NULL FROM edge AS e JOIN node AS n ON n.id = e.dst_id
+				WHERE e.src_id IN (?) AND e.relation = ?
+				ORDER BY n.created_at, e.dst_id`,
+			frontier, relation,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("prepare walk query: %w", err)
+		}
+		rows, err := tx.QueryxContext(ctx, tx.Rebind(query), args...)
+		if err != nil {
+			return nil, fmt.Errorf("select edges: %w", err)
+		}
+		var next []string
+		var nodeID string
+		var deleted bool
+		for rows.Next() {
+			if err := rows.Scan(&nodeID, &deleted); err != nil {
+				return nil, fmt.Errorf("scan edge: %w", errors.Join(err, rows.Close()))
+			}
+			if visited[nodeID] {
+				continue
+			}
+			visited[nodeID] = true
+			// Deleted nodes aren't returned, but the walk goes on through them.
+			next = append(next, nodeID)
+			if !deleted {
+				nodeIDs = append(nodeIDs, nodeID)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("select edges: %w", err)
+		}
+		frontier = next
+	}
+	return nodeIDs, nil
+}
+
 func (s *Storage) QueryFullTextSearch(ctx context.Context, searchTerm string, limit int) ([]string, error) {
 	// TODO: implement snowball stemming pre-processing.
 	rows, err := s.readDB.NamedQueryContext(
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// QueryObserver receives duration of each database query. DB is "read" or "write", op is statement kind
+// ("select", "insert", "update", "delete" etc.). Query duration includes reading of result rows.
+type QueryObserver func(db, op string, d time.Duration)
+
+// SetQueryObserver sets observer for database queries, e.g. to collect metrics. Must be called before Open.
+func (s *Storage) SetQueryObserver(f QueryObserver) {
+	s.queryObserver = f
+}
+
+func (s *Storage) openDB(connURI, name string) (*sqlx.DB, error) {
+	if s.queryObserver == nil {
+		return sqlx.Open(sqliteDriverName, connURI)
+	}
+	observe := func(op string, d time.Duration) { s.queryObserver(name, op, d) }
+	connector := &observedConnector{dsn: connURI, observe: observe}
+	return sqlx.NewDb(sql.OpenDB(connector), sqliteDriverName), nil
+}
+
+func queryKind(query string) string {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	kind, _, _ := strings.Cut(query, " ")
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	switch kind {
+	case "select", "insert", "update", "delete", "with", "pragma", "begin", "commit", "rollback", "create", "alter", "drop", "vacuum":
+		return kind
+	default:
+		return "other"
+	}
+}
+
+type observedConnector struct {
+	dsn     string
+	observe func(op string, d time.Duration)
+}
+
+func (c *observedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := sqliteDriver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &observedConn{conn: conn.(sqliteConn), observe: c.observe}, nil
+}
+
+func (c *observedConnector) Driver() driver.Driver {
+	return sqliteDriver
+}
+
+// sqliteConn lists driver interfaces implemented by sqlite3.SQLiteConn.
+type sqliteConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+}
+
+type observedConn struct {
+	conn    sqliteConn
+	observe func(op string, d time.Duration)
+}
+
+var _ sqliteConn = (*observedConn)(nil)
+
+func (c *observedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.conn.Prepare(query)
+}
+
+func (c *observedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.conn.PrepareContext(ctx, query)
+}
+
+func (c *observedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *observedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *observedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	tx, err := c.conn.BeginTx(ctx, opts)
+	c.observe("begin", time.Since(start))
+	return tx, err
+}
+
+func (c *observedConn) Ping(ctx context.Context) error {
+	return c.conn.Ping(ctx)
+}
+
+func (c *observedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.conn.ExecContext(ctx, query, args)
+	c.observe(queryKind(query), time.Since(start))
+	return res, err
+}
+
+func (c *observedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.conn.QueryContext(ctx, query, args)
+	if err != nil {
+		c.observe(queryKind(query), time.Since(start))
+		return nil, err
+	}
+	return &observedRows{Rows: rows, done: func() { c.observe(queryKind(query), time.Since(start)) }}, nil
+}
+
+type observedRows struct {
+	driver.Rows
+	done func()
+}
+
+func (r *observedRows) Close() error {
+	err := r.Rows.Close()
+	if r.done != nil {
+		r.done()
+		r.done = nil
+	}
+	return err
+}
@@ -9,18 +9,21 @@ import (
 
 const sqliteDriverName = "sqlite3_custom"
 
+var sqliteDriver = &sqlite3.SQLiteDriver{
+	ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+		if err := conn.RegisterFunc("is_text_mimetype", IsTextMimetype, true); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
 func init() {
-	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
-		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
-			if err := conn.RegisterFunc("is_text_mimetype", isTextMimetype, true); err != nil {
-				return err
-			}
-			return nil
-		},
-	})
+	sql.Register(sqliteDriverName, sqliteDriver)
 }
 
-func isTextMimetype(mimetype string) bool {
+// IsTextMimetype reports whether content of the mimetype is text, which is indexed for full text search.
+func IsTextMimetype(mimetype string) bool {
 	switch {
 	case strings.HasPrefix(mimetype, "text/"):
 		return true
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Stats describes database size and contents.
+type Stats struct {
+	PageCount    int64
+	PageSize     int64
+	WALSize      int64
+	Nodes        int64
+	DeletedNodes int64
+	Edges        int64
+	Blobs        int64
+	ContentBytes int64
+}
+
+func (s *Storage) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	if err := s.readDB.GetContext(ctx, &stats.PageCount, `PRAGMA page_count`); err != nil {
+		return stats, fmt.Errorf("page count: %w", err)
+	}
+	if err := s.readDB.GetContext(ctx, &stats.PageSize, `PRAGMA page_size`); err != nil {
+		return stats, fmt.Errorf("page size: %w", err)
+	}
+	row := s.readDB.QueryRowxContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM node WHERE deleted_at IS NULL),
+			(SELECT COUNT(*) FROM node WHERE deleted_at IS NOT NULL),
+			(SELECT COUNT(*) FROM edge),
+			(SELECT COUNT(*) FROM node_content),
+			(SELECT COALESCE(SUM(length(content)), 0) FROM node_content)
+	`)
+	if err := row.Scan(&stats.Nodes, &stats.DeletedNodes, &stats.Edges, &stats.Blobs, &stats.ContentBytes); err != nil {
+		return stats, fmt.Errorf("count records: %w", err)
+	}
+	fi, err := os.Stat(s.dbPath() + "-wal")
+	if err == nil {
+		stats.WALSize = fi.Size()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return stats, fmt.Errorf("stat WAL file: %w", err)
+	}
+	return stats, nil
+}
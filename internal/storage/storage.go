@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
@@ -22,15 +23,23 @@ type Storage struct {
 	writeDB *sqlx.DB
 	readDB  *sqlx.DB
 
-	nodeIDMu      sync.Mutex
-	nodeIDLast    string
-	nodeIDCounter int
+	nodeIDMu          sync.Mutex
+	nodeIDGen         IDGenerator
+	nodeIDIssued      map[string]time.Time
+	nodeIDLastBase    string
+	nodeIDLastAttempt int
+
+	changeNotify chan struct{}
+
+	queryObserver QueryObserver
 }
 
 func NewStorage(logger *slog.Logger, dataDir string) (*Storage, error) {
 	storage := &Storage{
-		DataDir: dataDir,
-		logger:  logger,
+		DataDir:      dataDir,
+		logger:       logger,
+		nodeIDIssued: make(map[string]time.Time),
+		changeNotify: make(chan struct{}, 1),
 	}
 	return storage, nil
 }
@@ -48,14 +57,24 @@ func (s *Storage) Open(ctx context.Context, upgrade bool) error {
 	return nil
 }
 
+// Close closes database connections. WAL is checkpointed and truncated, so database file is self-contained
+// after close.
 func (s *Storage) Close() error {
-	wCloseErr := s.writeDB.Close()
 	rCloseErr := s.readDB.Close()
-	return errors.Join(wCloseErr, rCloseErr)
+	_, checkpointErr := s.writeDB.Exec("PRAGMA wal_checkpoint(TRUNCATE);")
+	if checkpointErr != nil {
+		checkpointErr = fmt.Errorf("checkpoint WAL: %w", checkpointErr)
+	}
+	wCloseErr := s.writeDB.Close()
+	return errors.Join(checkpointErr, wCloseErr, rCloseErr)
+}
+
+func (s *Storage) dbPath() string {
+	return s.DataDir + "/data.db"
 }
 
 func (s *Storage) connURI(mode string) string {
-	connURI := s.DataDir + "/data.db"
+	connURI := s.dbPath()
 	switch mode {
 	case "read":
 		connURI += "?mode=r"
@@ -72,7 +91,7 @@ func (s *Storage) connURI(mode string) string {
 
 func (s *Storage) openWrite(ctx context.Context) (err error) {
 	connURI := s.connURI("create")
-	s.writeDB, err = sqlx.Open(sqliteDriverName, connURI)
+	s.writeDB, err = s.openDB(connURI, "write")
 	if err != nil {
 		return fmt.Errorf("sqlite open %q: %w", connURI, err)
 	}
@@ -80,7 +99,7 @@ func (s *Storage) openWrite(ctx context.Context) (err error) {
 		return fmt.Errorf("sqlite open %q: %w", connURI, err)
 	}
 	s.writeDB.SetMaxOpenConns(1)
-	s.logger.Debug("sqlite open write connection", slog.String("conn_uri", connURI))
+	s.logger.DebugContext(ctx, "sqlite open write connection", slog.String("conn_uri", connURI))
 
 	s.writeDB.ExecContext(ctx, "PRAGMA journal_mode = WAL;")
 	s.writeDB.ExecContext(ctx, "PRAGMA synchronous = NORMAL;")
@@ -93,7 +112,7 @@ func (s *Storage) openWrite(ctx context.Context) (err error) {
 
 func (s *Storage) openRead(ctx context.Context) (err error) {
 	connURI := s.connURI("read")
-	s.readDB, err = sqlx.Open(sqliteDriverName, connURI)
+	s.readDB, err = s.openDB(connURI, "read")
 	if err != nil {
 		return fmt.Errorf("sqlite open %q: %w", connURI, err)
 	}
@@ -101,7 +120,7 @@ func (s *Storage) openRead(ctx context.Context) (err error) {
 		return fmt.Errorf("sqlite open %q: %w", connURI, err)
 	}
 	s.readDB.SetMaxOpenConns(max(4, runtime.NumCPU()))
-	s.logger.Debug("sqlite open read connection", slog.String("conn_uri", connURI))
+	s.logger.DebugContext(ctx, "sqlite open read connection", slog.String("conn_uri", connURI))
 
 	s.readDB.ExecContext(ctx, "PRAGMA journal_mode = WAL;")
 	s.readDB.ExecContext(ctx, "PRAGMA synchronous = NORMAL;")
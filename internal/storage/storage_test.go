@@ -3,9 +3,13 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -101,7 +105,7 @@ func TestStorage(t *testing.T) {
 		assert.Equal(t, "test node", node.Name)
 		assert.Equal(t, contentHash1, node.ContentHash)
 		assert.Equal(t, "text/plain", node.ContentMimetype)
-		assert.Equal(t, len([]byte(`TEST CONTENT 1`)), node.ContentLength)
+		assert.Equal(t, int64(len([]byte(`TEST CONTENT 1`))), node.ContentLength)
 		assert.False(t, node.IsDeleted())
 		assert.Equal(t, node.CreatedAt, node.UpdatedAt)
 		assert.Equal(t, 2, len(node.Attributes))
@@ -127,6 +131,41 @@ func TestStorage(t *testing.T) {
 			assert.Equal(t, contentHash2, node.ContentHash)
 			assert.NotEqual(t, node.CreatedAt, node.UpdatedAt)
 			assert.Equal(t, 2, len(node.Attributes))
+
+			// Loaded node saved back gets new UpdatedAt.
+			updatedAt := node.UpdatedAt
+			require.NoError(t, s.NodeSave(ctx, node))
+			nodes, err = s.NodesLoad(ctx, []string{nodeID})
+			require.NoError(t, err)
+			assert.True(t, nodes[nodeID].UpdatedAt.After(updatedAt))
+
+			// Importer keeps given UpdatedAt.
+			node.UpdatedAt = updatedAt
+			require.NoError(t, s.NodeImport(ctx, node))
+			nodes, err = s.NodesLoad(ctx, []string{nodeID})
+			require.NoError(t, err)
+			assert.True(t, nodes[nodeID].UpdatedAt.Equal(updatedAt))
+		})
+
+		t.Run("bulk_update", func(t *testing.T) {
+			errUpdate := errors.New("update failed")
+			err := s.NodesUpdate(ctx, []string{nodeID, "missing"}, func(nodes map[string]Node) ([]Node, error) {
+				assert.Len(t, nodes, 1)
+				node := nodes[nodeID]
+				node.Name = "not saved"
+				return []Node{node}, errUpdate
+			})
+			assert.ErrorIs(t, err, errUpdate)
+			err = s.NodesUpdate(ctx, []string{nodeID}, func(nodes map[string]Node) ([]Node, error) {
+				node := nodes[nodeID]
+				assert.Equal(t, "edited test node", node.Name)
+				node.Name = "bulk updated"
+				return []Node{node}, nil
+			})
+			require.NoError(t, err)
+			nodes, err := s.NodesLoad(ctx, []string{nodeID})
+			require.NoError(t, err)
+			assert.Equal(t, "bulk updated", nodes[nodeID].Name)
 		})
 
 		t.Run("remove_all_attrs", func(t *testing.T) {
@@ -177,6 +216,15 @@ func TestStorage(t *testing.T) {
 			edges, err := s.EdgesForNodes(ctx, []string{nodeID1, nodeID2})
 			require.NoError(t, err)
 			assert.Equal(t, 1, len(edges))
+
+			err = s.EdgesRemove(ctx, []Edge{
+				{SrcID: nodeID1, DstID: "non-existed-node", Relation: EdgeRelLink},
+				{SrcID: nodeID2, DstID: nodeID1, Relation: EdgeRelChild},
+			})
+			require.NoError(t, err)
+			edges, err = s.EdgesForNodes(ctx, []string{nodeID1, nodeID2})
+			require.NoError(t, err)
+			assert.Empty(t, edges)
 		})
 	})
 
@@ -250,9 +298,359 @@ func TestStorage(t *testing.T) {
 			require.NoError(t, err)
 			assert.Equal(t, []string{nodeID1, nodeID2}, nodeIDs)
 		})
+
+		t.Run("walk", func(t *testing.T) {
+			nodeID3, err := s.GenerateNodeID(ctx)
+			require.NoError(t, err)
+			require.NoError(t, s.NodeSave(ctx, Node{ID: nodeID3, ContentHash: emptyContentHash}))
+			err = s.EdgesAdd(ctx, []Edge{
+				{SrcID: nodeID3, DstID: nodeID2, Relation: EdgeRelChain},
+				{SrcID: nodeID2, DstID: nodeID1, Relation: EdgeRelChain},
+				{SrcID: nodeID1, DstID: nodeID3, Relation: EdgeRelChain},
+				{SrcID: nodeID3, DstID: nodeID1, Relation: EdgeRelChild},
+			})
+			require.NoError(t, err)
+
+			nodeIDs, err := s.QueryWalk(ctx, nodeID3, EdgeRelChain)
+			require.NoError(t, err)
+			assert.Equal(t, []string{nodeID2, nodeID1}, nodeIDs)
+			nodeIDs, err = s.QueryWalk(ctx, nodeID3, EdgeRelChild)
+			require.NoError(t, err)
+			assert.Equal(t, []string{nodeID1}, nodeIDs)
+
+			require.NoError(t, s.NodesDelete(ctx, []string{nodeID2}))
+			nodeIDs, err = s.QueryWalk(ctx, nodeID3, EdgeRelChain)
+			require.NoError(t, err)
+			assert.Equal(t, []string{nodeID1}, nodeIDs)
+
+			// Lattice of two nodes per level has 2^levels paths, every node is still visited once.
+			var edges []Edge
+			prev := []string{nodeID3}
+			for level := range 40 {
+				cur := []string{fmt.Sprintf("lattice-%d-a", level), fmt.Sprintf("lattice-%d-b", level)}
+				for _, id := range cur {
+					require.NoError(t, s.NodeSave(ctx, Node{ID: id, ContentHash: emptyContentHash}))
+					for _, src := range prev {
+						edges = append(edges, Edge{SrcID: src, DstID: id, Relation: EdgeRelLink})
+					}
+				}
+				prev = cur
+			}
+			require.NoError(t, s.EdgesAdd(ctx, edges))
+			nodeIDs, err = s.QueryWalk(ctx, nodeID3, EdgeRelLink)
+			require.NoError(t, err)
+			assert.Len(t, nodeIDs, 80)
+			assert.Equal(t, []string{"lattice-0-a", "lattice-0-b", "lattice-1-a"}, nodeIDs[:3])
+		})
+
+		t.Run("timeline", func(t *testing.T) {
+			base := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+			for i, id := range []string{"tl-a", "tl-b", "tl-c"} {
+				node := Node{ID: id, ContentHash: emptyContentHash, CreatedAt: base.Add(time.Duration(i%2) * time.Hour)}
+				if id != "tl-b" {
+					node.Attributes = []NodeAttribute{{Key: NodeAttrKind, Value: NodeAttrKindMicro}}
+				}
+				require.NoError(t, s.NodeSave(ctx, node))
+			}
+
+			nodeIDs, err := s.QueryTimeline(ctx, "", TimelineCursor{}, false, 2)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"tl-a", "tl-c"}, nodeIDs)
+			nodeIDs, err = s.QueryTimeline(ctx, "", TimelineCursor{CreatedAt: base, ID: "tl-c"}, false, 2)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"tl-b"}, nodeIDs[:1])
+			nodeIDs, err = s.QueryTimeline(ctx, NodeAttrKindMicro, TimelineCursor{}, true, 10)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"tl-c", "tl-a"}, nodeIDs)
+			nodeIDs, err = s.QueryTimeline(ctx, NodeAttrKindMicro, TimelineCursor{CreatedAt: base, ID: "tl-c"}, true, 10)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"tl-a"}, nodeIDs)
+
+			// Times given in different zones are ordered by instant.
+			for id, createdAt := range map[string]time.Time{
+				"tz-east": time.Date(2001, 2, 3, 10, 0, 0, 0, time.FixedZone("UTC+9", 9*60*60)),
+				"tz-utc":  time.Date(2001, 2, 3, 3, 0, 0, 0, time.UTC),
+				"tz-west": time.Date(2001, 2, 3, 0, 0, 0, 0, time.FixedZone("UTC-5", -5*60*60)),
+			} {
+				attrs := []NodeAttribute{{Key: NodeAttrKind, Value: "tz"}}
+				require.NoError(t, s.NodeSave(ctx, Node{ID: id, ContentHash: emptyContentHash, CreatedAt: createdAt, Attributes: attrs}))
+			}
+			nodeIDs, err = s.QueryTimeline(ctx, "tz", TimelineCursor{}, false, 10)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"tz-east", "tz-utc", "tz-west"}, nodeIDs)
+			cursor := TimelineCursor{CreatedAt: time.Date(2001, 2, 3, 12, 0, 0, 0, time.FixedZone("UTC+9", 9*60*60)), ID: "tz-utc"}
+			nodeIDs, err = s.QueryTimeline(ctx, "tz", cursor, false, 10)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"tz-west"}, nodeIDs)
+			nodeIDs, err = s.QueryTimeline(ctx, "tz", cursor, true, 10)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"tz-east"}, nodeIDs)
+		})
 	})
 }
 
+func TestStorageChangeLog(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewStorage(testLogger(t), t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Open(ctx, false))
+	defer func() { require.NoError(t, s.Close()) }()
+
+	lastSeq, err := s.LastChangeSeq(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), lastSeq)
+
+	contentHash, err := s.NodeContentSave(ctx, bytes.NewReader([]byte(`CHANGE LOG`)))
+	require.NoError(t, err)
+	nodeID1, err := s.GenerateNodeID(ctx)
+	require.NoError(t, err)
+	nodeID2, err := s.GenerateNodeID(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.NodeSave(ctx, Node{ID: nodeID1, Name: "node1", ContentHash: contentHash, ContentMimetype: "text/plain"}))
+	require.NoError(t, s.NodeSave(ctx, Node{ID: nodeID2, Name: "node2", ContentHash: contentHash, ContentMimetype: "text/plain"}))
+	edge := Edge{SrcID: nodeID1, DstID: nodeID2, Relation: EdgeRelLink}
+	require.NoError(t, s.EdgesAdd(ctx, []Edge{edge}))
+	require.NoError(t, s.EdgesRemove(ctx, []Edge{edge}))
+	require.NoError(t, s.NodesDelete(ctx, []string{nodeID2}))
+
+	select {
+	case <-s.ChangeNotify():
+	default:
+		t.Fatal("change not notified")
+	}
+
+	changes, err := s.ChangesAfter(ctx, 0, 100)
+	require.NoError(t, err)
+	ops := make([]string, 0, len(changes))
+	for _, change := range changes {
+		ops = append(ops, change.Entity+"."+change.Op)
+		assert.False(t, change.CreatedAt.IsZero())
+	}
+	assert.Equal(t, []string{"content.upload", "node.save", "node.save", "edge.add", "edge.remove", "node.delete"}, ops)
+	assert.Equal(t, contentHash, changes[0].Data["hash"])
+	assert.Equal(t, nodeID2, changes[3].Data["dst_id"])
+
+	changes, err = s.ChangesAfter(ctx, changes[4].Seq, 100)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, nodeID2, changes[0].NodeID)
+}
+
+func TestStorageChangesSince(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewStorage(testLogger(t), t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Open(ctx, false))
+	defer func() { require.NoError(t, s.Close()) }()
+	require.NoError(t, s.SetDevice(ctx, "laptop"))
+
+	contentHash, err := s.NodeContentSave(ctx, bytes.NewReader([]byte(`CHANGES SINCE`)))
+	require.NoError(t, err)
+	nodeID, err := s.GenerateNodeID(ctx)
+	require.NoError(t, err)
+	node := Node{ID: nodeID, Name: "node", ContentHash: contentHash, ContentMimetype: "text/plain", Attributes: []NodeAttribute{{Key: "tag", Value: "a"}, {Key: "tag", Value: "b"}}}
+	require.NoError(t, s.NodeSave(ctx, node))
+	node.Attributes = []NodeAttribute{{Key: "tag", Value: "b"}}
+	require.NoError(t, s.NodeSave(ctx, node))
+
+	changes, cursor, err := s.ChangesSince(ctx, ChangeCursor{}, 100)
+	require.NoError(t, err)
+	ops := make([]string, 0, len(changes))
+	for _, change := range changes {
+		ops = append(ops, change.Entity+"."+change.Op+":"+change.Data["value"])
+		assert.Equal(t, "laptop", change.Device)
+		assert.Equal(t, change.Seq, change.DeviceSeq)
+	}
+	assert.Equal(t, []string{"content.upload:", "node.save:", "attribute.add:a", "attribute.add:b", "node.save:", "attribute.remove:a"}, ops)
+	assert.Equal(t, ChangeCursor{Seq: changes[5].Seq, Devices: map[string]int64{"laptop": changes[5].DeviceSeq}}, cursor)
+
+	changes, next, err := s.ChangesSince(ctx, cursor, 100)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, cursor, next)
+
+	changes, next, err = s.ChangesSince(ctx, ChangeCursor{Seq: 2, Devices: map[string]int64{"laptop": 2}}, 2)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, int64(3), changes[0].DeviceSeq)
+	assert.Equal(t, ChangeCursor{Seq: 4, Devices: map[string]int64{"laptop": 4}}, next)
+
+	// Records of other device replicated out of order aren't skipped.
+	replicate := func(deviceSeq int64) {
+		_, err := s.writeDB.ExecContext(ctx, `
+			INSERT INTO change_log(entity, op, node_id, data, device, device_seq, created_at)
+				VALUES ('node', 'save', $1, '{}', 'phone', $2, '2024-01-01 00:00:00.000+00:00')`,
+			nodeID, deviceSeq)
+		require.NoError(t, err)
+	}
+	replicate(20)
+	changes, cursor, err = s.ChangesSince(ctx, cursor, 100)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, int64(20), cursor.Devices["phone"])
+	replicate(10)
+	changes, cursor, err = s.ChangesSince(ctx, cursor, 100)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "phone", changes[0].Device)
+	assert.Equal(t, int64(10), changes[0].DeviceSeq)
+	assert.Equal(t, int64(20), cursor.Devices["phone"])
+	changes, _, err = s.ChangesSince(ctx, cursor, 100)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestStorageUpgrade(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	s, err := NewStorage(testLogger(t), dataDir)
+	require.NoError(t, err)
+	require.NoError(t, s.openWrite(ctx))
+	require.NoError(t, s.openRead(ctx))
+	_, err = s.writeDB.ExecContext(ctx, schema)
+	require.NoError(t, err)
+	_, err = s.writeDB.ExecContext(ctx, "INSERT INTO schema_version (version, created_at) VALUES (1, '2024-01-01 00:00:00')")
+	require.NoError(t, err)
+	_, err = s.writeDB.ExecContext(ctx, `
+INSERT INTO node_content (hash, content, created_at) VALUES ('h', X'', '2024-01-01 00:00:00');
+INSERT INTO node (id, name, content_hash, content_mimetype, created_at, updated_at, deleted_at)
+	VALUES ('n1', 'note', 'h', 'text/plain', '2024-01-01 10:00:00.123456789+03:00', '2024-01-01 00:00:00Z', '2024-01-02 00:00:00');
+INSERT INTO node_attribute (node_id, key, value, created_at) VALUES
+	('n1', 'tags', 'a', '2024-01-01 00:00:00'),
+	('n1', 'tags', 'b', '2024-01-01 00:00:00'),
+	('n1', 'tag', 'b', '2024-01-01 00:00:00');
+`)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	s, err = NewStorage(testLogger(t), dataDir)
+	require.NoError(t, err)
+	require.Error(t, s.Open(ctx, false))
+	require.NoError(t, s.Close())
+
+	s, err = NewStorage(testLogger(t), dataDir)
+	require.NoError(t, err)
+	require.NoError(t, s.Open(ctx, true))
+	defer func() { require.NoError(t, s.Close()) }()
+	version, err := s.GetSchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, schemaVersion, version)
+
+	// Migration 8 renames "tags" attributes to "tag".
+	nodes, err := s.NodesLoad(ctx, []string{"n1"})
+	require.NoError(t, err)
+	var attrs []string
+	for _, attr := range nodes["n1"].Attributes {
+		attrs = append(attrs, attr.Key+"="+attr.Value)
+	}
+	assert.ElementsMatch(t, []string{"tag=a", "tag=b"}, attrs)
+
+	// Migration 9 converts node timestamps to UTC without change log records.
+	times := make([]string, 3)
+	err = s.readDB.QueryRowxContext(ctx, `SELECT created_at, updated_at, deleted_at FROM node WHERE id = 'n1'`).
+		Scan(&times[0], &times[1], &times[2])
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"2024-01-01 07:00:00.123456789+00:00", "2024-01-01 00:00:00+00:00", "2024-01-02 00:00:00+00:00",
+	}, times)
+	assert.True(t, nodes["n1"].CreatedAt.Equal(time.Date(2024, 1, 1, 7, 0, 0, 123456789, time.UTC)))
+	var nodeChanges int
+	require.NoError(t, s.readDB.GetContext(ctx, &nodeChanges, `SELECT COUNT(*) FROM change_log WHERE entity = 'node'`))
+	assert.Zero(t, nodeChanges)
+}
+
+func TestStorageAPITokens(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewStorage(testLogger(t), t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Open(ctx, false))
+	defer func() { require.NoError(t, s.Close()) }()
+
+	require.NoError(t, s.UserSave(ctx, User{Name: "alice", PasswordHash: "x"}))
+	require.NoError(t, s.UserSave(ctx, User{Name: "bob", PasswordHash: "x"}))
+	now := time.Now()
+	require.NoError(t, s.APITokenSave(ctx, APIToken{ID: "t1", TokenHash: "h1", UserName: "alice", Scopes: []string{"read", "rpc:NodeSave"}, CreatedAt: now}))
+	require.NoError(t, s.APITokenSave(ctx, APIToken{ID: "t2", TokenHash: "h2", UserName: "bob", Scopes: []string{"*"}, CreatedAt: now}))
+
+	token, err := s.APITokenLoadByHash(ctx, "h1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read", "rpc:NodeSave"}, token.Scopes)
+
+	tokens, err := s.APITokensList(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, tokens, 2)
+	tokens, err = s.APITokensList(ctx, "bob")
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "t2", tokens[0].ID)
+
+	require.NoError(t, s.APITokenDelete(ctx, "t1"))
+	assert.ErrorIs(t, s.APITokenDelete(ctx, "t1"), ErrNoRecord)
+	_, err = s.APITokenLoadByHash(ctx, "h1")
+	assert.ErrorIs(t, err, ErrNoRecord)
+}
+
+func TestStorageStats(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewStorage(testLogger(t), t.TempDir())
+	require.NoError(t, err)
+	var mu sync.Mutex
+	observed := make(map[string]int)
+	s.SetQueryObserver(func(db, op string, d time.Duration) {
+		mu.Lock()
+		observed[db+" "+op]++
+		mu.Unlock()
+	})
+	require.NoError(t, s.Open(ctx, false))
+	defer func() { require.NoError(t, s.Close()) }()
+
+	contentHash, err := s.NodeContentSave(ctx, bytes.NewReader([]byte(`STATS`)))
+	require.NoError(t, err)
+	nodeID, err := s.GenerateNodeID(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.NodeSave(ctx, Node{ID: nodeID, Name: "node", ContentHash: contentHash, ContentMimetype: "text/plain"}))
+
+	stats, err := s.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Nodes)
+	assert.Equal(t, int64(0), stats.DeletedNodes)
+	assert.Equal(t, int64(1), stats.Blobs)
+	assert.Equal(t, int64(5), stats.ContentBytes)
+	assert.Greater(t, stats.PageCount, int64(0))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, observed["read select"], 0)
+	assert.Greater(t, observed["write insert"], 0)
+}
+
+func TestStorageBackup(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewStorage(testLogger(t), t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Open(ctx, false))
+	defer func() { require.NoError(t, s.Close()) }()
+
+	contentHash, err := s.NodeContentSave(ctx, bytes.NewReader([]byte(`BACKUP`)))
+	require.NoError(t, err)
+	nodeID, err := s.GenerateNodeID(ctx)
+	require.NoError(t, err)
+	require.NoError(t, s.NodeSave(ctx, Node{ID: nodeID, Name: "node", ContentHash: contentHash, ContentMimetype: "text/plain"}))
+
+	backupDir := t.TempDir()
+	require.NoError(t, s.Backup(ctx, backupDir+"/data.db"))
+	// Existing backup is replaced.
+	require.NoError(t, s.Backup(ctx, backupDir+"/data.db"))
+
+	b, err := NewStorage(testLogger(t), backupDir)
+	require.NoError(t, err)
+	require.NoError(t, b.Open(ctx, false))
+	defer func() { require.NoError(t, b.Close()) }()
+	nodes, err := b.NodesLoad(ctx, []string{nodeID})
+	require.NoError(t, err)
+	assert.Equal(t, "node", nodes[nodeID].Name)
+}
+
 func TestXXX(t *testing.T) {
-	assert.True(t, isTextMimetype("text/plain"))
+	assert.True(t, IsTextMimetype("text/plain"))
 }
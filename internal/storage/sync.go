@@ -0,0 +1,501 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// syncMinPeerSchemaVersion is the first schema version with origin devices in change log.
+const syncMinPeerSchemaVersion = 6
+
+// Conflict resolutions, the latest updated version of node wins.
+const (
+	SyncResolutionLocal = "local"
+	SyncResolutionPeer  = "peer"
+)
+
+// SyncPeer is merge state of other device's database.
+type SyncPeer struct {
+	Device string
+	// Cursor is the latest node update time (by peer clock) already merged.
+	Cursor time.Time
+	// ChangeSeq is the latest sequence number of peer change log already merged.
+	ChangeSeq int64
+	// LocalSeq is sequence number of local change log at last merge, later records are local changes unknown to peer.
+	LocalSeq int64
+	// FileModTime is modification time of peer file at last merge.
+	FileModTime time.Time
+	MergedAt    time.Time
+}
+
+type syncPeerRow struct {
+	Device      string    `db:"device"`
+	Cursor      Timestamp `db:"cursor"`
+	ChangeSeq   int64     `db:"change_seq"`
+	LocalSeq    int64     `db:"local_seq"`
+	FileModTime Timestamp `db:"file_mod_time"`
+	MergedAt    Timestamp `db:"merged_at"`
+}
+
+// SyncConflict is recorded when node was changed on both devices since last merge.
+// LocalData and PeerData hold both versions, Resolution tells which one was kept.
+type SyncConflict struct {
+	ID         int64
+	NodeID     string
+	Device     string
+	Resolution string
+	LocalData  SyncNodeData
+	PeerData   SyncNodeData
+	CreatedAt  time.Time
+}
+
+type SyncNodeData struct {
+	Name            string    `json:"name"`
+	ContentHash     string    `json:"content_hash"`
+	ContentMimetype string    `json:"content_mimetype"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	DeletedAt       time.Time `json:"deleted_at,omitempty"`
+	// Attributes are sorted by key and value.
+	Attributes []SyncAttribute `json:"attributes,omitempty"`
+}
+
+type SyncAttribute struct {
+	Key   string `json:"key" db:"key"`
+	Value string `json:"value" db:"value"`
+}
+
+type syncConflictRow struct {
+	ID         int64     `db:"id"`
+	NodeID     string    `db:"node_id"`
+	Device     string    `db:"device"`
+	Resolution string    `db:"resolution"`
+	LocalData  string    `db:"local_data"`
+	PeerData   string    `db:"peer_data"`
+	CreatedAt  Timestamp `db:"created_at"`
+}
+
+// MergeResult counts records merged from peer.
+type MergeResult struct {
+	Nodes     int
+	Edges     int
+	Blobs     int
+	Conflicts int
+}
+
+func (s *Storage) SyncPeerLoad(ctx context.Context, device string) (SyncPeer, error) {
+	var row syncPeerRow
+	err := s.readDB.GetContext(ctx, &row, `
+		SELECT device, cursor, change_seq, local_seq, file_mod_time, merged_at FROM sync_peer WHERE device = $1`,
+		device)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SyncPeer{Device: device}, nil
+	}
+	if err != nil {
+		return SyncPeer{}, fmt.Errorf("select sync peer: %w", err)
+	}
+	return SyncPeer{
+		Device:      row.Device,
+		Cursor:      row.Cursor.Time,
+		ChangeSeq:   row.ChangeSeq,
+		LocalSeq:    row.LocalSeq,
+		FileModTime: row.FileModTime.Time,
+		MergedAt:    row.MergedAt.Time,
+	}, nil
+}
+
+func (s *Storage) SyncConflictsList(ctx context.Context, limit int) ([]SyncConflict, error) {
+	var rows []syncConflictRow
+	err := s.readDB.SelectContext(ctx, &rows, `
+		SELECT id, node_id, device, resolution, local_data, peer_data, created_at
+		FROM sync_conflict ORDER BY id DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select sync conflicts: %w", err)
+	}
+	conflicts := make([]SyncConflict, 0, len(rows))
+	for _, row := range rows {
+		c := SyncConflict{
+			ID:         row.ID,
+			NodeID:     row.NodeID,
+			Device:     row.Device,
+			Resolution: row.Resolution,
+			CreatedAt:  row.CreatedAt.Time,
+		}
+		if err := json.Unmarshal([]byte(row.LocalData), &c.LocalData); err != nil {
+			return nil, fmt.Errorf("unmarshal conflict %d local data: %w", row.ID, err)
+		}
+		if err := json.Unmarshal([]byte(row.PeerData), &c.PeerData); err != nil {
+			return nil, fmt.Errorf("unmarshal conflict %d peer data: %w", row.ID, err)
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, nil
+}
+
+// MergeFrom merges nodes, attributes, edges and content from other device's database file. Nodes updated
+// on peer since the previous merge replace local ones with all their attributes, unless local node is newer.
+// Node changed on both devices since the previous merge is a conflict: the latest version wins and both are
+// recorded. Edge additions and removals are replayed from peer change log. File must not be modified
+// during merge, callers should pass a copy of synced file.
+func (s *Storage) MergeFrom(ctx context.Context, device, path string, fileModTime time.Time) (MergeResult, error) {
+	var result MergeResult
+	peer, err := s.SyncPeerLoad(ctx, device)
+	if err != nil {
+		return result, err
+	}
+
+	conn, err := s.writeDB.Connx(ctx)
+	if err != nil {
+		return result, fmt.Errorf("get conn: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `ATTACH DATABASE $1 AS peer`, path); err != nil {
+		return result, fmt.Errorf("attach %q: %w", path, err)
+	}
+	defer func() {
+		// Use separate context, connection must be detached even if ctx is canceled.
+		if _, err := conn.ExecContext(context.Background(), `DETACH DATABASE peer`); err != nil {
+			s.logger.ErrorContext(ctx, "detach peer database", "error", err)
+		}
+	}()
+
+	var peerVersion int
+	if err := conn.GetContext(ctx, &peerVersion, `SELECT MAX(version) FROM peer.schema_version`); err != nil {
+		return result, fmt.Errorf("get peer schema version: %w", err)
+	}
+	if peerVersion > schemaVersion {
+		return result, fmt.Errorf("peer schema version %d is newer than %d, upgrade required", peerVersion, schemaVersion)
+	}
+	if peerVersion < syncMinPeerSchemaVersion {
+		return result, fmt.Errorf("peer schema version %d is older than %d, upgrade peer", peerVersion, syncMinPeerSchemaVersion)
+	}
+
+	tx, err := conn.BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return result, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var peerNodes []nodeRow
+	err = tx.SelectContext(ctx, &peerNodes, `
+		SELECT id, name, content_hash, content_mimetype, created_at, updated_at, deleted_at FROM peer.node`)
+	if err != nil {
+		return result, fmt.Errorf("select peer nodes: %w", err)
+	}
+	var seqBefore int64
+	if err := tx.GetContext(ctx, &seqBefore, `SELECT COALESCE(MAX(seq), 0) FROM main.change_log`); err != nil {
+		return result, fmt.Errorf("get last change seq: %w", err)
+	}
+	cursor := peer.Cursor
+	now := time.Now()
+	var mergedIDs []string
+	for _, peerNode := range peerNodes {
+		if peerNode.UpdatedAt.After(cursor) {
+			cursor = peerNode.UpdatedAt.Time
+		}
+		if !peerNode.UpdatedAt.After(peer.Cursor) {
+			continue
+		}
+		applied, err := s.mergeNode(ctx, tx, device, peer, peerNode, now, &result)
+		if err != nil {
+			return result, fmt.Errorf("merge node %q: %w", peerNode.ID, err)
+		}
+		if applied {
+			mergedIDs = append(mergedIDs, peerNode.ID)
+		}
+	}
+	if err := replicateNodeChanges(ctx, tx, device, seqBefore, mergedIDs); err != nil {
+		return result, err
+	}
+
+	changeSeq, err := mergeEdges(ctx, tx, device, peer, seqBefore, &result)
+	if err != nil {
+		return result, err
+	}
+
+	var localSeq int64
+	if err := tx.GetContext(ctx, &localSeq, `SELECT COALESCE(MAX(seq), 0) FROM main.change_log`); err != nil {
+		return result, fmt.Errorf("get last change seq: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sync_peer(device, cursor, change_seq, local_seq, file_mod_time, merged_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT(device) DO UPDATE
+				SET cursor=excluded.cursor,
+					change_seq=excluded.change_seq,
+					local_seq=excluded.local_seq,
+					file_mod_time=excluded.file_mod_time,
+					merged_at=excluded.merged_at`,
+		device, Timestamp{cursor}, changeSeq, localSeq, Timestamp{fileModTime}, Timestamp{now})
+	if err != nil {
+		return result, fmt.Errorf("save sync peer: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("commit: %w", err)
+	}
+	if result.Nodes > 0 || result.Edges > 0 || result.Blobs > 0 {
+		s.notifyChanged()
+	}
+	return result, nil
+}
+
+// mergeNode applies peer node with its content and attributes unless local node is newer, reports whether node was
+// applied.
+func (s *Storage) mergeNode(ctx context.Context, tx *sqlx.Tx, device string, peer SyncPeer, peerNode nodeRow, now time.Time, result *MergeResult) (bool, error) {
+	var local nodeRow
+	err := tx.GetContext(ctx, &local, `
+		SELECT id, name, content_hash, content_mimetype, created_at, updated_at, deleted_at FROM main.node WHERE id = $1`,
+		peerNode.ID)
+	exists := true
+	if errors.Is(err, sql.ErrNoRows) {
+		exists = false
+	} else if err != nil {
+		return false, fmt.Errorf("select local node: %w", err)
+	}
+
+	// Local changes are found in change log rather than by time, peer timestamps are set by peer clock.
+	changedLocally := false
+	if exists {
+		err := tx.GetContext(ctx, &changedLocally, `
+			SELECT EXISTS (
+				SELECT 1 FROM main.change_log
+					WHERE node_id = $1 AND entity IN ('node', 'attribute') AND seq > $2 AND device != $3)`,
+			peerNode.ID, peer.LocalSeq, device)
+		if err != nil {
+			return false, fmt.Errorf("select local changes: %w", err)
+		}
+	}
+	// Attributes are part of node data, e.g. change of tags alone has to be merged.
+	var localAttrs, peerAttrs []SyncAttribute
+	if exists {
+		if err := tx.SelectContext(ctx, &localAttrs, `
+			SELECT key, value FROM main.node_attribute WHERE node_id = $1 ORDER BY key, value`, peerNode.ID); err != nil {
+			return false, fmt.Errorf("select local attrs: %w", err)
+		}
+	}
+	if err := tx.SelectContext(ctx, &peerAttrs, `
+		SELECT key, value FROM peer.node_attribute WHERE node_id = $1 ORDER BY key, value`, peerNode.ID); err != nil {
+		return false, fmt.Errorf("select peer attrs: %w", err)
+	}
+	same := exists && sameNodeData(local, peerNode) && slices.Equal(localAttrs, peerAttrs)
+
+	applyPeer := !exists || peerNode.UpdatedAt.After(local.UpdatedAt.Time)
+	conflict := exists && !same && changedLocally
+	if conflict {
+		resolution := SyncResolutionLocal
+		if applyPeer {
+			resolution = SyncResolutionPeer
+		}
+		localData, _ := json.Marshal(syncNodeData(local, localAttrs))
+		peerData, _ := json.Marshal(syncNodeData(peerNode, peerAttrs))
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO sync_conflict(node_id, device, resolution, local_data, peer_data, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+			peerNode.ID, device, resolution, string(localData), string(peerData), Timestamp{now})
+		if err != nil {
+			return false, fmt.Errorf("insert conflict: %w", err)
+		}
+		result.Conflicts++
+	}
+	if !applyPeer || same {
+		return false, nil
+	}
+
+	// Content is copied before node, so full text search index triggers can read it.
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO main.node_content(hash, content, created_at)
+			SELECT hash, content, created_at FROM peer.node_content WHERE hash = $1
+			ON CONFLICT DO NOTHING`,
+		peerNode.ContentHash)
+	if err != nil {
+		return false, fmt.Errorf("copy content: %w", err)
+	}
+	blobs, _ := res.RowsAffected()
+	result.Blobs += int(blobs)
+	_, err = tx.NamedExecContext(ctx, `
+		INSERT INTO main.node(id, name, content_hash, content_mimetype, created_at, updated_at, deleted_at)
+			VALUES (:id, :name, :content_hash, :content_mimetype, :created_at, :updated_at, :deleted_at)
+			ON CONFLICT(id) DO UPDATE
+				SET name=excluded.name,
+					content_hash=excluded.content_hash,
+					content_mimetype=excluded.content_mimetype,
+					updated_at=excluded.updated_at,
+					deleted_at=excluded.deleted_at`,
+		&peerNode)
+	if err != nil {
+		return false, fmt.Errorf("upsert node: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM main.node_attribute WHERE node_id = $1`, peerNode.ID); err != nil {
+		return false, fmt.Errorf("delete attrs: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO main.node_attribute(node_id, key, value, created_at)
+			SELECT node_id, key, value, created_at FROM peer.node_attribute WHERE node_id = $1`,
+		peerNode.ID)
+	if err != nil {
+		return false, fmt.Errorf("copy attrs: %w", err)
+	}
+	result.Nodes++
+	return true, nil
+}
+
+type peerEdgeChange struct {
+	Op        string    `db:"op"`
+	Data      string    `db:"data"`
+	Device    string    `db:"device"`
+	DeviceSeq int64     `db:"device_seq"`
+	CreatedAt Timestamp `db:"created_at"`
+
+	SrcID string `db:"-"`
+}
+
+// mergeEdges replays edge additions and removals recorded in peer change log since the previous merge, changes
+// already known locally (e.g. made on this device and merged by peer) are skipped. On the first merge edges made
+// before peer had change log are copied. Returns the latest merged sequence number of peer change log.
+func mergeEdges(ctx context.Context, tx *sqlx.Tx, device string, peer SyncPeer, seqBefore int64, result *MergeResult) (int64, error) {
+	var changeSeq int64
+	if err := tx.GetContext(ctx, &changeSeq, `SELECT COALESCE(MAX(seq), 0) FROM peer.change_log`); err != nil {
+		return 0, fmt.Errorf("get peer last change seq: %w", err)
+	}
+	if peer.ChangeSeq == 0 {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO main.edge(src_id, dst_id, relation, created_at)
+				SELECT e.src_id, e.dst_id, e.relation, e.created_at FROM peer.edge AS e
+				WHERE EXISTS (SELECT 1 FROM main.node WHERE id = e.src_id)
+					AND EXISTS (SELECT 1 FROM main.node WHERE id = e.dst_id)
+					AND NOT EXISTS (
+						SELECT 1 FROM peer.change_log AS c
+							WHERE c.entity = 'edge' AND c.node_id = e.src_id
+								AND json_extract(c.data, '$.dst_id') = e.dst_id
+								AND json_extract(c.data, '$.relation') = e.relation)
+				ON CONFLICT DO NOTHING`)
+		if err != nil {
+			return 0, fmt.Errorf("copy edges: %w", err)
+		}
+		edges, _ := res.RowsAffected()
+		result.Edges += int(edges)
+	}
+
+	var changes []peerEdgeChange
+	err := tx.SelectContext(ctx, &changes, `
+		SELECT p.op, p.data, IIF(p.device = '', $1, p.device) AS device, p.device_seq, p.created_at
+			FROM peer.change_log AS p
+			WHERE p.entity = 'edge' AND p.seq > $2
+				AND NOT EXISTS (
+					SELECT 1 FROM main.change_log AS l
+						WHERE l.device = IIF(p.device = '', $1, p.device) AND l.device_seq = p.device_seq)
+			ORDER BY p.seq`,
+		device, peer.ChangeSeq)
+	if err != nil {
+		return 0, fmt.Errorf("select peer edge changes: %w", err)
+	}
+	var applied []peerEdgeChange
+	for _, change := range changes {
+		var edge struct {
+			SrcID    string `json:"src_id"`
+			DstID    string `json:"dst_id"`
+			Relation string `json:"relation"`
+		}
+		if err := json.Unmarshal([]byte(change.Data), &edge); err != nil {
+			return 0, fmt.Errorf("unmarshal peer edge change: %w", err)
+		}
+		change.SrcID = edge.SrcID
+		var res sql.Result
+		switch change.Op {
+		case ChangeOpAdd:
+			res, err = tx.ExecContext(ctx, `
+				INSERT INTO main.edge(src_id, dst_id, relation, created_at)
+					SELECT $1, $2, $3, $4
+					WHERE EXISTS (SELECT 1 FROM main.node WHERE id = $1)
+						AND EXISTS (SELECT 1 FROM main.node WHERE id = $2)
+					ON CONFLICT DO NOTHING`,
+				edge.SrcID, edge.DstID, edge.Relation, change.CreatedAt)
+		case ChangeOpRemove:
+			res, err = tx.ExecContext(ctx, `
+				DELETE FROM main.edge WHERE src_id = $1 AND dst_id = $2 AND relation = $3`,
+				edge.SrcID, edge.DstID, edge.Relation)
+		default:
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s edge: %w", change.Op, err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.Edges++
+			applied = append(applied, change)
+		}
+	}
+
+	// Replace records made by triggers with peer ones, see replicateNodeChanges.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM main.change_log WHERE seq > $1 AND entity = 'edge'`, seqBefore); err != nil {
+		return 0, fmt.Errorf("delete merge changes: %w", err)
+	}
+	for _, change := range applied {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO main.change_log(entity, op, node_id, data, device, device_seq, created_at)
+				VALUES ('edge', $1, $2, $3, $4, $5, $6)`,
+			change.Op, change.SrcID, change.Data, change.Device, change.DeviceSeq, change.CreatedAt)
+		if err != nil {
+			return 0, fmt.Errorf("insert peer edge change: %w", err)
+		}
+	}
+	return changeSeq, nil
+}
+
+// replicateNodeChanges replaces change log records made by merge of nodes with peer records of their changes, so
+// replicated changes keep origin device and its sequence number. Records without origin device are made on peer
+// before its device name was set.
+func replicateNodeChanges(ctx context.Context, tx *sqlx.Tx, device string, seqBefore int64, nodeIDs []string) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM main.change_log WHERE seq > $1 AND entity IN ('node', 'attribute')`,
+		seqBefore)
+	if err != nil {
+		return fmt.Errorf("delete merge changes: %w", err)
+	}
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	idsJSON, err := json.Marshal(nodeIDs)
+	if err != nil {
+		return fmt.Errorf("marshal node ids: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO main.change_log(entity, op, node_id, data, device, device_seq, created_at)
+			SELECT p.entity, p.op, p.node_id, p.data, IIF(p.device = '', $1, p.device), p.device_seq, p.created_at
+				FROM peer.change_log AS p
+				WHERE p.entity IN ('node', 'attribute')
+					AND p.node_id IN (SELECT value FROM json_each($2))
+					AND NOT EXISTS (
+						SELECT 1 FROM main.change_log AS l
+							WHERE l.device = IIF(p.device = '', $1, p.device) AND l.device_seq = p.device_seq)
+				ORDER BY p.seq`,
+		device, string(idsJSON))
+	if err != nil {
+		return fmt.Errorf("copy peer changes: %w", err)
+	}
+	return nil
+}
+
+func sameNodeData(a, b nodeRow) bool {
+	return a.Name == b.Name &&
+		a.ContentHash == b.ContentHash &&
+		a.ContentMimetype == b.ContentMimetype &&
+		a.DeletedAt.IsZero() == b.DeletedAt.IsZero()
+}
+
+func syncNodeData(row nodeRow, attrs []SyncAttribute) SyncNodeData {
+	return SyncNodeData{
+		Name:            row.Name,
+		ContentHash:     row.ContentHash,
+		ContentMimetype: row.ContentMimetype,
+		UpdatedAt:       row.UpdatedAt.Time,
+		DeletedAt:       row.DeletedAt.Time,
+		Attributes:      attrs,
+	}
+}
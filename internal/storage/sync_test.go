@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageMergeFrom(t *testing.T) {
+	ctx := context.Background()
+	open := func() *Storage {
+		s, err := NewStorage(testLogger(t), t.TempDir())
+		require.NoError(t, err)
+		require.NoError(t, s.Open(ctx, false))
+		t.Cleanup(func() { require.NoError(t, s.Close()) })
+		return s
+	}
+	saveNode := func(s *Storage, id, name, content string) {
+		hash, err := s.NodeContentSave(ctx, bytes.NewReader([]byte(content)))
+		require.NoError(t, err)
+		require.NoError(t, s.NodeSave(ctx, Node{
+			ID:              id,
+			Name:            name,
+			ContentHash:     hash,
+			ContentMimetype: "text/plain",
+			Attributes:      []NodeAttribute{{Key: "tag", Value: name}},
+		}))
+	}
+	exportDir := t.TempDir()
+	export := func(s *Storage, device string) string {
+		path := filepath.Join(exportDir, device+".db")
+		require.NoError(t, s.Backup(ctx, path))
+		return path
+	}
+
+	a, b := open(), open()
+	require.NoError(t, a.SetDevice(ctx, "a"))
+	require.NoError(t, b.SetDevice(ctx, "b"))
+	saveNode(a, "n1", "first", "unique merged content")
+	saveNode(a, "n2", "second", "second content")
+	require.NoError(t, a.EdgesAdd(ctx, []Edge{{SrcID: "n2", DstID: "n1", Relation: EdgeRelChild}}))
+
+	result, err := b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Nodes: 2, Edges: 1, Blobs: 2}, result)
+	nodes, err := b.NodesLoad(ctx, []string{"n1", "n2"})
+	require.NoError(t, err)
+	assert.Equal(t, "first", nodes["n1"].Name)
+	assert.Equal(t, []string{"first"}, attrValues(nodes["n1"]))
+	ids, err := b.QueryFullTextSearch(ctx, "merged", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"n1"}, ids)
+	edges, err := b.EdgesForNodes(ctx, []string{"n1"})
+	require.NoError(t, err)
+	assert.Len(t, edges, 1)
+
+	// Merged changes keep origin device and its sequence numbers.
+	nodeChanges := func(s *Storage, nodeID string) []Change {
+		changes, _, err := s.ChangesSince(ctx, ChangeCursor{}, 100)
+		require.NoError(t, err)
+		var found []Change
+		for _, change := range changes {
+			if change.NodeID == nodeID && change.Entity != ChangeEntityEdge {
+				change.Seq = 0
+				found = append(found, change)
+			}
+		}
+		return found
+	}
+	assert.Equal(t, nodeChanges(a, "n1"), nodeChanges(b, "n1"))
+	assert.Equal(t, "a", nodeChanges(b, "n1")[0].Device)
+
+	// Nothing new, merge is idempotent.
+	result, err = b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{}, result)
+
+	// Concurrent changes: b's change is newer and wins, conflict is recorded.
+	time.Sleep(10 * time.Millisecond)
+	saveNode(a, "n1", "first (a)", "content a")
+	time.Sleep(10 * time.Millisecond)
+	saveNode(b, "n1", "first (b)", "content b")
+	require.NoError(t, a.NodesDelete(ctx, []string{"n2"}))
+
+	result, err = b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, MergeResult{Nodes: 1, Conflicts: 1}, result)
+	nodes, err = b.NodesLoad(ctx, []string{"n1", "n2"})
+	require.NoError(t, err)
+	assert.Equal(t, "first (b)", nodes["n1"].Name)
+	n2 := nodes["n2"]
+	assert.True(t, n2.IsDeleted())
+
+	conflicts, err := b.SyncConflictsList(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "n1", conflicts[0].NodeID)
+	assert.Equal(t, "a", conflicts[0].Device)
+	assert.Equal(t, SyncResolutionLocal, conflicts[0].Resolution)
+	assert.Equal(t, "first (b)", conflicts[0].LocalData.Name)
+	assert.Equal(t, "first (a)", conflicts[0].PeerData.Name)
+
+	t.Run("edges", func(t *testing.T) {
+		a, b := open(), open()
+		require.NoError(t, a.SetDevice(ctx, "a"))
+		require.NoError(t, b.SetDevice(ctx, "b"))
+		for _, id := range []string{"e1", "e2", "e3"} {
+			saveNode(a, id, id, id)
+		}
+		e12 := Edge{SrcID: "e1", DstID: "e2", Relation: EdgeRelLink}
+		e13 := Edge{SrcID: "e1", DstID: "e3", Relation: EdgeRelLink}
+		require.NoError(t, a.EdgesAdd(ctx, []Edge{e12, e13}))
+		result, err := b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Edges)
+
+		edgeCount := func(s *Storage) int {
+			edges, err := s.EdgesForNodes(ctx, []string{"e1"})
+			require.NoError(t, err)
+			return len(edges)
+		}
+		// Removal on peer is propagated.
+		require.NoError(t, a.EdgesRemove(ctx, []Edge{e12}))
+		result, err = b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, MergeResult{Edges: 1}, result)
+		assert.Equal(t, 1, edgeCount(b))
+
+		// Local removal isn't undone by the next merge, and peer merging it back doesn't re-add edges.
+		require.NoError(t, b.EdgesRemove(ctx, []Edge{e13}))
+		result, err = b.MergeFrom(ctx, "a", export(a, "a"), time.Now().Add(time.Second))
+		require.NoError(t, err)
+		assert.Equal(t, MergeResult{}, result)
+		assert.Equal(t, 0, edgeCount(b))
+		_, err = a.MergeFrom(ctx, "b", export(b, "b"), time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 0, edgeCount(a))
+	})
+
+	t.Run("attributes", func(t *testing.T) {
+		a, b := open(), open()
+		require.NoError(t, a.SetDevice(ctx, "a"))
+		require.NoError(t, b.SetDevice(ctx, "b"))
+		saveNode(a, "t1", "tagged", "tagged")
+		_, err := b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+		require.NoError(t, err)
+		setTags := func(s *Storage, tags ...string) {
+			nodes, err := s.NodesLoad(ctx, []string{"t1"})
+			require.NoError(t, err)
+			node := nodes["t1"]
+			node.Attributes = nil
+			for _, tag := range tags {
+				node.Attributes = append(node.Attributes, NodeAttribute{Key: "tag", Value: tag})
+			}
+			require.NoError(t, s.NodeSave(ctx, node))
+		}
+		tags := func(s *Storage) []string {
+			nodes, err := s.NodesLoad(ctx, []string{"t1"})
+			require.NoError(t, err)
+			values := attrValues(nodes["t1"])
+			sort.Strings(values)
+			return values
+		}
+
+		// Change of tags alone is merged.
+		time.Sleep(10 * time.Millisecond)
+		setTags(a, "tagged", "added")
+		result, err := b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, MergeResult{Nodes: 1}, result)
+		assert.Equal(t, []string{"added", "tagged"}, tags(b))
+
+		// Concurrent changes of tags are conflict.
+		time.Sleep(10 * time.Millisecond)
+		setTags(a, "from-a")
+		time.Sleep(10 * time.Millisecond)
+		setTags(b, "from-b")
+		result, err = b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, MergeResult{Conflicts: 1}, result)
+		assert.Equal(t, []string{"from-b"}, tags(b))
+		conflicts, err := b.SyncConflictsList(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, conflicts, 1)
+		assert.Equal(t, []SyncAttribute{{Key: "tag", Value: "from-a"}}, conflicts[0].PeerData.Attributes)
+		assert.Equal(t, []SyncAttribute{{Key: "tag", Value: "from-b"}}, conflicts[0].LocalData.Attributes)
+	})
+
+	t.Run("peer_clock", func(t *testing.T) {
+		a, b := open(), open()
+		require.NoError(t, a.SetDevice(ctx, "a"))
+		require.NoError(t, b.SetDevice(ctx, "b"))
+		// Peer clock is ahead, merged node on b has timestamp later than b's merge time.
+		hash, err := a.NodeContentSave(ctx, bytes.NewReader([]byte("clock")))
+		require.NoError(t, err)
+		node := Node{ID: "c1", Name: "v1", ContentHash: hash, ContentMimetype: "text/plain", UpdatedAt: time.Now().Add(time.Hour)}
+		require.NoError(t, a.NodeImport(ctx, node))
+		_, err = b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+		require.NoError(t, err)
+
+		// Change made only on peer isn't a conflict.
+		node.Name, node.UpdatedAt = "v2", time.Now().Add(2*time.Hour)
+		require.NoError(t, a.NodeImport(ctx, node))
+		result, err := b.MergeFrom(ctx, "a", export(a, "a"), time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, MergeResult{Nodes: 1}, result)
+	})
+}
+
+func attrValues(n Node) []string {
+	values := make([]string, 0, len(n.Attributes))
+	for _, attr := range n.Attributes {
+		values = append(values, attr.Value)
+	}
+	return values
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/mattn/go-sqlite3"
 )
 
+// Timestamp is time stored as text in UTC, so stored values are ordered as text.
 type Timestamp struct {
 	time.Time
 }
@@ -17,7 +18,7 @@ func (t Timestamp) Value() (driver.Value, error) {
 	if t.Time.IsZero() {
 		return nil, nil
 	}
-	return t.Time.Format(sqlite3.SQLiteTimestampFormats[0]), nil
+	return t.Time.UTC().Format(sqlite3.SQLiteTimestampFormats[0]), nil
 }
 
 func (t *Timestamp) Scan(value interface{}) error {
@@ -5,15 +5,18 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/brainmorsel/libreta/internal/app"
 )
 
+//go:generate go run -tags sqlite_json,sqlite_fts5 . gen-ts ui/src/lib/api.ts
+
 func main() {
 	ctx := context.Background()
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer cancel()
-	if err := app.Run(ctx, os.Stdout, os.Stderr, os.Args, os.Getenv); err != nil {
+	if err := app.Run(ctx, os.Stdin, os.Stdout, os.Stderr, os.Args, os.Getenv); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
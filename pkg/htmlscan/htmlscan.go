@@ -0,0 +1,189 @@
+// Package htmlscan finds tags and their attributes in HTML without building a document tree. It is enough to
+// extract page metadata and to rewrite URLs in attributes by byte offsets, keeping the rest of the page intact.
+package htmlscan
+
+import (
+	"bytes"
+	"html"
+	"strings"
+)
+
+// Tag is start or end tag found in source.
+type Tag struct {
+	// Name is lower case tag name.
+	Name    string
+	Closing bool
+	Attrs   []Attr
+	// Start and End are offsets of the tag in source, End is offset after ">".
+	Start int
+	End   int
+}
+
+// Attr is tag attribute.
+type Attr struct {
+	// Name is lower case attribute name.
+	Name string
+	// Value is unescaped attribute value.
+	Value string
+	// Start and End are offsets of the whole attribute in source.
+	Start int
+	End   int
+	// ValueStart and ValueEnd are offsets of raw value in source without quotes, both are -1 for attribute
+	// without value.
+	ValueStart int
+	ValueEnd   int
+}
+
+// Attr returns value of attribute by lower case name.
+func (t *Tag) Attr(name string) (string, bool) {
+	for _, attr := range t.Attrs {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// rawTextTags contain text which isn't parsed for tags.
+var rawTextTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"textarea": true,
+	"title":    true,
+}
+
+// Tags returns tags of src in order. Comments, doctype and processing instructions are skipped, content of raw
+// text elements (script, style, textarea, title) isn't scanned for tags.
+func Tags(src []byte) []Tag {
+	var tags []Tag
+	for i := 0; i < len(src); {
+		lt := bytes.IndexByte(src[i:], '<')
+		if lt < 0 {
+			break
+		}
+		i += lt
+		rest := src[i:]
+		switch {
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			end := bytes.Index(rest[4:], []byte("-->"))
+			if end < 0 {
+				return tags
+			}
+			i += 4 + end + 3
+			continue
+		case len(rest) > 1 && (rest[1] == '!' || rest[1] == '?'):
+			end := bytes.IndexByte(rest, '>')
+			if end < 0 {
+				return tags
+			}
+			i += end + 1
+			continue
+		}
+		tag, ok := parseTag(src, i)
+		if !ok {
+			i++
+			continue
+		}
+		tags = append(tags, tag)
+		i = tag.End
+		if !tag.Closing && rawTextTags[tag.Name] {
+			end := indexFold(src[i:], "</"+tag.Name)
+			if end < 0 {
+				break
+			}
+			i += end
+		}
+	}
+	return tags
+}
+
+// Text returns unescaped text between end of start tag and the next tag, e.g. content of <title>.
+func Text(src []byte, tags []Tag, i int) string {
+	end := len(src)
+	if i+1 < len(tags) {
+		end = tags[i+1].Start
+	}
+	return html.UnescapeString(string(src[tags[i].End:end]))
+}
+
+func indexFold(s []byte, substr string) int {
+	n := len(substr)
+	for i := 0; i+n <= len(s); i++ {
+		if bytes.EqualFold(s[i:i+n], []byte(substr)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isNameByte(c byte) bool {
+	return c == '-' || c == ':' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseTag parses tag starting with "<" at offset start.
+func parseTag(src []byte, start int) (Tag, bool) {
+	tag := Tag{Start: start}
+	i := start + 1
+	if i < len(src) && src[i] == '/' {
+		tag.Closing = true
+		i++
+	}
+	nameStart := i
+	for i < len(src) && isNameByte(src[i]) {
+		i++
+	}
+	if i == nameStart || !(src[nameStart] >= 'a' && src[nameStart] <= 'z' || src[nameStart] >= 'A' && src[nameStart] <= 'Z') {
+		return Tag{}, false
+	}
+	tag.Name = strings.ToLower(string(src[nameStart:i]))
+	for i < len(src) {
+		for i < len(src) && (isSpace(src[i]) || src[i] == '/') {
+			i++
+		}
+		if i >= len(src) {
+			break
+		}
+		if src[i] == '>' {
+			tag.End = i + 1
+			return tag, true
+		}
+		attrStart := i
+		for i < len(src) && !isSpace(src[i]) && src[i] != '>' && src[i] != '=' && (src[i] != '/' || i == attrStart) {
+			i++
+		}
+		attr := Attr{Name: strings.ToLower(string(src[attrStart:i])), Start: attrStart, End: i, ValueStart: -1, ValueEnd: -1}
+		j := i
+		for j < len(src) && isSpace(src[j]) {
+			j++
+		}
+		if j < len(src) && src[j] == '=' {
+			j++
+			for j < len(src) && isSpace(src[j]) {
+				j++
+			}
+			if j < len(src) && (src[j] == '"' || src[j] == '\'') {
+				end := bytes.IndexByte(src[j+1:], src[j])
+				if end < 0 {
+					return Tag{}, false
+				}
+				attr.ValueStart, attr.ValueEnd = j+1, j+1+end
+				i = j + 1 + end + 1
+			} else {
+				attr.ValueStart = j
+				for j < len(src) && !isSpace(src[j]) && src[j] != '>' {
+					j++
+				}
+				attr.ValueEnd = j
+				i = j
+			}
+			attr.Value = html.UnescapeString(string(src[attr.ValueStart:attr.ValueEnd]))
+			attr.End = i
+		}
+		tag.Attrs = append(tag.Attrs, attr)
+	}
+	return Tag{}, false
+}
@@ -0,0 +1,61 @@
+package htmlscan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTags(t *testing.T) {
+	src := []byte(`<!DOCTYPE html><!-- <a href="x"> --><HTML><head>
+<title>A &amp; <b></title>
+<meta name=description content='It&#39;s "quoted"'>
+<link rel="icon" href = "/fav.ico"/>
+<script>if (a < b) { document.write("<img src=x>") }</script>
+</head><body class=main hidden><img src="p.png" alt=""><p>1 < 2</p></body></HTML>`)
+	tags := Tags(src)
+	var names []string
+	for _, tag := range tags {
+		name := tag.Name
+		if tag.Closing {
+			name = "/" + name
+		}
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{
+		"html", "head", "title", "/title", "meta", "link", "script", "/script", "/head",
+		"body", "img", "p", "/p", "/body", "/html",
+	}, names)
+
+	assert.Equal(t, "A & <b>", Text(src, tags, 2))
+	meta := tags[4]
+	v, ok := meta.Attr("content")
+	assert.True(t, ok)
+	assert.Equal(t, `It's "quoted"`, v)
+	v, _ = meta.Attr("name")
+	assert.Equal(t, "description", v)
+
+	link := tags[5]
+	href := link.Attrs[1]
+	assert.Equal(t, "/fav.ico", href.Value)
+	assert.Equal(t, "/fav.ico", string(src[href.ValueStart:href.ValueEnd]))
+	assert.Equal(t, `<link rel="icon" href = "/fav.ico"/>`, string(src[link.Start:link.End]))
+
+	body := tags[9]
+	require.Len(t, body.Attrs, 2)
+	hidden := body.Attrs[1]
+	assert.Equal(t, Attr{Name: "hidden", Start: hidden.Start, End: hidden.Start + 6, ValueStart: -1, ValueEnd: -1}, hidden)
+	assert.Equal(t, "hidden", string(src[hidden.Start:hidden.End]))
+	assert.Equal(t, "main", string(src[body.Attrs[0].ValueStart:body.Attrs[0].ValueEnd]))
+	assert.Equal(t, "class=main", string(src[body.Attrs[0].Start:body.Attrs[0].End]))
+	assert.Equal(t, `href = "/fav.ico"`, string(src[href.Start:href.End]))
+}
+
+func TestTagsMalformed(t *testing.T) {
+	for _, src := range []string{"<", "<a", `<a href="x`, "<!--", "<!", "</", "< a>", "<1>", "<script>x"} {
+		assert.NotPanics(t, func() { Tags([]byte(src)) }, src)
+	}
+	assert.Empty(t, Tags([]byte(`<a href="x`)))
+	assert.Len(t, Tags([]byte("<script>x")), 1)
+}
@@ -0,0 +1,112 @@
+package jmsgp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// marshalMessage encodes data (or error) as message. On marshaling failure internal error message is encoded instead
+// and marshaling error is returned along with it.
+func marshalMessage(target, id string, data any, partial bool) (body []byte, errCode string, err error) {
+	msg := Message{
+		Id:      id,
+		Target:  target,
+		Partial: partial,
+	}
+
+	dErr, ok := data.(error)
+	if ok {
+		msg.setError(dErr)
+	} else {
+		msg.Data = data
+	}
+	if msg.ErrorCode != "" && msg.ErrorText == "" {
+		msg.ErrorText = DefaultErrorRegistry.FormatMessage(msg.ErrorCode, msg.Data)
+	}
+
+	body, marshalErr := json.Marshal(&msg)
+	if marshalErr != nil {
+		fallbackMsg := Message{
+			Id:        id,
+			Target:    target,
+			ErrorCode: InternalErrCode,
+			Partial:   partial,
+		}
+		fallbackBody, err := json.Marshal(&fallbackMsg)
+		if err != nil {
+			// Must not happen.
+			panic(err)
+		}
+		return fallbackBody, fallbackMsg.ErrorCode, fmt.Errorf("jmsgp send msg marshal: %w", marshalErr)
+	}
+	return body, msg.ErrorCode, nil
+}
+
+// bindJSON decodes single JSON object from r into dst and validates it.
+func bindJSON(ctx context.Context, r io.Reader, dst any) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			msg := fmt.Sprintf("request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
+			return &jmsgpError{code: InvalidMessageErrCode, text: msg}
+
+		// https://github.com/golang/go/issues/25956
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			msg := fmt.Sprintf("request body contains badly-formed JSON")
+			return &jmsgpError{code: InvalidMessageErrCode, text: msg}
+
+		case errors.As(err, &unmarshalTypeError):
+			msg := "invalid message data"
+			issue := fmt.Sprintf("invalid type, expected %q", unmarshalTypeError.Type.Name())
+			return &jmsgpError{code: InvalidDataErrCode, text: msg, data: map[string]string{unmarshalTypeError.Field: issue}}
+
+		// https://github.com/golang/go/issues/29035
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			fieldName = strings.Trim(fieldName, `"`)
+			msg := "invalid message data"
+			issue := "unknown field"
+			return &jmsgpError{code: InvalidDataErrCode, text: msg, data: map[string]string{fieldName: issue}}
+
+		case errors.Is(err, io.EOF):
+			msg := "request body must not be empty"
+			return &jmsgpError{code: InvalidMessageErrCode, text: msg}
+
+		case errors.As(err, &maxBytesError):
+			msg := fmt.Sprintf("request body must not be larger than %d bytes", maxBytesError.Limit)
+			return &jmsgpError{code: InvalidMessageErrCode, text: msg}
+
+		default:
+			return err
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if err != io.EOF {
+		msg := "request body must only contain a single JSON object"
+		return &jmsgpError{code: InvalidMessageErrCode, text: msg}
+	}
+
+	validator, ok := dst.(Validator)
+	if ok {
+		if issues := validator.Validate(ctx); len(issues) > 0 {
+			msg := "invalid message data"
+			return &jmsgpError{code: InvalidDataErrCode, text: msg, data: issues}
+		}
+	}
+
+	return nil
+}
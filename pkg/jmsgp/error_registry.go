@@ -0,0 +1,117 @@
+package jmsgp
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ErrorSpec declares properties of an error code.
+type ErrorSpec struct {
+	Code       string `json:"code"`
+	HTTPStatus int    `json:"http_status"`
+	Retryable  bool   `json:"retryable"`
+	// Message is a text/template of user-facing message. It is executed with error data
+	// when error itself doesn't provide any text.
+	Message string `json:"message,omitempty"`
+
+	tmpl *template.Template
+}
+
+// ErrorRegistry keeps error specs of protocol and application error codes. Use NewErrorRegistry() to instantiate.
+type ErrorRegistry struct {
+	mu    sync.RWMutex
+	specs map[string]ErrorSpec
+}
+
+func NewErrorRegistry() *ErrorRegistry {
+	return &ErrorRegistry{
+		specs: make(map[string]ErrorSpec),
+	}
+}
+
+// DefaultErrorRegistry is used by transports to map error codes to HTTP statuses and messages.
+var DefaultErrorRegistry = NewErrorRegistry()
+
+func init() {
+	DefaultErrorRegistry.Register(
+		ErrorSpec{Code: InvalidTargetErrCode, HTTPStatus: http.StatusNotFound, Message: "target not found"},
+		ErrorSpec{Code: InvalidMessageErrCode, HTTPStatus: http.StatusBadRequest, Message: "invalid message"},
+		ErrorSpec{Code: InvalidDataErrCode, HTTPStatus: http.StatusBadRequest, Message: "invalid message data"},
+		ErrorSpec{Code: InternalErrCode, HTTPStatus: http.StatusInternalServerError},
+	)
+}
+
+// RegisterErrors adds error specs to DefaultErrorRegistry.
+func RegisterErrors(specs ...ErrorSpec) {
+	DefaultErrorRegistry.Register(specs...)
+}
+
+// Register adds error specs. Panics on duplicate code, not namespaced code or invalid message template,
+// so it's expected to be called on application initialization.
+func (r *ErrorRegistry) Register(specs ...ErrorSpec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, spec := range specs {
+		if !strings.Contains(spec.Code, ".") {
+			panic(fmt.Errorf("jmsgp: error code %q must be namespaced", spec.Code))
+		}
+		if _, ok := r.specs[spec.Code]; ok {
+			panic(fmt.Errorf("jmsgp: error code %q already registered", spec.Code))
+		}
+		if spec.HTTPStatus == 0 {
+			spec.HTTPStatus = http.StatusInternalServerError
+		}
+		if spec.Message != "" {
+			spec.tmpl = template.Must(template.New(spec.Code).Option("missingkey=zero").Parse(spec.Message))
+		}
+		r.specs[spec.Code] = spec
+	}
+}
+
+func (r *ErrorRegistry) Lookup(code string) (ErrorSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	spec, ok := r.specs[code]
+	return spec, ok
+}
+
+// HTTPStatus maps error code to HTTP status. Empty code means success, unknown codes are internal errors.
+func (r *ErrorRegistry) HTTPStatus(code string) int {
+	if code == "" {
+		return http.StatusOK
+	}
+	if spec, ok := r.Lookup(code); ok {
+		return spec.HTTPStatus
+	}
+	return http.StatusInternalServerError
+}
+
+// FormatMessage renders user-facing message of error code with error data. Returns empty string if code
+// is unknown, has no message or template execution fails.
+func (r *ErrorRegistry) FormatMessage(code string, data any) string {
+	spec, ok := r.Lookup(code)
+	if !ok || spec.tmpl == nil {
+		return ""
+	}
+	var sb strings.Builder
+	if err := spec.tmpl.Execute(&sb, data); err != nil {
+		return ""
+	}
+	return sb.String()
+}
+
+// Catalog returns all registered error specs sorted by code.
+func (r *ErrorRegistry) Catalog() []ErrorSpec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	specs := make([]ErrorSpec, 0, len(r.specs))
+	for _, spec := range r.specs {
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Code < specs[j].Code })
+	return specs
+}
@@ -1,8 +1,8 @@
 package jmsgp
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"path"
 	"strings"
+	"sync"
 )
 
 const DefaultHTTPBodyMaxBytes = 1048576 // 1MB
@@ -20,7 +21,7 @@ func TargetFromHTTPRequestURLPath(r *http.Request) string {
 }
 
 func TargetFromHTTPRequestURLPathValue(name string) func(*http.Request) string {
-	return func (r *http.Request) string {
+	return func(r *http.Request) string {
 		return r.PathValue(name)
 	}
 }
@@ -44,7 +45,7 @@ func NewHTTPServerTransport(hub *Hub) *HTTPServerTransport {
 func (t *HTTPServerTransport) HandleRequest(w http.ResponseWriter, r *http.Request) error {
 	env := &httpEnvelope{
 		ctx:    r.Context(),
-		peer:   &httpPeer{w: w},
+		peer:   &httpPeer{w: w, streamFormat: negotiateStreamFormat(r)},
 		id:     r.Header.Get(t.MessageIdHeader),
 		target: t.ExtractTargetFunc(r),
 		body:   http.MaxBytesReader(w, r.Body, t.BodyMaxBytes),
@@ -68,47 +69,89 @@ func (t *HTTPServerTransport) dispatch(ctx context.Context, r *http.Request, env
 	return t.hub.Dispatch(ctx, env)
 }
 
+// Streaming response formats for partial messages. Client opts in with Accept header.
+const (
+	NDJSONMediaType        = "application/x-ndjson"
+	EventStreamMediaType   = "text/event-stream"
+	httpStreamFormatNone   = ""
+	httpStreamFormatNDJSON = NDJSONMediaType
+	httpStreamFormatSSE    = EventStreamMediaType
+)
+
+func negotiateStreamFormat(r *http.Request) string {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediatype, _, _ := mime.ParseMediaType(strings.TrimSpace(part))
+			switch mediatype {
+			case NDJSONMediaType:
+				return httpStreamFormatNDJSON
+			case EventStreamMediaType:
+				return httpStreamFormatSSE
+			}
+		}
+	}
+	return httpStreamFormatNone
+}
+
 type httpPeer struct {
-	w http.ResponseWriter
+	mu           sync.Mutex
+	w            http.ResponseWriter
+	streamFormat string
+	streaming    bool
 }
 
 var _ Peer = (*httpPeer)(nil)
 
 func (p *httpPeer) Send(ctx context.Context, target, id string, data any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.streaming {
+		return p.writeStreamMessage(target, id, data, false)
+	}
 	return WriteHTTPResponse(ctx, p.w, target, id, data)
 }
 
-func WriteHTTPResponse(ctx context.Context, w http.ResponseWriter, target, id string, data any) error {
-	msg := Message{
-		Id:     id,
-		Target: target,
+// sendPartial switches response to streaming mode on first call. Partial messages are dropped
+// if client didn't ask for streaming response.
+func (p *httpPeer) sendPartial(ctx context.Context, target, id string, data any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.streamFormat == httpStreamFormatNone {
+		return nil
 	}
-
-	dErr, ok := data.(error)
-	if ok {
-		msg.setError(dErr)
-	} else {
-		msg.Data = data
+	if !p.streaming {
+		p.streaming = true
+		p.w.Header().Set("Content-Type", p.streamFormat)
+		p.w.Header().Set("Cache-Control", "no-cache")
+		p.w.WriteHeader(http.StatusOK)
 	}
+	return p.writeStreamMessage(target, id, data, true)
+}
 
-	httpStatus := mapErrorCodeToHTTPStatus(msg.ErrorCode)
-	body, marshalErr := json.Marshal(&msg)
-	if marshalErr != nil {
-		fallbackMsg := Message{
-			Id:        id,
-			Target:    target,
-			ErrorCode: InternalErrCode,
-		}
-		httpStatus = mapErrorCodeToHTTPStatus(fallbackMsg.ErrorCode)
-		fallbackBody, err := json.Marshal(&fallbackMsg)
-		if err != nil {
-			// Must not happen.
-			panic(err)
-		}
-		body = fallbackBody
-		marshalErr = fmt.Errorf("jmsgp send msg marshal: %w", marshalErr)
-
+func (p *httpPeer) writeStreamMessage(target, id string, data any, partial bool) error {
+	body, _, marshalErr := marshalMessage(target, id, data, partial)
+	var frame bytes.Buffer
+	switch p.streamFormat {
+	case httpStreamFormatSSE:
+		frame.WriteString("data: ")
+		frame.Write(body)
+		frame.WriteString("\n\n")
+	default:
+		frame.Write(body)
+		frame.WriteByte('\n')
 	}
+	_, writeErr := p.w.Write(frame.Bytes())
+	if writeErr != nil {
+		writeErr = fmt.Errorf("jmsgp send msg write: %w", writeErr)
+	} else if err := http.NewResponseController(p.w).Flush(); err != nil {
+		writeErr = fmt.Errorf("jmsgp send msg flush: %w", err)
+	}
+	return errors.Join(marshalErr, writeErr)
+}
+
+func WriteHTTPResponse(ctx context.Context, w http.ResponseWriter, target, id string, data any) error {
+	body, errCode, marshalErr := marshalMessage(target, id, data, false)
+	httpStatus := DefaultErrorRegistry.HTTPStatus(errCode)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(httpStatus)
 	_, writeErr := w.Write(body)
@@ -119,30 +162,16 @@ func WriteHTTPResponse(ctx context.Context, w http.ResponseWriter, target, id st
 	return errors.Join(marshalErr, writeErr)
 }
 
-func mapErrorCodeToHTTPStatus(code string) int {
-	switch {
-	case code == "":
-		return http.StatusOK
-	case code == InvalidTargetErrCode:
-		return http.StatusNotFound
-	case code == InvalidMessageErrCode:
-		return http.StatusBadRequest
-	case code == InvalidDataErrCode:
-		return http.StatusBadRequest
-	default:
-		return http.StatusInternalServerError
-	}
-}
-
 type httpEnvelope struct {
 	ctx    context.Context
-	peer   Peer
+	peer   *httpPeer
 	id     string
 	target string
 	body   io.ReadCloser
 }
 
 var _ Envelope = (*httpEnvelope)(nil)
+var _ PartialResponder = (*httpEnvelope)(nil)
 
 func (e *httpEnvelope) Context() context.Context {
 	return e.ctx
@@ -164,65 +193,10 @@ func (e *httpEnvelope) Respond(ctx context.Context, data any) error {
 	return e.peer.Send(ctx, e.target, e.id, data)
 }
 
-func (e *httpEnvelope) BindData(ctx context.Context, dst any) error {
-	dec := json.NewDecoder(e.body)
-	dec.DisallowUnknownFields()
-
-	err := dec.Decode(&dst)
-	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var maxBytesError *http.MaxBytesError
-
-		switch {
-		case errors.As(err, &syntaxError):
-			msg := fmt.Sprintf("request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
-			return &jmsgpError{code: InvalidMessageErrCode, text: msg}
-
-		// https://github.com/golang/go/issues/25956
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			msg := fmt.Sprintf("request body contains badly-formed JSON")
-			return &jmsgpError{code: InvalidMessageErrCode, text: msg}
-
-		case errors.As(err, &unmarshalTypeError):
-			msg := "invalid message data"
-			issue := fmt.Sprintf("invalid type, expected %q", unmarshalTypeError.Type.Name())
-			return &jmsgpError{code: InvalidDataErrCode, text: msg, data: map[string]string{unmarshalTypeError.Field: issue}}
-
-		// https://github.com/golang/go/issues/29035
-		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			fieldName = strings.Trim(fieldName, `"`)
-			msg := "invalid message data"
-			issue := "unknown field"
-			return &jmsgpError{code: InvalidDataErrCode, text: msg, data: map[string]string{fieldName: issue}}
-
-		case errors.Is(err, io.EOF):
-			msg := "request body must not be empty"
-			return &jmsgpError{code: InvalidMessageErrCode, text: msg}
-
-		case errors.As(err, &maxBytesError):
-			msg := fmt.Sprintf("request body must not be larger than %d bytes", maxBytesError.Limit)
-			return &jmsgpError{code: InvalidMessageErrCode, text: msg}
-
-		default:
-			return err
-		}
-	}
-
-	err = dec.Decode(&struct{}{})
-	if err != io.EOF {
-		msg := "request body must only contain a single JSON object"
-		return &jmsgpError{code: InvalidMessageErrCode, text: msg}
-	}
-
-	validator, ok := dst.(Validator)
-	if ok {
-		if issues := validator.Validate(ctx); len(issues) > 0 {
-			msg := "invalid message data"
-			return &jmsgpError{code: InvalidDataErrCode, text: msg, data: issues}
-		}
-	}
+func (e *httpEnvelope) RespondPartial(ctx context.Context, data any) error {
+	return e.peer.sendPartial(ctx, e.target, e.id, data)
+}
 
-	return nil
+func (e *httpEnvelope) BindData(ctx context.Context, dst any) error {
+	return bindJSON(ctx, e.body, dst)
 }
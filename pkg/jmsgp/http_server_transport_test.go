@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/brainmorsel/libreta/pkg/jmsgp"
@@ -144,3 +145,120 @@ func TestHTTPServerTransport(t *testing.T) {
 		})
 	}
 }
+
+type testAppError struct {
+	code string
+	data map[string]string
+}
+
+func (err *testAppError) Error() string                { return err.code }
+func (err *testAppError) JMSGPError() (string, string) { return err.code, "" }
+func (err *testAppError) JMSGPErrorData() any {
+	if err.data == nil {
+		return nil
+	}
+	return err.data
+}
+
+// registerTestErrors adds test errors to default registry once, as Register panics on duplicates
+// when tests are run repeatedly (e.g. with -count=2).
+var registerTestErrors = sync.OnceFunc(func() {
+	jmsgp.RegisterErrors(jmsgp.ErrorSpec{
+		Code:       "test.not_found",
+		HTTPStatus: http.StatusNotFound,
+		Message:    "item {{.id}} not found",
+	})
+})
+
+func TestWriteHTTPResponseRegisteredError(t *testing.T) {
+	registerTestErrors()
+
+	tests := map[string]struct {
+		err        error
+		wantBody   string
+		wantStatus int
+	}{
+		"registered": {
+			err:        &testAppError{code: "test.not_found", data: map[string]string{"id": "42"}},
+			wantBody:   `{"id":"test-id","err":"test.not_found","txt":"item 42 not found","dat":{"id":"42"}}`,
+			wantStatus: http.StatusNotFound,
+		},
+		"unregistered": {
+			err:        &testAppError{code: "test.unknown"},
+			wantBody:   `{"id":"test-id","err":"test.unknown"}`,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			require.NoError(t, jmsgp.WriteHTTPResponse(context.Background(), w, "", "test-id", tc.err))
+			res := w.Result()
+			defer res.Body.Close()
+			data, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantBody, string(data))
+			assert.Equal(t, tc.wantStatus, res.StatusCode)
+		})
+	}
+
+	spec, ok := jmsgp.DefaultErrorRegistry.Lookup("test.not_found")
+	require.True(t, ok)
+	assert.Contains(t, jmsgp.DefaultErrorRegistry.Catalog(), spec)
+}
+
+func TestHTTPServerTransportPartial(t *testing.T) {
+	hub := jmsgp.NewHub()
+	jmsgp.AddRPCHandler(hub, "progress", func(ctx context.Context, _ struct{}) (string, error) {
+		for n := range 2 {
+			if err := jmsgp.RespondPartial(ctx, n+1); err != nil {
+				return "", err
+			}
+		}
+		return "done", nil
+	})
+	transport := jmsgp.NewHTTPServerTransport(hub)
+
+	tests := map[string]struct {
+		accept          string
+		wantBody        string
+		wantContentType string
+	}{
+		"not streaming": {
+			wantBody:        `{"id":"test-id","trg":"progress","dat":"done"}`,
+			wantContentType: "application/json",
+		},
+		"ndjson": {
+			accept: "application/x-ndjson",
+			wantBody: `{"id":"test-id","trg":"progress","dat":1,"prt":true}` + "\n" +
+				`{"id":"test-id","trg":"progress","dat":2,"prt":true}` + "\n" +
+				`{"id":"test-id","trg":"progress","dat":"done"}` + "\n",
+			wantContentType: "application/x-ndjson",
+		},
+		"sse": {
+			accept: "text/event-stream",
+			wantBody: `data: {"id":"test-id","trg":"progress","dat":1,"prt":true}` + "\n\n" +
+				`data: {"id":"test-id","trg":"progress","dat":2,"prt":true}` + "\n\n" +
+				`data: {"id":"test-id","trg":"progress","dat":"done"}` + "\n\n",
+			wantContentType: "text/event-stream",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/progress", strings.NewReader(`{}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", tc.accept)
+			req.Header.Set(jmsgp.DefaultMessageIdHTTPHeader, "test-id")
+
+			w := httptest.NewRecorder()
+			require.NoError(t, transport.HandleRequest(w, req))
+			res := w.Result()
+			defer res.Body.Close()
+			data, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantBody, string(data))
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, tc.wantContentType, res.Header.Get("Content-Type"))
+		})
+	}
+}
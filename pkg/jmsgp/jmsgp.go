@@ -5,6 +5,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"sync"
 )
 
 // Protocol specific error codes. Application code must use namespaced errors, e.g. `app.some_error`.
@@ -21,6 +24,8 @@ type Message struct {
 	ErrorCode string `json:"err,omitempty"`
 	ErrorText string `json:"txt,omitempty"`
 	Data      any    `json:"dat,omitempty"`
+	// Partial marks intermediate message (e.g. progress notification) sent before the final response.
+	Partial bool `json:"prt,omitempty"`
 }
 
 func (msg *Message) setError(err error) {
@@ -40,6 +45,19 @@ func (msg *Message) setError(err error) {
 	}
 }
 
+// ErrorCode returns protocol error code err is reported with, empty for nil error.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var pErr JMSGPError
+	if errors.As(err, &pErr) {
+		code, _ := pErr.JMSGPError()
+		return code
+	}
+	return InternalErrCode
+}
+
 type Envelope interface {
 	Id() string
 	Target() string
@@ -49,6 +67,12 @@ type Envelope interface {
 	Respond(ctx context.Context, data any) error
 }
 
+// PartialResponder is implemented by envelopes able to send partial messages correlated by Id
+// before the final response.
+type PartialResponder interface {
+	RespondPartial(ctx context.Context, data any) error
+}
+
 type Peer interface {
 	Send(ctx context.Context, target, id string, data any) error
 }
@@ -92,28 +116,175 @@ func (err *jmsgpError) Error() string {
 
 type HandleFunc func(Envelope) error
 
+// Middleware wraps message handler, e.g. to check permissions or collect metrics.
+type Middleware func(HandleFunc) HandleFunc
+
 func NewHub() *Hub {
 	return &Hub{
 		handlers: make(map[string]HandleFunc),
+		targets:  make(map[string]TargetInfo),
+		inflight: make(map[inflightKey]*inflightMessage),
 	}
 }
 
 // Hub dispatches message to appropriate handlers. Use NewHub() to instantiate.
 type Hub struct {
-	handlers map[string]HandleFunc
+	handlers    map[string]HandleFunc
+	targets     map[string]TargetInfo
+	middlewares []Middleware
+
+	// OwnerFunc returns owner of message dispatched with ctx, e.g. authenticated user. Message can be canceled
+	// only with CancelTarget message of the same owner. All messages have the same owner if it isn't set.
+	OwnerFunc func(ctx context.Context) string
+
+	inflightMu sync.Mutex
+	inflight   map[inflightKey]*inflightMessage
+}
+
+type inflightKey struct {
+	owner string
+	id    string
+}
+
+type inflightMessage struct {
+	cancel context.CancelFunc
+}
+
+// TargetInfo describes registered target. In and Out types are known only for handlers added with AddRPCHandler.
+type TargetInfo struct {
+	Target string
+	In     reflect.Type
+	Out    reflect.Type
 }
 
 // AddHandler adds message handling function to dispatcher. Not thread safe at current time.
 func (h *Hub) AddHandler(target string, f HandleFunc) {
 	h.handlers[target] = f
+	h.targets[target] = TargetInfo{Target: target}
+}
+
+// Use adds middleware applied to all handlers, first added is outermost. Not thread safe at current time.
+func (h *Hub) Use(mw Middleware) {
+	h.middlewares = append(h.middlewares, mw)
+}
+
+// Targets returns descriptions of all registered targets sorted by name.
+func (h *Hub) Targets() []TargetInfo {
+	targets := make([]TargetInfo, 0, len(h.targets))
+	for _, info := range h.targets {
+		targets = append(targets, info)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Target < targets[j].Target })
+	return targets
+}
+
+// CancelTarget is handled by hub itself: it cancels context of in-flight message with Id from CancelRequest made by
+// the same owner (see Hub.OwnerFunc). Middlewares are applied to it as to any other target.
+const CancelTarget = "jmsgp.cancel"
+
+type CancelRequest struct {
+	Id string `json:"id"`
 }
 
 func (h *Hub) Dispatch(ctx context.Context, env Envelope) error {
 	f, ok := h.handlers[env.Target()]
+	if env.Target() == CancelTarget {
+		f, ok = h.handleCancel, true
+	}
 	if !ok {
 		return &jmsgpError{code: InvalidTargetErrCode, text: "target not found"}
 	}
-	return f(env)
+
+	ctx, cancel := context.WithCancel(env.Context())
+	defer cancel()
+	denv := &dispatchEnvelope{Envelope: env}
+	denv.ctx = context.WithValue(ctx, envelopeCtxKey{}, denv)
+	if id := env.Id(); id != "" {
+		denv.ctx = ContextWithMessageId(denv.ctx, id)
+	}
+	if id := env.Id(); id != "" && env.Target() != CancelTarget {
+		key := inflightKey{owner: h.owner(denv.ctx), id: id}
+		msg := &inflightMessage{cancel: cancel}
+		h.inflightMu.Lock()
+		h.inflight[key] = msg
+		h.inflightMu.Unlock()
+		defer func() {
+			h.inflightMu.Lock()
+			if h.inflight[key] == msg {
+				delete(h.inflight, key)
+			}
+			h.inflightMu.Unlock()
+		}()
+	}
+	for i := len(h.middlewares) - 1; i >= 0; i-- {
+		f = h.middlewares[i](f)
+	}
+	return f(denv)
+}
+
+func (h *Hub) handleCancel(env Envelope) error {
+	var req CancelRequest
+	if err := env.BindData(env.Context(), &req); err != nil {
+		return err
+	}
+	h.inflightMu.Lock()
+	msg, ok := h.inflight[inflightKey{owner: h.owner(env.Context()), id: req.Id}]
+	h.inflightMu.Unlock()
+	if ok {
+		msg.cancel()
+	}
+	return env.Respond(env.Context(), ok)
+}
+
+func (h *Hub) owner(ctx context.Context) string {
+	if h.OwnerFunc == nil {
+		return ""
+	}
+	return h.OwnerFunc(ctx)
+}
+
+type envelopeCtxKey struct{}
+
+type messageIdCtxKey struct{}
+
+// ContextWithMessageId returns ctx carrying message (request) id, e.g. for logging.
+func ContextWithMessageId(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, messageIdCtxKey{}, id)
+}
+
+// MessageIdFromContext returns id of the message being handled or empty string.
+func MessageIdFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(messageIdCtxKey{}).(string)
+	return id
+}
+
+// dispatchEnvelope overrides context of original envelope with cancelable one.
+type dispatchEnvelope struct {
+	Envelope
+	ctx context.Context
+}
+
+var _ PartialResponder = (*dispatchEnvelope)(nil)
+
+func (e *dispatchEnvelope) Context() context.Context {
+	return e.ctx
+}
+
+func (e *dispatchEnvelope) RespondPartial(ctx context.Context, data any) error {
+	if pr, ok := e.Envelope.(PartialResponder); ok {
+		return pr.RespondPartial(ctx, data)
+	}
+	return nil
+}
+
+// RespondPartial sends partial message (e.g. progress notification) in response to message being dispatched
+// with ctx. Partial messages are silently dropped if transport or client doesn't support them.
+func RespondPartial(ctx context.Context, data any) error {
+	env, ok := ctx.Value(envelopeCtxKey{}).(PartialResponder)
+	if !ok {
+		return nil
+	}
+	return env.RespondPartial(ctx, data)
 }
 
 // RPCHandler converts any function with compatible signature to RPC-like message handler.
@@ -134,3 +305,14 @@ func RPCHandler[I, O any](f func(context.Context, I) (O, error)) HandleFunc {
 		return env.Respond(env.Context(), resp)
 	}
 }
+
+// AddRPCHandler adds RPC-like handler to hub, keeping its request and response types for introspection
+// (e.g. client code generation).
+func AddRPCHandler[I, O any](h *Hub, target string, f func(context.Context, I) (O, error)) {
+	h.AddHandler(target, RPCHandler(f))
+	h.targets[target] = TargetInfo{
+		Target: target,
+		In:     reflect.TypeFor[I](),
+		Out:    reflect.TypeFor[O](),
+	}
+}
@@ -0,0 +1,282 @@
+package jmsgp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DefaultStreamMessageMaxBytes = 1048576 // 1MB
+
+// StreamFraming defines how messages are delimited in byte stream.
+type StreamFraming int
+
+const (
+	// FramingNewline is newline-delimited JSON, one message per line.
+	FramingNewline StreamFraming = iota
+	// FramingContentLength prefixes each message with "Content-Length: N\r\n\r\n" header like LSP does.
+	FramingContentLength
+)
+
+func ParseStreamFraming(s string) (StreamFraming, error) {
+	switch s {
+	case "", "ndjson", "newline":
+		return FramingNewline, nil
+	case "content-length", "lsp":
+		return FramingContentLength, nil
+	default:
+		return 0, fmt.Errorf("unknown stream framing %q", s)
+	}
+}
+
+// StreamTransport serves messages read from byte stream (e.g. stdin/stdout of a process).
+type StreamTransport struct {
+	Framing         StreamFraming
+	MessageMaxBytes int
+	hub             *Hub
+}
+
+func NewStreamTransport(hub *Hub) *StreamTransport {
+	return &StreamTransport{
+		Framing:         FramingNewline,
+		MessageMaxBytes: DefaultStreamMessageMaxBytes,
+		hub:             hub,
+	}
+}
+
+type streamMessage struct {
+	Id     string          `json:"id"`
+	Target string          `json:"trg"`
+	Data   json.RawMessage `json:"dat"`
+}
+
+// Serve reads messages from r until EOF and dispatches them concurrently, responses are written to w in order
+// of completion. Serve waits for in-flight messages before returning. Messages are not read anymore after ctx is
+// done, but pending read can't be interrupted.
+func (t *StreamTransport) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	peer := &streamPeer{w: w, framing: t.Framing}
+	reader := bufio.NewReader(r)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for ctx.Err() == nil {
+		frame, err := t.readFrame(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			var pErr *jmsgpError
+			if errors.As(err, &pErr) {
+				// Framing is still in sync, report and go on.
+				if sendErr := peer.Send(ctx, "", "", pErr); sendErr != nil {
+					return sendErr
+				}
+				continue
+			}
+			return fmt.Errorf("jmsgp read frame: %w", err)
+		}
+		if len(bytes.TrimSpace(frame)) == 0 {
+			continue
+		}
+
+		var msg streamMessage
+		if err := json.Unmarshal(frame, &msg); err != nil {
+			err := &jmsgpError{code: InvalidMessageErrCode, text: "message contains badly-formed JSON"}
+			if sendErr := peer.Send(ctx, "", "", err); sendErr != nil {
+				return sendErr
+			}
+			continue
+		}
+		env := &streamEnvelope{
+			ctx:    ctx,
+			peer:   peer,
+			id:     msg.Id,
+			target: msg.Target,
+			data:   msg.Data,
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if dispatchErr := t.hub.Dispatch(env.ctx, env); dispatchErr != nil {
+				// Send errors are reported by the peer on next write attempt, nothing more to do here.
+				_ = env.Respond(env.ctx, dispatchErr)
+			}
+		}()
+	}
+	return ctx.Err()
+}
+
+func (t *StreamTransport) readFrame(r *bufio.Reader) ([]byte, error) {
+	switch t.Framing {
+	case FramingContentLength:
+		return readContentLengthFrame(r, t.MessageMaxBytes)
+	default:
+		return readLineFrame(r, t.MessageMaxBytes)
+	}
+}
+
+func readLineFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) > 0 {
+				return line, nil
+			}
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if !isPrefix {
+			break
+		}
+		if len(line) > maxBytes {
+			// Skip the rest of the line to stay in sync.
+			for isPrefix && err == nil {
+				_, isPrefix, err = r.ReadLine()
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, messageTooLargeErr(maxBytes)
+		}
+	}
+	if len(line) > maxBytes {
+		return nil, messageTooLargeErr(maxBytes)
+	}
+	return line, nil
+}
+
+func readContentLengthFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	length := -1
+	headers := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && (headers || strings.TrimSpace(line) != "") {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if !headers {
+				// Tolerate blank lines between frames.
+				continue
+			}
+			if length < 0 {
+				return nil, errors.New("missing Content-Length header")
+			}
+			break
+		}
+		headers = true
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header line %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length > maxBytes {
+		if _, err := r.Discard(length); err != nil {
+			return nil, err
+		}
+		return nil, messageTooLargeErr(maxBytes)
+	}
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func messageTooLargeErr(maxBytes int) error {
+	msg := fmt.Sprintf("message must not be larger than %d bytes", maxBytes)
+	return &jmsgpError{code: InvalidMessageErrCode, text: msg}
+}
+
+type streamPeer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	framing StreamFraming
+	err     error
+}
+
+var _ Peer = (*streamPeer)(nil)
+
+func (p *streamPeer) Send(ctx context.Context, target, id string, data any) error {
+	return p.send(target, id, data, false)
+}
+
+func (p *streamPeer) send(target, id string, data any, partial bool) error {
+	body, _, marshalErr := marshalMessage(target, id, data, partial)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	var frame bytes.Buffer
+	switch p.framing {
+	case FramingContentLength:
+		fmt.Fprintf(&frame, "Content-Length: %d\r\n\r\n", len(body))
+		frame.Write(body)
+	default:
+		frame.Write(body)
+		frame.WriteByte('\n')
+	}
+	if _, err := p.w.Write(frame.Bytes()); err != nil {
+		p.err = fmt.Errorf("jmsgp send msg write: %w", err)
+		return errors.Join(marshalErr, p.err)
+	}
+	return marshalErr
+}
+
+type streamEnvelope struct {
+	ctx    context.Context
+	peer   *streamPeer
+	id     string
+	target string
+	data   json.RawMessage
+}
+
+var _ Envelope = (*streamEnvelope)(nil)
+var _ PartialResponder = (*streamEnvelope)(nil)
+
+func (e *streamEnvelope) Context() context.Context {
+	return e.ctx
+}
+
+func (e *streamEnvelope) Peer() Peer {
+	return e.peer
+}
+
+func (e *streamEnvelope) Id() string {
+	return e.id
+}
+
+func (e *streamEnvelope) Target() string {
+	return e.target
+}
+
+func (e *streamEnvelope) Respond(ctx context.Context, data any) error {
+	return e.peer.Send(ctx, e.target, e.id, data)
+}
+
+func (e *streamEnvelope) RespondPartial(ctx context.Context, data any) error {
+	return e.peer.send(e.target, e.id, data, true)
+}
+
+func (e *streamEnvelope) BindData(ctx context.Context, dst any) error {
+	return bindJSON(ctx, bytes.NewReader(e.data), dst)
+}
@@ -0,0 +1,143 @@
+package jmsgp_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseNDJSON(t *testing.T, out string) map[string]string {
+	t.Helper()
+	byId := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		var msg jmsgp.Message
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+		byId[msg.Id] = scanner.Text()
+	}
+	return byId
+}
+
+func TestStreamTransport(t *testing.T) {
+	hub := jmsgp.NewHub()
+	hub.AddHandler("test-target", testHandler)
+	hub.AddHandler("test-rpc", jmsgp.RPCHandler(testHandlerRPC))
+
+	t.Run("newline", func(t *testing.T) {
+		transport := jmsgp.NewStreamTransport(hub)
+		transport.MessageMaxBytes = 1024
+		in := strings.Join([]string{
+			`{"id":"1","trg":"test-target","dat":{"param":"value1"}}`,
+			``,
+			`{"id":"2","trg":"test-rpc","dat":{"param":"value2"}}`,
+			`{"id":"3","trg":"not-valid-target","dat":{}}`,
+			`{"id":"4","trg":"test-target","dat":{"param":"INVALID"}}`,
+			`{"id":"5","trg":"test-rpc"}`,
+			`{"id":"6","trg":"test-rpc","dat":{"param":"` + strings.Repeat("X", 1024) + `"}}`,
+			`{not-a-json}`,
+		}, "\n")
+		var out bytes.Buffer
+		require.NoError(t, transport.Serve(context.Background(), strings.NewReader(in), &out))
+
+		got := parseNDJSON(t, out.String())
+		assert.Equal(t, `{"id":"1","trg":"test-target","dat":{"result":"value1"}}`, got["1"])
+		assert.Equal(t, `{"id":"2","trg":"test-rpc","dat":{"result":"value2"}}`, got["2"])
+		assert.Equal(t, `{"id":"3","trg":"not-valid-target","err":"jmsgp.invalid_target","txt":"target not found"}`, got["3"])
+		assert.Equal(t, `{"id":"4","trg":"test-target","err":"jmsgp.invalid_data","txt":"invalid message data","dat":{"param":"must be value1 or value2"}}`, got["4"])
+		assert.Equal(t, `{"id":"5","trg":"test-rpc","err":"jmsgp.invalid_message","txt":"request body must not be empty"}`, got["5"])
+		assert.Equal(t, `{"id":"","err":"jmsgp.invalid_message","txt":"message contains badly-formed JSON"}`, got[""])
+		assert.Len(t, got, 6)
+		assert.Contains(t, out.String(), `{"id":"","err":"jmsgp.invalid_message","txt":"message must not be larger than 1024 bytes"}`)
+	})
+
+	t.Run("content_length", func(t *testing.T) {
+		transport := jmsgp.NewStreamTransport(hub)
+		transport.Framing = jmsgp.FramingContentLength
+		body := `{"id":"1","trg":"test-rpc","dat":{"param":"value1"}}`
+		in := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+		var out bytes.Buffer
+		require.NoError(t, transport.Serve(context.Background(), strings.NewReader(in), &out))
+
+		want := `{"id":"1","trg":"test-rpc","dat":{"result":"value1"}}`
+		assert.Equal(t, fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(want), want), out.String())
+	})
+
+	t.Run("content_length_missing", func(t *testing.T) {
+		transport := jmsgp.NewStreamTransport(hub)
+		transport.Framing = jmsgp.FramingContentLength
+		var out bytes.Buffer
+		err := transport.Serve(context.Background(), strings.NewReader("Content-Type: application/json\r\n\r\n{}"), &out)
+		assert.ErrorContains(t, err, "missing Content-Length header")
+		err = transport.Serve(context.Background(), strings.NewReader("Content-Type: application/json\r\n"), &out)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		hub := jmsgp.NewHub()
+		release := make(chan struct{})
+		jmsgp.AddRPCHandler(hub, "wait", func(ctx context.Context, _ struct{}) (string, error) {
+			select {
+			case <-release:
+				return "released", nil
+			case <-time.After(5 * time.Second):
+				return "timeout", nil
+			}
+		})
+		jmsgp.AddRPCHandler(hub, "release", func(ctx context.Context, _ struct{}) (string, error) {
+			close(release)
+			return "ok", nil
+		})
+		transport := jmsgp.NewStreamTransport(hub)
+		in := `{"id":"1","trg":"wait","dat":{}}` + "\n" + `{"id":"2","trg":"release","dat":{}}` + "\n"
+		var out bytes.Buffer
+		require.NoError(t, transport.Serve(context.Background(), strings.NewReader(in), &out))
+
+		got := parseNDJSON(t, out.String())
+		assert.Equal(t, `{"id":"1","trg":"wait","dat":"released"}`, got["1"])
+		assert.Equal(t, `{"id":"2","trg":"release","dat":"ok"}`, got["2"])
+	})
+	t.Run("cancel", func(t *testing.T) {
+		hub := jmsgp.NewHub()
+		started := make(chan struct{})
+		jmsgp.AddRPCHandler(hub, "wait", func(ctx context.Context, _ struct{}) (string, error) {
+			close(started)
+			if err := jmsgp.RespondPartial(ctx, "started"); err != nil {
+				return "", err
+			}
+			select {
+			case <-ctx.Done():
+				return "canceled", nil
+			case <-time.After(5 * time.Second):
+				return "timeout", nil
+			}
+		})
+		transport := jmsgp.NewStreamTransport(hub)
+		r, w := io.Pipe()
+		var out bytes.Buffer
+		done := make(chan error)
+		go func() { done <- transport.Serve(context.Background(), r, &out) }()
+
+		_, err := io.WriteString(w, `{"id":"1","trg":"wait","dat":{}}`+"\n")
+		require.NoError(t, err)
+		<-started
+		_, err = io.WriteString(w, `{"id":"2","trg":"jmsgp.cancel","dat":{"id":"1"}}`+"\n")
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		require.NoError(t, <-done)
+
+		assert.Contains(t, out.String(), `{"id":"1","trg":"wait","dat":"started","prt":true}`)
+		assert.Contains(t, out.String(), `{"id":"1","trg":"wait","dat":"canceled"}`)
+		assert.Contains(t, out.String(), `{"id":"2","trg":"jmsgp.cancel","dat":true}`)
+	})
+}
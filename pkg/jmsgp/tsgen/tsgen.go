@@ -0,0 +1,372 @@
+// Package tsgen generates TypeScript client bindings for jmsgp RPC targets.
+package tsgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+)
+
+const DefaultBaseURL = "/api/rpc/"
+
+type Options struct {
+	// BaseURL is prepended to target name to form request URL.
+	BaseURL string
+	// Header is written at the top of generated file.
+	Header string
+}
+
+// Generate writes TypeScript interfaces for request and response types of RPC targets and typed call functions.
+// Targets without known types (added with Hub.AddHandler) are skipped.
+func Generate(w io.Writer, targets []jmsgp.TargetInfo, opts Options) error {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DefaultBaseURL
+	}
+	g := &generator{
+		named: make(map[string]reflect.Type),
+		decls: make(map[string]string),
+	}
+
+	var funcs bytes.Buffer
+	for _, target := range targets {
+		if target.In == nil || target.Out == nil {
+			continue
+		}
+		inTS, err := g.typeRef(target.In)
+		if err != nil {
+			return fmt.Errorf("target %q request: %w", target.Target, err)
+		}
+		outTS, err := g.typeRef(target.Out)
+		if err != nil {
+			return fmt.Errorf("target %q response: %w", target.Target, err)
+		}
+		name := funcName(target.Target)
+		if isEmptyStruct(target.In) {
+			fmt.Fprintf(&funcs, "\nexport function %s(options?: CallOptions): Promise<%s> {\n", name, outTS)
+			fmt.Fprintf(&funcs, "\treturn call('%s', {}, options);\n}\n", target.Target)
+		} else {
+			fmt.Fprintf(&funcs, "\nexport function %s(params: %s, options?: CallOptions): Promise<%s> {\n", name, inTS, outTS)
+			fmt.Fprintf(&funcs, "\treturn call('%s', params, options);\n}\n", target.Target)
+		}
+	}
+
+	var buf bytes.Buffer
+	if opts.Header != "" {
+		for _, line := range strings.Split(strings.TrimRight(opts.Header, "\n"), "\n") {
+			fmt.Fprintf(&buf, "// %s\n", line)
+		}
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(&buf, preamble, opts.BaseURL)
+	names := make([]string, 0, len(g.decls))
+	for name := range g.decls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString("\n")
+		buf.WriteString(g.decls[name])
+	}
+	buf.Write(funcs.Bytes())
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+const preamble = `export const rpcBaseURL = '%s';
+
+export interface Message<T = unknown> {
+	id: string;
+	trg?: string;
+	err?: string;
+	txt?: string;
+	dat?: T;
+	prt?: boolean;
+}
+
+export class RPCError extends Error {
+	constructor(
+		public code: string,
+		public text: string,
+		public data?: unknown
+	) {
+		super(text ? code + ': ' + text : code);
+		this.name = 'RPCError';
+	}
+}
+
+export interface CallOptions {
+	id?: string;
+	baseURL?: string;
+	signal?: AbortSignal;
+	fetch?: typeof fetch;
+	// Extra request headers, e.g. X-CSRF-Token or Authorization.
+	headers?: Record<string, string>;
+	// Receives partial messages (e.g. progress notifications), enables streaming response.
+	onPartial?: (data: unknown) => void;
+}
+
+export async function call<I, O>(target: string, params: I, options: CallOptions = {}): Promise<O> {
+	const headers: Record<string, string> = { ...options.headers, 'Content-Type': 'application/json' };
+	if (options.id) {
+		headers['X-Request-Id'] = options.id;
+	}
+	if (options.onPartial) {
+		headers['Accept'] = 'application/x-ndjson';
+	}
+	const res = await (options.fetch ?? fetch)((options.baseURL ?? rpcBaseURL) + target, {
+		method: 'POST',
+		headers,
+		body: JSON.stringify(params),
+		signal: options.signal
+	});
+	let msg: Message<O>;
+	if (res.body && res.headers.get('Content-Type')?.startsWith('application/x-ndjson')) {
+		msg = await readStream<O>(res.body, options.onPartial);
+	} else {
+		msg = await res.json();
+	}
+	if (msg.err) {
+		throw new RPCError(msg.err, msg.txt ?? '', msg.dat);
+	}
+	return msg.dat as O;
+}
+
+async function readStream<O>(
+	body: ReadableStream<Uint8Array>,
+	onPartial?: (data: unknown) => void
+): Promise<Message<O>> {
+	const reader = body.pipeThrough(new TextDecoderStream()).getReader();
+	let buf = '';
+	for (;;) {
+		const { done, value } = await reader.read();
+		buf += value ?? '';
+		let pos: number;
+		while ((pos = buf.indexOf('\n')) >= 0) {
+			const line = buf.slice(0, pos).trim();
+			buf = buf.slice(pos + 1);
+			if (!line) {
+				continue;
+			}
+			const msg: Message<O> = JSON.parse(line);
+			if (!msg.prt) {
+				return msg;
+			}
+			onPartial?.(msg.dat);
+		}
+		if (done) {
+			throw new RPCError('jmsgp.invalid_message', 'stream ended without final message');
+		}
+	}
+}
+
+// cancel asks server to cancel in-flight call made with options.id.
+export function cancel(id: string, options?: CallOptions): Promise<boolean> {
+	return call('jmsgp.cancel', { id }, options);
+}
+`
+
+type generator struct {
+	named map[string]reflect.Type
+	decls map[string]string
+}
+
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+)
+
+func (g *generator) typeRef(t reflect.Type) (string, error) {
+	switch {
+	case t == timeType:
+		return "string", nil
+	case t == rawMessageType:
+		return "unknown", nil
+	case t.Kind() == reflect.Pointer:
+		ref, err := g.typeRef(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return ref + " | null", nil
+	}
+
+	if t.Name() != "" && t.PkgPath() != "" && !isBasic(t.Kind()) {
+		return g.namedRef(t)
+	}
+	return g.typeExpr(t)
+}
+
+func (g *generator) namedRef(t reflect.Type) (string, error) {
+	name := t.Name()
+	if strings.ContainsAny(name, "[]") {
+		return "", fmt.Errorf("generic type %s is not supported", t)
+	}
+	if prev, ok := g.named[name]; ok {
+		if prev != t {
+			return "", fmt.Errorf("type name %q is ambiguous: %s and %s", name, prev, t)
+		}
+		return name, nil
+	}
+	g.named[name] = t
+	if t.Kind() == reflect.Struct {
+		body, err := g.structBody(t)
+		if err != nil {
+			return "", err
+		}
+		g.decls[name] = fmt.Sprintf("export interface %s %s\n", name, body)
+	} else {
+		expr, err := g.typeExpr(t)
+		if err != nil {
+			return "", err
+		}
+		g.decls[name] = fmt.Sprintf("export type %s = %s;\n", name, expr)
+	}
+	return name, nil
+}
+
+func (g *generator) typeExpr(t reflect.Type) (string, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.String:
+		return "string", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number", nil
+	case reflect.Interface:
+		return "unknown", nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json marshals byte slices as base64 strings.
+			return "string", nil
+		}
+		elem, err := g.typeRef(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]", nil
+	case reflect.Map:
+		key := "string"
+		if isNumber(t.Key().Kind()) {
+			key = "number"
+		}
+		val, err := g.typeRef(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Record<%s, %s>", key, val), nil
+	case reflect.Struct:
+		return g.structBody(t)
+	case reflect.Pointer:
+		return g.typeRef(t)
+	default:
+		return "", fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+func (g *generator) structBody(t reflect.Type) (string, error) {
+	fields, err := g.structFields(t, "\t")
+	if err != nil {
+		return "", err
+	}
+	if len(fields) == 0 {
+		return "Record<string, never>", nil
+	}
+	return "{\n" + strings.Join(fields, "") + "}", nil
+}
+
+func (g *generator) structFields(t reflect.Type, indent string) ([]string, error) {
+	fields := make([]string, 0, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, tagOpts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded, err := g.structFields(ft, indent)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, embedded...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ref, err := g.typeRef(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: %w", t.Name(), f.Name, err)
+		}
+		if strings.Contains(tagOpts, "string") {
+			ref = "string"
+		}
+		optional := ""
+		if strings.Contains(tagOpts, "omitempty") {
+			optional = "?"
+		}
+		fields = append(fields, fmt.Sprintf("%s%s%s: %s;\n", indent, name, optional, ref))
+	}
+	return fields, nil
+}
+
+func funcName(target string) string {
+	r := []rune(target)
+	// Lower leading run of capitals: "NodeSave" -> "nodeSave", "URLFetch" -> "urlFetch".
+	for i := range r {
+		if !unicode.IsUpper(r[i]) {
+			break
+		}
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	name := strings.Map(func(c rune) rune {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' {
+			return c
+		}
+		return '_'
+	}, string(r))
+	return name
+}
+
+func isEmptyStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.NumField() == 0
+}
+
+func isBasic(k reflect.Kind) bool {
+	return k == reflect.Bool || k == reflect.String || isNumber(k)
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
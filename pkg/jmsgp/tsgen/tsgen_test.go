@@ -0,0 +1,63 @@
+package tsgen_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brainmorsel/libreta/pkg/jmsgp"
+	"github.com/brainmorsel/libreta/pkg/jmsgp/tsgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBase struct {
+	ID string `json:"id"`
+}
+
+type testItem struct {
+	testBase
+	Name     string            `json:"name"`
+	Tags     []string          `json:"tags,omitempty"`
+	Attrs    map[string]string `json:"attrs"`
+	Parent   *testItem         `json:"parent"`
+	Created  time.Time         `json:"created_at"`
+	Content  []byte            `json:"content"`
+	Count    int64             `json:"count,string"`
+	internal string
+	Skipped  string `json:"-"`
+}
+
+func TestGenerate(t *testing.T) {
+	hub := jmsgp.NewHub()
+	hub.AddHandler("untyped", func(env jmsgp.Envelope) error { return nil })
+	jmsgp.AddRPCHandler(hub, "ItemSave", func(ctx context.Context, item testItem) (string, error) { return "", nil })
+	jmsgp.AddRPCHandler(hub, "ItemsList", func(ctx context.Context, _ struct{}) ([]testItem, error) { return nil, nil })
+
+	var sb strings.Builder
+	require.NoError(t, tsgen.Generate(&sb, hub.Targets(), tsgen.Options{Header: "generated"}))
+	out := sb.String()
+
+	assert.True(t, strings.HasPrefix(out, "// generated\n"))
+	assert.Contains(t, out, `export interface testItem {
+	id: string;
+	name: string;
+	tags?: string[];
+	attrs: Record<string, string>;
+	parent: testItem | null;
+	created_at: string;
+	content: string;
+	count: string;
+}
+`)
+	assert.Contains(t, out, `export function itemSave(params: testItem, options?: CallOptions): Promise<string> {
+	return call('ItemSave', params, options);
+}
+`)
+	assert.Contains(t, out, `export function itemsList(options?: CallOptions): Promise<testItem[]> {
+	return call('ItemsList', {}, options);
+}
+`)
+	assert.NotContains(t, out, "untyped")
+}
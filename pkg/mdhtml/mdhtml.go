@@ -0,0 +1,508 @@
+// Package mdhtml renders a common subset of Markdown to HTML: headings, paragraphs, lists (including task lists),
+// block quotes, fenced and indented code, thematic breaks, emphasis, strikethrough, code spans, links, images,
+// autolinks and wikilinks. Raw HTML isn't supported and is escaped, so output is safe to embed into a page.
+package mdhtml
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Options customizes rendering.
+type Options struct {
+	// Wikilink resolves target of [[target]] or embed ![[target]]. Returns URL and whether target is an image,
+	// ok is false for unresolved targets, which are rendered as text.
+	Wikilink func(target string, embed bool) (href string, image bool, ok bool)
+	// URL rewrites destinations of links and images, e.g. relative ones.
+	URL func(dest string) string
+}
+
+// Render renders Markdown source to HTML.
+func Render(src []byte, opts Options) string {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	r := &renderer{opts: opts}
+	r.blocks(strings.Split(text, "\n"))
+	return r.out.String()
+}
+
+// RenderInline renders single line of Markdown, e.g. a title, without block elements.
+func RenderInline(src string, opts Options) string {
+	r := &renderer{opts: opts}
+	r.inline(src)
+	return r.out.String()
+}
+
+type renderer struct {
+	opts  Options
+	out   strings.Builder
+	tight bool
+}
+
+var (
+	headingRe  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ ]+(.*?))?(?:[ ]+#+)?[ ]*$`)
+	hrRe       = regexp.MustCompile(`^ {0,3}(?:(?:\*[ ]*){3,}|(?:-[ ]*){3,}|(?:_[ ]*){3,})$`)
+	fenceRe    = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ ]*([^`\\s]*)")
+	listItemRe = regexp.MustCompile(`^( *)([-*+]|\d{1,9}[.)])( +|$)`)
+	quoteRe    = regexp.MustCompile(`^ {0,3}> ?`)
+	taskRe     = regexp.MustCompile(`^\[([ xX])\] `)
+)
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// startsBlock reports whether line interrupts a paragraph.
+func startsBlock(line string) bool {
+	return headingRe.MatchString(line) || hrRe.MatchString(line) || fenceRe.MatchString(line) ||
+		quoteRe.MatchString(line) || listItemRe.MatchString(line) && !isBlank(listItemRe.ReplaceAllString(line, ""))
+}
+
+func (r *renderer) blocks(lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRe.MatchString(line):
+			i = r.fencedCode(lines, i)
+		case headingRe.MatchString(line):
+			m := headingRe.FindStringSubmatch(line)
+			level := strconv.Itoa(len(m[1]))
+			r.out.WriteString("<h" + level + ">")
+			r.inline(m[2])
+			r.out.WriteString("</h" + level + ">\n")
+			i++
+		case hrRe.MatchString(line):
+			r.out.WriteString("<hr>\n")
+			i++
+		case quoteRe.MatchString(line):
+			var inner []string
+			for ; i < len(lines) && quoteRe.MatchString(lines[i]); i++ {
+				inner = append(inner, quoteRe.ReplaceAllString(lines[i], ""))
+			}
+			r.out.WriteString("<blockquote>\n")
+			r.sub(inner, false)
+			r.out.WriteString("</blockquote>\n")
+		case listItemRe.MatchString(line):
+			i = r.list(lines, i)
+		case indentOf(line) >= 4:
+			var code []string
+			for ; i < len(lines) && (indentOf(lines[i]) >= 4 || isBlank(lines[i])); i++ {
+				code = append(code, strings.TrimPrefix(lines[i], "    "))
+			}
+			for len(code) > 0 && isBlank(code[len(code)-1]) {
+				code = code[:len(code)-1]
+			}
+			r.out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "\n</code></pre>\n")
+		default:
+			para := []string{strings.TrimLeft(line, " ")}
+			for i++; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]); i++ {
+				para = append(para, strings.TrimLeft(lines[i], " "))
+			}
+			for j, l := range para {
+				// Two trailing spaces make a hard line break, same as a trailing backslash.
+				if trimmed := strings.TrimRight(l, " "); j < len(para)-1 && len(l)-len(trimmed) >= 2 {
+					para[j] = trimmed + "\\"
+				} else {
+					para[j] = trimmed
+				}
+			}
+			if !r.tight {
+				r.out.WriteString("<p>")
+			}
+			r.inline(strings.Join(para, "\n"))
+			if !r.tight {
+				r.out.WriteString("</p>\n")
+			} else if i < len(lines) {
+				r.out.WriteString("\n")
+			}
+		}
+	}
+}
+
+// sub renders nested blocks, e.g. of list item or block quote.
+func (r *renderer) sub(lines []string, tight bool) {
+	prev := r.tight
+	r.tight = tight
+	r.blocks(lines)
+	r.tight = prev
+}
+
+func (r *renderer) fencedCode(lines []string, i int) int {
+	m := fenceRe.FindStringSubmatch(lines[i])
+	indent, fence, lang := len(m[1]), m[2], m[3]
+	var code []string
+	for i++; i < len(lines); i++ {
+		line := lines[i]
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, fence[:3]) && strings.Trim(trimmed, fence[:1]) == "" &&
+			len(trimmed) >= len(fence) && indentOf(line) < 4 {
+			i++
+			break
+		}
+		code = append(code, strings.TrimPrefix(line, strings.Repeat(" ", min(indent, indentOf(line)))))
+	}
+	r.out.WriteString("<pre><code")
+	if lang != "" {
+		r.out.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+	}
+	r.out.WriteString(">")
+	if len(code) > 0 {
+		r.out.WriteString(html.EscapeString(strings.Join(code, "\n")) + "\n")
+	}
+	r.out.WriteString("</code></pre>\n")
+	return i
+}
+
+type listItem struct {
+	lines []string
+	// loose items are separated by blank lines, their paragraphs are wrapped into <p>.
+	loose bool
+}
+
+func (r *renderer) list(lines []string, i int) int {
+	first := listItemRe.FindStringSubmatch(lines[i])
+	ordered := len(first[2]) > 1 || unicode.IsDigit(rune(first[2][0]))
+	delim := first[2][len(first[2])-1:]
+	baseIndent := len(first[1])
+
+	var items []listItem
+	for i < len(lines) {
+		m := listItemRe.FindStringSubmatch(lines[i])
+		if m == nil || len(m[1]) != baseIndent || (len(m[2]) > 1 || unicode.IsDigit(rune(m[2][0]))) != ordered ||
+			m[2][len(m[2])-1:] != delim {
+			break
+		}
+		width := len(m[0])
+		if m[3] == "" || len(m[3]) > 4 {
+			width = len(m[1]) + len(m[2]) + 1
+		}
+		item := listItem{lines: []string{strings.TrimLeft(lines[i][min(width, len(lines[i])):], " ")}}
+		if len(m[3]) > 4 {
+			item.lines[0] = strings.Repeat(" ", len(m[3])-1) + item.lines[0]
+		}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if isBlank(line) {
+				// Blank line continues item only if followed by indented content or next item.
+				j := i + 1
+				for j < len(lines) && isBlank(lines[j]) {
+					j++
+				}
+				if j < len(lines) && indentOf(lines[j]) >= width {
+					item.lines = append(item.lines, "")
+					item.loose = true
+					continue
+				}
+				if j < len(lines) && listItemRe.MatchString(lines[j]) && indentOf(lines[j]) == baseIndent {
+					item.loose = true
+					i = j
+				}
+				break
+			}
+			if indentOf(line) >= width {
+				item.lines = append(item.lines, line[width:])
+				continue
+			}
+			if startsBlock(line) {
+				break
+			}
+			// Lazy continuation of paragraph.
+			item.lines = append(item.lines, strings.TrimLeft(line, " "))
+		}
+		items = append(items, item)
+		if i >= len(lines) || isBlank(lines[i]) {
+			break
+		}
+	}
+
+	loose := false
+	for _, item := range items {
+		loose = loose || item.loose
+	}
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	r.out.WriteString("<" + tag)
+	if start := strings.TrimRight(first[2], ".)"); ordered && start != "1" {
+		n, _ := strconv.Atoi(start)
+		r.out.WriteString(` start="` + strconv.Itoa(n) + `"`)
+	}
+	r.out.WriteString(">\n")
+	for _, item := range items {
+		r.out.WriteString("<li>")
+		if m := taskRe.FindStringSubmatch(item.lines[0]); m != nil {
+			if m[1] == " " {
+				r.out.WriteString(`<input type="checkbox" disabled> `)
+			} else {
+				r.out.WriteString(`<input type="checkbox" checked disabled> `)
+			}
+			item.lines[0] = item.lines[0][len(m[0]):]
+		}
+		r.sub(item.lines, !loose)
+		r.out.WriteString("</li>\n")
+	}
+	r.out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+var (
+	autolinkRe = regexp.MustCompile(`^<((?:https?|mailto):[^\s<>]+)>`)
+	bareURLRe  = regexp.MustCompile(`^https?://[^\s<>]*[^\s<>.,:;"')\]!?]`)
+)
+
+func (r *renderer) inline(s string) {
+	// noCloser maps emphasis delimiter to position in s after which it has no closer, so every opener doesn't rescan
+	// the rest of text.
+	noCloser := make(map[string]int)
+	for i := 0; i < len(s); {
+		c := s[i]
+		rest := s[i:]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			r.out.WriteString("<br>\n")
+			i += 2
+			continue
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!|~<>\"'", s[i+1]) >= 0:
+			r.out.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '`':
+			if n := r.codeSpan(rest); n > 0 {
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "![["), strings.HasPrefix(rest, "[["):
+			if n := r.wikilink(rest); n > 0 {
+				i += n
+				continue
+			}
+		case c == '!' && strings.HasPrefix(rest, "!["), c == '[':
+			if n := r.link(rest); n > 0 {
+				i += n
+				continue
+			}
+		case c == '<':
+			if m := autolinkRe.FindStringSubmatch(rest); m != nil {
+				r.anchor(m[1], html.EscapeString(m[1]))
+				i += len(m[0])
+				continue
+			}
+		case c == 'h' && (i == 0 || !isWordByte(s[i-1])):
+			if m := bareURLRe.FindString(rest); m != "" {
+				r.anchor(m, html.EscapeString(m))
+				i += len(m)
+				continue
+			}
+		case c == '*' || c == '_' || c == '~':
+			if n := r.emphasis(s, i, noCloser); n > 0 {
+				i += n
+				continue
+			}
+		}
+		if c == ' ' && strings.HasPrefix(rest, "  \n") {
+			i++ // Trailing spaces are dropped, line break is written on newline.
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(rest)
+		r.out.WriteString(html.EscapeString(rest[:size]))
+		i += size
+	}
+}
+
+// isWordByte reports whether c is part of a word, bytes of multibyte characters are treated as letters.
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func (r *renderer) codeSpan(s string) int {
+	n := len(s) - len(strings.TrimLeft(s, "`"))
+	fence := s[:n]
+	for j := n; j < len(s); {
+		k := strings.Index(s[j:], fence)
+		if k < 0 {
+			return 0
+		}
+		end := j + k
+		if run := len(s[end:]) - len(strings.TrimLeft(s[end:], "`")); run != n {
+			j = end + run // backtick run of other length
+			continue
+		}
+		code := strings.ReplaceAll(s[n:end], "\n", " ")
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		r.out.WriteString("<code>" + html.EscapeString(code) + "</code>")
+		return end + n
+	}
+	return 0
+}
+
+var wikilinkRe = regexp.MustCompile(`^(!?)\[\[([^\[\]|\n]+?)(?:\|([^\[\]\n]*))?\]\]`)
+
+func (r *renderer) wikilink(s string) int {
+	m := wikilinkRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	embed, target, label := m[1] == "!", strings.TrimSpace(m[2]), m[3]
+	if label == "" {
+		label = target
+	}
+	var (
+		href  string
+		image bool
+		ok    bool
+	)
+	if r.opts.Wikilink != nil {
+		name, _, _ := strings.Cut(target, "#")
+		href, image, ok = r.opts.Wikilink(name, embed)
+	}
+	switch {
+	case !ok:
+		r.out.WriteString(`<span class="wikilink-unresolved">` + html.EscapeString(label) + "</span>")
+	case embed && image:
+		r.out.WriteString(`<img src="` + html.EscapeString(href) + `" alt="` + html.EscapeString(label) + `">`)
+	default:
+		r.out.WriteString(`<a class="wikilink" href="` + html.EscapeString(href) + `">`)
+		r.inline(label)
+		r.out.WriteString("</a>")
+	}
+	return len(m[0])
+}
+
+var linkDestRe = regexp.MustCompile(`^\(\s*(<[^<>\n]*>|[^\s()]*(?:\([^\s()]*\)[^\s()]*)*)(?:\s+"([^"]*)")?\s*\)`)
+
+// link renders [text](dest "title") or ![alt](dest "title").
+func (r *renderer) link(s string) int {
+	image := s[0] == '!'
+	start := 1
+	if image {
+		start = 2
+	}
+	depth, end := 0, -1
+	for j := start; j < len(s) && end < 0; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			if depth == 0 {
+				end = j
+			}
+			depth--
+		}
+	}
+	if end < 0 {
+		return 0
+	}
+	m := linkDestRe.FindStringSubmatch(s[end+1:])
+	if m == nil {
+		return 0
+	}
+	text := s[start:end]
+	dest := strings.TrimSuffix(strings.TrimPrefix(m[1], "<"), ">")
+	if r.opts.URL != nil {
+		dest = r.opts.URL(dest)
+	}
+	if image {
+		r.out.WriteString(`<img src="` + html.EscapeString(safeURL(dest)) + `" alt="` + html.EscapeString(text) + `"`)
+		if m[2] != "" {
+			r.out.WriteString(` title="` + html.EscapeString(m[2]) + `"`)
+		}
+		r.out.WriteString(">")
+	} else {
+		r.out.WriteString(`<a href="` + html.EscapeString(safeURL(dest)) + `"`)
+		if m[2] != "" {
+			r.out.WriteString(` title="` + html.EscapeString(m[2]) + `"`)
+		}
+		r.out.WriteString(">")
+		r.inline(text)
+		r.out.WriteString("</a>")
+	}
+	return end + 1 + len(m[0])
+}
+
+func (r *renderer) anchor(href, text string) {
+	r.out.WriteString(`<a href="` + html.EscapeString(safeURL(href)) + `">` + text + "</a>")
+}
+
+// emphasis renders *em*, **strong**, _em_, __strong__ and ~~del~~ starting at s[i]. Whether closing delimiter is
+// valid doesn't depend on opener, so failed search is remembered in noCloser and later openers of the same delimiter
+// are rejected without scanning.
+func (r *renderer) emphasis(s string, i int, noCloser map[string]int) int {
+	c := s[i]
+	n := len(s[i:]) - len(strings.TrimLeft(s[i:], string(c)))
+	if c == '~' && n != 2 || n > 3 {
+		return 0
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return 0
+	}
+	delim := s[i : i+n]
+	body := s[i+n:]
+	if body == "" || body[0] == ' ' || body[0] == '\n' {
+		return 0
+	}
+	if from, ok := noCloser[delim]; ok && i+n >= from {
+		return 0
+	}
+	for j := 1; j < len(body); j++ {
+		k := strings.Index(body[j:], delim)
+		if k < 0 {
+			break
+		}
+		end := j + k
+		after := end + n
+		if body[end-1] != ' ' && body[end-1] != '\n' && (after >= len(body) || body[after] != c) &&
+			(c != '_' || after >= len(body) || !isWordByte(body[after])) {
+			inner := body[:end]
+			switch {
+			case c == '~':
+				r.out.WriteString("<del>")
+				r.inline(inner)
+				r.out.WriteString("</del>")
+			case n == 1:
+				r.out.WriteString("<em>")
+				r.inline(inner)
+				r.out.WriteString("</em>")
+			case n == 2:
+				r.out.WriteString("<strong>")
+				r.inline(inner)
+				r.out.WriteString("</strong>")
+			default:
+				r.out.WriteString("<em><strong>")
+				r.inline(inner)
+				r.out.WriteString("</strong></em>")
+			}
+			return n + after
+		}
+		j = end
+	}
+	noCloser[delim] = i + n
+	return 0
+}
+
+// safeURL replaces URLs with schemes able to run scripts.
+func safeURL(u string) string {
+	scheme, _, ok := strings.Cut(u, ":")
+	if !ok || strings.ContainsAny(scheme, "/?#") {
+		return u // relative
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto", "ftp":
+		return u
+	default:
+		return "#"
+	}
+}
@@ -0,0 +1,70 @@
+package mdhtml
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		{"hard_break", "one  \ntwo\\\nthree", "<p>one<br>\ntwo<br>\nthree</p>\n"},
+		{"heading", "# Title #\n## Sub *em*", "<h1>Title</h1>\n<h2>Sub <em>em</em></h2>\n"},
+		{"hr", "a\n\n---\n* * *", "<p>a</p>\n<hr>\n<hr>\n"},
+		{"escape", "<script>&\\*x\\*", "<p>&lt;script&gt;&amp;*x*</p>\n"},
+		{"emphasis", "*a* **b** ***c*** _d_ __e__ ~~f~~ snake_case_name 2 * 3 * 4",
+			"<p><em>a</em> <strong>b</strong> <em><strong>c</strong></em> <em>d</em> <strong>e</strong> <del>f</del> snake_case_name 2 * 3 * 4</p>\n"},
+		{"code_span", "a `b <c>` `` d`e ``", "<p>a <code>b &lt;c&gt;</code> <code>d`e</code></p>\n"},
+		{"fenced_code", "```go\nx := 1 < 2\n```\n", "<pre><code class=\"language-go\">x := 1 &lt; 2\n</code></pre>\n"},
+		{"indented_code", "    code\n\n    more", "<pre><code>code\n\nmore\n</code></pre>\n"},
+		{"quote", "> a\n> b\n>\n> - c", "<blockquote>\n<p>a\nb</p>\n<ul>\n<li>c</li>\n</ul>\n</blockquote>\n"},
+		{"list", "- a\n- b\n  - c\n- [x] d", "<ul>\n<li>a</li>\n<li>b\n<ul>\n<li>c</li>\n</ul>\n</li>\n<li><input type=\"checkbox\" checked disabled> d</li>\n</ul>\n"},
+		{"loose_list", "1. a\n\n2. b\n\ntext", "<ol>\n<li><p>a</p>\n</li>\n<li><p>b</p>\n</li>\n</ol>\n<p>text</p>\n"},
+		{"ordered_start", "3) a\n4) b", "<ol start=\"3\">\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"link", `[a *b*](http://x.y/?q=1&r=2 "T") ![i](p.png)`,
+			`<p><a href="http://x.y/?q=1&amp;r=2" title="T">a <em>b</em></a> <img src="p.png" alt="i"></p>` + "\n"},
+		{"unsafe_link", "[x](javascript:alert(1))", `<p><a href="#">x</a></p>` + "\n"},
+		{"autolink", "see <https://a.b/c> and https://d.e/f.", `<p>see <a href="https://a.b/c">https://a.b/c</a> and <a href="https://d.e/f">https://d.e/f</a>.</p>` + "\n"},
+		{"wikilink", "[[Note|the note]] [[Missing]] ![[pic.png]]",
+			`<p><a class="wikilink" href="/n/note">the note</a> <span class="wikilink-unresolved">Missing</span> <img src="/f/pic.png" alt="pic.png"></p>` + "\n"},
+	}
+	opts := Options{
+		Wikilink: func(target string, embed bool) (string, bool, bool) {
+			switch target {
+			case "Note":
+				return "/n/note", false, true
+			case "pic.png":
+				return "/f/pic.png", true, true
+			}
+			return "", false, false
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Render([]byte(tt.src), opts))
+		})
+	}
+}
+
+func TestRenderInline(t *testing.T) {
+	assert.Equal(t, "<em>a</em> &amp; b", RenderInline("*a* & b", Options{}))
+	assert.NotPanics(t, func() {
+		Render([]byte(strings.Repeat("*[`![[<_~", 100)), Options{})
+	})
+}
+
+func TestRenderPathologicalEmphasis(t *testing.T) {
+	for _, unit := range []string{"_a _", "*a ", "**a ", "~~a ", "*a **b "} {
+		src := strings.Repeat(unit, 64<<10/len(unit))
+		start := time.Now()
+		Render([]byte(src), Options{})
+		assert.Less(t, time.Since(start), time.Second, unit)
+	}
+}